@@ -2,152 +2,113 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
 	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+	"web-tr/internal/auth"
 	"web-tr/internal/config"
 	"web-tr/internal/db"
+	"web-tr/internal/events"
+	"web-tr/internal/layout"
+	"web-tr/internal/metrics"
+	"web-tr/internal/models"
+	"web-tr/internal/motion"
+	"web-tr/internal/onvif"
+	"web-tr/internal/proxy"
+	"web-tr/internal/retention"
+	"web-tr/internal/scanner"
+	"web-tr/internal/share"
+	"web-tr/internal/snapshot"
 	"web-tr/internal/stream"
+	"web-tr/internal/timelapse"
+	"web-tr/internal/timeline"
+	"web-tr/internal/transcode"
+	"web-tr/internal/transfer"
+	"web-tr/internal/vault"
+	"web-tr/internal/webhook"
 )
 
-// CSV Helper Functions
-func splitLines(s string) []string {
-	var lines []string
-	var current string
-	for _, ch := range s {
-		if ch == '\n' || ch == '\r' {
-			if current != "" {
-				lines = append(lines, current)
-				current = ""
-			}
-		} else {
-			current += string(ch)
-		}
-	}
-	if current != "" {
-		lines = append(lines, current)
-	}
-	return lines
-}
+var (
+	proxyBytes = metrics.NewCounterVec("webtr_proxy_bytes_total",
+		"Bytes sent to clients by the media proxies.", "endpoint", "stream")
+	proxyViewers = metrics.NewGaugeVec("webtr_proxy_active_viewers",
+		"Requests currently open on the media proxies.", "endpoint", "stream")
+	csvImportRows = metrics.NewCounterVec("webtr_csv_import_rows_total",
+		"Rows processed by stream imports, by outcome.", "outcome")
+)
 
-func splitCSVLine(line string) []string {
-	var parts []string
-	var current string
-	inQuotes := false
-
-	for _, ch := range line {
-		if ch == '"' {
-			inQuotes = !inQuotes
-		} else if ch == ',' && !inQuotes {
-			parts = append(parts, current)
-			current = ""
-		} else {
-			current += string(ch)
-		}
-	}
-	parts = append(parts, current)
-	return parts
+// countingWriter adds the bytes a proxy sends to the client to a counter as they go out
+type countingWriter struct {
+	http.ResponseWriter
+	bytes *metrics.Value
 }
 
-func trimString(s string) string {
-	// Remove spaces, quotes, and newlines
-	result := ""
-	for _, ch := range s {
-		if ch != ' ' && ch != '\t' && ch != '"' && ch != '\'' && ch != '\r' && ch != '\n' {
-			result += string(ch)
-		} else if len(result) > 0 && ch == ' ' {
-			// Keep internal spaces
-			if result[len(result)-1] != ' ' {
-				result += " "
-			}
-		}
-	}
-	// Trim trailing space
-	for len(result) > 0 && result[len(result)-1] == ' ' {
-		result = result[:len(result)-1]
-	}
-	return result
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(b)
+	cw.bytes.Add(float64(n))
+	return n, err
 }
 
-func startsWithString(s, prefix string) bool {
-	if len(s) < len(prefix) {
-		return false
+func (cw *countingWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	return s[:len(prefix)] == prefix
 }
 
-func proxyToGo2RTC(w http.ResponseWriter, r *http.Request) {
-	targetURL := "http://localhost:1984" + r.URL.RequestURI()
-	log.Printf("[Proxy] Request: %s -> %s\n", r.URL.Path, targetURL)
+func (cw *countingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
 
-	req, err := http.NewRequest(r.Method, targetURL, r.Body)
-	if err != nil {
+// writeBulkResult answers a bulk request with the per-item results. A rejected
+// batch is a 422; a batch stored without reaching a running engine still counts as applied.
+func writeBulkResult(w http.ResponseWriter, results []models.BulkResult, err error, dryRun bool) {
+	if results == nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Copy headers
-	for name, values := range r.Header {
-		for _, value := range values {
-			req.Header.Add(name, value)
-		}
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Go2RTC Proxy Error: %v", err), http.StatusBadGateway)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Copy response headers
-	for name, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(name, value)
-		}
+	resp := map[string]interface{}{
+		"applied": !dryRun && !errors.Is(err, stream.ErrBulkRejected),
+		"dry_run": dryRun,
+		"results": results,
 	}
-
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
-}
-
-func syncStreamToGo2RTC(name, streamUrl string, isDelete bool) error {
-	apiUser := "http://localhost:1984/api/streams"
-	method := http.MethodPut
-	if isDelete {
-		method = http.MethodDelete
-	}
-
-	reqUrl := fmt.Sprintf("%s?name=%s&src=%s", apiUser, url.QueryEscape(name), url.QueryEscape(streamUrl))
-	if isDelete {
-		reqUrl = fmt.Sprintf("%s?src=%s", apiUser, url.QueryEscape(name))
-	}
-
-	req, err := http.NewRequest(method, reqUrl, nil)
-	if err != nil {
-		return err
+	status := http.StatusOK
+	if errors.Is(err, stream.ErrBulkRejected) {
+		status = http.StatusUnprocessableEntity
 	}
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		resp["error"] = err.Error()
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	log.Printf("Sync stream %s response: %s (Status: %d)", name, string(body), resp.StatusCode)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("go2rtc api returned status %d: %s", resp.StatusCode, string(body))
+// eventStream returns the stream an event is about, if any
+func eventStream(ev events.Event) string {
+	switch d := ev.Data.(type) {
+	case models.HealthChange:
+		return d.Stream
+	case models.MotionEvent:
+		return d.Stream
+	case models.RecordingGap:
+		return d.Stream
+	case map[string]interface{}:
+		if name, ok := d["name"].(string); ok && strings.HasPrefix(ev.Type, "stream.") {
+			return name
+		}
 	}
-	return nil
+	return ""
 }
 
 func main() {
@@ -158,7 +119,20 @@ func main() {
 	log.Println("Initializing Stream Manager...")
 	streamMgr := stream.NewManager(cfgMgr)
 
+	// Live events for dashboards, see /api/events
+	eventHub := events.NewHub()
+	streamMgr.Events = eventHub
+
 	// DB Setup
+	var userStore auth.UserStore
+	var shareStore share.Store
+	var credStore vault.Store
+	var webhookStore webhook.Store
+	var layoutStore layout.Store
+	var profileStore transcode.Store
+	var motionStore motion.Store
+	var timelineStore timeline.Store
+	var retentionStore retention.Store
 	if dbURL := os.Getenv("DATABASE_URL"); dbURL != "" {
 		log.Println("Connecting to Database...")
 		store, err := db.NewStore(dbURL)
@@ -166,32 +140,285 @@ func main() {
 			log.Fatalf("Failed to connect to DB: %v", err)
 		}
 		streamMgr.Store = store
+		userStore = store
+		shareStore = store
+		credStore = store
+		webhookStore = store
+		layoutStore = store
+		profileStore = store
+		motionStore = store
+		timelineStore = store
+		retentionStore = store
 		log.Println("Database/PostgreSQL mode enabled")
 	} else {
 		log.Println("No DATABASE_URL found. Running in File/YAML mode.")
+		userStore = auth.NewFileStore("users.json")
+		shareStore = share.NewFileStore("shares.json")
+		credStore = vault.NewFileStore("credentials.json")
+		webhookStore = webhook.NewFileStore("webhooks.json", "webhook-deliveries.json")
+		layoutStore = layout.NewFileStore("layouts.json")
+		profileStore = transcode.NewFileStore("profiles.json")
+		motionStore = motion.NewFileStore("motion.json")
+		timelineStore = timeline.NewFileStore("timeline.json")
+		retentionStore = retention.NewFileStore("retention.json")
+	}
+
+	// Accounts
+	authSvc := auth.NewService(userStore)
+	if err := authSvc.Bootstrap(); err != nil {
+		log.Fatalf("Failed to initialise user accounts: %v", err)
+	}
+
+	streamMgr.OnRemove = func(name string) {
+		proxyViewers.DeleteMatching("stream", name)
+		proxyBytes.DeleteMatching("stream", name)
+	}
+
+	// instrument counts viewers and bytes of a media proxy. Unknown stream names
+	// are grouped so arbitrary ?src= values can't blow up the label set.
+	instrument := func(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			stream := r.URL.Query().Get("src")
+			if !streamMgr.HasStream(stream) {
+				stream = "unknown"
+			}
+
+			viewers := proxyViewers.With(endpoint, stream)
+			viewers.Inc()
+			defer viewers.Dec()
+
+			next(&countingWriter{ResponseWriter: w, bytes: proxyBytes.With(endpoint, stream)}, r)
+		}
+	}
+
+	// Share links
+	secretKey, err := config.LoadSecretKey()
+	if err != nil {
+		log.Fatalf("Failed to load secret key: %v", err)
+	}
+	shareSvc := share.NewService(shareStore, secretKey)
+	shareSvc.Start(eventHub)
+
+	// Camera credentials
+	credVault, err := vault.New(credStore, secretKey)
+	if err != nil {
+		log.Fatalf("Failed to open credential vault: %v", err)
+	}
+	streamMgr.Vault = credVault
+
+	// Outbound webhooks, fed from the same events as the dashboard
+	webhookSvc := webhook.NewService(webhookStore)
+	webhookSvc.Start(eventHub)
+
+	// Saved video wall layouts
+	layoutSvc := layout.NewService(layoutStore)
+
+	// Transcoding profiles, applied by the engines to the streams referring to them
+	profileSvc := transcode.NewService(profileStore)
+	streamMgr.Profiles = profileSvc
+
+	// Snapshots and dashboard thumbnails, cached per stream
+	snapshotSvc := snapshot.NewService(streamMgr)
+	snapshotSvc.Start(eventHub)
+
+	// Time-lapse frames of the streams that ask for them, from the same snapshots
+	timelapseSvc := timelapse.NewService(snapshotSvc, streamMgr)
+	timelapseSvc.Start(eventHub)
+
+	// Motion detection, keeping events and clips in the recording store
+	motionSvc := motion.NewService(motionStore, streamMgr, snapshotSvc, streamMgr.Recorder.Dir)
+	motionSvc.Start(eventHub)
+
+	// Per-stream event history for the playback timeline
+	timelineSvc := timeline.NewService(timelineStore)
+	timelineSvc.Start(eventHub)
+
+	// Retention janitor keeping the recording store within its limits
+	retentionSvc := retention.NewService(retentionStore, streamMgr, streamMgr.Recorder.Dir)
+	retentionSvc.Start(eventHub)
+
+	// streamAllowed reports whether the signed-in user may access stream name.
+	// Users limited to some groups only reach the streams in them.
+	streamAllowed := func(r *http.Request, name string) bool {
+		u := auth.UserFrom(r.Context())
+		if !auth.Restricted(u) {
+			return u != nil
+		}
+		st, found := streamMgr.FindStream(name)
+		return found && auth.CanAccessGroup(u, st.Group)
+	}
+
+	// visibleBatch keeps the changes of a StreamsChanged event to streams the
+	// signed-in user may access, checked against one read of the stream list.
+	// Deleted streams can no longer be checked and are kept.
+	visibleBatch := func(r *http.Request, ev events.Event) (events.Event, bool) {
+		u := auth.UserFrom(r.Context())
+		batch, ok := ev.Data.(events.Batch)
+		if !ok || !auth.Restricted(u) {
+			return ev, u != nil
+		}
+		streams, err := streamMgr.GetStreams()
+		if err != nil {
+			return ev, false
+		}
+		groups := make(map[string]string, len(streams))
+		for _, st := range streams {
+			groups[st.Name] = st.Group
+		}
+		var kept []events.Change
+		for _, c := range batch.Changes {
+			data, _ := c.Data.(map[string]interface{})
+			name, _ := data["name"].(string)
+			if group, exists := groups[name]; !exists || auth.CanAccessGroup(u, group) {
+				kept = append(kept, c)
+			}
+		}
+		batch.Changes = kept
+		ev.Data = batch
+		return ev, len(kept) > 0
+	}
+
+	// visibleStreams returns the streams the signed-in user may access
+	visibleStreams := func(r *http.Request) ([]models.Stream, error) {
+		streams, err := streamMgr.GetStreams()
+		if err != nil {
+			return nil, err
+		}
+		u := auth.UserFrom(r.Context())
+		return stream.FilterStreams(streams, stream.Filter{}, func(st models.Stream) bool {
+			return auth.CanAccessGroup(u, st.Group)
+		}), nil
+	}
+
+	// requireStream answers 404 for streams outside the user's groups, named by
+	// the query parameter param. Requests without the parameter pass through.
+	requireStream := func(param string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, name := range r.URL.Query()[param] {
+				if !streamAllowed(r, name) {
+					http.Error(w, "stream not found", http.StatusNotFound)
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+
+	// checkBulkOps rejects operations on streams, or into groups, outside the user's groups
+	checkBulkOps := func(r *http.Request, ops []models.BulkOp) error {
+		u := auth.UserFrom(r.Context())
+		if !auth.Restricted(u) {
+			return nil
+		}
+		streams, err := streamMgr.GetStreams()
+		if err != nil {
+			return err
+		}
+		groups := make(map[string]string, len(streams))
+		for _, st := range streams {
+			groups[st.Name] = st.Group
+		}
+		for i, op := range ops {
+			name := op.Name
+			if name == "" {
+				name = op.Stream.Name
+			}
+			if group, found := groups[name]; found && op.Op != models.BulkCreate && !auth.CanAccessGroup(u, group) {
+				return fmt.Errorf("operation %d: stream '%s' is outside your groups", i, name)
+			}
+			if op.Op != models.BulkDelete && !auth.CanAccessGroup(u, models.NormalizeGroup(op.Stream.Group)) {
+				return fmt.Errorf("operation %d: group '%s' is outside your groups", i, op.Stream.Group)
+			}
+		}
+		return nil
+	}
+
+	// Media proxy; the engines are only reached through it
+	mediaProxy := proxy.New(streamMgr, func(r *http.Request, st models.Stream) bool {
+		u := auth.UserFrom(r.Context())
+		return u != nil && (!auth.Restricted(u) || auth.CanAccessGroup(u, st.Group))
+	})
+
+	// shareOrRequire lets a request through with a valid share token for the stream in ?src=,
+	// and falls back to the normal login check otherwise. Access to the stream itself is
+	// checked by the media proxy.
+	shareOrRequire := func(role string, next http.HandlerFunc) http.HandlerFunc {
+		protected := authSvc.Require(role, next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			token := q.Get("share")
+			if token == "" {
+				protected(w, r)
+				return
+			}
+			if len(q["src"]) != 1 {
+				http.Error(w, "exactly one src is required", http.StatusBadRequest)
+				return
+			}
+			if _, err := shareSvc.Validate(token, q.Get("src")); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+
+			// Don't leak the token upstream
+			q.Del("share")
+			r.URL.RawQuery = q.Encode()
+			next(w, r.WithContext(proxy.WithShare(r.Context(), q.Get("src"), token)))
+		}
 	}
 
 	// Ensure config exists
 	if err := streamMgr.EnsureConfig(); err != nil {
 		log.Fatalf("Failed to ensure config: %v", err)
 	}
+	if err := streamMgr.MigrateCredentials(); err != nil {
+		log.Fatalf("Failed to migrate stream credentials: %v", err)
+	}
 
 	// Start Engine
 	go func() {
-		log.Println("Starting go2rtc...")
+		engine := streamMgr.Settings().StreamEngine
 		if err := streamMgr.Start(); err != nil {
-			log.Printf("Error starting go2rtc: %v", err)
-			log.Println("Ensure go2rtc (or .exe) is in the current directory or PATH.")
+			log.Printf("Error starting %s: %v", engine, err)
+			log.Printf("Ensure %s (or .exe) is in the current directory or PATH.", engine)
 		}
 	}()
 	defer streamMgr.Stop()
 
 	// Public Share Page
 	http.HandleFunc("/share", func(w http.ResponseWriter, r *http.Request) {
-		streamName := r.URL.Query().Get("stream")
-		if streamName == "" {
-			http.Error(w, "Stream name is required", http.StatusBadRequest)
-			return
+		var streamName, token string
+
+		if token = r.URL.Query().Get("token"); token != "" {
+			link, err := shareSvc.Open(token)
+			if err != nil {
+				status := http.StatusForbidden
+				if err == share.ErrExpired || err == share.ErrRevoked || err == share.ErrViewLimit {
+					status = http.StatusGone
+				} else if err != share.ErrInvalid {
+					log.Printf("Share link lookup failed: %v", err)
+					status = http.StatusInternalServerError
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			streamName, token = link.Stream, link.Token
+		} else {
+			// Without a token the page is only available to signed-in users
+			u := authSvc.Authenticate(r)
+			if u == nil {
+				http.Error(w, "A share link is required", http.StatusForbidden)
+				return
+			}
+			streamName = r.URL.Query().Get("stream")
+			if streamName == "" {
+				http.Error(w, "Stream name is required", http.StatusBadRequest)
+				return
+			}
+			if !streamAllowed(r.WithContext(auth.WithUser(r.Context(), u)), streamName) {
+				http.Error(w, "stream not found", http.StatusNotFound)
+				return
+			}
 		}
 
 		tmpl, err := template.ParseFiles("web/templates/player.html")
@@ -201,361 +428,1875 @@ func main() {
 			return
 		}
 
-		// We pass the name. The template will handle the hostname logic via JS.
-		tmpl.Execute(w, map[string]interface{}{
-			"Name": streamName,
-		})
-	})
-
-	// HTTP handlers
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		tmpl, err := template.ParseFiles("web/templates/index.html", "web/templates/player.html") // Preload templates? No, separate logic
-		// Just parse index for now
-		if r.URL.Path != "/" {
-			http.NotFound(w, r)
-			return
-		}
-
-		tmpl, err = template.ParseFiles("web/templates/index.html")
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		streams, err := streamMgr.GetStreams()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("Rendering index with %d streams", len(streams))
 		tmpl.Execute(w, map[string]interface{}{
-			"Streams": streams,
+			"Name":  streamName,
+			"Token": token,
 		})
 	})
 
-	http.HandleFunc("/api/streams", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			streams, err := streamMgr.GetStreams()
+	// Share link management
+	http.HandleFunc("/api/shares", authSvc.Require(auth.RoleOperator, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			links, err := shareSvc.List(r.URL.Query().Get("stream"))
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			json.NewEncoder(w).Encode(streams)
-			return
-		}
+			if auth.Restricted(auth.UserFrom(r.Context())) {
+				visible := links[:0]
+				for _, l := range links {
+					if streamAllowed(r, l.Stream) {
+						visible = append(visible, l)
+					}
+				}
+				links = visible
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(links)
 
-		if r.Method == http.MethodPost {
+		case http.MethodPost:
 			var req struct {
-				Name string `json:"name"`
-				URL  string `json:"url"`
+				Stream    string `json:"stream"`
+				ExpiresIn int    `json:"expires_in"` // seconds
+				MaxViews  int    `json:"max_views"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			if _, found := streamMgr.FindStream(req.Stream); !found || !streamAllowed(r, req.Stream) {
+				http.Error(w, "stream not found", http.StatusNotFound)
+				return
+			}
 
-			if err := streamMgr.AddStream(req.Name, req.URL); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			u := auth.UserFrom(r.Context())
+			link, err := shareSvc.Create(req.Stream, u.Username, time.Duration(req.ExpiresIn)*time.Second, req.MaxViews)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(link)
 
-			// Sync with Go2RTC
-			if err := syncStreamToGo2RTC(req.Name, req.URL, false); err != nil {
-				log.Printf("Failed to sync stream to go2rtc: %v", err)
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "id required", http.StatusBadRequest)
+				return
+			}
+			if auth.Restricted(auth.UserFrom(r.Context())) {
+				link, err := shareSvc.Store.GetShareLink(id)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if link == nil || !streamAllowed(r, link.Stream) {
+					http.Error(w, "share link not found", http.StatusNotFound)
+					return
+				}
+			}
+			if err := shareSvc.Revoke(id); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+			w.WriteHeader(http.StatusOK)
 
-			w.WriteHeader(http.StatusCreated)
-			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
+	})))
 
-		if r.Method == http.MethodPut {
-			var req struct {
-				Name         string `json:"name"`
-				URL          string `json:"url"`
-				OriginalName string `json:"originalName"`
+	// Webhooks notify external systems; they can carry stream details off the box, so admins only
+	http.HandleFunc("/api/webhooks", authSvc.Require(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			URL     string   `json:"url"`
+			Events  []string `json:"events"`
+			Enabled *bool    `json:"enabled"`
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			hooks, err := webhookSvc.List()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"webhooks": hooks,
+				"events":   webhook.Events,
+			})
+
+		case http.MethodPost:
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-
-			// Use Manager Update
-			if err := streamMgr.UpdateStream(req.OriginalName, req.Name, req.URL); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			hook, err := webhookSvc.Create(req.URL, req.Events, auth.UserFrom(r.Context()).Username)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(hook)
 
-			// Handle Sync Logic
-			// If name changed, delete old
-			if req.OriginalName != "" && req.OriginalName != req.Name {
-				syncStreamToGo2RTC(req.OriginalName, "", true)
+		case http.MethodPut:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "id required", http.StatusBadRequest)
+				return
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
-			// Add/Update new
-			if err := syncStreamToGo2RTC(req.Name, req.URL, false); err != nil {
-				log.Printf("Failed to sync stream to go2rtc: %v", err)
+			if err := webhookSvc.Update(id, req.URL, req.Events, req.Enabled); err != nil {
+				status := http.StatusBadRequest
+				if err == webhook.ErrNotFound {
+					status = http.StatusNotFound
+				}
+				http.Error(w, err.Error(), status)
+				return
 			}
-
 			w.WriteHeader(http.StatusOK)
-			return
-		}
 
-		if r.Method == http.MethodDelete {
-			name := r.URL.Query().Get("name")
-			if name == "" {
-				http.Error(w, "name is required", http.StatusBadRequest)
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "id required", http.StatusBadRequest)
 				return
 			}
-			if err := streamMgr.RemoveStream(name); err != nil {
+			if err := webhookSvc.Remove(id); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			w.WriteHeader(http.StatusOK)
 
-			// Sync with Go2RTC
-			if err := syncStreamToGo2RTC(name, "", true); err != nil {
-				log.Printf("Failed to remove stream from go2rtc: %v", err)
-			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
 
-			w.WriteHeader(http.StatusOK)
+	// Delivery log, optionally for one webhook with ?id=
+	http.HandleFunc("/api/webhooks/deliveries", authSvc.Require(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-	})
+		deliveries, err := webhookSvc.Deliveries(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries)
+	}))
 
-	// CSV Import endpoint for bulk adding streams
-	http.HandleFunc("/api/streams/import", func(w http.ResponseWriter, r *http.Request) {
+	// Sends a ping so the receiving side can check its signature verification
+	http.HandleFunc("/api/webhooks/test", authSvc.Require(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-
-		// Parse multipart form (10MB max)
-		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		delivery, err := webhookSvc.Test(r.URL.Query().Get("id"))
+		if err == webhook.ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-
-		file, _, err := r.FormFile("file")
 		if err != nil {
-			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(delivery)
+	}))
+
+	// hideCells blanks the cells showing streams the user may not access and
+	// reports whether there were any
+	hideCells := func(r *http.Request, l *models.Layout) bool {
+		hidden := false
+		for i, c := range l.Cells {
+			if c.Stream != "" && !streamAllowed(r, c.Stream) {
+				l.Cells[i] = models.LayoutCell{}
+				hidden = true
+			}
+		}
+		return hidden
+	}
 
-		// Read CSV content
-		content, err := io.ReadAll(file)
-		if err != nil {
-			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+	// Layouts are listed to every viewer; saving one requires an operator
+	http.HandleFunc("/api/layouts", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+
+		if r.Method == http.MethodGet {
+			var out interface{}
+			if name == "" {
+				layouts, err := layoutSvc.List()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for i := range layouts {
+					hideCells(r, &layouts[i])
+				}
+				out = layouts
+			} else {
+				l, err := layoutSvc.Get(name)
+				if err == layout.ErrNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				hideCells(r, l)
+				out = l
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(out)
 			return
 		}
 
-		// Parse CSV - simple line-by-line parsing
-		lines := splitLines(string(content))
-		successCount := 0
-		failCount := 0
-		errors := []string{}
-
-		for i, line := range lines {
-			lineNum := i + 1
-			line = trimString(line)
+		if !auth.HasRole(r, auth.RoleOperator) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 
-			// Skip empty lines, comments, and header row
-			if line == "" || startsWithString(line, "#") || lineNum == 1 {
-				continue
+		// A restricted user can't change a layout showing streams outside their groups
+		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			if name == "" {
+				http.Error(w, "name required", http.StatusBadRequest)
+				return
 			}
-
-			// Split by comma
-			parts := splitCSVLine(line)
-			if len(parts) < 2 {
-				failCount++
-				errors = append(errors, fmt.Sprintf("Row %d: invalid format (expected: name,url)", lineNum))
-				continue
+			old, err := layoutSvc.Get(name)
+			if err == layout.ErrNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
 			}
-
-			name := trimString(parts[0])
-			streamURL := trimString(parts[1])
-
-			if name == "" || streamURL == "" {
-				failCount++
-				errors = append(errors, fmt.Sprintf("Row %d: empty name or URL", lineNum))
-				continue
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if hideCells(r, old) {
+				http.Error(w, "layout shows streams outside your groups", http.StatusForbidden)
+				return
 			}
+		}
 
-			// Add stream
-			if err := streamMgr.AddStream(name, streamURL); err != nil {
-				failCount++
-				errors = append(errors, fmt.Sprintf("Row %d (%s): %v", lineNum, name, err))
-				continue
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			var req models.Layout
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, c := range req.Cells {
+				if c.Stream != "" && !streamAllowed(r, c.Stream) {
+					http.Error(w, fmt.Sprintf("stream '%s' not found", c.Stream), http.StatusForbidden)
+					return
+				}
 			}
 
-			// Sync with Go2RTC
-			if err := syncStreamToGo2RTC(name, streamURL, false); err != nil {
-				log.Printf("Failed to sync stream %s to go2rtc: %v", name, err)
+			var l *models.Layout
+			var err error
+			status := http.StatusOK
+			if r.Method == http.MethodPost {
+				l, err = layoutSvc.Create(req, auth.UserFrom(r.Context()).Username)
+				status = http.StatusCreated
+			} else {
+				l, err = layoutSvc.Update(name, req)
+			}
+			if err == layout.ErrExists {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(l)
 
-			successCount++
+		case http.MethodDelete:
+			if err := layoutSvc.Remove(name); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// Full-screen video wall. The page cycles through the layout's rotation
+	// unless ?rotate=0 is given.
+	http.HandleFunc("/wall/", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/wall/")
+		seq, err := layoutSvc.Sequence(name)
+		if err == layout.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Query().Get("rotate") == "0" {
+			seq = seq[:1]
+		}
+
+		type wallLayout struct {
+			models.Layout
+			Template layout.Grid `json:"template"`
+		}
+		walls := make([]wallLayout, 0, len(seq))
+		for _, l := range seq {
+			g, err := layout.ParseGrid(l.Grid)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			hideCells(r, &l)
+			walls = append(walls, wallLayout{Layout: l, Template: g})
+		}
+
+		tmpl, err := template.ParseFiles("web/templates/wall.html")
+		if err != nil {
+			log.Printf("Error parsing wall template: %v", err)
+			http.Error(w, "Template Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, map[string]interface{}{
+			"Name":    seq[0].Name,
+			"Layouts": walls,
+			"Seconds": seq[0].RotateSeconds,
+		})
+	}))
+
+	// Transcoding profiles are listed to every viewer; changing one requires an
+	// operator and applies to every stream using it
+	http.HandleFunc("/api/profiles", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+
+		if r.Method == http.MethodGet {
+			var out interface{}
+			var err error
+			if id == "" {
+				out, err = profileSvc.List()
+			} else {
+				out, err = profileSvc.Get(id)
+			}
+			if err == transcode.ErrNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+
+		if !auth.HasRole(r, auth.RoleOperator) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// A restricted user can't change a profile used by streams outside their groups
+		if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+			if id == "" {
+				http.Error(w, "id required", http.StatusBadRequest)
+				return
+			}
+			users, err := streamMgr.ProfileStreams(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, st := range users {
+				if !streamAllowed(r, st.Name) {
+					http.Error(w, "profile is used by streams outside your groups", http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			var req models.TranscodeProfile
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			var p *models.TranscodeProfile
+			var err error
+			status := http.StatusOK
+			if r.Method == http.MethodPost {
+				p, err = profileSvc.Create(req)
+				status = http.StatusCreated
+			} else {
+				p, err = streamMgr.UpdateProfile(id, req, auth.UserFrom(r.Context()).Username)
+			}
+			if err == transcode.ErrNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if p == nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// The profile is saved even if the engines could not be updated
+			if err != nil {
+				log.Printf("Failed to apply transcoding profile %s: %v", p.ID, err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(p)
+
+		case http.MethodDelete:
+			err := streamMgr.RemoveProfile(id)
+			if err == transcode.ErrNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, transcode.ErrInUse) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// Login Page
+	http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		next := r.URL.Query().Get("next")
+		// Only allow local redirects
+		if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+			next = "/"
+		}
+
+		data := map[string]interface{}{"Next": next}
+
+		if r.Method == http.MethodPost {
+			token, _, err := authSvc.Login(r.FormValue("username"), r.FormValue("password"))
+			if err == nil {
+				auth.SetSessionCookie(w, r, token, authSvc.SessionTTL)
+				http.Redirect(w, r, next, http.StatusFound)
+				return
+			}
+			log.Printf("Failed login for %q from %s", r.FormValue("username"), r.RemoteAddr)
+			data["Error"] = "Invalid username or password"
+			data["Username"] = r.FormValue("username")
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+
+		tmpl, err := template.ParseFiles("web/templates/login.html")
+		if err != nil {
+			log.Printf("Error parsing login template: %v", err)
+			http.Error(w, "Template Error", http.StatusInternalServerError)
+			return
+		}
+		tmpl.Execute(w, data)
+	})
+
+	http.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(auth.SessionCookie); err == nil {
+			authSvc.Logout(cookie.Value)
+		}
+		auth.ClearSessionCookie(w)
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+
+	http.HandleFunc("/api/me", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFrom(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"username": u.Username,
+			"role":     u.Role,
+			"groups":   u.Groups,
+		})
+	}))
+
+	// User management (admin only)
+	http.HandleFunc("/api/users", authSvc.Require(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			users, err := authSvc.Store.GetUsers()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for i := range users {
+				users[i].PasswordHash = ""
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(users)
+			return
+		}
+
+		var req struct {
+			Username string   `json:"username"`
+			Password string   `json:"password"`
+			Role     string   `json:"role"`
+			Groups   []string `json:"groups"` // omitted on PUT keeps the current groups
+		}
+
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if _, err := authSvc.CreateUser(req.Username, req.Password, req.Role, req.Groups); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := authSvc.UpdateUser(req.Username, req.Password, req.Role, req.Groups); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			username := r.URL.Query().Get("username")
+			if username == "" {
+				http.Error(w, "username is required", http.StatusBadRequest)
+				return
+			}
+			if username == auth.UserFrom(r.Context()).Username {
+				http.Error(w, "cannot delete your own account", http.StatusBadRequest)
+				return
+			}
+			if err := authSvc.RemoveUser(username); err != nil {
+				status := http.StatusInternalServerError
+				if err == auth.ErrLastAdmin {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}))
+
+	// API tokens for automation. Users manage their own, admins see everyone's.
+	http.HandleFunc("/api/tokens", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		u := auth.UserFrom(r.Context())
+
+		if r.Method == http.MethodGet {
+			owner := u.Username
+			if u.Role == auth.RoleAdmin {
+				owner = ""
+			}
+			tokens, err := authSvc.Store.GetAPITokens(owner)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if tokens == nil {
+				tokens = []models.APIToken{}
+			}
+			for i := range tokens {
+				tokens[i].Hash = ""
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tokens)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			var req struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			plain, tok, err := authSvc.CreateToken(u.Username, req.Name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{
+				"id":    tok.ID,
+				"name":  tok.Name,
+				"token": plain,
+			})
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			id := r.URL.Query().Get("id")
+			tokens, err := authSvc.Store.GetAPITokens("")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, t := range tokens {
+				if t.ID != id {
+					continue
+				}
+				if t.Username != u.Username && u.Role != auth.RoleAdmin {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				if err := authSvc.Store.RemoveAPIToken(id); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Error(w, "token not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}))
+
+	// Recording Playback Page
+	http.HandleFunc("/playback", authSvc.Require(auth.RoleViewer, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		streamName := r.URL.Query().Get("stream")
+		if streamName == "" {
+			http.Error(w, "Stream name is required", http.StatusBadRequest)
+			return
+		}
+
+		tmpl, err := template.ParseFiles("web/templates/playback.html")
+		if err != nil {
+			log.Printf("Error parsing playback template: %v", err)
+			http.Error(w, "Template Error", http.StatusInternalServerError)
+			return
+		}
+
+		tmpl.Execute(w, map[string]interface{}{
+			"Name":    streamName,
+			"CanEdit": auth.HasRole(r, auth.RoleOperator),
+		})
+	})))
+
+	// HTTP handlers
+	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
+
+	http.HandleFunc("/", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := template.ParseFiles("web/templates/index.html", "web/templates/player.html") // Preload templates? No, separate logic
+		// Just parse index for now
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		tmpl, err = template.ParseFiles("web/templates/index.html")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		streams, err := visibleStreams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		u := auth.UserFrom(r.Context())
+		log.Printf("Rendering index with %d streams", len(streams))
+		tmpl.Execute(w, map[string]interface{}{
+			"Streams": streams,
+			"User":    u,
+			"CanEdit": auth.RoleAtLeast(u.Role, auth.RoleOperator),
+		})
+	}))
+
+	http.HandleFunc("/api/streams", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			streams, err := visibleStreams(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// ?group=HQ/Building A matches subgroups too; every ?tag= must be present
+			q := r.URL.Query()
+			filter := stream.Filter{Group: q.Get("group"), Tags: q["tag"], Query: q.Get("q")}
+			json.NewEncoder(w).Encode(stream.FilterStreams(streams, filter, nil))
+			return
+		}
+
+		// Changing streams requires at least an operator
+		if !auth.HasRole(r, auth.RoleOperator) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			var req models.Stream
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := checkBulkOps(r, []models.BulkOp{{Op: models.BulkCreate, Stream: req}}); err != nil {
+				http.Error(w, "Forbidden: you can only add streams to your groups", http.StatusForbidden)
+				return
+			}
+
+			// The manager pushes the change to the running engine
+			if err := streamMgr.AddStream(req, auth.UserFrom(r.Context()).Username); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, stream.ErrInvalidStream) {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			var req struct {
+				models.Stream
+				OriginalName string `json:"originalName"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := checkBulkOps(r, []models.BulkOp{{Op: models.BulkUpdate, Name: req.OriginalName, Stream: req.Stream}}); err != nil {
+				http.Error(w, "Forbidden: the stream or its new group is outside your groups", http.StatusForbidden)
+				return
+			}
+
+			// Use Manager Update
+			if err := streamMgr.UpdateStream(req.OriginalName, req.Stream, auth.UserFrom(r.Context()).Username); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, stream.ErrInvalidStream) {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			name := r.URL.Query().Get("name")
+			if name == "" {
+				http.Error(w, "name is required", http.StatusBadRequest)
+				return
+			}
+			if !streamAllowed(r, name) {
+				http.Error(w, "stream not found", http.StatusNotFound)
+				return
+			}
+			if err := streamMgr.RemoveStream(name, auth.UserFrom(r.Context()).Username); err != nil {
+				status := http.StatusInternalServerError
+				if err == stream.ErrStreamNotFound {
+					status = http.StatusNotFound
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}))
+
+	// Bulk create/update/delete. The batch is validated as a whole and applied in
+	// one transaction, or not at all; dry_run=1 only validates.
+	http.HandleFunc("/api/streams/bulk", authSvc.Require(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Operations []models.BulkOp `json:"operations"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Operations) == 0 {
+			http.Error(w, "operations is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Operations) > stream.MaxBulkOps {
+			http.Error(w, fmt.Sprintf("too many operations, the limit is %d", stream.MaxBulkOps), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := checkBulkOps(r, req.Operations); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+		results, err := streamMgr.ApplyBulk(req.Operations, dryRun, auth.UserFrom(r.Context()).Username)
+		writeBulkResult(w, results, err, dryRun)
+	}))
+
+	// Group tree and tags of the streams the user can see, for the dashboard filters
+	http.HandleFunc("/api/streams/groups", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		streams, err := visibleStreams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		tags := []string{}
+		seen := map[string]bool{}
+		for _, st := range streams {
+			for _, t := range st.Tags {
+				if !seen[t] {
+					seen[t] = true
+					tags = append(tags, t)
+				}
+			}
+		}
+		sort.Strings(tags)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"groups": stream.GroupTree(streams),
+			"tags":   tags,
+		})
+	}))
+
+	// Apply one action (record, move, tag, delete...) to every stream matching a filter
+	http.HandleFunc("/api/streams/action", authSvc.Require(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req stream.GroupAction
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+		streams, err := visibleStreams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ops, err := stream.GroupActionOps(streams, req, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// A move must stay within the user's groups
+		if err := checkBulkOps(r, ops); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		results, err := streamMgr.ApplyBulk(ops, dryRun, auth.UserFrom(r.Context()).Username)
+		writeBulkResult(w, results, err, dryRun)
+	}))
+
+	// Stream import from CSV, JSON or go2rtc YAML. dry_run=1 returns the plan without writing.
+	http.HandleFunc("/api/streams/import", authSvc.Require(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Parse multipart form (10MB max)
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		format, err := transfer.DetectFormat(strings.ToLower(r.FormValue("format")), header.Filename)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		policy := r.FormValue("policy")
+		if !transfer.ValidPolicy(policy) {
+			http.Error(w, "policy must be skip, overwrite or rename", http.StatusBadRequest)
+			return
+		}
+		// mapping is a JSON object of field -> column title or 1-based column number
+		var mapping map[string]string
+		if m := r.FormValue("mapping"); m != "" {
+			if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+				http.Error(w, "Invalid mapping: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+
+		rows, err := transfer.Parse(file, format, mapping)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		u := auth.UserFrom(r.Context())
+		// Planning is reported at most a few times per second so a large file doesn't
+		// flood the feed; the write is one bulk operation, announced when it starts
+		lastProgress := time.Now()
+		progress := func(phase string, row, total int) {
+			if dryRun || (phase == transfer.PhasePlan && time.Since(lastProgress) < 500*time.Millisecond) {
+				return
+			}
+			lastProgress = time.Now()
+			eventHub.Publish(events.ImportProgress, map[string]interface{}{
+				"by":    u.Username,
+				"phase": phase,
+				"row":   row,
+				"total": total,
+			})
+		}
+		report, err := transfer.Import(streamMgr, rows, transfer.Options{
+			Policy:   policy,
+			DryRun:   dryRun,
+			By:       u.Username,
+			Progress: progress,
+			Allowed: func(st models.Stream) bool {
+				return auth.CanAccessGroup(u, st.Group)
+			},
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !dryRun {
+			imported := report.Created + report.Updated + report.Renamed
+			csvImportRows.With("imported").Add(float64(imported))
+			csvImportRows.With("skipped").Add(float64(report.Skipped))
+			csvImportRows.With("failed").Add(float64(report.Failed))
+			eventHub.Publish(events.ImportDone, map[string]interface{}{
+				"by":       u.Username,
+				"total":    report.Total,
+				"imported": imported,
+				"skipped":  report.Skipped,
+				"failed":   report.Failed,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}))
+
+	// Stream list export. Passwords are redacted unless an admin asks for credentials=1.
+	http.HandleFunc("/api/streams/export", authSvc.Require(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		format, err := transfer.DetectFormat(strings.ToLower(r.URL.Query().Get("format")), "streams.json")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		withCredentials, _ := strconv.ParseBool(r.URL.Query().Get("credentials"))
+		if withCredentials && !auth.HasRole(r, auth.RoleAdmin) {
+			http.Error(w, "Exporting credentials requires the admin role", http.StatusForbidden)
+			return
+		}
+
+		streams, err := streamMgr.ExportStreams(withCredentials)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		u := auth.UserFrom(r.Context())
+		streams = stream.FilterStreams(streams, stream.Filter{}, func(st models.Stream) bool {
+			return auth.CanAccessGroup(u, st.Group)
+		})
+
+		w.Header().Set("Content-Type", transfer.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="streams-%s.%s"`, time.Now().Format("20060102"), format))
+		if withCredentials {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		if err := transfer.Export(w, streams, format); err != nil {
+			log.Printf("Stream export failed: %v", err)
+		}
+	}))
+
+	http.HandleFunc("/api/probe", authSvc.Require(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			URL  string `json:"url"`
+			Name string `json:"name"` // stream being edited, to resolve a redacted password
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// A redacted password is resolved from the stream, so it must be one the user may access
+		if req.Name != "" && !streamAllowed(r, req.Name) {
+			http.Error(w, "stream not found", http.StatusNotFound)
+			return
+		}
+
+		// Basic cleanup if user pasted internal format
+		rawUrl, err := streamMgr.ResolveURL(req.Name, req.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Strip ffmpeg/exec prefixes for probing the source directly if possible.
+		// NOTE: if it is a complex ffmpeg command with filters, ffprobe might fail if treated as URL.
+		// For MVP, we probe the raw URL if it looks like a URL.
+		// Simple heuristic: if it starts with rtsp/http/tcp/udp
+
+		log.Printf("Probing stream: %s", vault.StripCredentials(rawUrl))
+		result, err := streamMgr.ProbeStream(rawUrl)
+		if err != nil {
+			log.Printf("Probe failed: %v", err)
+			http.Error(w, fmt.Sprintf("Probe failed: %v", err), http.StatusBadRequest)
+			return
+		}
+		// Build the suggestion from the submitted URL so a resolved password is not echoed back
+		result.Transcode.Source = result.Transcode.Suggest(req.URL)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}))
+
+	// ONVIF discovery; the credentials are used to read profiles and stream URLs
+	http.HandleFunc("/api/discover", authSvc.Require(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Username string   `json:"username"`
+			Password string   `json:"password"`
+			Hosts    []string `json:"hosts"`
+			Wait     int      `json:"wait"` // seconds to collect discovery replies
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Wait < 0 || req.Wait > 30 {
+			http.Error(w, "wait must be between 0 and 30 seconds", http.StatusBadRequest)
+			return
+		}
+
+		log.Println("Starting ONVIF discovery...")
+		devices, err := streamMgr.DiscoverStreams(r.Context(), onvif.Options{
+			Username: req.Username,
+			Password: req.Password,
+			Hosts:    req.Hosts,
+			Wait:     time.Duration(req.Wait) * time.Second,
+		})
+		if err != nil {
+			log.Printf("Discovery failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Discovery complete. Found %d devices", len(devices))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(devices)
+	}))
+
+	// Network scan over CIDR ranges and ports, streamed back as NDJSON:
+	// {"type":"progress",...}, {"type":"host","host":{...}} and a final {"type":"done"}
+	http.HandleFunc("/api/discover/scan", authSvc.Require(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		var req struct {
+			CIDRs    []string `json:"cidrs"`
+			Ports    []int    `json:"ports"`
+			Username string   `json:"username"`
+			Password string   `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Ports) > 16 {
+			http.Error(w, "at most 16 ports can be scanned", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		enc := json.NewEncoder(w)
+		send := func(v interface{}) {
+			enc.Encode(v)
+			flusher.Flush()
+		}
+
+		log.Printf("Starting network scan of %v...", req.CIDRs)
+		hosts := 0
+		lastProgress := time.Time{}
+		err := streamMgr.ScanNetwork(r.Context(), scanner.Options{
+			CIDRs:    req.CIDRs,
+			Ports:    req.Ports,
+			Username: req.Username,
+			Password: req.Password,
+		}, func(h scanner.Host) {
+			hosts++
+			send(map[string]interface{}{"type": "host", "host": h})
+		}, func(scanned, total int) {
+			// Large ranges would otherwise send a line per address
+			if scanned < total && time.Since(lastProgress) < 250*time.Millisecond {
+				return
+			}
+			lastProgress = time.Now()
+			send(map[string]interface{}{"type": "progress", "scanned": scanned, "total": total})
+		})
+
+		// Errors before the first line can still be reported with a status code
+		done := map[string]interface{}{"type": "done", "hosts": hosts}
+		if err != nil {
+			log.Printf("Network scan failed: %v", err)
+			if hosts == 0 && lastProgress.IsZero() {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			done["error"] = err.Error()
+		}
+		log.Printf("Network scan complete. Found %d hosts", hosts)
+		send(done)
+	}))
+
+	// GET /api/snapshot?stream=<name>[&width=<px>][&quality=<1-100>] returns a
+	// JPEG of the stream; name= is accepted as an older spelling of stream=
+	http.HandleFunc("/api/snapshot", authSvc.Require(auth.RoleViewer, requireStream("stream", requireStream("name", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		name := q.Get("stream")
+		if name == "" {
+			name = q.Get("name")
+		}
+		if name == "" {
+			http.Error(w, "stream required", http.StatusBadRequest)
+			return
 		}
 
-		// Return result
-		result := map[string]interface{}{
-			"success": successCount,
-			"failed":  failCount,
-			"errors":  errors,
+		var opts snapshot.Options
+		for param, dst := range map[string]*int{"width": &opts.Width, "quality": &opts.Quality} {
+			if v := q.Get(param); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					http.Error(w, "invalid "+param, http.StatusBadRequest)
+					return
+				}
+				*dst = n
+			}
+		}
+
+		frame, err := snapshotSvc.Get(r.Context(), name, opts)
+		if err != nil {
+			switch {
+			case errors.Is(err, snapshot.ErrInvalidOptions):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, snapshot.ErrNotFound):
+				http.Error(w, "stream not found", http.StatusNotFound)
+			case r.Context().Err() != nil:
+				// The client is gone, nobody reads the answer
+			case errors.Is(err, snapshot.ErrTimeout):
+				http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			default:
+				log.Printf("Snapshot of %s failed: %v", name, err)
+				http.Error(w, err.Error(), http.StatusBadGateway)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(len(frame.JPEG)))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name+".jpg"))
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(snapshotSvc.TTL.Seconds())))
+		w.Header().Set("Last-Modified", frame.Time.Format(http.TimeFormat))
+		w.Header().Set("X-Snapshot-Source", frame.Source)
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(frame.JPEG)
+	}))))
+
+	http.HandleFunc("/api/engine/status", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
-	})
+		json.NewEncoder(w).Encode(streamMgr.EngineStatus())
+	}))
 
-	http.HandleFunc("/api/probe", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+	// Health of one stream with its online/offline history, or the history of all streams
+	http.HandleFunc("/api/health", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req struct {
-			URL string `json:"url"`
+		name := r.URL.Query().Get("stream")
+		changes := streamMgr.Monitor.History(name)
+		if auth.Restricted(auth.UserFrom(r.Context())) {
+			visible := changes[:0:0]
+			for _, c := range changes {
+				if streamAllowed(r, c.Stream) {
+					visible = append(visible, c)
+				}
+			}
+			changes = visible
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		resp := map[string]interface{}{
+			"changes": changes,
+		}
+		if name != "" {
+			if _, found := streamMgr.FindStream(name); !found || !streamAllowed(r, name) {
+				http.Error(w, "stream not found", http.StatusNotFound)
+				return
+			}
+			resp["health"] = streamMgr.Monitor.Get(name)
 		}
 
-		// Basic cleanup if user pasted internal format
-		rawUrl := req.URL
-		// Strip ffmpeg/exec prefixes for probing the source directly if possible.
-		// NOTE: if it is a complex ffmpeg command with filters, ffprobe might fail if treated as URL.
-		// For MVP, we probe the raw URL if it looks like a URL.
-		// Simple heuristic: if it starts with rtsp/http/tcp/udp
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
 
-		log.Printf("Probing stream: %s", rawUrl)
-		if err := streamMgr.ProbeStream(rawUrl); err != nil {
-			log.Printf("Probe failed: %v", err)
-			http.Error(w, fmt.Sprintf("Probe failed: %v", err), http.StatusBadRequest)
+	// Server-Sent Events feed of stream changes, imports, engine restarts and health transitions
+	http.HandleFunc("/api/events", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+		// EventSource sends the last id it saw when it reconnects
+		lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+		ch := eventHub.Subscribe(lastID)
+		defer eventHub.Unsubscribe(ch)
 
-	http.HandleFunc("/api/discover", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		fmt.Fprint(w, "retry: 3000\n\n")
+		flusher.Flush()
+
+		// Comments keep idle connections open through proxies
+		keepalive := time.NewTicker(25 * time.Second)
+		defer keepalive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+			case ev, ok := <-ch:
+				if !ok {
+					return
+				}
+				if ev.Type == events.StreamsChanged {
+					if ev, ok = visibleBatch(r, ev); !ok {
+						continue
+					}
+				}
+				// Hide streams outside the user's groups; deleted ones can no longer be checked
+				if name := eventStream(ev); name != "" && !streamAllowed(r, name) {
+					if _, exists := streamMgr.FindStream(name); exists {
+						continue
+					}
+				}
+				data, err := json.Marshal(ev)
+				if err != nil {
+					log.Printf("Failed to encode event %s: %v", ev.Type, err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+				flusher.Flush()
+			}
+		}
+	}))
+
+	http.HandleFunc("/api/settings", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(streamMgr.Settings())
 			return
 		}
 
-		log.Println("Starting network discovery...")
-		streams, err := streamMgr.DiscoverStreams()
-		if err != nil {
-			log.Printf("Discovery failed: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if r.Method == http.MethodPut {
+			if !auth.HasRole(r, auth.RoleAdmin) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			var req config.AppSettings
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := streamMgr.ApplySettings(req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
 			return
 		}
-		log.Printf("Discovery complete. Found %d streams", len(streams))
 
-	})
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}))
 
-	http.HandleFunc("/api/snapshot", func(w http.ResponseWriter, r *http.Request) {
-		name := r.URL.Query().Get("name")
+	// Recorded segments for the playback page
+	http.HandleFunc("/api/recordings", authSvc.Require(auth.RoleViewer, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("stream")
 		if name == "" {
-			http.Error(w, "name required", http.StatusBadRequest)
+			http.Error(w, "stream required", http.StatusBadRequest)
 			return
 		}
 
-		// Look up stream URL
-		streams, err := streamMgr.GetStreams()
+		segments, err := streamMgr.Recorder.ListSegments(name)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		var streamUrl string
-		for _, s := range streams {
-			if s.Name == name {
-				streamUrl = s.URL
-				break
-			}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(segments)
+	})))
+
+	// Locking a segment or motion event file keeps it from retention
+	http.HandleFunc("/api/recordings/lock", authSvc.Require(auth.RoleOperator, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		var locked bool
+		switch r.Method {
+		case http.MethodPut:
+			locked = true
+		case http.MethodDelete:
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name, file := r.URL.Query().Get("stream"), r.URL.Query().Get("file")
+		if name == "" || file == "" {
+			http.Error(w, "stream and file required", http.StatusBadRequest)
+			return
 		}
 
-		if streamUrl == "" {
-			http.Error(w, "stream not found", http.StatusNotFound)
+		err := streamMgr.Recorder.SetLocked(name, file, locked)
+		switch {
+		case os.IsNotExist(err):
+			http.Error(w, "recording not found", http.StatusNotFound)
+			return
+		case errors.Is(err, stream.ErrInvalidRecording):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		w.WriteHeader(http.StatusOK)
+	})))
 
-		// Prepare FFmpeg command
-		// ffmpeg -y -rtsp_transport tcp -i <url> -vframes 1 -f image2pipe -vcodec mjpeg -
-		// Strip ffmpeg: prefix if present for clean URL
-		cleanUrl := streamUrl
-		if len(cleanUrl) > 7 && cleanUrl[:7] == "ffmpeg:" {
-			cleanUrl = cleanUrl[7:]
-			// simplistic strip, might need more if complex args
-			// But for snapshot, we usually want the raw source
+	// Retention policies. The one without a stream is global and only admins
+	// change it; operators set and drop the policies of streams.
+	http.HandleFunc("/api/retention", authSvc.Require(auth.RoleViewer, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("stream")
+
+		if r.Method == http.MethodGet {
+			policies, err := retentionSvc.List()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			visible := policies[:1]
+			for _, p := range policies[1:] {
+				if streamAllowed(r, p.Stream) {
+					visible = append(visible, p)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(visible)
+			return
 		}
 
-		args := []string{
-			"-y",
-			"-rtsp_transport", "tcp",
-			"-i", cleanUrl,
-			"-vframes", "1",
-			"-f", "image2pipe",
-			"-vcodec", "mjpeg",
-			"-",
+		required := auth.RoleOperator
+		if name == "" {
+			required = auth.RoleAdmin
+		}
+		if !auth.HasRole(r, required) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
 		}
 
-		cmd := exec.Command("ffmpeg", args...)
+		switch r.Method {
+		case http.MethodPut:
+			var req models.RetentionPolicy
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Stream = name
+			p, err := retentionSvc.Set(req)
+			switch {
+			case errors.Is(err, retention.ErrUnknownStream):
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case errors.Is(err, retention.ErrInvalidPolicy):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
 
-		// Pipe output directly to response
-		w.Header().Set("Content-Type", "image/jpeg")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.jpg\"", name))
+		case http.MethodDelete:
+			if name == "" {
+				http.Error(w, "stream required", http.StatusBadRequest)
+				return
+			}
+			err := retentionSvc.Remove(name)
+			if errors.Is(err, retention.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
 
-		cmd.Stdout = w
-		cmd.Stderr = os.Stderr // Log errors to server console
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	// Footage kept per stream, disk space and the latest retention deletions.
+	// POST runs the janitor now.
+	http.HandleFunc("/api/storage", authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			status, err := retentionSvc.Status()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if auth.Restricted(auth.UserFrom(r.Context())) {
+				streams := status.Streams[:0]
+				for _, st := range status.Streams {
+					if streamAllowed(r, st.Stream) {
+						streams = append(streams, st)
+					}
+				}
+				actions := status.Actions[:0]
+				for _, a := range status.Actions {
+					if streamAllowed(r, a.Stream) {
+						actions = append(actions, a)
+					}
+				}
+				status.Streams, status.Actions = streams, actions
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(status)
+
+		case http.MethodPost:
+			if !auth.HasRole(r, auth.RoleAdmin) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			actions := retentionSvc.Run()
+			if actions == nil {
+				actions = []models.RetentionAction{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(actions)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// streamFiles serves root under prefix, where the first path element is a
+	// stream's directory as named by stream.SafeDirName
+	streamFiles := func(prefix, root string) http.HandlerFunc {
+		files := http.StripPrefix(prefix, http.FileServer(http.Dir(root)))
+		return authSvc.Require(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+			if u := auth.UserFrom(r.Context()); auth.Restricted(u) {
+				dir, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+				streams, err := visibleStreams(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				allowed := false
+				for _, st := range streams {
+					allowed = allowed || stream.SafeDirName(st.Name) == dir
+				}
+				if !allowed {
+					http.NotFound(w, r)
+					return
+				}
+			}
+			files.ServeHTTP(w, r)
+		})
+	}
+	http.HandleFunc("/recordings/", streamFiles("/recordings/", streamMgr.Recorder.Dir))
 
-		if err := cmd.Run(); err != nil {
-			log.Printf("Snapshot error for %s: %v", name, err)
+	// Time-lapses by day, next to the recordings. POST makes the video of
+	// ?date=YYYY-MM-DD from the frames stored so far.
+	http.HandleFunc("/api/timelapses", authSvc.Require(auth.RoleViewer, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("stream")
+		if name == "" {
+			http.Error(w, "stream required", http.StatusBadRequest)
 			return
 		}
-	})
 
-	http.HandleFunc("/api/webrtc", func(w http.ResponseWriter, r *http.Request) {
-		targetURL := "http://localhost:1984" + r.URL.RequestURI()
+		switch r.Method {
+		case http.MethodGet:
+			days, err := timelapseSvc.List(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(days)
 
-		// Create proxy request
-		proxyReq, err := http.NewRequest(r.Method, targetURL, r.Body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case http.MethodPost:
+			if !auth.HasRole(r, auth.RoleOperator) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			day, err := timelapseSvc.Generate(r.Context(), name, r.URL.Query().Get("date"))
+			switch {
+			case errors.Is(err, timelapse.ErrInvalidDate):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case errors.Is(err, timelapse.ErrNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case err != nil:
+				log.Printf("Time-lapse of %s failed: %v", name, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(day)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/timelapses/", streamFiles("/timelapses/", timelapseSvc.Dir))
+
+	// Motion detection settings. GET without ?stream= lists the streams that
+	// have settings; a stream without any gets the defaults.
+	http.HandleFunc("/api/motion", authSvc.Require(auth.RoleViewer, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("stream")
+
+		type motionStatus struct {
+			models.MotionConfig
+			Detecting bool `json:"detecting"`
+		}
+
+		if r.Method == http.MethodGet {
+			var out interface{}
+			if name == "" {
+				configs, err := motionSvc.List()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				list := []motionStatus{}
+				for _, c := range configs {
+					if streamAllowed(r, c.Stream) {
+						list = append(list, motionStatus{c, motionSvc.Detecting(c.Stream)})
+					}
+				}
+				out = list
+			} else {
+				if _, found := streamMgr.FindStream(name); !found {
+					http.Error(w, "stream not found", http.StatusNotFound)
+					return
+				}
+				c, err := motionSvc.Get(name)
+				if errors.Is(err, motion.ErrNotFound) {
+					d := motion.Defaults(name)
+					c, err = &d, nil
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				out = motionStatus{*c, motionSvc.Detecting(name)}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+
+		if !auth.HasRole(r, auth.RoleOperator) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if name == "" {
+			http.Error(w, "stream required", http.StatusBadRequest)
 			return
 		}
 
-		// Copy headers
-		for name, values := range r.Header {
-			for _, value := range values {
-				proxyReq.Header.Add(name, value)
+		switch r.Method {
+		case http.MethodPut:
+			var req models.MotionConfig
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Stream = name
+			c, err := motionSvc.Set(req)
+			switch {
+			case errors.Is(err, motion.ErrUnknownStream):
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case errors.Is(err, motion.ErrInvalidConfig):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(motionStatus{*c, motionSvc.Detecting(name)})
+
+		case http.MethodDelete:
+			err := motionSvc.Remove(name)
+			if errors.Is(err, motion.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
 			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	// Motion events of a stream with their snapshots and clips, oldest first
+	http.HandleFunc("/api/motion/events", authSvc.Require(auth.RoleViewer, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("stream")
+		if name == "" {
+			http.Error(w, "stream required", http.StatusBadRequest)
+			return
 		}
 
-		resp, err := http.DefaultClient.Do(proxyReq)
+		list, err := motionSvc.EventsOf(name)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Go2RTC Proxy Error: %v", err), http.StatusBadGateway)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		defer resp.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	})))
+
+	// Timeline events. GET takes ?stream=, ?from= and ?to= (RFC 3339, the last
+	// day by default) and any number of ?type=; operators add bookmarks with
+	// POST and delete them with DELETE ?id=.
+	http.HandleFunc("/api/timeline", authSvc.Require(auth.RoleViewer, requireStream("stream", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			q := models.TimelineQuery{Stream: query.Get("stream"), To: time.Now(), Limit: 1000}
+			for _, v := range query["type"] {
+				for _, t := range strings.Split(v, ",") {
+					if t = strings.TrimSpace(t); t != "" {
+						q.Types = append(q.Types, t)
+					}
+				}
+			}
+			for param, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+				if v := query.Get(param); v != "" {
+					t, err := time.Parse(time.RFC3339, v)
+					if err != nil {
+						http.Error(w, "invalid "+param+": use RFC 3339", http.StatusBadRequest)
+						return
+					}
+					*dst = t
+				}
+			}
+			if query.Get("from") == "" {
+				q.From = q.To.Add(-24 * time.Hour)
+			}
+			if v := query.Get("limit"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > 10000 {
+					http.Error(w, "limit must be between 1 and 10000", http.StatusBadRequest)
+					return
+				}
+				q.Limit = n
+			}
 
-		// Copy response headers
-		for name, values := range resp.Header {
-			for _, value := range values {
-				w.Header().Add(name, value)
+			list, err := timelineSvc.Query(q)
+			if errors.Is(err, timeline.ErrInvalidQuery) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
-		}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if q.Stream == "" {
+				visible := list[:0]
+				for _, ev := range list {
+					if streamAllowed(r, ev.Stream) {
+						visible = append(visible, ev)
+					}
+				}
+				list = visible
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
 
-		w.WriteHeader(resp.StatusCode)
-		io.Copy(w, resp.Body)
-	})
+		case http.MethodPost:
+			if !auth.HasRole(r, auth.RoleOperator) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			var req models.TimelineEvent
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if _, found := streamMgr.FindStream(req.Stream); !found || !streamAllowed(r, req.Stream) {
+				http.Error(w, "stream not found", http.StatusNotFound)
+				return
+			}
+			req.CreatedBy = auth.UserFrom(r.Context()).Username
+			b, err := timelineSvc.AddBookmark(req)
+			if errors.Is(err, timeline.ErrInvalidEvent) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(b)
+
+		case http.MethodDelete:
+			if !auth.HasRole(r, auth.RoleOperator) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "id required", http.StatusBadRequest)
+				return
+			}
+			b, err := timelineSvc.Bookmark(id)
+			if err == nil && !streamAllowed(r, b.Stream) {
+				err = timeline.ErrNotFound
+			}
+			if err == nil {
+				err = timelineSvc.RemoveBookmark(id)
+			}
+			if errors.Is(err, timeline.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
 
 	// HLS & MSE Proxy Handlers
-	http.HandleFunc("/api/stream.mp4", proxyToGo2RTC) // MSE/MP4
+	// Player traffic: WebRTC signalling, WHEP, MP4 for MSE players and HLS
+	http.HandleFunc("/api/webrtc", shareOrRequire(auth.RoleViewer, instrument("webrtc", mediaProxy.WebRTC)))
+	http.HandleFunc("/api/whep", shareOrRequire(auth.RoleViewer, instrument("whep", mediaProxy.WHEP)))
+	http.HandleFunc("/api/stream.mp4", shareOrRequire(auth.RoleViewer, instrument("mp4", mediaProxy.MP4)))
+	http.HandleFunc(proxy.HLSPrefix, proxy.HLSSource(shareOrRequire(auth.RoleViewer, instrument("hls", mediaProxy.HLS))))
+
+	// Prometheus scrape endpoint. Scrapers authenticate with an API token
+	// (Authorization: Bearer wtr_...) like any other client.
+	metrics.RegisterCollector(streamMgr.CollectMetrics)
+	http.HandleFunc("/metrics", authSvc.Require(auth.RoleViewer, metrics.Handler().ServeHTTP))
 
 	// Start Server
 	port := os.Getenv("PORT")
@@ -627,5 +2368,12 @@ func main() {
 
 	<-stop
 	log.Println("Shutting down...")
+	webhookSvc.Stop()
+	shareSvc.Stop()
+	timelapseSvc.Stop()
+	motionSvc.Stop()
+	timelineSvc.Stop()
+	retentionSvc.Stop()
+	snapshotSvc.Stop()
 	streamMgr.Stop()
 }
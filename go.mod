@@ -2,11 +2,14 @@ module web-tr
 
 go 1.25.6
 
+require (
+	github.com/lib/pq v1.11.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/aws/aws-sdk-go v1.38.20 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/lib/pq v1.11.1 // indirect
 	github.com/u2takey/ffmpeg-go v0.5.0 // indirect
 	github.com/u2takey/go-utils v0.3.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
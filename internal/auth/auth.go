@@ -0,0 +1,428 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/models"
+)
+
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants everything min grants
+func RoleAtLeast(role, min string) bool {
+	return roleRank[role] >= roleRank[min]
+}
+
+const SessionCookie = "webtr_session"
+
+// UserStore is implemented by db.Store in DB mode and FileStore otherwise
+type UserStore interface {
+	GetUsers() ([]models.User, error)
+	GetUser(username string) (*models.User, error)
+	SaveUser(u models.User) error
+	RemoveUser(username string) error
+	GetAPITokens(username string) ([]models.APIToken, error)
+	AddAPIToken(t models.APIToken) error
+	RemoveAPIToken(id string) error
+	FindAPIToken(hash string) (*models.APIToken, error)
+}
+
+// ErrLastAdmin is returned for a change that would leave no admin account
+var ErrLastAdmin = errors.New("at least one admin account is required")
+
+type session struct {
+	username string
+	expires  time.Time
+}
+
+// Service authenticates dashboard sessions and API tokens
+type Service struct {
+	Store      UserStore
+	SessionTTL time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	// usersMu serialises role changes and removals so the last admin can't be lost to a race
+	usersMu sync.Mutex
+}
+
+func NewService(store UserStore) *Service {
+	return &Service{
+		Store:      store,
+		SessionTTL: 12 * time.Hour,
+		sessions:   make(map[string]*session),
+	}
+}
+
+// Bootstrap creates the first admin account when no users exist yet.
+// ADMIN_USER and ADMIN_PASSWORD override the defaults; otherwise a password is generated and logged once.
+func (s *Service) Bootstrap() error {
+	users, err := s.Store.GetUsers()
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return nil
+	}
+
+	username := os.Getenv("ADMIN_USER")
+	if username == "" {
+		username = "admin"
+	}
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		password, err = randomToken(9)
+		if err != nil {
+			return err
+		}
+		log.Printf("Created initial admin account '%s' with password: %s", username, password)
+	} else {
+		log.Printf("Created initial admin account '%s' from ADMIN_PASSWORD", username)
+	}
+
+	_, err = s.CreateUser(username, password, RoleAdmin, nil)
+	return err
+}
+
+// CreateUser adds a new account
+func (s *Service) CreateUser(username, password, role string, groups []string) (*models.User, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("username and password are required")
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("unknown role '%s'", role)
+	}
+	existing, err := s.Store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("user '%s' already exists", username)
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	u := models.User{
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+		Groups:       normalizeGroups(groups),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.Store.SaveUser(u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UpdateUser changes the role, password and/or stream groups of an account.
+// Empty values and nil groups are left alone; an empty list lifts the restriction.
+func (s *Service) UpdateUser(username, password, role string, groups []string) error {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	u, err := s.Store.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("user '%s' not found", username)
+	}
+
+	if role != "" {
+		if !ValidRole(role) {
+			return fmt.Errorf("unknown role '%s'", role)
+		}
+		if u.Role == RoleAdmin && role != RoleAdmin {
+			if err := s.keepAdmin(username); err != nil {
+				return err
+			}
+		}
+		u.Role = role
+	}
+	if groups != nil {
+		u.Groups = normalizeGroups(groups)
+	}
+	if password != "" {
+		hash, err := HashPassword(password)
+		if err != nil {
+			return err
+		}
+		u.PasswordHash = hash
+		// A password change ends existing sessions
+		s.dropSessions(username)
+	}
+	return s.Store.SaveUser(*u)
+}
+
+func normalizeGroups(groups []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, g := range groups {
+		if g = models.NormalizeGroup(g); g != "" && !seen[g] {
+			seen[g] = true
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// Restricted reports whether u only has access to some stream groups
+func Restricted(u *models.User) bool {
+	return u != nil && u.Role != RoleAdmin && len(u.Groups) > 0
+}
+
+// CanAccessGroup reports whether u may see and, with the right role, change
+// streams in group. Admins and users without groups have access to every stream.
+func CanAccessGroup(u *models.User, group string) bool {
+	if u == nil {
+		return false
+	}
+	if !Restricted(u) {
+		return true
+	}
+	for _, g := range u.Groups {
+		if models.InGroup(group, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveUser deletes an account along with its sessions and tokens
+func (s *Service) RemoveUser(username string) error {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	if err := s.keepAdmin(username); err != nil {
+		return err
+	}
+	s.dropSessions(username)
+	return s.Store.RemoveUser(username)
+}
+
+// keepAdmin returns ErrLastAdmin if username is the only admin account
+func (s *Service) keepAdmin(username string) error {
+	users, err := s.Store.GetUsers()
+	if err != nil {
+		return err
+	}
+	others, target := 0, false
+	for _, u := range users {
+		if u.Role != RoleAdmin {
+			continue
+		}
+		if u.Username == username {
+			target = true
+		} else {
+			others++
+		}
+	}
+	if target && others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// Login checks credentials and opens a session, returning its token
+func (s *Service) Login(username, password string) (string, *models.User, error) {
+	u, err := s.Store.GetUser(username)
+	if err != nil {
+		return "", nil, err
+	}
+	if u == nil || !CheckPassword(u.PasswordHash, password) {
+		return "", nil, fmt.Errorf("invalid username or password")
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.mu.Lock()
+	s.sessions[token] = &session{username: u.Username, expires: time.Now().Add(s.SessionTTL)}
+	s.mu.Unlock()
+
+	return token, u, nil
+}
+
+// Logout ends a session
+func (s *Service) Logout(token string) {
+	s.mu.Lock()
+	delete(s.sessions, token)
+	s.mu.Unlock()
+}
+
+func (s *Service) dropSessions(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, sess := range s.sessions {
+		if sess.username == username {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// CreateToken issues an API token for a user. The plaintext is only returned here.
+func (s *Service) CreateToken(username, name string) (string, *models.APIToken, error) {
+	secret, err := randomToken(24)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := randomToken(6)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plain := "wtr_" + secret
+	t := models.APIToken{
+		ID:        id,
+		Username:  username,
+		Name:      name,
+		Hash:      hashToken(plain),
+		CreatedAt: time.Now(),
+	}
+	if err := s.Store.AddAPIToken(t); err != nil {
+		return "", nil, err
+	}
+	return plain, &t, nil
+}
+
+// Authenticate resolves the user behind a request from its session cookie or API token
+func (s *Service) Authenticate(r *http.Request) *models.User {
+	if token := bearerToken(r); token != "" {
+		t, err := s.Store.FindAPIToken(hashToken(token))
+		if err != nil {
+			log.Printf("[Auth] Token lookup failed: %v", err)
+			return nil
+		}
+		if t == nil {
+			return nil
+		}
+		return s.lookup(t.Username)
+	}
+
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	sess, ok := s.sessions[cookie.Value]
+	if ok && time.Now().After(sess.expires) {
+		delete(s.sessions, cookie.Value)
+		ok = false
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.lookup(sess.username)
+}
+
+func (s *Service) lookup(username string) *models.User {
+	u, err := s.Store.GetUser(username)
+	if err != nil {
+		log.Printf("[Auth] User lookup failed: %v", err)
+		return nil
+	}
+	return u
+}
+
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+type contextKey struct{}
+
+// UserFrom returns the authenticated user stored by Require, if any
+func UserFrom(ctx context.Context) *models.User {
+	u, _ := ctx.Value(contextKey{}).(*models.User)
+	return u
+}
+
+// WithUser returns a copy of ctx carrying u
+func WithUser(ctx context.Context, u *models.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// HasRole reports whether the request's user has at least the given role
+func HasRole(r *http.Request, role string) bool {
+	u := UserFrom(r.Context())
+	return u != nil && RoleAtLeast(u.Role, role)
+}
+
+// Require wraps a handler so that only users with at least role may call it.
+// Browsers asking for a page are redirected to the login form instead of getting a 401.
+func (s *Service) Require(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := s.Authenticate(r)
+		if u == nil {
+			if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !RoleAtLeast(u.Role, role) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(WithUser(r.Context(), u)))
+	}
+}
+
+// SetSessionCookie stores the session token in the browser
+func SetSessionCookie(w http.ResponseWriter, r *http.Request, token string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie removes the session cookie
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"web-tr/internal/models"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	return NewService(NewFileStore(filepath.Join(t.TempDir(), "users.json")))
+}
+
+func TestCanAccessGroup(t *testing.T) {
+	admin := &models.User{Role: RoleAdmin, Groups: []string{"Branch"}}
+	unrestricted := &models.User{Role: RoleOperator}
+	branch := &models.User{Role: RoleOperator, Groups: []string{"Branch", "HQ/Gate"}}
+
+	tests := []struct {
+		name  string
+		user  *models.User
+		group string
+		want  bool
+	}{
+		{"nobody", nil, "Branch", false},
+		{"admins ignore their groups", admin, "HQ", true},
+		{"no groups means every stream", unrestricted, "HQ", true},
+		{"own group", branch, "Branch", true},
+		{"subgroup", branch, "Branch/Dock", true},
+		{"nested grant", branch, "HQ/Gate/North", true},
+		{"parent of a grant", branch, "HQ", false},
+		{"similar name", branch, "Branch2", false},
+		{"ungrouped streams are outside every group", branch, "", false},
+	}
+	for _, tt := range tests {
+		if got := CanAccessGroup(tt.user, tt.group); got != tt.want {
+			t.Errorf("%s: CanAccessGroup(%q) = %v, want %v", tt.name, tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeGroups(t *testing.T) {
+	got := normalizeGroups([]string{" HQ / Gate", "HQ/Gate", "", "Branch"})
+	if len(got) != 2 || got[0] != "HQ/Gate" || got[1] != "Branch" {
+		t.Errorf("normalizeGroups = %v", got)
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, min string
+		want      bool
+	}{
+		{RoleAdmin, RoleViewer, true},
+		{RoleOperator, RoleOperator, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleAdmin, false},
+		{"root", RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := RoleAtLeast(tt.role, tt.min); got != tt.want {
+			t.Errorf("RoleAtLeast(%q, %q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestLastAdminIsKept(t *testing.T) {
+	s := newTestService(t)
+	for _, u := range []struct{ name, role string }{{"root", RoleAdmin}, {"ops", RoleOperator}} {
+		if _, err := s.CreateUser(u.name, "secret", u.role, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.UpdateUser("root", "", RoleOperator, nil); err != ErrLastAdmin {
+		t.Errorf("demoting the only admin: %v, want ErrLastAdmin", err)
+	}
+	if err := s.RemoveUser("root"); err != ErrLastAdmin {
+		t.Errorf("removing the only admin: %v, want ErrLastAdmin", err)
+	}
+	// Changes that keep the role are fine
+	if err := s.UpdateUser("root", "", RoleAdmin, []string{"HQ"}); err != nil {
+		t.Errorf("keeping the admin role: %v", err)
+	}
+	if err := s.RemoveUser("ops"); err != nil {
+		t.Errorf("removing an operator: %v", err)
+	}
+
+	// With a second admin either may go
+	if _, err := s.CreateUser("backup", "secret", RoleAdmin, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateUser("root", "", RoleViewer, nil); err != nil {
+		t.Errorf("demoting one of two admins: %v", err)
+	}
+	if err := s.RemoveUser("backup"); err != ErrLastAdmin {
+		t.Errorf("removing the remaining admin: %v, want ErrLastAdmin", err)
+	}
+}
+
+func TestUpdateUserValidates(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.CreateUser("ops", "secret", RoleOperator, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateUser("ops", "", "root", nil); err == nil {
+		t.Error("unknown role was accepted")
+	}
+	if err := s.UpdateUser("nobody", "", RoleViewer, nil); err == nil {
+		t.Error("unknown user was accepted")
+	}
+	if _, err := s.CreateUser("ops", "other", RoleViewer, nil); err == nil {
+		t.Error("duplicate user was accepted")
+	}
+}
+
+func TestLoginAndAuthenticate(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.CreateUser("ops", "secret", RoleOperator, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Login("ops", "wrong"); err == nil {
+		t.Error("wrong password was accepted")
+	}
+
+	session, _, err := s.Login("ops", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: session})
+	if u := s.Authenticate(r); u == nil || u.Username != "ops" {
+		t.Errorf("session login = %+v", u)
+	}
+
+	plain, _, err := s.CreateToken("ops", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+plain)
+	if u := s.Authenticate(r); u == nil || u.Username != "ops" {
+		t.Errorf("token login = %+v", u)
+	}
+
+	// A password change ends the session
+	if err := s.UpdateUser("ops", "changed", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: session})
+	if u := s.Authenticate(r); u != nil {
+		t.Errorf("session survived a password change: %+v", u)
+	}
+}
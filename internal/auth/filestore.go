@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// FileStore keeps users and API tokens in a local JSON file for File/YAML mode
+type FileStore struct {
+	FilePath string
+	mu       sync.Mutex
+}
+
+type fileData struct {
+	Users  []models.User     `json:"users"`
+	Tokens []models.APIToken `json:"tokens"`
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() (*fileData, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return &fileData{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var d fileData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (fs *FileStore) save(d *fileData) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The file holds password hashes, keep it private
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetUsers() ([]models.User, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(d.Users, func(i, j int) bool {
+		return d.Users[i].Username < d.Users[j].Username
+	})
+	return d.Users, nil
+}
+
+func (fs *FileStore) GetUser(username string) (*models.User, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range d.Users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *FileStore) SaveUser(u models.User) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for i, existing := range d.Users {
+		if existing.Username == u.Username {
+			u.CreatedAt = existing.CreatedAt
+			d.Users[i] = u
+			return fs.save(d)
+		}
+	}
+	d.Users = append(d.Users, u)
+	return fs.save(d)
+}
+
+func (fs *FileStore) RemoveUser(username string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return err
+	}
+
+	users := d.Users[:0]
+	for _, u := range d.Users {
+		if u.Username != username {
+			users = append(users, u)
+		}
+	}
+	d.Users = users
+
+	// Tokens die with their owner, like the ON DELETE CASCADE in DB mode
+	tokens := d.Tokens[:0]
+	for _, t := range d.Tokens {
+		if t.Username != username {
+			tokens = append(tokens, t)
+		}
+	}
+	d.Tokens = tokens
+
+	return fs.save(d)
+}
+
+func (fs *FileStore) GetAPITokens(username string) ([]models.APIToken, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []models.APIToken
+	for _, t := range d.Tokens {
+		if username == "" || t.Username == username {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (fs *FileStore) AddAPIToken(t models.APIToken) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for _, existing := range d.Tokens {
+		if existing.ID == t.ID {
+			return fmt.Errorf("token '%s' already exists", t.ID)
+		}
+	}
+	d.Tokens = append(d.Tokens, t)
+	return fs.save(d)
+}
+
+func (fs *FileStore) RemoveAPIToken(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return err
+	}
+
+	tokens := d.Tokens[:0]
+	for _, t := range d.Tokens {
+		if t.ID != id {
+			tokens = append(tokens, t)
+		}
+	}
+	d.Tokens = tokens
+	return fs.save(d)
+}
+
+func (fs *FileStore) FindAPIToken(hash string) (*models.APIToken, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	d, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range d.Tokens {
+		if t.Hash == hash {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
@@ -7,6 +7,8 @@ import (
 	"sort"
 	"sync"
 	"web-tr/internal/models"
+	"web-tr/internal/transcode"
+	"web-tr/internal/vault"
 
 	"gopkg.in/yaml.v3"
 )
@@ -56,32 +58,121 @@ func (cm *ConfigManager) Save(cfg *models.Config) error {
 		return err
 	}
 
-	return os.WriteFile(cm.FilePath, data, 0644)
+	// Stream URLs in the engine config carry camera credentials
+	return os.WriteFile(cm.FilePath, data, 0600)
 }
 
-func (cm *ConfigManager) saveStreamConfig(cfg *models.Config, name, url string) error {
-	cfg.Streams[name] = url
-	return cm.Save(cfg)
+// isGo2RTCStream reports whether a stream belongs in go2rtc.yaml
+func isGo2RTCStream(st models.Stream) bool {
+	return st.Backend == "" || st.Backend == "go2rtc"
+}
+
+// setStreamSource stores the stream URL, keeping the extra sources of a
+// multi-source definition (e.g. an "ffmpeg:" transcode) when its primary URL is
+// unchanged. Credentials are ignored in the comparison since the YAML holds
+// them while the stream list does not.
+func setStreamSource(streams map[string]interface{}, st models.Stream) {
+	prev, ok := streams[st.Name]
+	if ok && vault.StripCredentials(primaryURL(st.Name, prev)) == vault.StripCredentials(st.URL) {
+		if list, isList := prev.([]interface{}); isList && len(list) > 0 {
+			sources := append([]interface{}{st.URL}, list[1:]...)
+			streams[st.Name] = sources
+			return
+		}
+	}
+	streams[st.Name] = st.URL
+}
+
+func (cm *ConfigManager) saveStreamConfig(cfg *models.Config, st models.Stream) error {
+	if isGo2RTCStream(st) {
+		setStreamSource(cfg.Streams, st)
+	} else {
+		delete(cfg.Streams, st.Name)
+	}
+	if err := cm.Save(cfg); err != nil {
+		return err
+	}
+	return updateStreamSettings(func(settings map[string]StreamSettings) {
+		putStreamSettings(settings, st)
+	})
+}
+
+// putStreamSettings records the options of a stream. Streams served by another
+// engine are kept out of go2rtc.yaml and remember their URL here instead.
+func putStreamSettings(settings map[string]StreamSettings, st models.Stream) {
+	entry := settingsFromStream(st)
+	if !isGo2RTCStream(st) {
+		entry.URL = st.URL
+	}
+	settings[st.Name] = entry
+}
+
+// ApplyStreamChanges writes a batch of changes with a single rewrite of
+// go2rtc.yaml and the settings file. Credentials are not handled here.
+func (cm *ConfigManager) ApplyStreamChanges(changes []models.StreamChange) error {
+	cfg, err := cm.Load()
+	if err != nil {
+		return err
+	}
+
+	streamSettingsMu.Lock()
+	defer streamSettingsMu.Unlock()
+	settings, err := loadStreamSettings()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		st := c.Stream
+		switch c.Op {
+		case models.BulkDelete:
+			delete(cfg.Streams, st.Name)
+			delete(settings, st.Name)
+			continue
+		case models.BulkUpdate:
+			if c.OldName != st.Name {
+				delete(cfg.Streams, c.OldName)
+				delete(settings, c.OldName)
+			}
+		}
+		if isGo2RTCStream(st) {
+			setStreamSource(cfg.Streams, st)
+		} else {
+			delete(cfg.Streams, st.Name)
+		}
+		putStreamSettings(settings, st)
+	}
+
+	if err := cm.Save(cfg); err != nil {
+		return err
+	}
+	return saveStreamSettings(settings)
 }
 
 // Deprecated: But keeping signature for now as it matches new logic
-func (cm *ConfigManager) AddStream(name, url string) error {
+func (cm *ConfigManager) AddStream(st models.Stream) error {
 	cfg, err := cm.Load()
 	if err != nil {
 		return err
 	}
-	if _, exists := cfg.Streams[name]; exists {
-		return fmt.Errorf("stream '%s' already exists", name)
+	streams, err := cm.GetStreams()
+	if err != nil {
+		return err
+	}
+	for _, existing := range streams {
+		if existing.Name == st.Name {
+			return fmt.Errorf("stream '%s' already exists", st.Name)
+		}
 	}
-	return cm.saveStreamConfig(cfg, name, url)
+	return cm.saveStreamConfig(cfg, st)
 }
 
-func (cm *ConfigManager) SetStream(name, url string) error {
+func (cm *ConfigManager) SetStream(st models.Stream) error {
 	cfg, err := cm.Load()
 	if err != nil {
 		return err
 	}
-	return cm.saveStreamConfig(cfg, name, url)
+	return cm.saveStreamConfig(cfg, st)
 }
 
 func (cm *ConfigManager) RemoveStream(name string) error {
@@ -91,40 +182,95 @@ func (cm *ConfigManager) RemoveStream(name string) error {
 	}
 
 	delete(cfg.Streams, name)
+	if err := cm.Save(cfg); err != nil {
+		return err
+	}
+	return updateStreamSettings(func(settings map[string]StreamSettings) {
+		delete(settings, name)
+	})
+}
+
+// ReplaceStreams rewrites the streams section of go2rtc.yaml with exactly the given streams
+func (cm *ConfigManager) ReplaceStreams(streams []models.Stream) error {
+	cfg, err := cm.Load()
+	if err != nil {
+		return err
+	}
+
+	previous := cfg.Streams
+	cfg.Streams = make(map[string]interface{})
+	for _, s := range streams {
+		if prev, ok := previous[s.Name]; ok {
+			cfg.Streams[s.Name] = prev
+		}
+		setStreamSource(cfg.Streams, s)
+	}
+
 	return cm.Save(cfg)
 }
 
+// primaryURL extracts the first source of a go2rtc stream definition
+func primaryURL(name string, val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				return s
+			}
+		}
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	default:
+		log.Printf("Stream '%s' has unexpected type: %T value: %v", name, val, val)
+		return "complex source"
+	}
+	return ""
+}
+
 func (cm *ConfigManager) GetStreams() ([]models.Stream, error) {
 	cfg, err := cm.Load()
 	if err != nil {
 		return nil, err
 	}
 
+	streamSettingsMu.Lock()
+	settings, err := loadStreamSettings()
+	streamSettingsMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
 	var streams []models.Stream
 	for name, val := range cfg.Streams {
-		var urlStr string
-		switch v := val.(type) {
-		case string:
-			urlStr = v
-		case []interface{}:
-			if len(v) > 0 {
-				if s, ok := v[0].(string); ok {
-					urlStr = s
-				}
-			}
-		case []string:
-			if len(v) > 0 {
-				urlStr = v[0]
-			}
-		default:
-			log.Printf("Stream '%s' has unexpected type: %T value: %v", name, val, val)
-			urlStr = "complex source"
+		st := models.Stream{
+			Name: name,
+			URL:  primaryURL(name, val),
 		}
+		settings[name].applyTo(&st)
+		// go2rtc pulls a stream with a profile through ffmpeg; the stream's URL is the camera
+		if st.ProfileID != "" {
+			st.URL = transcode.Go2RTCInput(st.URL)
+		}
+		// Anything in go2rtc.yaml is served by go2rtc
+		st.Backend = "go2rtc"
+		streams = append(streams, st)
+	}
 
-		streams = append(streams, models.Stream{
+	// Streams owned by other engines only exist in the settings file
+	for name, entry := range settings {
+		if _, inYAML := cfg.Streams[name]; inYAML || entry.URL == "" {
+			continue
+		}
+		st := models.Stream{
 			Name: name,
-			URL:  urlStr,
-		})
+			URL:  entry.URL,
+		}
+		entry.applyTo(&st)
+		streams = append(streams, st)
 	}
 
 	// Sort by name
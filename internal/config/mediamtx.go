@@ -3,7 +3,6 @@ package config
 import (
 	"fmt"
 	"os"
-	"web-tr/internal/models"
 
 	"gopkg.in/yaml.v3"
 )
@@ -30,25 +29,20 @@ type MediaMTXConfig struct {
 	Paths              map[string]MediaMTXPath `yaml:"paths"`
 }
 
+// MediaMTXPath is the config of one path. The JSON form is the body of the
+// path API and always carries every field, so an update clears what is unset.
 type MediaMTXPath struct {
-	Source string `yaml:"source,omitempty"`
+	Source string `yaml:"source,omitempty" json:"source"`
+	// RunOnDemand publishes to a path with source "publisher" while it has readers
+	RunOnDemand        string `yaml:"runOnDemand,omitempty" json:"runOnDemand"`
+	RunOnDemandRestart bool   `yaml:"runOnDemandRestart,omitempty" json:"runOnDemandRestart"`
 }
 
-// GenerateMediaMTXConfig creates or updates mediamtx.yml from stream list
-func GenerateMediaMTXConfig(streams []models.Stream, filepath string) error {
-	// Filter only MediaMTX streams
-	mtxStreams := make(map[string]MediaMTXPath)
-	for _, s := range streams {
-		if s.Backend == "mediamtx" {
-			mtxStreams[s.Name] = MediaMTXPath{
-				Source: s.URL,
-			}
-		}
-	}
-
+// GenerateMediaMTXConfig creates or updates mediamtx.yml with the given paths
+func GenerateMediaMTXConfig(paths map[string]MediaMTXPath, filepath string) error {
 	// Add default "all" path if no streams
-	if len(mtxStreams) == 0 {
-		mtxStreams["all"] = MediaMTXPath{}
+	if len(paths) == 0 {
+		paths = map[string]MediaMTXPath{"all": {}}
 	}
 
 	config := MediaMTXConfig{
@@ -58,8 +52,8 @@ func GenerateMediaMTXConfig(streams []models.Stream, filepath string) error {
 		APIAddress:         ":9997",
 		HLS:                true,
 		HLSAddress:         ":8888",
-		HLSVariant:         "mpegts",
-		HLSSegmentCount:    3,
+		HLSVariant:         "lowLatency", // LL-HLS, which needs at least 7 segments
+		HLSSegmentCount:    7,
 		HLSSegmentDuration: "1s",
 		HLSPartDuration:    "200ms",
 		HLSSegmentMaxSize:  "50M",
@@ -71,7 +65,7 @@ func GenerateMediaMTXConfig(streams []models.Stream, filepath string) error {
 		RTSP:        true,
 		RTSPAddress: ":8555",
 		Protocols:   []string{"tcp"},
-		Paths:       mtxStreams,
+		Paths:       paths,
 	}
 
 	data, err := yaml.Marshal(&config)
@@ -79,7 +73,7 @@ func GenerateMediaMTXConfig(streams []models.Stream, filepath string) error {
 		return fmt.Errorf("failed to marshal mediamtx config: %w", err)
 	}
 
-	if err := os.WriteFile(filepath, data, 0644); err != nil {
+	if err := os.WriteFile(filepath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write mediamtx.yml: %w", err)
 	}
 
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const SecretKeyFile = "secret.key"
+
+// LoadSecretKey returns the 32-byte server key used to sign share links and encrypt camera credentials.
+// SECRET_KEY takes precedence; otherwise the key is read from SecretKeyFile, which is generated on first use.
+func LoadSecretKey() ([]byte, error) {
+	if env := os.Getenv("SECRET_KEY"); env != "" {
+		sum := sha256.Sum256([]byte(env))
+		return sum[:], nil
+	}
+
+	data, err := os.ReadFile(SecretKeyFile)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid key in %s", SecretKeyFile)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(SecretKeyFile, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// StreamSettingsFile stores per-stream options that have no place in go2rtc.yaml.
+// It is only used in File/YAML mode; in DB mode these live in the streams table.
+const StreamSettingsFile = "stream-settings.json"
+
+var streamSettingsMu sync.Mutex
+
+type StreamSettings struct {
+	// URL is only set for streams that are not stored in go2rtc.yaml
+	URL       string   `json:"url,omitempty"`
+	Backend   string   `json:"backend,omitempty"`
+	Recording bool     `json:"recording,omitempty"`
+	Group     string   `json:"group,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	ProfileID string   `json:"profile_id,omitempty"`
+
+	TimelapseInterval int `json:"timelapse_interval,omitempty"`
+}
+
+func settingsFromStream(st models.Stream) StreamSettings {
+	return StreamSettings{
+		Backend:   st.Backend,
+		Recording: st.Recording,
+		Group:     st.Group,
+		Tags:      st.Tags,
+		ProfileID: st.ProfileID,
+
+		TimelapseInterval: st.TimelapseInterval,
+	}
+}
+
+func (s StreamSettings) applyTo(st *models.Stream) {
+	st.Backend = s.Backend
+	st.Recording = s.Recording
+	st.Group = s.Group
+	st.Tags = s.Tags
+	st.ProfileID = s.ProfileID
+	st.TimelapseInterval = s.TimelapseInterval
+}
+
+func loadStreamSettings() (map[string]StreamSettings, error) {
+	data, err := os.ReadFile(StreamSettingsFile)
+	if os.IsNotExist(err) {
+		return map[string]StreamSettings{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]StreamSettings{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func saveStreamSettings(settings map[string]StreamSettings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(StreamSettingsFile, data, 0644)
+}
+
+// updateStreamSettings loads the settings file, applies fn and writes it back
+func updateStreamSettings(fn func(settings map[string]StreamSettings)) error {
+	streamSettingsMu.Lock()
+	defer streamSettingsMu.Unlock()
+
+	settings, err := loadStreamSettings()
+	if err != nil {
+		return err
+	}
+	fn(settings)
+	return saveStreamSettings(settings)
+}
@@ -0,0 +1,43 @@
+package db
+
+func (s *Store) initCredentials() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS stream_credentials (
+		stream TEXT PRIMARY KEY,
+		sealed TEXT NOT NULL
+	);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+// GetCredentials returns the sealed credentials of every stream, keyed by stream name
+func (s *Store) GetCredentials() (map[string]string, error) {
+	rows, err := s.db.Query("SELECT stream, sealed FROM stream_credentials")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	creds := map[string]string{}
+	for rows.Next() {
+		var stream, sealed string
+		if err := rows.Scan(&stream, &sealed); err != nil {
+			return nil, err
+		}
+		creds[stream] = sealed
+	}
+	return creds, rows.Err()
+}
+
+func (s *Store) SaveCredential(stream, sealed string) error {
+	_, err := s.db.Exec(
+		"INSERT INTO stream_credentials (stream, sealed) VALUES ($1, $2) ON CONFLICT (stream) DO UPDATE SET sealed = $2",
+		stream, sealed,
+	)
+	return err
+}
+
+func (s *Store) RemoveCredential(stream string) error {
+	_, err := s.db.Exec("DELETE FROM stream_credentials WHERE stream = $1", stream)
+	return err
+}
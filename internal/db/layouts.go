@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"web-tr/internal/models"
+)
+
+func (s *Store) initLayouts() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS layouts (
+		name TEXT PRIMARY KEY,
+		grid TEXT NOT NULL,
+		cells TEXT NOT NULL DEFAULT '[]',
+		rotate TEXT NOT NULL DEFAULT '',
+		rotate_seconds INTEGER NOT NULL DEFAULT 0,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+const layoutColumns = "name, grid, cells, rotate, rotate_seconds, created_by, created_at, updated_at"
+
+// Cells are stored as JSON, the rotation as a comma separated list of layout names
+func scanLayout(row interface{ Scan(...any) error }) (models.Layout, error) {
+	var l models.Layout
+	var cells, rotate string
+	err := row.Scan(&l.Name, &l.Grid, &cells, &rotate, &l.RotateSeconds, &l.CreatedBy, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return l, err
+	}
+	if rotate != "" {
+		l.Rotate = strings.Split(rotate, ",")
+	}
+	return l, json.Unmarshal([]byte(cells), &l.Cells)
+}
+
+func (s *Store) GetLayouts() ([]models.Layout, error) {
+	rows, err := s.db.Query("SELECT " + layoutColumns + " FROM layouts ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var layouts []models.Layout
+	for rows.Next() {
+		l, err := scanLayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		layouts = append(layouts, l)
+	}
+	return layouts, rows.Err()
+}
+
+// GetLayout returns nil if the layout does not exist
+func (s *Store) GetLayout(name string) (*models.Layout, error) {
+	l, err := scanLayout(s.db.QueryRow("SELECT "+layoutColumns+" FROM layouts WHERE name = $1", name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (s *Store) AddLayout(l models.Layout) error {
+	cells, err := json.Marshal(l.Cells)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO layouts ("+layoutColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		l.Name, l.Grid, string(cells), strings.Join(l.Rotate, ","), l.RotateSeconds, l.CreatedBy, l.CreatedAt, l.UpdatedAt,
+	)
+	return err
+}
+
+func (s *Store) UpdateLayout(name string, l models.Layout) error {
+	cells, err := json.Marshal(l.Cells)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		"UPDATE layouts SET name = $1, grid = $2, cells = $3, rotate = $4, rotate_seconds = $5, updated_at = $6 WHERE name = $7",
+		l.Name, l.Grid, string(cells), strings.Join(l.Rotate, ","), l.RotateSeconds, l.UpdatedAt, name,
+	)
+	return err
+}
+
+func (s *Store) RemoveLayout(name string) error {
+	_, err := s.db.Exec("DELETE FROM layouts WHERE name = $1", name)
+	return err
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"encoding/json"
+	"web-tr/internal/models"
+)
+
+func (s *Store) initMotion() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS motion_configs (
+		stream TEXT PRIMARY KEY,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		source TEXT NOT NULL DEFAULT '',
+		fps INTEGER NOT NULL DEFAULT 0,
+		sensitivity INTEGER NOT NULL DEFAULT 0,
+		zones TEXT NOT NULL DEFAULT '[]',
+		clips BOOLEAN NOT NULL DEFAULT FALSE,
+		pre_roll INTEGER NOT NULL DEFAULT 0,
+		post_roll INTEGER NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+// Zones are stored as JSON
+func (s *Store) GetMotionConfigs() ([]models.MotionConfig, error) {
+	rows, err := s.db.Query("SELECT stream, enabled, source, fps, sensitivity, zones, clips, pre_roll, post_roll, updated_at FROM motion_configs ORDER BY stream ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []models.MotionConfig
+	for rows.Next() {
+		var c models.MotionConfig
+		var zones string
+		if err := rows.Scan(&c.Stream, &c.Enabled, &c.Source, &c.FPS, &c.Sensitivity, &zones, &c.Clips, &c.PreRoll, &c.PostRoll, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(zones), &c.Zones); err != nil {
+			return nil, err
+		}
+		configs = append(configs, c)
+	}
+	return configs, rows.Err()
+}
+
+func (s *Store) SaveMotionConfig(c models.MotionConfig) error {
+	zones, err := json.Marshal(c.Zones)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO motion_configs (stream, enabled, source, fps, sensitivity, zones, clips, pre_roll, post_roll, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (stream) DO UPDATE SET enabled = $2, source = $3, fps = $4, sensitivity = $5, zones = $6, clips = $7, pre_roll = $8, post_roll = $9, updated_at = $10",
+		c.Stream, c.Enabled, c.Source, c.FPS, c.Sensitivity, string(zones), c.Clips, c.PreRoll, c.PostRoll, c.UpdatedAt,
+	)
+	return err
+}
+
+func (s *Store) RemoveMotionConfig(stream string) error {
+	_, err := s.db.Exec("DELETE FROM motion_configs WHERE stream = $1", stream)
+	return err
+}
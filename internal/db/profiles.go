@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+	"web-tr/internal/models"
+)
+
+func (s *Store) initProfiles() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS transcode_profiles (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		video_codec TEXT NOT NULL,
+		audio_codec TEXT NOT NULL,
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		fps INTEGER NOT NULL DEFAULT 0,
+		bitrate INTEGER NOT NULL DEFAULT 0,
+		hwaccel TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+const profileColumns = "id, name, video_codec, audio_codec, width, height, fps, bitrate, hwaccel, created_at, updated_at"
+
+func scanProfile(row interface{ Scan(...any) error }) (models.TranscodeProfile, error) {
+	var p models.TranscodeProfile
+	err := row.Scan(&p.ID, &p.Name, &p.VideoCodec, &p.AudioCodec, &p.Width, &p.Height, &p.FPS, &p.Bitrate, &p.HWAccel, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+func (s *Store) GetProfiles() ([]models.TranscodeProfile, error) {
+	rows, err := s.db.Query("SELECT " + profileColumns + " FROM transcode_profiles ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []models.TranscodeProfile
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// GetProfile returns nil if the profile does not exist
+func (s *Store) GetProfile(id string) (*models.TranscodeProfile, error) {
+	p, err := scanProfile(s.db.QueryRow("SELECT "+profileColumns+" FROM transcode_profiles WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) AddProfile(p models.TranscodeProfile) error {
+	_, err := s.db.Exec(
+		"INSERT INTO transcode_profiles ("+profileColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		p.ID, p.Name, p.VideoCodec, p.AudioCodec, p.Width, p.Height, p.FPS, p.Bitrate, p.HWAccel, p.CreatedAt, p.UpdatedAt,
+	)
+	return err
+}
+
+func (s *Store) UpdateProfile(p models.TranscodeProfile) error {
+	_, err := s.db.Exec(
+		"UPDATE transcode_profiles SET name = $1, video_codec = $2, audio_codec = $3, width = $4, height = $5, fps = $6, bitrate = $7, hwaccel = $8, updated_at = $9 WHERE id = $10",
+		p.Name, p.VideoCodec, p.AudioCodec, p.Width, p.Height, p.FPS, p.Bitrate, p.HWAccel, p.UpdatedAt, p.ID,
+	)
+	return err
+}
+
+func (s *Store) RemoveProfile(id string) error {
+	_, err := s.db.Exec("DELETE FROM transcode_profiles WHERE id = $1", id)
+	return err
+}
@@ -0,0 +1,48 @@
+package db
+
+import "web-tr/internal/models"
+
+// The global policy is the row with an empty stream
+func (s *Store) initRetention() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS retention_policies (
+		stream TEXT PRIMARY KEY,
+		max_age_days INTEGER NOT NULL DEFAULT 0,
+		max_size_gb DOUBLE PRECISION NOT NULL DEFAULT 0,
+		min_free_gb DOUBLE PRECISION NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+func (s *Store) GetRetentionPolicies() ([]models.RetentionPolicy, error) {
+	rows, err := s.db.Query("SELECT stream, max_age_days, max_size_gb, min_free_gb, updated_at FROM retention_policies ORDER BY stream ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []models.RetentionPolicy
+	for rows.Next() {
+		var p models.RetentionPolicy
+		if err := rows.Scan(&p.Stream, &p.MaxAgeDays, &p.MaxSizeGB, &p.MinFreeGB, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+func (s *Store) SaveRetentionPolicy(p models.RetentionPolicy) error {
+	_, err := s.db.Exec(
+		"INSERT INTO retention_policies (stream, max_age_days, max_size_gb, min_free_gb, updated_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (stream) DO UPDATE SET max_age_days = $2, max_size_gb = $3, min_free_gb = $4, updated_at = $5",
+		p.Stream, p.MaxAgeDays, p.MaxSizeGB, p.MinFreeGB, p.UpdatedAt,
+	)
+	return err
+}
+
+func (s *Store) RemoveRetentionPolicy(stream string) error {
+	_, err := s.db.Exec("DELETE FROM retention_policies WHERE stream = $1", stream)
+	return err
+}
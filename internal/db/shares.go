@@ -0,0 +1,96 @@
+package db
+
+import (
+	"database/sql"
+	"web-tr/internal/models"
+)
+
+func (s *Store) initShares() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS share_links (
+		id TEXT PRIMARY KEY,
+		stream TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		max_views INTEGER NOT NULL DEFAULT 0,
+		views INTEGER NOT NULL DEFAULT 0,
+		revoked BOOLEAN NOT NULL DEFAULT FALSE
+	);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+const shareColumns = "id, stream, created_by, created_at, expires_at, max_views, views, revoked"
+
+func scanShareLink(row interface{ Scan(...any) error }) (models.ShareLink, error) {
+	var l models.ShareLink
+	err := row.Scan(&l.ID, &l.Stream, &l.CreatedBy, &l.CreatedAt, &l.ExpiresAt, &l.MaxViews, &l.Views, &l.Revoked)
+	return l, err
+}
+
+// GetShareLinks lists the links of one stream, or of all streams if stream is empty
+func (s *Store) GetShareLinks(stream string) ([]models.ShareLink, error) {
+	rows, err := s.db.Query(
+		"SELECT "+shareColumns+" FROM share_links WHERE $1 = '' OR stream = $1 ORDER BY created_at DESC",
+		stream,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []models.ShareLink
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// GetShareLink returns nil if the link does not exist
+func (s *Store) GetShareLink(id string) (*models.ShareLink, error) {
+	l, err := scanShareLink(s.db.QueryRow("SELECT "+shareColumns+" FROM share_links WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (s *Store) AddShareLink(l models.ShareLink) error {
+	_, err := s.db.Exec(
+		"INSERT INTO share_links ("+shareColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		l.ID, l.Stream, l.CreatedBy, l.CreatedAt, l.ExpiresAt, l.MaxViews, l.Views, l.Revoked,
+	)
+	return err
+}
+
+func (s *Store) RevokeShareLink(id string) error {
+	_, err := s.db.Exec("UPDATE share_links SET revoked = TRUE WHERE id = $1", id)
+	return err
+}
+
+// RevokeStreamShareLinks revokes every link of a stream
+func (s *Store) RevokeStreamShareLinks(stream string) error {
+	_, err := s.db.Exec("UPDATE share_links SET revoked = TRUE WHERE stream = $1 AND NOT revoked", stream)
+	return err
+}
+
+// CountShareView records a view, returning false once the link's view limit is used up
+func (s *Store) CountShareView(id string) (bool, error) {
+	res, err := s.db.Exec(
+		"UPDATE share_links SET views = views + 1 WHERE id = $1 AND (max_views = 0 OR views < max_views)",
+		id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
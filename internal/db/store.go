@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"web-tr/internal/models"
 
 	_ "github.com/lib/pq"
@@ -45,16 +46,48 @@ func (s *Store) Init() error {
 		return err
 	}
 
-	// Add backend column if it doesn't exist (migration)
+	// Add backend/recording/group/tags/profile/timelapse columns if they don't exist (migration)
 	alterQuery := `
 	ALTER TABLE streams 
-	ADD COLUMN IF NOT EXISTS backend TEXT DEFAULT 'go2rtc';`
-	_, err := s.db.Exec(alterQuery)
-	return err
+	ADD COLUMN IF NOT EXISTS backend TEXT DEFAULT 'go2rtc',
+	ADD COLUMN IF NOT EXISTS recording BOOLEAN DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS group_name TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS profile_id TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS timelapse_interval INTEGER NOT NULL DEFAULT 0;`
+	if _, err := s.db.Exec(alterQuery); err != nil {
+		return err
+	}
+
+	if err := s.initUsers(); err != nil {
+		return err
+	}
+	if err := s.initShares(); err != nil {
+		return err
+	}
+	if err := s.initCredentials(); err != nil {
+		return err
+	}
+	if err := s.initWebhooks(); err != nil {
+		return err
+	}
+	if err := s.initLayouts(); err != nil {
+		return err
+	}
+	if err := s.initProfiles(); err != nil {
+		return err
+	}
+	if err := s.initMotion(); err != nil {
+		return err
+	}
+	if err := s.initTimeline(); err != nil {
+		return err
+	}
+	return s.initRetention()
 }
 
 func (s *Store) GetStreams() ([]models.Stream, error) {
-	rows, err := s.db.Query("SELECT name, url, COALESCE(backend, 'go2rtc') as backend FROM streams ORDER BY name ASC")
+	rows, err := s.db.Query("SELECT name, url, COALESCE(backend, 'go2rtc') as backend, COALESCE(recording, FALSE), group_name, tags, profile_id, timelapse_interval FROM streams ORDER BY name ASC")
 	if err != nil {
 		return nil, err
 	}
@@ -63,10 +96,14 @@ func (s *Store) GetStreams() ([]models.Stream, error) {
 	var streams []models.Stream
 	for rows.Next() {
 		var st models.Stream
-		if err := rows.Scan(&st.Name, &st.URL, &st.Backend); err != nil {
+		var tags string
+		if err := rows.Scan(&st.Name, &st.URL, &st.Backend, &st.Recording, &st.Group, &tags, &st.ProfileID, &st.TimelapseInterval); err != nil {
 			log.Printf("Error scanning row: %v", err)
 			continue
 		}
+		if tags != "" {
+			st.Tags = strings.Split(tags, ",")
+		}
 		// Default to go2rtc if empty
 		if st.Backend == "" {
 			st.Backend = "go2rtc"
@@ -82,8 +119,8 @@ func (s *Store) AddStream(st models.Stream) error {
 		st.Backend = "go2rtc"
 	}
 	_, err := s.db.Exec(
-		"INSERT INTO streams (name, url, backend) VALUES ($1, $2, $3) ON CONFLICT (name) DO UPDATE SET url = $2, backend = $3",
-		st.Name, st.URL, st.Backend,
+		"INSERT INTO streams (name, url, backend, recording, group_name, tags, profile_id, timelapse_interval) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (name) DO UPDATE SET url = $2, backend = $3, recording = $4, group_name = $5, tags = $6, profile_id = $7, timelapse_interval = $8",
+		st.Name, st.URL, st.Backend, st.Recording, st.Group, strings.Join(st.Tags, ","), st.ProfileID, st.TimelapseInterval,
 	)
 	return err
 }
@@ -93,10 +130,10 @@ func (s *Store) RemoveStream(name string) error {
 	return err
 }
 
-func (s *Store) UpdateStream(oldName, newName, url, backend string) error {
+func (s *Store) UpdateStream(oldName string, st models.Stream) error {
 	// Default to go2rtc if backend not specified
-	if backend == "" {
-		backend = "go2rtc"
+	if st.Backend == "" {
+		st.Backend = "go2rtc"
 	}
 
 	tx, err := s.db.Begin()
@@ -105,25 +142,25 @@ func (s *Store) UpdateStream(oldName, newName, url, backend string) error {
 	}
 	defer tx.Rollback()
 
-	if oldName != newName {
+	if oldName != st.Name {
 		// Check if new name exists
 		var exists bool
-		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM streams WHERE name = $1)", newName).Scan(&exists)
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM streams WHERE name = $1)", st.Name).Scan(&exists)
 		if err != nil {
 			return err
 		}
 		if exists {
-			return fmt.Errorf("stream name '%s' already exists", newName)
+			return fmt.Errorf("stream name '%s' already exists", st.Name)
 		}
 
-		// Update name, url, and backend
-		_, err = tx.Exec("UPDATE streams SET name = $1, url = $2, backend = $3 WHERE name = $4", newName, url, backend, oldName)
+		// Update name and all settings
+		_, err = tx.Exec("UPDATE streams SET name = $1, url = $2, backend = $3, recording = $4, group_name = $5, tags = $6, profile_id = $7, timelapse_interval = $8 WHERE name = $9", st.Name, st.URL, st.Backend, st.Recording, st.Group, strings.Join(st.Tags, ","), st.ProfileID, st.TimelapseInterval, oldName)
 		if err != nil {
 			return err
 		}
 	} else {
-		// Just update url and backend
-		_, err = tx.Exec("UPDATE streams SET url = $1, backend = $2 WHERE name = $3", url, backend, newName)
+		// Just update the settings
+		_, err = tx.Exec("UPDATE streams SET url = $1, backend = $2, recording = $3, group_name = $4, tags = $5, profile_id = $6, timelapse_interval = $7 WHERE name = $8", st.URL, st.Backend, st.Recording, st.Group, strings.Join(st.Tags, ","), st.ProfileID, st.TimelapseInterval, st.Name)
 		if err != nil {
 			return err
 		}
@@ -131,3 +168,57 @@ func (s *Store) UpdateStream(oldName, newName, url, backend string) error {
 
 	return tx.Commit()
 }
+
+// ApplyStreamChanges writes a batch of stream changes and their credentials in
+// one transaction, so either all of them are stored or none
+func (s *Store) ApplyStreamChanges(changes []models.StreamChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range changes {
+		st := c.Stream
+		if st.Backend == "" {
+			st.Backend = "go2rtc"
+		}
+		tags := strings.Join(st.Tags, ",")
+
+		switch c.Op {
+		case models.BulkCreate:
+			_, err = tx.Exec("INSERT INTO streams (name, url, backend, recording, group_name, tags, profile_id, timelapse_interval) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+				st.Name, st.URL, st.Backend, st.Recording, st.Group, tags, st.ProfileID, st.TimelapseInterval)
+		case models.BulkUpdate:
+			var res sql.Result
+			res, err = tx.Exec("UPDATE streams SET name = $1, url = $2, backend = $3, recording = $4, group_name = $5, tags = $6, profile_id = $7, timelapse_interval = $8 WHERE name = $9",
+				st.Name, st.URL, st.Backend, st.Recording, st.Group, tags, st.ProfileID, st.TimelapseInterval, c.OldName)
+			if err == nil {
+				if n, _ := res.RowsAffected(); n == 0 {
+					err = fmt.Errorf("stream '%s' not found", c.OldName)
+				}
+			}
+			if err == nil && c.OldName != st.Name {
+				_, err = tx.Exec("DELETE FROM stream_credentials WHERE stream = $1", c.OldName)
+			}
+		case models.BulkDelete:
+			_, err = tx.Exec("DELETE FROM streams WHERE name = $1", st.Name)
+		default:
+			err = fmt.Errorf("unknown operation '%s'", c.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", c.Op, st.Name, err)
+		}
+
+		if c.Credential == "" {
+			_, err = tx.Exec("DELETE FROM stream_credentials WHERE stream = $1", st.Name)
+		} else {
+			_, err = tx.Exec("INSERT INTO stream_credentials (stream, sealed) VALUES ($1, $2) ON CONFLICT (stream) DO UPDATE SET sealed = $2", st.Name, c.Credential)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", c.Op, st.Name, err)
+		}
+	}
+
+	return tx.Commit()
+}
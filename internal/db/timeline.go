@@ -0,0 +1,155 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"web-tr/internal/models"
+)
+
+func (s *Store) initTimeline() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS timeline_events (
+		id BIGSERIAL PRIMARY KEY,
+		stream TEXT NOT NULL,
+		type TEXT NOT NULL,
+		time TIMESTAMP NOT NULL,
+		end_time TIMESTAMP,
+		message TEXT NOT NULL DEFAULT '',
+		data TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS timeline_events_stream_time ON timeline_events (stream, time);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+const timelineColumns = "id, stream, type, time, end_time, message, data, created_by"
+
+// Times are stored in UTC and Data as JSON
+func scanTimelineEvent(row interface{ Scan(...any) error }) (models.TimelineEvent, error) {
+	var ev models.TimelineEvent
+	var end sql.NullTime
+	var data string
+	if err := row.Scan(&ev.ID, &ev.Stream, &ev.Type, &ev.Time, &end, &ev.Message, &data, &ev.CreatedBy); err != nil {
+		return ev, err
+	}
+	ev.Time = ev.Time.UTC()
+	if end.Valid {
+		ev.End = end.Time.UTC()
+	}
+	if data != "" {
+		if err := json.Unmarshal([]byte(data), &ev.Data); err != nil {
+			return ev, err
+		}
+	}
+	return ev, nil
+}
+
+// GetTimelineEvents returns the events matching q by time, oldest first
+func (s *Store) GetTimelineEvents(q models.TimelineQuery) ([]models.TimelineEvent, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Stream != "" {
+		where = append(where, "stream = "+arg(q.Stream))
+	}
+	if !q.From.IsZero() {
+		where = append(where, "COALESCE(end_time, time) >= "+arg(q.From.UTC()))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "time <= "+arg(q.To.UTC()))
+	}
+	if len(q.Types) > 0 {
+		in := make([]string, len(q.Types))
+		for i, t := range q.Types {
+			in[i] = arg(t)
+		}
+		where = append(where, "type IN ("+strings.Join(in, ", ")+")")
+	}
+
+	query := "SELECT " + timelineColumns + " FROM timeline_events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time ASC, id ASC"
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TimelineEvent{}
+	for rows.Next() {
+		ev, err := scanTimelineEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ev)
+	}
+	return list, rows.Err()
+}
+
+// GetTimelineEvent returns nil if the event does not exist
+func (s *Store) GetTimelineEvent(id int64) (*models.TimelineEvent, error) {
+	ev, err := scanTimelineEvent(s.db.QueryRow("SELECT "+timelineColumns+" FROM timeline_events WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+func (s *Store) AddTimelineEvent(ev models.TimelineEvent) (int64, error) {
+	var data string
+	if len(ev.Data) > 0 {
+		b, err := json.Marshal(ev.Data)
+		if err != nil {
+			return 0, err
+		}
+		data = string(b)
+	}
+	var end sql.NullTime
+	if !ev.End.IsZero() {
+		end = sql.NullTime{Time: ev.End.UTC(), Valid: true}
+	}
+
+	var id int64
+	err := s.db.QueryRow(
+		"INSERT INTO timeline_events (stream, type, time, end_time, message, data, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		ev.Stream, ev.Type, ev.Time.UTC(), end, ev.Message, data, ev.CreatedBy,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *Store) RemoveTimelineEvent(id int64) error {
+	_, err := s.db.Exec("DELETE FROM timeline_events WHERE id = $1", id)
+	return err
+}
+
+// RenameTimelineStream moves the events of a renamed stream to its new name
+func (s *Store) RenameTimelineStream(oldName, newName string) error {
+	_, err := s.db.Exec("UPDATE timeline_events SET stream = $1 WHERE stream = $2", newName, oldName)
+	return err
+}
+
+// PruneTimeline deletes the events that ended before t
+func (s *Store) PruneTimeline(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM timeline_events WHERE COALESCE(end_time, time) < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
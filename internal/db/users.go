@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"web-tr/internal/models"
+)
+
+func (s *Store) initUsers() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS users (
+		username TEXT PRIMARY KEY,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'viewer',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS stream_groups TEXT NOT NULL DEFAULT '';
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE ON UPDATE CASCADE,
+		name TEXT NOT NULL DEFAULT '',
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+func (s *Store) GetUsers() ([]models.User, error) {
+	rows, err := s.db.Query("SELECT username, password_hash, role, stream_groups, created_at FROM users ORDER BY username ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		var groups string
+		if err := rows.Scan(&u.Username, &u.PasswordHash, &u.Role, &groups, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		u.Groups = splitGroups(groups)
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetUser returns nil if the user does not exist
+func (s *Store) GetUser(username string) (*models.User, error) {
+	var u models.User
+	var groups string
+	err := s.db.QueryRow(
+		"SELECT username, password_hash, role, stream_groups, created_at FROM users WHERE username = $1", username,
+	).Scan(&u.Username, &u.PasswordHash, &u.Role, &groups, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.Groups = splitGroups(groups)
+	return &u, nil
+}
+
+func (s *Store) SaveUser(u models.User) error {
+	_, err := s.db.Exec(
+		"INSERT INTO users (username, password_hash, role, stream_groups, created_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (username) DO UPDATE SET password_hash = $2, role = $3, stream_groups = $4",
+		u.Username, u.PasswordHash, u.Role, strings.Join(u.Groups, "\n"), u.CreatedAt,
+	)
+	return err
+}
+
+// splitGroups reads the newline-separated group list of a user
+func splitGroups(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func (s *Store) RemoveUser(username string) error {
+	_, err := s.db.Exec("DELETE FROM users WHERE username = $1", username)
+	return err
+}
+
+// GetAPITokens lists the tokens of one user, or of everyone if username is empty
+func (s *Store) GetAPITokens(username string) ([]models.APIToken, error) {
+	rows, err := s.db.Query(
+		"SELECT id, username, name, token_hash, created_at FROM api_tokens WHERE $1 = '' OR username = $1 ORDER BY created_at ASC",
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var t models.APIToken
+		if err := rows.Scan(&t.ID, &t.Username, &t.Name, &t.Hash, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *Store) AddAPIToken(t models.APIToken) error {
+	_, err := s.db.Exec(
+		"INSERT INTO api_tokens (id, username, name, token_hash, created_at) VALUES ($1, $2, $3, $4, $5)",
+		t.ID, t.Username, t.Name, t.Hash, t.CreatedAt,
+	)
+	return err
+}
+
+func (s *Store) RemoveAPIToken(id string) error {
+	_, err := s.db.Exec("DELETE FROM api_tokens WHERE id = $1", id)
+	return err
+}
+
+// FindAPIToken returns nil if no token has the given hash
+func (s *Store) FindAPIToken(hash string) (*models.APIToken, error) {
+	var t models.APIToken
+	err := s.db.QueryRow(
+		"SELECT id, username, name, token_hash, created_at FROM api_tokens WHERE token_hash = $1", hash,
+	).Scan(&t.ID, &t.Username, &t.Name, &t.Hash, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
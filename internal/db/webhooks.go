@@ -0,0 +1,148 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"web-tr/internal/models"
+)
+
+func (s *Store) initWebhooks() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id TEXT PRIMARY KEY,
+		webhook_id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_created ON webhook_deliveries (created_at);`
+	_, err := s.db.Exec(query)
+	return err
+}
+
+const webhookColumns = "id, url, secret, events, enabled, created_by, created_at"
+
+func scanWebhook(row interface{ Scan(...any) error }) (models.Webhook, error) {
+	var w models.Webhook
+	var events string
+	err := row.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.Enabled, &w.CreatedBy, &w.CreatedAt)
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return w, err
+}
+
+func (s *Store) GetWebhooks() ([]models.Webhook, error) {
+	rows, err := s.db.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY created_at ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, w)
+	}
+	return hooks, rows.Err()
+}
+
+// GetWebhook returns nil if the webhook does not exist
+func (s *Store) GetWebhook(id string) (*models.Webhook, error) {
+	w, err := scanWebhook(s.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *Store) AddWebhook(w models.Webhook) error {
+	_, err := s.db.Exec(
+		"INSERT INTO webhooks ("+webhookColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		w.ID, w.URL, w.Secret, strings.Join(w.Events, ","), w.Enabled, w.CreatedBy, w.CreatedAt,
+	)
+	return err
+}
+
+func (s *Store) UpdateWebhook(w models.Webhook) error {
+	_, err := s.db.Exec(
+		"UPDATE webhooks SET url = $1, events = $2, enabled = $3 WHERE id = $4",
+		w.URL, strings.Join(w.Events, ","), w.Enabled, w.ID,
+	)
+	return err
+}
+
+func (s *Store) RemoveWebhook(id string) error {
+	_, err := s.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	return err
+}
+
+const deliveryColumns = "id, webhook_id, event, status, attempts, status_code, error, created_at, updated_at"
+
+// SaveDelivery adds or replaces a logged delivery and prunes the log to the newest keep deliveries
+func (s *Store) SaveDelivery(d models.WebhookDelivery, keep int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO webhook_deliveries ("+deliveryColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (id) DO UPDATE SET status = $4, attempts = $5, status_code = $6, error = $7, updated_at = $9",
+		d.ID, d.WebhookID, d.Event, d.Status, d.Attempts, d.StatusCode, d.Error, d.CreatedAt.UTC(), d.UpdatedAt.UTC(),
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"DELETE FROM webhook_deliveries WHERE id NOT IN (SELECT id FROM webhook_deliveries ORDER BY created_at DESC LIMIT $1)",
+		keep,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDeliveries returns the logged deliveries of one webhook, or of all if webhookID is empty, newest first
+func (s *Store) GetDeliveries(webhookID string) ([]models.WebhookDelivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries"
+	var args []interface{}
+	if webhookID != "" {
+		query += " WHERE webhook_id = $1"
+		args = append(args, webhookID)
+	}
+	rows, err := s.db.Query(query+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Status, &d.Attempts, &d.StatusCode, &d.Error, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.CreatedAt, d.UpdatedAt = d.CreatedAt.UTC(), d.UpdatedAt.UTC()
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,270 @@
+// Package events fans out stream and system events to live subscribers,
+// such as dashboards connected to /api/events.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the server
+const (
+	StreamAdded    = "stream.added"
+	StreamUpdated  = "stream.updated"
+	StreamDeleted  = "stream.deleted"
+	StreamsChanged = "streams.changed" // a batch of stream events, see Expand
+	ImportProgress = "import.progress"
+	ImportDone     = "import.done"
+	EngineRestart  = "engine.restart"
+	EngineReady    = "engine.ready"
+	HealthChanged  = "health.changed"
+	MotionStarted  = "motion.start"
+	MotionEnded    = "motion.end"
+	RecordingGap   = "recording.gap"
+	Dropped        = "events.dropped" // a live subscriber missed events and should reload
+)
+
+// replayLimit is how many recent events are kept for clients that reconnect
+const replayLimit = 100
+
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Change is one stream event of a StreamsChanged batch
+type Change struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Batch is the data of a StreamsChanged event
+type Batch struct {
+	By      string   `json:"by,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// Expand splits a StreamsChanged event into its stream events, as if each had
+// been published on its own. Other events are returned as they are.
+func Expand(ev Event) []Event {
+	b, ok := ev.Data.(Batch)
+	if ev.Type != StreamsChanged || !ok {
+		return []Event{ev}
+	}
+	out := make([]Event, len(b.Changes))
+	for i, c := range b.Changes {
+		out[i] = Event{ID: ev.ID, Type: c.Type, Time: ev.Time, Data: c.Data}
+	}
+	return out
+}
+
+// Hub delivers every published event to all subscribers. Live clients
+// subscribe with a bounded buffer: a slow one misses events instead of holding
+// up the publisher, and is sent a Dropped notice once it catches up. Services
+// that must see every event use Queue instead.
+type Hub struct {
+	mu     sync.Mutex
+	nextID uint64
+	recent []Event
+	subs   map[chan Event]*subscriber
+}
+
+type subscriber struct {
+	// queue is set for subscribers that never miss an event
+	queue *queue
+	// missed counts the events a live subscriber had no room for, up to lastMissed
+	missed     int
+	lastMissed uint64
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan Event]*subscriber)}
+}
+
+// Publish sends an event to every subscriber. It is safe to call on a nil Hub.
+func (h *Hub) Publish(typ string, data interface{}) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	ev := Event{ID: h.nextID, Type: typ, Time: time.Now(), Data: data}
+	h.recent = append(h.recent, ev)
+	if len(h.recent) > replayLimit {
+		h.recent = h.recent[len(h.recent)-replayLimit:]
+	}
+
+	for ch, sub := range h.subs {
+		if sub.queue != nil {
+			sub.queue.push(ev)
+			continue
+		}
+		// The notice goes first so the client knows its view is stale
+		if sub.missed > 0 {
+			select {
+			case ch <- droppedNotice(sub.missed, sub.lastMissed):
+				sub.missed = 0
+			default:
+			}
+		}
+		if sub.missed == 0 {
+			select {
+			case ch <- ev:
+				continue
+			default:
+			}
+		}
+		sub.missed++
+		sub.lastMissed = ev.ID
+	}
+}
+
+// droppedNotice tells a live subscriber it missed events, up to and including
+// lastID. Its id is lastID, so a client reconnecting after it doesn't get the
+// missed events replayed on top of the state it reloads.
+func droppedNotice(missed int, lastID uint64) Event {
+	return Event{ID: lastID, Type: Dropped, Time: time.Now(), Data: map[string]int{"missed": missed}}
+}
+
+// Subscribe returns a channel receiving new events, preceded by the kept
+// events newer than lastID, or by a Dropped notice if some of them are no
+// longer kept. Call Unsubscribe when done.
+func (h *Hub) Subscribe(lastID uint64) chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var missed []Event
+	if lastID > 0 && lastID < h.nextID {
+		if oldest := h.recent[0].ID; oldest > lastID+1 {
+			missed = append(missed, droppedNotice(int(oldest-lastID-1), oldest-1))
+		}
+		for _, ev := range h.recent {
+			if ev.ID > lastID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+
+	ch := make(chan Event, 64+len(missed))
+	for _, ev := range missed {
+		ch <- ev
+	}
+	h.subs[ch] = &subscriber{}
+	return ch
+}
+
+// Queue returns a channel receiving every event published from now on, in
+// order. Events wait in an unbounded queue while the receiver is busy, so
+// nothing is lost; it is meant for the server's own services, which keep up
+// over time. Call Unsubscribe or Drain when done.
+func (h *Hub) Queue() chan Event {
+	q := newQueue()
+	h.mu.Lock()
+	h.subs[q.out] = &subscriber{queue: q}
+	h.mu.Unlock()
+	go q.run()
+	return q.out
+}
+
+// Unsubscribe stops delivery to ch and closes it. Events still queued for it are discarded.
+func (h *Hub) Unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	sub, ok := h.subs[ch]
+	delete(h.subs, ch)
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	if sub.queue != nil {
+		sub.queue.close()
+		return
+	}
+	close(ch)
+}
+
+// Drain unsubscribes a channel from Queue and returns the events that were
+// published to it but not yet received, in order
+func (h *Hub) Drain(ch chan Event) []Event {
+	h.mu.Lock()
+	sub, ok := h.subs[ch]
+	delete(h.subs, ch)
+	h.mu.Unlock()
+	if !ok || sub.queue == nil {
+		return nil
+	}
+	return sub.queue.close()
+}
+
+// queue feeds the events pushed to it into out from its own goroutine
+type queue struct {
+	out chan Event
+
+	mu      sync.Mutex
+	pending []Event
+	wake    chan struct{}
+	done    chan struct{}
+	exited  chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{
+		out:    make(chan Event, 64),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+}
+
+func (q *queue) push(ev Event) {
+	q.mu.Lock()
+	q.pending = append(q.pending, ev)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) run() {
+	defer close(q.exited)
+	defer close(q.out)
+	for {
+		q.mu.Lock()
+		batch := q.pending
+		q.pending = nil
+		q.mu.Unlock()
+
+		for i, ev := range batch {
+			select {
+			case q.out <- ev:
+			case <-q.done:
+				q.mu.Lock()
+				q.pending = append(batch[i:], q.pending...)
+				q.mu.Unlock()
+				return
+			}
+		}
+
+		select {
+		case <-q.wake:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// close stops the queue and returns the events not yet received
+func (q *queue) close() []Event {
+	close(q.done)
+	<-q.exited
+	var rest []Event
+	for ev := range q.out {
+		rest = append(rest, ev)
+	}
+	return append(rest, q.pending...)
+}
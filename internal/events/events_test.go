@@ -0,0 +1,152 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, ch chan Event) Event {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestSubscribeReplaysAfterLastID(t *testing.T) {
+	h := NewHub()
+	for i := 0; i < 3; i++ {
+		h.Publish(StreamAdded, i)
+	}
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		want   []uint64
+	}{
+		{"new subscriber", 0, nil},
+		{"reconnect", 1, []uint64{2, 3}},
+		{"up to date", 3, nil},
+	}
+	for _, tt := range tests {
+		ch := h.Subscribe(tt.lastID)
+		var got []uint64
+		for len(ch) > 0 {
+			got = append(got, (<-ch).ID)
+		}
+		h.Unsubscribe(ch)
+		if len(got) != len(tt.want) || len(got) > 0 && got[0] != tt.want[0] {
+			t.Errorf("%s: replayed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubscribeReportsEventsNoLongerKept(t *testing.T) {
+	h := NewHub()
+	for i := 0; i < replayLimit+10; i++ {
+		h.Publish(StreamAdded, i)
+	}
+	ch := h.Subscribe(5)
+	defer h.Unsubscribe(ch)
+
+	ev := receive(t, ch)
+	if ev.Type != Dropped || ev.ID != 10 || ev.Data.(map[string]int)["missed"] != 5 {
+		t.Fatalf("first event = %+v, want a notice for 6 to 10", ev)
+	}
+	if ev := receive(t, ch); ev.ID != 11 {
+		t.Errorf("replay resumed at %d, want 11", ev.ID)
+	}
+}
+
+func TestSlowSubscriberIsToldWhatItMissed(t *testing.T) {
+	h := NewHub()
+	ch := h.Subscribe(0)
+	defer h.Unsubscribe(ch)
+
+	// Fill the buffer, then overflow it by three
+	for i := 0; i < cap(ch)+3; i++ {
+		h.Publish(StreamUpdated, i)
+	}
+	for i := 0; i < cap(ch); i++ {
+		<-ch
+	}
+	h.Publish(StreamDeleted, nil)
+
+	notice := receive(t, ch)
+	if notice.Type != Dropped || notice.Data.(map[string]int)["missed"] != 3 || notice.ID != uint64(cap(ch)+3) {
+		t.Fatalf("notice = %+v", notice)
+	}
+	if ev := receive(t, ch); ev.Type != StreamDeleted {
+		t.Errorf("after the notice got %+v, want the new event", ev)
+	}
+}
+
+func TestQueueKeepsEveryEvent(t *testing.T) {
+	h := NewHub()
+	ch := h.Queue()
+	defer h.Unsubscribe(ch)
+
+	// Far more than any channel buffer, published while nobody reads
+	const n = 5000
+	for i := 0; i < n; i++ {
+		h.Publish(StreamAdded, i)
+	}
+	for i := 0; i < n; i++ {
+		ev := receive(t, ch)
+		if ev.Data != i {
+			t.Fatalf("event %d carries %v", i, ev.Data)
+		}
+	}
+}
+
+func TestDrainReturnsQueuedEvents(t *testing.T) {
+	h := NewHub()
+	ch := h.Queue()
+	for i := 0; i < 200; i++ {
+		h.Publish(MotionEnded, i)
+	}
+	first := receive(t, ch)
+
+	rest := h.Drain(ch)
+	if len(rest) != 199 {
+		t.Fatalf("drained %d events, want 199", len(rest))
+	}
+	for i, ev := range append([]Event{first}, rest...) {
+		if ev.Data != i {
+			t.Fatalf("event %d carries %v", i, ev.Data)
+		}
+	}
+
+	// Nothing arrives after draining
+	h.Publish(MotionEnded, nil)
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after Drain")
+	}
+	if got := h.Drain(ch); got != nil {
+		t.Errorf("second Drain = %v", got)
+	}
+}
+
+func TestNilHubPublish(t *testing.T) {
+	var h *Hub
+	h.Publish(StreamAdded, nil)
+}
+
+func TestExpand(t *testing.T) {
+	batch := Event{ID: 7, Type: StreamsChanged, Data: Batch{Changes: []Change{
+		{Type: StreamAdded, Data: map[string]interface{}{"name": "yard"}},
+		{Type: StreamDeleted, Data: map[string]interface{}{"name": "door"}},
+	}}}
+	got := Expand(batch)
+	if len(got) != 2 || got[0].Type != StreamAdded || got[1].Type != StreamDeleted || got[1].ID != 7 {
+		t.Errorf("Expand(batch) = %+v", got)
+	}
+
+	single := Event{ID: 8, Type: StreamUpdated}
+	if got := Expand(single); len(got) != 1 || got[0] != single {
+		t.Errorf("Expand(single) = %+v", got)
+	}
+}
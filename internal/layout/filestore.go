@@ -0,0 +1,115 @@
+package layout
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// FileStore keeps layouts in a local JSON file for File/YAML mode
+type FileStore struct {
+	FilePath string
+	mu       sync.Mutex
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() ([]models.Layout, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var layouts []models.Layout
+	if err := json.Unmarshal(data, &layouts); err != nil {
+		return nil, err
+	}
+	return layouts, nil
+}
+
+func (fs *FileStore) save(layouts []models.Layout) error {
+	data, err := json.MarshalIndent(layouts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetLayouts() ([]models.Layout, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	layouts, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(layouts, func(i, j int) bool { return layouts[i].Name < layouts[j].Name })
+	return layouts, nil
+}
+
+func (fs *FileStore) GetLayout(name string) (*models.Layout, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	layouts, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layouts {
+		if l.Name == name {
+			return &l, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *FileStore) AddLayout(l models.Layout) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	layouts, err := fs.load()
+	if err != nil {
+		return err
+	}
+	return fs.save(append(layouts, l))
+}
+
+func (fs *FileStore) UpdateLayout(name string, l models.Layout) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	layouts, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for i := range layouts {
+		if layouts[i].Name == name {
+			layouts[i] = l
+		}
+	}
+	return fs.save(layouts)
+}
+
+func (fs *FileStore) RemoveLayout(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	layouts, err := fs.load()
+	if err != nil {
+		return err
+	}
+	kept := layouts[:0]
+	for _, l := range layouts {
+		if l.Name != name {
+			kept = append(kept, l)
+		}
+	}
+	return fs.save(kept)
+}
@@ -0,0 +1,225 @@
+// Package layout manages saved multi-camera layouts shown on video walls.
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"web-tr/internal/models"
+)
+
+var (
+	ErrNotFound = errors.New("layout not found")
+	ErrExists   = errors.New("a layout with this name already exists")
+)
+
+// Limits of a grid template
+const (
+	MaxGridSide      = 6
+	MinRotateSeconds = 5
+)
+
+// Store is implemented by db.Store in DB mode and FileStore otherwise
+type Store interface {
+	GetLayouts() ([]models.Layout, error)
+	GetLayout(name string) (*models.Layout, error)
+	AddLayout(l models.Layout) error
+	UpdateLayout(name string, l models.Layout) error
+	RemoveLayout(name string) error
+}
+
+// Grid describes how a template is drawn: a Size x Size (or Columns x Rows)
+// grid whose first cell spans Span columns and rows.
+type Grid struct {
+	Columns int `json:"columns"`
+	Rows    int `json:"rows"`
+	Span    int `json:"span"`
+	Cells   int `json:"cells"`
+}
+
+// ParseGrid reads a template. "CxR" is a plain grid of C columns and R rows;
+// "1+N" is one large tile with N small ones around it, for odd N of 3 or more
+// (1+5 is a 3x3 grid whose first tile spans 2x2, 1+7 a 4x4 grid with a 3x3 tile).
+func ParseGrid(grid string) (Grid, error) {
+	grid = strings.ToLower(strings.TrimSpace(grid))
+	if big, small, ok := strings.Cut(grid, "+"); ok {
+		n, err := strconv.Atoi(small)
+		if big != "1" || err != nil || n < 3 || n%2 == 0 || (n+1)/2 > MaxGridSide {
+			return Grid{}, fmt.Errorf("invalid grid '%s', use 1+N with an odd N from 3 to %d", grid, 2*MaxGridSide-1)
+		}
+		side := (n + 1) / 2
+		return Grid{Columns: side, Rows: side, Span: side - 1, Cells: n + 1}, nil
+	}
+
+	c, r, ok := strings.Cut(grid, "x")
+	cols, err1 := strconv.Atoi(c)
+	rows, err2 := strconv.Atoi(r)
+	if !ok || err1 != nil || err2 != nil || cols < 1 || rows < 1 || cols > MaxGridSide || rows > MaxGridSide {
+		return Grid{}, fmt.Errorf("invalid grid '%s', use CxR up to %dx%d or 1+N", grid, MaxGridSide, MaxGridSide)
+	}
+	return Grid{Columns: cols, Rows: rows, Span: 1, Cells: cols * rows}, nil
+}
+
+// Service validates layouts and keeps them in the store
+type Service struct {
+	Store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{Store: store}
+}
+
+func (s *Service) validate(l *models.Layout) error {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(l.Name, "/?#") {
+		return fmt.Errorf("name must not contain '/', '?' or '#'")
+	}
+
+	g, err := ParseGrid(l.Grid)
+	if err != nil {
+		return err
+	}
+	l.Grid = strings.ToLower(strings.TrimSpace(l.Grid))
+	if len(l.Cells) > g.Cells {
+		return fmt.Errorf("grid %s has %d cells, got %d", l.Grid, g.Cells, len(l.Cells))
+	}
+	for i := range l.Cells {
+		c := &l.Cells[i]
+		c.Stream = strings.TrimSpace(c.Stream)
+		switch c.Transport {
+		case "":
+			c.Transport = models.TransportWebRTC
+		case models.TransportWebRTC, models.TransportMSE:
+		default:
+			return fmt.Errorf("cell %d: unknown transport '%s', use webrtc or mse", i+1, c.Transport)
+		}
+	}
+
+	if len(l.Rotate) == 0 {
+		l.Rotate, l.RotateSeconds = nil, 0
+		return nil
+	}
+	if l.RotateSeconds < MinRotateSeconds {
+		return fmt.Errorf("rotation interval must be at least %d seconds", MinRotateSeconds)
+	}
+	for _, name := range l.Rotate {
+		if name == l.Name {
+			continue
+		}
+		other, err := s.Store.GetLayout(name)
+		if err != nil {
+			return err
+		}
+		if other == nil {
+			return fmt.Errorf("rotation: layout '%s' not found", name)
+		}
+	}
+	return nil
+}
+
+// List returns all layouts sorted by name
+func (s *Service) List() ([]models.Layout, error) {
+	layouts, err := s.Store.GetLayouts()
+	if err != nil {
+		return nil, err
+	}
+	if layouts == nil {
+		layouts = []models.Layout{}
+	}
+	return layouts, nil
+}
+
+func (s *Service) Get(name string) (*models.Layout, error) {
+	l, err := s.Store.GetLayout(name)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, ErrNotFound
+	}
+	return l, nil
+}
+
+func (s *Service) Create(l models.Layout, createdBy string) (*models.Layout, error) {
+	if err := s.validate(&l); err != nil {
+		return nil, err
+	}
+	existing, err := s.Store.GetLayout(l.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrExists
+	}
+
+	l.CreatedBy = createdBy
+	l.CreatedAt = time.Now().UTC()
+	l.UpdatedAt = l.CreatedAt
+	if err := s.Store.AddLayout(l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Update replaces the layout called name, which may be renamed by l.Name
+func (s *Service) Update(name string, l models.Layout) (*models.Layout, error) {
+	old, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(&l); err != nil {
+		return nil, err
+	}
+	if l.Name != name {
+		existing, err := s.Store.GetLayout(l.Name)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, ErrExists
+		}
+	}
+
+	l.CreatedBy, l.CreatedAt = old.CreatedBy, old.CreatedAt
+	l.UpdatedAt = time.Now().UTC()
+	if err := s.Store.UpdateLayout(name, l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (s *Service) Remove(name string) error {
+	if _, err := s.Get(name); err != nil {
+		return err
+	}
+	return s.Store.RemoveLayout(name)
+}
+
+// Sequence returns the layouts a wall started on name cycles through: the
+// layout itself followed by its rotation. Layouts removed since are left out.
+func (s *Service) Sequence(name string) ([]models.Layout, error) {
+	first, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	seq := []models.Layout{*first}
+	for _, n := range first.Rotate {
+		if n == first.Name {
+			seq = append(seq, *first)
+			continue
+		}
+		l, err := s.Store.GetLayout(n)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			seq = append(seq, *l)
+		}
+	}
+	return seq, nil
+}
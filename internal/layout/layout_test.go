@@ -0,0 +1,116 @@
+package layout
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"web-tr/internal/models"
+)
+
+func TestParseGrid(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Grid
+		wantErr bool
+	}{
+		{"1x1", Grid{Columns: 1, Rows: 1, Span: 1, Cells: 1}, false},
+		{"2x2", Grid{Columns: 2, Rows: 2, Span: 1, Cells: 4}, false},
+		{" 4X3 ", Grid{Columns: 4, Rows: 3, Span: 1, Cells: 12}, false},
+		{"6x6", Grid{Columns: 6, Rows: 6, Span: 1, Cells: 36}, false},
+		{"1+3", Grid{Columns: 2, Rows: 2, Span: 1, Cells: 4}, false},
+		{"1+5", Grid{Columns: 3, Rows: 3, Span: 2, Cells: 6}, false},
+		{"1+7", Grid{Columns: 4, Rows: 4, Span: 3, Cells: 8}, false},
+		{"1+11", Grid{Columns: 6, Rows: 6, Span: 5, Cells: 12}, false},
+		{"7x1", Grid{}, true},
+		{"0x2", Grid{}, true},
+		{"2x", Grid{}, true},
+		{"2", Grid{}, true},
+		{"", Grid{}, true},
+		{"1+4", Grid{}, true},
+		{"1+1", Grid{}, true},
+		{"1+13", Grid{}, true},
+		{"2+5", Grid{}, true},
+		{"1+x", Grid{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseGrid(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseGrid(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := NewService(NewFileStore(filepath.Join(t.TempDir(), "layouts.json")))
+	if _, err := s.Create(models.Layout{Name: "Lobby", Grid: "1x1"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		layout  models.Layout
+		wantErr string
+	}{
+		{"ok", models.Layout{Name: " Gate ", Grid: "2X2", Cells: []models.LayoutCell{{Stream: "a"}, {Stream: "b", Transport: "mse"}}}, ""},
+		{"no name", models.Layout{Grid: "2x2"}, "name is required"},
+		{"slash in name", models.Layout{Name: "a/b", Grid: "2x2"}, "must not contain"},
+		{"bad grid", models.Layout{Name: "x", Grid: "9x9"}, "invalid grid"},
+		{"too many cells", models.Layout{Name: "x", Grid: "1x1", Cells: make([]models.LayoutCell, 2)}, "has 1 cells"},
+		{"bad transport", models.Layout{Name: "x", Grid: "1x1", Cells: []models.LayoutCell{{Transport: "hls"}}}, "unknown transport"},
+		{"fast rotation", models.Layout{Name: "x", Grid: "1x1", Rotate: []string{"Lobby"}, RotateSeconds: 1}, "at least"},
+		{"unknown rotation", models.Layout{Name: "x", Grid: "1x1", Rotate: []string{"Nope"}, RotateSeconds: 10}, "not found"},
+		{"rotation with itself", models.Layout{Name: "x", Grid: "1x1", Rotate: []string{"x", "Lobby"}, RotateSeconds: 10}, ""},
+	}
+	for _, tt := range tests {
+		l := tt.layout
+		err := s.validate(&l)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	l := models.Layout{Name: " Gate ", Grid: " 2X2", Cells: []models.LayoutCell{{Stream: " a "}}, RotateSeconds: 30}
+	if err := s.validate(&l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Name != "Gate" || l.Grid != "2x2" || l.Cells[0].Stream != "a" || l.Cells[0].Transport != models.TransportWebRTC || l.RotateSeconds != 0 {
+		t.Errorf("normalized layout = %+v", l)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	s := NewService(NewFileStore(filepath.Join(t.TempDir(), "layouts.json")))
+	for _, name := range []string{"B", "C"} {
+		if _, err := s.Create(models.Layout{Name: name, Grid: "1x1"}, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Create(models.Layout{Name: "A", Grid: "1x1", Rotate: []string{"B", "A", "C"}, RotateSeconds: 10}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("C"); err != nil {
+		t.Fatal(err)
+	}
+
+	seq, err := s.Sequence("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range seq {
+		got = append(got, l.Name)
+	}
+	if strings.Join(got, ",") != "A,B,A" {
+		t.Errorf("sequence = %v, want A,B,A", got)
+	}
+
+	if _, err := s.Sequence("missing"); err != ErrNotFound {
+		t.Errorf("missing layout: %v, want ErrNotFound", err)
+	}
+}
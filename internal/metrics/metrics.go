@@ -0,0 +1,336 @@
+// Package metrics is a small Prometheus text-format exporter. Metrics are
+// registered on a package-level registry and served by Handler.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Emitter writes metrics computed at scrape time, e.g. from the health monitor
+type Emitter struct {
+	w *bufio.Writer
+}
+
+// Collector is called on every scrape to emit values that live elsewhere
+type Collector func(e *Emitter)
+
+var (
+	mu         sync.Mutex
+	registered []metric
+	collectors []Collector
+)
+
+func register(m metric) {
+	mu.Lock()
+	registered = append(registered, m)
+	mu.Unlock()
+}
+
+// RegisterCollector adds a function that emits metrics on every scrape
+func RegisterCollector(c Collector) {
+	mu.Lock()
+	collectors = append(collectors, c)
+	mu.Unlock()
+}
+
+// Handler serves all registered metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		mu.Lock()
+		ms := append([]metric(nil), registered...)
+		cs := append([]Collector(nil), collectors...)
+		mu.Unlock()
+
+		bw := bufio.NewWriter(w)
+		for _, m := range ms {
+			m.write(bw)
+		}
+		e := &Emitter{w: bw}
+		for _, c := range cs {
+			c(e)
+		}
+		bw.Flush()
+	})
+}
+
+// Header starts a metric family in a collector
+func (e *Emitter) Header(name, help, typ string) {
+	writeHeader(e.w, name, help, typ)
+}
+
+// Sample writes one value; labels are given as name/value pairs
+func (e *Emitter) Sample(name string, value float64, labels ...string) {
+	names := make([]string, 0, len(labels)/2)
+	values := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		names = append(names, labels[i])
+		values = append(values, labels[i+1])
+	}
+	writeSample(e.w, name, names, values, "", "", value)
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.ReplaceAll(help, "\n", " "), name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeSample writes "name{labels} value". extraName/extraValue add one more label, used for "le".
+func writeSample(w *bufio.Writer, name string, names, values []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(names) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, n := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, n, labelEscaper.Replace(values[i]))
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// vec holds one series per combination of label values
+type vec[T any] struct {
+	name   string
+	help   string
+	labels []string
+	newFn  func() *T
+
+	mu     sync.Mutex
+	series map[string]*series[T]
+}
+
+type series[T any] struct {
+	values []string
+	value  *T
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s.value
+	}
+	s := &series[T]{values: append([]string(nil), values...), value: v.newFn()}
+	v.series[key] = s
+	return s.value
+}
+
+func (v *vec[T]) delete(values []string) {
+	v.mu.Lock()
+	delete(v.series, strings.Join(values, "\xff"))
+	v.mu.Unlock()
+}
+
+func (v *vec[T]) deleteMatching(label, value string) {
+	i := slices.Index(v.labels, label)
+	if i < 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for key, s := range v.series {
+		if s.values[i] == value {
+			delete(v.series, key)
+		}
+	}
+}
+
+// sorted returns the series ordered by label values so output is stable
+func (v *vec[T]) sorted() []*series[T] {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	out := make([]*series[T], 0, len(v.series))
+	for _, s := range v.series {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].values, "\xff") < strings.Join(out[j].values, "\xff")
+	})
+	return out
+}
+
+// Value is a float that can be updated concurrently, used for counters and gauges
+type Value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (c *Value) Add(delta float64) {
+	c.mu.Lock()
+	c.v += delta
+	c.mu.Unlock()
+}
+
+func (c *Value) Inc() { c.Add(1) }
+func (c *Value) Dec() { c.Add(-1) }
+
+func (c *Value) Set(v float64) {
+	c.mu.Lock()
+	c.v = v
+	c.mu.Unlock()
+}
+
+func (c *Value) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.v
+}
+
+// ValueVec is a counter or gauge family
+type ValueVec struct {
+	typ string
+	vec[Value]
+}
+
+func newValueVec(typ, name, help string, labels []string) *ValueVec {
+	v := &ValueVec{typ: typ}
+	v.name, v.help, v.labels = name, help, labels
+	v.newFn = func() *Value { return &Value{} }
+	v.series = make(map[string]*series[Value])
+	register(v)
+	return v
+}
+
+// NewCounterVec registers a counter family. Counters must only go up.
+func NewCounterVec(name, help string, labels ...string) *ValueVec {
+	return newValueVec("counter", name, help, labels)
+}
+
+// NewGaugeVec registers a gauge family
+func NewGaugeVec(name, help string, labels ...string) *ValueVec {
+	return newValueVec("gauge", name, help, labels)
+}
+
+// With returns the series for the given label values, creating it if needed
+func (v *ValueVec) With(values ...string) *Value {
+	return v.with(values)
+}
+
+// Delete drops a series, e.g. when a stream is removed
+func (v *ValueVec) Delete(values ...string) {
+	v.delete(values)
+}
+
+// DeleteMatching drops every series whose label has the given value
+func (v *ValueVec) DeleteMatching(label, value string) {
+	v.deleteMatching(label, value)
+}
+
+func (v *ValueVec) write(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.typ)
+	for _, s := range v.sorted() {
+		writeSample(w, v.name, v.labels, s.values, "", "", s.value.get())
+	}
+}
+
+// DefBuckets suit durations of a few milliseconds up to tens of seconds
+var DefBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// HistogramVec is a histogram family
+type HistogramVec struct {
+	vec[Histogram]
+}
+
+// NewHistogramVec registers a histogram family; nil buckets means DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{}
+	h.name, h.help, h.labels = name, help, labels
+	h.newFn = func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	}
+	h.series = make(map[string]*series[Histogram])
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values)
+}
+
+func (h *HistogramVec) Delete(values ...string) {
+	h.delete(values)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, s := range h.sorted() {
+		hist := s.value
+		hist.mu.Lock()
+		for i, b := range hist.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, s.values, "le", formatFloat(b), float64(hist.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.values, "le", "+Inf", float64(hist.count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, "", "", hist.sum)
+		writeSample(w, h.name+"_count", h.labels, s.values, "", "", float64(hist.count))
+		hist.mu.Unlock()
+	}
+}
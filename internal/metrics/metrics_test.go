@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(m metric) string {
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	m.write(w)
+	w.Flush()
+	return sb.String()
+}
+
+func TestValueVecText(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests\nserved", "stream", "code")
+	c.With("yard", "200").Add(3)
+	c.With(`front "door"`, "500").Inc()
+	c.With("gone", "200").Inc()
+	c.Delete("gone", "200")
+
+	want := "# HELP test_requests_total Requests served\n" +
+		"# TYPE test_requests_total counter\n" +
+		`test_requests_total{stream="front \"door\"",code="500"} 1` + "\n" +
+		`test_requests_total{stream="yard",code="200"} 3` + "\n"
+	if got := render(c); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	g := NewGaugeVec("test_up", "Up")
+	g.With().Set(1)
+	g.With().Dec()
+	if got := render(g); !strings.HasSuffix(got, "test_up 0\n") {
+		t.Errorf("gauge without labels:\n%s", got)
+	}
+}
+
+func TestHistogramText(t *testing.T) {
+	h := NewHistogramVec("test_seconds", "Durations", []float64{1, 0.5}, "kind")
+	for _, v := range []float64{0.2, 0.7, 3} {
+		h.With("probe").Observe(v)
+	}
+
+	want := "# HELP test_seconds Durations\n" +
+		"# TYPE test_seconds histogram\n" +
+		`test_seconds_bucket{kind="probe",le="0.5"} 1` + "\n" +
+		`test_seconds_bucket{kind="probe",le="1"} 2` + "\n" +
+		`test_seconds_bucket{kind="probe",le="+Inf"} 3` + "\n" +
+		`test_seconds_sum{kind="probe"} 3.9` + "\n" +
+		`test_seconds_count{kind="probe"} 3` + "\n"
+	if got := render(h); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	v := NewGaugeVec("test_labels", "Labels", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("With accepted one value for two labels")
+		}
+	}()
+	v.With("only")
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{1.5, "1.5"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, tt := range tests {
+		if got := formatFloat(tt.in); got != tt.want {
+			t.Errorf("formatFloat(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerRunsCollectors(t *testing.T) {
+	RegisterCollector(func(e *Emitter) {
+		e.Header("test_stream_online", "Whether the stream is online", "gauge")
+		e.Sample("test_stream_online", 1, "stream", "yard")
+	})
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type = %s", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "# TYPE test_stream_online gauge\n"+`test_stream_online{stream="yard"} 1`+"\n") {
+		t.Errorf("collector output missing:\n%s", body)
+	}
+}
+
+func TestDeleteMatching(t *testing.T) {
+	c := NewCounterVec("test_bytes_total", "Bytes", "endpoint", "stream")
+	c.With("hls", "yard").Inc()
+	c.With("mp4", "yard").Inc()
+	c.With("hls", "door").Inc()
+	c.DeleteMatching("stream", "yard")
+	c.DeleteMatching("colour", "yard")
+
+	want := "# HELP test_bytes_total Bytes\n" +
+		"# TYPE test_bytes_total counter\n" +
+		`test_bytes_total{endpoint="hls",stream="door"} 1` + "\n"
+	if got := render(c); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+// Operations accepted by /api/streams/bulk
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// BulkOp is one item of a bulk request. Name is the stream to update or delete
+// and defaults to Stream.Name; Stream is the new definition for create and update.
+type BulkOp struct {
+	Op     string `json:"op"`
+	Name   string `json:"name,omitempty"`
+	Stream Stream `json:"stream"`
+}
+
+const (
+	BulkApplied    = "applied"
+	BulkError      = "error"
+	BulkNotApplied = "not_applied" // valid, but another item of the batch failed
+)
+
+type BulkResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// StreamChange is a validated write handed to the stores, which apply a batch
+// of them at once. Credential is the sealed credential for Stream.Name, empty
+// for none; it is only stored by the DB store, which keeps them in the same
+// transaction.
+type StreamChange struct {
+	Op         string
+	OldName    string
+	Stream     Stream
+	Credential string
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Transports a wall cell can play with
+const (
+	TransportWebRTC = "webrtc"
+	TransportMSE    = "mse"
+)
+
+// Layout is a saved video wall: a grid template such as "2x2", "3x3" or "1+5"
+// and the stream shown in each of its cells, in reading order.
+type Layout struct {
+	Name  string       `json:"name"`
+	Grid  string       `json:"grid"`
+	Cells []LayoutCell `json:"cells"`
+	// Rotate lists the layouts shown in turn after this one on a wall, every RotateSeconds
+	Rotate        []string  `json:"rotate,omitempty"`
+	RotateSeconds int       `json:"rotate_seconds,omitempty"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// LayoutCell is one tile of a layout. An empty stream leaves the tile blank.
+type LayoutCell struct {
+	Stream    string `json:"stream"`
+	Transport string `json:"transport,omitempty"` // webrtc (default) or mse
+}
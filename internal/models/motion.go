@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Feeds the motion detector can analyse
+const (
+	// MotionSourceFFmpeg decodes the engine's restream at a low frame rate
+	MotionSourceFFmpeg = "ffmpeg"
+	// MotionSourceFrames polls still frames from the snapshot service
+	MotionSourceFrames = "frames"
+)
+
+// MotionConfig sets up motion detection on one stream
+type MotionConfig struct {
+	Stream  string `json:"stream"`
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source,omitempty"` // MotionSourceFFmpeg when empty
+	// FPS is the number of frames analysed per second
+	FPS int `json:"fps"`
+	// Sensitivity from 1 to 100; higher values react to smaller changes
+	Sensitivity int `json:"sensitivity"`
+	// Zones limit detection to parts of the frame; none watches all of it
+	Zones []MotionZone `json:"zones,omitempty"`
+	// Clips records PreRoll seconds before and PostRoll seconds after each event
+	Clips     bool      `json:"clips"`
+	PreRoll   int       `json:"pre_roll"`
+	PostRoll  int       `json:"post_roll"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MotionZone is a rectangle of the frame, in fractions of its width and height
+type MotionZone struct {
+	Name   string  `json:"name,omitempty"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// MotionEvent is a period of motion on a stream. End is zero while it lasts.
+type MotionEvent struct {
+	ID     string    `json:"id"`
+	Stream string    `json:"stream"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitzero"`
+	// Zones lists the zones that saw motion
+	Zones []string `json:"zones,omitempty"`
+	// Score is the largest share of changed pixels in a zone, from 0 to 1
+	Score float64 `json:"score"`
+
+	// URLs of the files in the recording store, filled in when they exist
+	Snapshot string `json:"snapshot,omitempty"`
+	Clip     string `json:"clip,omitempty"`
+	// Locked events are kept by retention
+	Locked bool `json:"locked,omitempty"`
+}
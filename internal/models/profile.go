@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Codecs a transcoding profile can produce. CodecCopy passes the camera's
+// track through, CodecNone drops the audio.
+const (
+	CodecCopy  = "copy"
+	CodecH264  = "h264"
+	CodecH265  = "h265"
+	CodecMJPEG = "mjpeg"
+	CodecAAC   = "aac"
+	CodecOpus  = "opus"
+	CodecPCMU  = "pcmu"
+	CodecNone  = "none"
+)
+
+// TranscodeProfile is a named set of transcoding options. Streams refer to it
+// by ID and the engines build their transcoding source from it, so a change to
+// the profile applies to every stream using it.
+type TranscodeProfile struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	VideoCodec string `json:"video_codec"`
+	AudioCodec string `json:"audio_codec"`
+	// Width and Height scale the video; with only one of them set the aspect ratio is kept
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+	FPS     int    `json:"fps,omitempty"`
+	Bitrate int    `json:"bitrate,omitempty"` // video bitrate in kbit/s
+	HWAccel string `json:"hwaccel,omitempty"` // "auto", "vaapi", "cuda", ...; empty encodes on the CPU
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// RetentionPolicy limits the footage kept of a stream. The policy with an
+// empty Stream is the global one: its MaxAgeDays applies to the streams
+// without their own, its MaxSizeGB to all recordings together. Zero means no
+// limit, or the global limit in a stream's policy.
+type RetentionPolicy struct {
+	Stream     string  `json:"stream"`
+	MaxAgeDays int     `json:"max_age_days,omitempty"`
+	MaxSizeGB  float64 `json:"max_size_gb,omitempty"`
+	// MinFreeGB is the disk space kept free, only in the global policy
+	MinFreeGB float64   `json:"min_free_gb,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RetentionAction is one deletion by the retention janitor
+type RetentionAction struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	// Reason is the rule that was enforced: "age", "size", "total size" or "free space"
+	Reason string `json:"reason"`
+	// Segments counts recorded segments and motion events
+	Segments int   `json:"segments"`
+	Bytes    int64 `json:"bytes"`
+	// Oldest and Newest bound the footage that was deleted
+	Oldest time.Time `json:"oldest"`
+	Newest time.Time `json:"newest"`
+}
+
+// StreamStorage is the footage kept of a stream
+type StreamStorage struct {
+	Stream string `json:"stream"`
+	Bytes  int64  `json:"bytes"`
+	// Segments counts recorded segments and motion events
+	Segments int `json:"segments"`
+	Locked   int `json:"locked"`
+	// Oldest and Newest are zero without footage
+	Oldest time.Time `json:"oldest,omitzero"`
+	Newest time.Time `json:"newest,omitzero"`
+	// Days is the span from the oldest footage to now
+	Days float64 `json:"days"`
+	// MaxAgeDays and MaxSizeGB are the limits in effect
+	MaxAgeDays int     `json:"max_age_days,omitempty"`
+	MaxSizeGB  float64 `json:"max_size_gb,omitempty"`
+}
+
+// StorageStatus reports the recording store and the janitor's last run
+type StorageStatus struct {
+	Streams []StreamStorage `json:"streams"`
+	Bytes   int64           `json:"bytes"`
+	// DiskFree and DiskSize are zero when the platform cannot tell
+	DiskFree int64             `json:"disk_free"`
+	DiskSize int64             `json:"disk_size"`
+	LastRun  time.Time         `json:"last_run,omitzero"`
+	Actions  []RetentionAction `json:"actions"`
+}
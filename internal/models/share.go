@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ShareLink grants anonymous access to a single stream until it expires or is revoked.
+// The token itself is not stored, it is re-derived from the link fields and the server key.
+type ShareLink struct {
+	ID        string    `json:"id"`
+	Stream    string    `json:"stream"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxViews  int       `json:"max_views"` // 0 means unlimited
+	Views     int       `json:"views"`
+	Revoked   bool      `json:"revoked"`
+	Token     string    `json:"token,omitempty"`
+}
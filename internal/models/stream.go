@@ -1,13 +1,85 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
 type Stream struct {
-	Name      string `json:"name"`
-	URL       string `json:"url"`
-	Backend   string `json:"backend,omitempty"` // "go2rtc" or "mediamtx"
-	Recording bool   `json:"recording,omitempty"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Backend   string   `json:"backend,omitempty"` // "go2rtc" or "mediamtx"
+	Recording bool     `json:"recording,omitempty"`
+	Group     string   `json:"group,omitempty"` // nested path such as "HQ/Building A/Floor 2"
+	Tags      []string `json:"tags,omitempty"`
+	ProfileID string   `json:"profile_id,omitempty"` // transcoding profile; empty passes the camera through
+	// TimelapseInterval is the number of seconds between stored time-lapse frames, 0 disables them
+	TimelapseInterval int `json:"timelapse_interval,omitempty"`
+
+	// Transcode is the profile ProfileID refers to, resolved for the engines and never stored
+	Transcode *TranscodeProfile `json:"-"`
+
+	// Health is filled in from the health monitor and never stored
+	Health *StreamHealth `json:"health,omitempty"`
+}
+
+// Bounds of Stream.TimelapseInterval in seconds
+const (
+	MinTimelapseInterval = 5
+	MaxTimelapseInterval = 24 * 60 * 60
+)
+
+const (
+	HealthUnknown = "unknown"
+	HealthOnline  = "online"
+	HealthOffline = "offline"
+)
+
+// StreamHealth is the latest result of the background health check of a stream
+type StreamHealth struct {
+	Status    string    `json:"status"`
+	Since     time.Time `json:"since,omitzero"` // when Status last changed
+	LastSeen  time.Time `json:"last_seen,omitzero"`
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+	Codec     string    `json:"codec,omitempty"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	Source    string    `json:"source,omitempty"` // "go2rtc" or "ffprobe"
+	Error     string    `json:"error,omitempty"`
+}
+
+// HealthChange records a stream going online or offline
+type HealthChange struct {
+	Stream string    `json:"stream"`
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
 }
 
 type Config struct {
 	Streams map[string]interface{} `yaml:"streams"`
 	Rest    map[string]interface{} `yaml:",inline"`
 }
+
+// GroupSeparator separates the levels of a group path, e.g. "HQ/Building A/Floor 2"
+const GroupSeparator = "/"
+
+// NormalizeGroup trims the levels of a group path and drops empty ones
+func NormalizeGroup(group string) string {
+	var parts []string
+	for _, p := range strings.Split(group, GroupSeparator) {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, GroupSeparator)
+}
+
+// InGroup reports whether group is parent itself or one of its subgroups.
+// The empty parent contains every group.
+func InGroup(group, parent string) bool {
+	if parent == "" || group == parent {
+		return true
+	}
+	return strings.HasPrefix(group, parent+GroupSeparator)
+}
@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestNormalizeGroup(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"HQ", "HQ"},
+		{" HQ / Building A /Floor 2 ", "HQ/Building A/Floor 2"},
+		{"/HQ//Gate/", "HQ/Gate"},
+		{" / / ", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeGroup(tt.in); got != tt.want {
+			t.Errorf("NormalizeGroup(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInGroup(t *testing.T) {
+	tests := []struct {
+		group, parent string
+		want          bool
+	}{
+		{"", "", true},
+		{"HQ", "", true},
+		{"HQ", "HQ", true},
+		{"HQ/Gate", "HQ", true},
+		{"HQ/Gate/North", "HQ", true},
+		{"HQ/Gate", "HQ/Gate", true},
+		{"HQ", "HQ/Gate", false},
+		{"HQ2", "HQ", false},
+		{"HQ Annex/Gate", "HQ", false},
+		{"", "HQ", false},
+		{"Branch/HQ", "HQ", false},
+	}
+	for _, tt := range tests {
+		if got := InGroup(tt.group, tt.parent); got != tt.want {
+			t.Errorf("InGroup(%q, %q) = %v, want %v", tt.group, tt.parent, got, tt.want)
+		}
+	}
+}
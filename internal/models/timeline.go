@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Types of timeline events
+const (
+	TimelineMotion   = "motion"
+	TimelineOffline  = "offline"
+	TimelineOnline   = "online"
+	TimelineGap      = "gap"
+	TimelineBookmark = "bookmark"
+	TimelineConfig   = "config"
+)
+
+// TimelineTypes lists every timeline event type
+var TimelineTypes = []string{
+	TimelineMotion,
+	TimelineOffline,
+	TimelineOnline,
+	TimelineGap,
+	TimelineBookmark,
+	TimelineConfig,
+}
+
+// TimelineEvent is something that happened on a stream, shown on the
+// playback timeline. Events with an End cover a period, the others a moment.
+type TimelineEvent struct {
+	ID      int64     `json:"id"`
+	Stream  string    `json:"stream"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	End     time.Time `json:"end,omitzero"`
+	Message string    `json:"message,omitempty"`
+	// Data holds details of the type, such as the clip of a motion event
+	Data      map[string]string `json:"data,omitempty"`
+	CreatedBy string            `json:"created_by,omitempty"`
+}
+
+// TimelineQuery selects timeline events. Zero fields match everything.
+type TimelineQuery struct {
+	Stream string
+	// Events overlapping From..To are returned
+	From, To time.Time
+	Types    []string
+	Limit    int
+}
+
+// RecordingGap is a period a stream set to record was not recorded
+type RecordingGap struct {
+	Stream string    `json:"stream"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Error  string    `json:"error,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Role         string    `json:"role"`             // "viewer", "operator" or "admin"
+	Groups       []string  `json:"groups,omitempty"` // stream groups a non-admin is limited to; empty means all
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// APIToken grants automation clients the role of the owning user.
+// Only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,142 @@
+package motion
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"web-tr/internal/models"
+)
+
+// Frames are analysed in grayscale at this size. Zones are fractions of the
+// frame, so the aspect ratio of the camera does not matter.
+const (
+	frameWidth  = 160
+	frameHeight = 120
+	frameSize   = frameWidth * frameHeight
+)
+
+const (
+	// pixelThreshold is the change of gray level that counts a pixel as changed
+	pixelThreshold = 25
+	// lightingChange is the share of the whole frame that changes when lights
+	// switch or the camera flips to night mode, which is not motion
+	lightingChange = 0.8
+	// backgroundTime is the time constant, in seconds, of the background
+	// following the picture. Slow changes such as daylight are not reported, and
+	// an object that stops or leaves settles into it within a few seconds.
+	backgroundTime = 2.0
+)
+
+// zoneMask lists the pixels of a zone in the analysed frame
+type zoneMask struct {
+	name   string
+	pixels []int32
+}
+
+// detector compares frames against a running average of the picture
+type detector struct {
+	zones []zoneMask
+	// threshold is the share of a zone's pixels that must change
+	threshold float64
+	// rate is the share of each frame blended into the background
+	rate       float32
+	background []float32
+	changed    []bool
+}
+
+func newDetector(cfg models.MotionConfig) *detector {
+	zones := cfg.Zones
+	if len(zones) == 0 {
+		zones = []models.MotionZone{{Name: "frame", Width: 1, Height: 1}}
+	}
+
+	d := &detector{
+		// Sensitivity 1 needs 10% of a zone to change, 100 needs 0.1%
+		threshold: float64(101-cfg.Sensitivity) / 1000,
+		rate:      float32(1 - math.Exp(-1/(float64(cfg.FPS)*backgroundTime))),
+		changed:   make([]bool, frameSize),
+	}
+	for _, z := range zones {
+		x0, x1 := span(z.X, z.Width, frameWidth)
+		y0, y1 := span(z.Y, z.Height, frameHeight)
+		m := zoneMask{name: z.Name}
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				m.pixels = append(m.pixels, int32(y*frameWidth+x))
+			}
+		}
+		if len(m.pixels) > 0 {
+			d.zones = append(d.zones, m)
+		}
+	}
+	return d
+}
+
+// span maps a zone's offset and length in fractions to pixels, covering at
+// least one pixel
+func span(offset, length float64, size int) (int, int) {
+	from := min(max(int(offset*float64(size)), 0), size-1)
+	to := min(int(math.Ceil((offset+length)*float64(size))), size)
+	return from, max(to, from+1)
+}
+
+// feed compares a frame with the background and returns the largest share of
+// changed pixels in a zone and the zones where it crossed the threshold
+func (d *detector) feed(frame []byte) (float64, []string) {
+	if d.background == nil {
+		d.background = make([]float32, frameSize)
+		d.reset(frame)
+		return 0, nil
+	}
+
+	total := 0
+	for i, v := range frame {
+		diff := float32(v) - d.background[i]
+		d.changed[i] = diff > pixelThreshold || diff < -pixelThreshold
+		if d.changed[i] {
+			total++
+		}
+		d.background[i] += diff * d.rate
+	}
+	if float64(total) > lightingChange*frameSize {
+		d.reset(frame)
+		return 0, nil
+	}
+
+	var score float64
+	var zones []string
+	for _, z := range d.zones {
+		n := 0
+		for _, i := range z.pixels {
+			if d.changed[i] {
+				n++
+			}
+		}
+		share := float64(n) / float64(len(z.pixels))
+		score = max(score, share)
+		if share >= d.threshold {
+			zones = append(zones, z.name)
+		}
+	}
+	return score, zones
+}
+
+func (d *detector) reset(frame []byte) {
+	for i, v := range frame {
+		d.background[i] = float32(v)
+	}
+}
+
+// grayFrame samples a decoded still down to the analysed size
+func grayFrame(img image.Image) []byte {
+	b := img.Bounds()
+	frame := make([]byte, frameSize)
+	for y := 0; y < frameHeight; y++ {
+		sy := b.Min.Y + (2*y+1)*b.Dy()/(2*frameHeight)
+		for x := 0; x < frameWidth; x++ {
+			sx := b.Min.X + (2*x+1)*b.Dx()/(2*frameWidth)
+			frame[y*frameWidth+x] = color.GrayModel.Convert(img.At(sx, sy)).(color.Gray).Y
+		}
+	}
+	return frame
+}
@@ -0,0 +1,107 @@
+package motion
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+	"web-tr/internal/models"
+)
+
+func TestSpan(t *testing.T) {
+	tests := []struct {
+		offset, length float64
+		from, to       int
+	}{
+		{0, 1, 0, 160},
+		{0.5, 0.25, 80, 120},
+		{0.999, 0.0001, 159, 160},
+		{-0.1, 0.2, 0, 16},
+		{0.9, 0.5, 144, 160},
+	}
+	for _, tt := range tests {
+		if from, to := span(tt.offset, tt.length, frameWidth); from != tt.from || to != tt.to {
+			t.Errorf("span(%v, %v) = %d, %d; want %d, %d", tt.offset, tt.length, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+// paint returns a gray frame with the rectangle x0,y0-x1,y1 set to white
+func paint(x0, y0, x1, y1 int) []byte {
+	f := make([]byte, frameSize)
+	for i := range f {
+		f[i] = 40
+	}
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			f[y*frameWidth+x] = 255
+		}
+	}
+	return f
+}
+
+func TestDetectorFeed(t *testing.T) {
+	cfg := models.MotionConfig{
+		FPS:         2,
+		Sensitivity: 91, // 1% of a zone
+		Zones: []models.MotionZone{
+			{Name: "door", X: 0, Y: 0, Width: 0.5, Height: 1},
+			{Name: "street", X: 0.5, Y: 0, Width: 0.5, Height: 1},
+		},
+	}
+	tests := []struct {
+		name      string
+		frame     []byte
+		wantZones []string
+	}{
+		{"still picture", paint(0, 0, 0, 0), nil},
+		{"object at the door", paint(10, 10, 30, 30), []string{"door"}},
+		{"object in both", paint(70, 10, 90, 30), []string{"door", "street"}},
+		{"a few noisy pixels", paint(100, 100, 102, 102), nil},
+		{"lights on", paint(0, 0, frameWidth, frameHeight), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDetector(cfg)
+			if score, zones := d.feed(paint(0, 0, 0, 0)); score != 0 || zones != nil {
+				t.Fatalf("the first frame reported motion: %v %v", score, zones)
+			}
+			score, zones := d.feed(tt.frame)
+			if !reflect.DeepEqual(zones, tt.wantZones) {
+				t.Errorf("zones = %v (score %v), want %v", zones, score, tt.wantZones)
+			}
+		})
+	}
+}
+
+func TestDetectorWholeFrameByDefault(t *testing.T) {
+	d := newDetector(models.MotionConfig{FPS: 1, Sensitivity: 100})
+	d.feed(paint(0, 0, 0, 0))
+	if _, zones := d.feed(paint(0, 0, 10, 10)); !reflect.DeepEqual(zones, []string{"frame"}) {
+		t.Errorf("zones = %v", zones)
+	}
+}
+
+func TestGrayFrame(t *testing.T) {
+	// Left half black, right half white, at twice the analysed size
+	img := image.NewGray(image.Rect(0, 0, 2*frameWidth, 2*frameHeight))
+	for y := 0; y < 2*frameHeight; y++ {
+		for x := frameWidth; x < 2*frameWidth; x++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+	f := grayFrame(img)
+	if len(f) != frameSize {
+		t.Fatalf("frame has %d pixels", len(f))
+	}
+	for _, x := range []int{0, frameWidth/2 - 1} {
+		if f[x] != 0 {
+			t.Errorf("pixel %d = %d, want black", x, f[x])
+		}
+	}
+	for _, x := range []int{frameWidth / 2, frameWidth - 1} {
+		if f[frameHeight/2*frameWidth+x] != 255 {
+			t.Errorf("pixel %d = %d, want white", x, f[x])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package motion
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// FileStore keeps motion settings in a local JSON file for File/YAML mode
+type FileStore struct {
+	FilePath string
+	mu       sync.Mutex
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() ([]models.MotionConfig, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []models.MotionConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+func (fs *FileStore) save(configs []models.MotionConfig) error {
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetMotionConfigs() ([]models.MotionConfig, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.load()
+}
+
+func (fs *FileStore) SaveMotionConfig(c models.MotionConfig) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	configs, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for i := range configs {
+		if configs[i].Stream == c.Stream {
+			configs[i] = c
+			return fs.save(configs)
+		}
+	}
+	return fs.save(append(configs, c))
+}
+
+func (fs *FileStore) RemoveMotionConfig(stream string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	configs, err := fs.load()
+	if err != nil {
+		return err
+	}
+	kept := configs[:0]
+	for _, c := range configs {
+		if c.Stream != stream {
+			kept = append(kept, c)
+		}
+	}
+	return fs.save(kept)
+}
@@ -0,0 +1,423 @@
+// Package motion watches streams for motion by frame differencing. Each event
+// is announced on the event hub and kept in the recording store with a
+// snapshot and, optionally, a clip with pre- and post-roll:
+//
+//	recordings/<stream>/motion/2006-01-02_15-04-05.json
+//	recordings/<stream>/motion/2006-01-02_15-04-05.jpg
+//	recordings/<stream>/motion/2006-01-02_15-04-05.mp4
+package motion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+	"web-tr/internal/snapshot"
+	"web-tr/internal/stream"
+)
+
+var (
+	ErrNotFound      = errors.New("motion detection is not set up for this stream")
+	ErrInvalidConfig = errors.New("invalid motion settings")
+	ErrUnknownStream = errors.New("stream not found")
+)
+
+// Limits of a MotionConfig
+const (
+	MaxFPS      = 10
+	MaxZones    = 16
+	MaxPreRoll  = 60
+	MaxPostRoll = 120
+)
+
+// Store is implemented by db.Store in DB mode and FileStore otherwise
+type Store interface {
+	GetMotionConfigs() ([]models.MotionConfig, error)
+	// SaveMotionConfig adds the config of a stream or replaces it
+	SaveMotionConfig(c models.MotionConfig) error
+	RemoveMotionConfig(stream string) error
+}
+
+// Streams finds a stream and the engine serving it, see stream.Manager
+type Streams interface {
+	Lookup(name string) (models.Stream, stream.Engine, bool)
+}
+
+// Frames is the snapshot pipeline, see snapshot.Service
+type Frames interface {
+	Get(ctx context.Context, name string, opts snapshot.Options) (*snapshot.Frame, error)
+}
+
+// Service keeps the motion settings and runs a detector for every stream
+// with detection enabled
+type Service struct {
+	Store   Store
+	Streams Streams
+	Frames  Frames
+	Events  *events.Hub
+	// Dir is the recording store, events are kept in <stream>/motion
+	Dir string
+	// BufferDir holds the short segments clips are cut from
+	BufferDir string
+	FFmpeg    string
+
+	mu      sync.Mutex
+	runners map[string]*runner
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// runner is the detector of one stream
+type runner struct {
+	cfg    models.MotionConfig
+	source string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewService(store Store, streams Streams, frames Frames, dir string) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		Store:     store,
+		Streams:   streams,
+		Frames:    frames,
+		Dir:       dir,
+		BufferDir: "motion-buffer",
+		FFmpeg:    stream.FindBinary("ffmpeg"),
+		runners:   make(map[string]*runner),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Defaults returns the settings offered for a stream without any
+func Defaults(name string) models.MotionConfig {
+	return models.MotionConfig{
+		Stream:      name,
+		Source:      models.MotionSourceFFmpeg,
+		FPS:         2,
+		Sensitivity: 50,
+		Clips:       true,
+		PreRoll:     5,
+		PostRoll:    5,
+	}
+}
+
+func validate(c *models.MotionConfig) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...))
+	}
+
+	switch c.Source {
+	case "":
+		c.Source = models.MotionSourceFFmpeg
+	case models.MotionSourceFFmpeg, models.MotionSourceFrames:
+	default:
+		return invalid("unknown source '%s'", c.Source)
+	}
+	if c.FPS == 0 {
+		c.FPS = 2
+	}
+	if c.FPS < 1 || c.FPS > MaxFPS {
+		return invalid("fps must be between 1 and %d", MaxFPS)
+	}
+	if c.Sensitivity == 0 {
+		c.Sensitivity = 50
+	}
+	if c.Sensitivity < 1 || c.Sensitivity > 100 {
+		return invalid("sensitivity must be between 1 and 100")
+	}
+	if c.PreRoll < 0 || c.PreRoll > MaxPreRoll {
+		return invalid("pre-roll must be between 0 and %d seconds", MaxPreRoll)
+	}
+	if c.PostRoll < 0 || c.PostRoll > MaxPostRoll {
+		return invalid("post-roll must be between 0 and %d seconds", MaxPostRoll)
+	}
+
+	if len(c.Zones) > MaxZones {
+		return invalid("at most %d zones", MaxZones)
+	}
+	for i := range c.Zones {
+		z := &c.Zones[i]
+		z.Name = strings.TrimSpace(z.Name)
+		if z.Name == "" {
+			z.Name = fmt.Sprintf("Zone %d", i+1)
+		}
+		// A little slack for rounding in the zone editor
+		const slack = 1e-6
+		if z.X < 0 || z.Y < 0 || z.Width <= 0 || z.Height <= 0 || z.X+z.Width > 1+slack || z.Y+z.Height > 1+slack {
+			return invalid("zone '%s' must lie within the frame", z.Name)
+		}
+	}
+	return nil
+}
+
+// List returns the settings of all streams that have any
+func (s *Service) List() ([]models.MotionConfig, error) {
+	configs, err := s.Store.GetMotionConfigs()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Stream < configs[j].Stream })
+	return configs, nil
+}
+
+func (s *Service) Get(name string) (*models.MotionConfig, error) {
+	configs, err := s.Store.GetMotionConfigs()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if c.Stream == name {
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Set validates and stores the settings of c.Stream and restarts its detector
+func (s *Service) Set(c models.MotionConfig) (*models.MotionConfig, error) {
+	if _, _, found := s.Streams.Lookup(c.Stream); !found {
+		return nil, ErrUnknownStream
+	}
+	if err := validate(&c); err != nil {
+		return nil, err
+	}
+	c.UpdatedAt = time.Now().UTC()
+	if err := s.Store.SaveMotionConfig(c); err != nil {
+		return nil, err
+	}
+	s.refresh()
+	return &c, nil
+}
+
+func (s *Service) Remove(name string) error {
+	if _, err := s.Get(name); err != nil {
+		return err
+	}
+	if err := s.Store.RemoveMotionConfig(name); err != nil {
+		return err
+	}
+	s.refresh()
+	return nil
+}
+
+// Start runs the detectors and follows stream changes on the hub until Stop
+// is called. Renamed streams keep their settings; deleted ones lose them.
+func (s *Service) Start(hub *events.Hub) {
+	s.Events = hub
+	ch := hub.Queue()
+	s.refresh()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer hub.Unsubscribe(ch)
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case ev := <-ch:
+				switch ev.Type {
+				case events.StreamAdded, events.StreamUpdated, events.StreamDeleted:
+					s.followStream(ev)
+					s.refresh()
+				case events.StreamsChanged:
+					for _, ev := range events.Expand(ev) {
+						s.followStream(ev)
+					}
+					s.refresh()
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the detectors. Events in progress are closed and their clips cut
+// from the segments buffered so far.
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	s.sync(nil)
+}
+
+// followStream moves or drops the settings of a renamed or deleted stream
+func (s *Service) followStream(ev events.Event) {
+	data, _ := ev.Data.(map[string]interface{})
+	name, _ := data["name"].(string)
+	oldName, _ := data["originalName"].(string)
+
+	var err error
+	switch {
+	case ev.Type == events.StreamDeleted:
+		if _, found := s.get(name); found {
+			err = s.Store.RemoveMotionConfig(name)
+		}
+	case ev.Type == events.StreamUpdated && oldName != "":
+		if c, found := s.get(oldName); found {
+			c.Stream = name
+			if err = s.Store.SaveMotionConfig(c); err == nil {
+				err = s.Store.RemoveMotionConfig(oldName)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[Motion] Failed to update the settings of %s: %v", name, err)
+	}
+}
+
+func (s *Service) get(name string) (models.MotionConfig, bool) {
+	c, err := s.Get(name)
+	if err != nil {
+		return models.MotionConfig{}, false
+	}
+	return *c, true
+}
+
+// refresh aligns the detectors with the stored settings
+func (s *Service) refresh() {
+	if s.ctx.Err() != nil {
+		return
+	}
+	configs, err := s.Store.GetMotionConfigs()
+	if err != nil {
+		log.Printf("[Motion] Failed to load settings: %v", err)
+		return
+	}
+	s.sync(configs)
+}
+
+// sync starts detectors for enabled streams and stops the others. A detector
+// whose settings or source changed is restarted.
+func (s *Service) sync(configs []models.MotionConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type want struct {
+		cfg    models.MotionConfig
+		source string
+	}
+	wanted := make(map[string]want)
+	for _, c := range configs {
+		if !c.Enabled {
+			continue
+		}
+		if _, engine, found := s.Streams.Lookup(c.Stream); found {
+			wanted[c.Stream] = want{cfg: c, source: engine.RTSPURL(c.Stream)}
+		}
+	}
+
+	for name, r := range s.runners {
+		if w, ok := wanted[name]; !ok || w.source != r.source || !reflect.DeepEqual(w.cfg, r.cfg) {
+			log.Printf("[Motion] Stopping detection on %s", name)
+			r.cancel()
+			<-r.done
+			delete(s.runners, name)
+		}
+	}
+
+	for name, w := range wanted {
+		if _, running := s.runners[name]; running {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &runner{cfg: w.cfg, source: w.source, cancel: cancel, done: make(chan struct{})}
+		s.runners[name] = r
+		log.Printf("[Motion] Watching %s at %d fps", name, w.cfg.FPS)
+		go s.run(ctx, r)
+	}
+}
+
+// Detecting reports whether a detector is running on the stream
+func (s *Service) Detecting(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.runners[name]
+	return ok
+}
+
+// eventDir returns the directory of a stream's events in the recording store
+func (s *Service) eventDir(name string) string {
+	return filepath.Join(s.Dir, stream.SafeDirName(name), "motion")
+}
+
+// fileURL returns the URL of an event file served from the recording store
+func fileURL(name, file string) string {
+	return "/recordings/" + url.PathEscape(stream.SafeDirName(name)) + "/motion/" + url.PathEscape(file)
+}
+
+// withFiles fills in the URLs of the event's snapshot and clip that exist
+func (s *Service) withFiles(ev models.MotionEvent) models.MotionEvent {
+	dir := s.eventDir(ev.Stream)
+	ev.Snapshot, ev.Clip = "", ""
+	ev.Locked = stream.Locked(filepath.Join(dir, ev.ID+".json"))
+	if _, err := os.Stat(filepath.Join(dir, ev.ID+".jpg")); err == nil {
+		ev.Snapshot = fileURL(ev.Stream, ev.ID+".jpg")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ev.ID+".mp4")); err == nil {
+		ev.Clip = fileURL(ev.Stream, ev.ID+".mp4")
+	}
+	return ev
+}
+
+// EventsOf returns the motion events kept for a stream, oldest first
+func (s *Service) EventsOf(name string) ([]models.MotionEvent, error) {
+	entries, err := os.ReadDir(s.eventDir(name))
+	if os.IsNotExist(err) {
+		return []models.MotionEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := []models.MotionEvent{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.eventDir(name), e.Name()))
+		if err != nil {
+			continue
+		}
+		var ev models.MotionEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			continue
+		}
+		// The directory, not the file, tells which stream an event belongs to
+		// after a rename
+		ev.Stream = name
+		list = append(list, s.withFiles(ev))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+	return list, nil
+}
+
+// saveEvent writes the event file, replacing it as the event goes on
+func (s *Service) saveEvent(ev models.MotionEvent) error {
+	dir := s.eventDir(ev.Stream)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ev.Snapshot, ev.Clip, ev.Locked = "", "", false
+	data, err := json.MarshalIndent(ev, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, ev.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
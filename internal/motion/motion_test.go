@@ -0,0 +1,235 @@
+package motion
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+	"web-tr/internal/snapshot"
+	"web-tr/internal/stream"
+)
+
+type fakeEngine struct{ stream.Engine }
+
+func (fakeEngine) RTSPURL(name string) string { return "rtsp://127.0.0.1:8554/" + name }
+
+type fakeStreams []string
+
+func (f fakeStreams) Lookup(name string) (models.Stream, stream.Engine, bool) {
+	for _, n := range f {
+		if n == name {
+			return models.Stream{Name: name}, fakeEngine{}, true
+		}
+	}
+	return models.Stream{}, nil, false
+}
+
+type fakeFrames struct{}
+
+func (fakeFrames) Get(ctx context.Context, name string, opts snapshot.Options) (*snapshot.Frame, error) {
+	return &snapshot.Frame{JPEG: []byte{0xFF, 0xD8, 0xFF, 0xD9}, Time: time.Now()}, nil
+}
+
+func newTestService(t *testing.T, streams ...string) *Service {
+	t.Helper()
+	dir := t.TempDir()
+	s := NewService(NewFileStore(filepath.Join(dir, "motion.json")), fakeStreams(streams), fakeFrames{}, filepath.Join(dir, "recordings"))
+	s.BufferDir = filepath.Join(dir, "buffer")
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       models.MotionConfig
+		wantErr string
+	}{
+		{"defaults", models.MotionConfig{}, ""},
+		{"zones named", models.MotionConfig{Zones: []models.MotionZone{{X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5}}}, ""},
+		{"source", models.MotionConfig{Source: "onvif"}, "unknown source"},
+		{"fps", models.MotionConfig{FPS: MaxFPS + 1}, "fps"},
+		{"sensitivity", models.MotionConfig{Sensitivity: 101}, "sensitivity"},
+		{"pre-roll", models.MotionConfig{PreRoll: -1}, "pre-roll"},
+		{"post-roll", models.MotionConfig{PostRoll: MaxPostRoll + 1}, "post-roll"},
+		{"too many zones", models.MotionConfig{Zones: make([]models.MotionZone, MaxZones+1)}, "at most"},
+		{"zone outside", models.MotionConfig{Zones: []models.MotionZone{{Name: "gate", X: 0.6, Width: 0.5, Height: 1}}}, "'gate' must lie within"},
+		{"empty zone", models.MotionConfig{Zones: []models.MotionZone{{Width: 0, Height: 1}}}, "'Zone 1' must lie within"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			err := validate(&c)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.Source != models.MotionSourceFFmpeg || c.FPS != 2 || c.Sensitivity != 50 {
+					t.Errorf("defaults = %+v", c)
+				}
+				for i, z := range c.Zones {
+					if z.Name == "" {
+						t.Errorf("zone %d has no name", i)
+					}
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSettingsFollowStreams(t *testing.T) {
+	s := newTestService(t, "yard", "door")
+	for _, name := range []string{"yard", "door"} {
+		if _, err := s.Set(models.MotionConfig{Stream: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Set(models.MotionConfig{Stream: "nowhere"}); err != ErrUnknownStream {
+		t.Errorf("Set on an unknown stream = %v", err)
+	}
+
+	s.followStream(events.Event{Type: events.StreamUpdated, Data: map[string]interface{}{"name": "garden", "originalName": "yard"}})
+	s.followStream(events.Event{Type: events.StreamDeleted, Data: map[string]interface{}{"name": "door"}})
+
+	configs, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Stream != "garden" {
+		t.Errorf("configs = %+v, want only garden", configs)
+	}
+	if err := s.Remove("door"); err != ErrNotFound {
+		t.Errorf("Remove of a dropped config = %v", err)
+	}
+}
+
+func TestSyncRunsEnabledStreams(t *testing.T) {
+	s := newTestService(t, "yard", "door")
+	s.FFmpeg = "/nonexistent/ffmpeg"
+	defer s.Stop()
+
+	s.sync([]models.MotionConfig{
+		{Stream: "yard", Enabled: true, FPS: 1},
+		{Stream: "door", FPS: 1},
+		{Stream: "gone", Enabled: true, FPS: 1},
+	})
+	if !s.Detecting("yard") || s.Detecting("door") || s.Detecting("gone") {
+		t.Errorf("detecting yard %v, door %v, gone %v", s.Detecting("yard"), s.Detecting("door"), s.Detecting("gone"))
+	}
+	s.sync(nil)
+	if s.Detecting("yard") {
+		t.Error("yard is still watched")
+	}
+}
+
+// fakeFFmpeg writes a script that stores the concat list as the clip
+func fakeFFmpeg(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\nlist=\nfor a; do\n  [ \"$prev\" = -i ] && list=$a\n  prev=$a\n  out=$a\ndone\ncp \"$list\" \"$out\"\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWatcherRecordsEvents(t *testing.T) {
+	s := newTestService(t, "yard")
+	s.FFmpeg = fakeFFmpeg(t)
+	hub := events.NewHub()
+	s.Events = hub
+	ch := hub.Queue()
+	defer hub.Unsubscribe(ch)
+
+	// At 10 fps the background barely follows a single frame
+	cfg := models.MotionConfig{Stream: "yard", FPS: 10, Sensitivity: 91, Clips: true, PreRoll: 2, PostRoll: 4}
+	w := &watcher{s: s, cfg: cfg, det: newDetector(cfg), bufferDir: filepath.Join(s.BufferDir, "yard")}
+	if err := os.MkdirAll(w.bufferDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+	// Buffered segments every 2s around the event
+	for i := -6; i <= 12; i += 2 {
+		name := start.Add(time.Duration(i)*time.Second).Format(eventLayout) + ".ts"
+		if err := os.WriteFile(filepath.Join(w.bufferDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	still, moving := paint(0, 0, 0, 0), paint(10, 10, 40, 40)
+	w.frame(frame{start.Add(-time.Second), still})
+	w.frame(frame{start, moving})
+	if w.active != nil {
+		t.Fatal("a single frame with motion started an event")
+	}
+	w.frame(frame{start.Add(time.Second), still})
+	w.frame(frame{start.Add(2 * time.Second), moving})
+	w.frame(frame{start.Add(3 * time.Second), paint(50, 50, 80, 80)})
+	if w.active == nil {
+		t.Fatal("two frames with motion started no event")
+	}
+
+	w.tick(start.Add(7 * time.Second))
+	if w.active == nil {
+		t.Fatal("the event ended before the quiet period")
+	}
+	w.tick(start.Add(8 * time.Second))
+	if w.active != nil || len(w.pending) != 1 {
+		t.Fatalf("active %v, pending %d after the quiet period", w.active, len(w.pending))
+	}
+	// The clip waits for its post-roll and the segment being written then
+	w.tick(start.Add(8500 * time.Millisecond))
+	if len(w.pending) != 1 {
+		t.Fatal("the clip was cut before its post-roll was buffered")
+	}
+	w.tick(start.Add(9 * time.Second))
+	if len(w.pending) != 0 {
+		t.Fatal("the clip was not cut")
+	}
+	w.close()
+
+	list, err := s.EventsOf("yard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("events = %+v", list)
+	}
+	ev := list[0]
+	id := start.Add(3 * time.Second).Format(eventLayout)
+	if ev.ID != id || !ev.End.Equal(start.Add(3*time.Second).UTC()) || !reflect.DeepEqual(ev.Zones, []string{"frame"}) {
+		t.Errorf("event = %+v", ev)
+	}
+	if ev.Snapshot != "/recordings/yard/motion/"+id+".jpg" || ev.Clip != "/recordings/yard/motion/"+id+".mp4" {
+		t.Errorf("files = %q, %q", ev.Snapshot, ev.Clip)
+	}
+
+	// Segments from 2s before the pre-roll to the end of the post-roll
+	clip, _ := os.ReadFile(filepath.Join(s.eventDir("yard"), id+".mp4"))
+	var want strings.Builder
+	want.WriteString("ffconcat version 1.0\n")
+	for i := 0; i <= 6; i += 2 {
+		want.WriteString("file '" + start.Add(time.Duration(i)*time.Second).Format(eventLayout) + ".ts'\n")
+	}
+	if string(clip) != want.String() {
+		t.Errorf("clip list:\n%s\nwant:\n%s", clip, want.String())
+	}
+
+	var types []string
+	for len(ch) > 0 {
+		types = append(types, (<-ch).Type)
+	}
+	if !reflect.DeepEqual(types, []string{events.MotionStarted, events.MotionEnded}) {
+		t.Errorf("announced %v", types)
+	}
+}
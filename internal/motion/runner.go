@@ -0,0 +1,429 @@
+package motion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+	"web-tr/internal/snapshot"
+	"web-tr/internal/stream"
+)
+
+const (
+	// eventLayout names the files of an event after its start
+	eventLayout = "2006-01-02_15-04-05"
+	// segmentDuration is the length of the buffered segments clips are cut from
+	segmentDuration = 2 * time.Second
+	// minHits is the number of frames in a row with motion that start an event,
+	// a single noisy frame does not
+	minHits = 2
+	// quietPeriod without motion ends an event
+	quietPeriod = 5 * time.Second
+	// restartDelay is the pause before a failed feed is started again
+	restartDelay = 5 * time.Second
+)
+
+// frame is one analysed picture of the feed
+type frame struct {
+	time time.Time
+	gray []byte
+}
+
+// watcher follows the frames of one stream and turns them into events. It is
+// only used from the runner's goroutine.
+type watcher struct {
+	s         *Service
+	cfg       models.MotionConfig
+	det       *detector
+	bufferDir string
+
+	hits       int
+	active     *models.MotionEvent
+	lastMotion time.Time
+	// pending events ended but wait for their post-roll to be buffered
+	pending   []models.MotionEvent
+	lastPrune time.Time
+	// snapshots are saved in the background, the feed must keep flowing
+	snapshots sync.WaitGroup
+}
+
+func (s *Service) run(ctx context.Context, r *runner) {
+	defer close(r.done)
+
+	w := &watcher{
+		s:         s,
+		cfg:       r.cfg,
+		det:       newDetector(r.cfg),
+		bufferDir: filepath.Join(s.BufferDir, stream.SafeDirName(r.cfg.Stream)),
+	}
+	// Segments left by an earlier run are of no use
+	os.RemoveAll(w.bufferDir)
+	if r.cfg.Clips {
+		if err := os.MkdirAll(w.bufferDir, 0755); err != nil {
+			log.Printf("[Motion] Cannot create %s, recording no clips: %v", w.bufferDir, err)
+			w.cfg.Clips = false
+		}
+	}
+
+	var feeds sync.WaitGroup
+	frames := make(chan frame, 4)
+	if w.cfg.Source == models.MotionSourceFrames {
+		feeds.Add(1)
+		go func() {
+			defer feeds.Done()
+			s.keepRunning(ctx, r.cfg.Stream, "frame feed", func() error { return s.pollFrames(ctx, r.cfg, frames) })
+		}()
+		if w.cfg.Clips {
+			feeds.Add(1)
+			go func() {
+				defer feeds.Done()
+				s.keepRunning(ctx, r.cfg.Stream, "clip buffer", func() error { return s.decode(ctx, r.source, w.bufferDir, 0, nil) })
+			}()
+		}
+	} else {
+		bufferDir := ""
+		if w.cfg.Clips {
+			bufferDir = w.bufferDir
+		}
+		feeds.Add(1)
+		go func() {
+			defer feeds.Done()
+			s.keepRunning(ctx, r.cfg.Stream, "ffmpeg feed", func() error { return s.decode(ctx, r.source, bufferDir, r.cfg.FPS, frames) })
+		}()
+	}
+
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			feeds.Wait()
+			w.close()
+			return
+		case f := <-frames:
+			w.frame(f)
+		case now := <-tick.C:
+			w.tick(now)
+		}
+	}
+}
+
+// keepRunning calls feed again after it fails until ctx is done
+func (s *Service) keepRunning(ctx context.Context, name, what string, feed func() error) {
+	for {
+		err := feed()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[Motion] %s of %s stopped (%v), restarting in %s", what, name, err, restartDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// decode runs ffmpeg on the engine's restream. With fps set it sends gray
+// frames of the analysed size to out; with bufferDir set it also writes short
+// segments for clips there. One connection serves both.
+func (s *Service) decode(ctx context.Context, source, bufferDir string, fps int, out chan<- frame) error {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if strings.HasPrefix(source, "rtsp") {
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	args = append(args, "-i", source)
+	if bufferDir != "" {
+		args = append(args,
+			"-map", "0:v:0",
+			"-map", "0:a?",
+			"-c:v", "copy",
+			"-c:a", "aac",
+			"-f", "segment",
+			"-segment_time", strconv.Itoa(int(segmentDuration.Seconds())),
+			"-reset_timestamps", "1",
+			"-strftime", "1",
+			filepath.Join(bufferDir, "%Y-%m-%d_%H-%M-%S.ts"),
+		)
+	}
+	if fps > 0 {
+		args = append(args,
+			"-map", "0:v:0",
+			"-vf", fmt.Sprintf("fps=%d,scale=%d:%d,format=gray", fps, frameWidth, frameHeight),
+			"-f", "rawvideo",
+			"-pix_fmt", "gray",
+			"pipe:1",
+		)
+	}
+
+	cmd := exec.CommandContext(ctx, s.FFmpeg, args...)
+	cmd.Stderr = os.Stderr
+	if fps == 0 {
+		return cmd.Run()
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	for {
+		buf := make([]byte, frameSize)
+		if _, err := io.ReadFull(stdout, buf); err != nil {
+			break
+		}
+		select {
+		case out <- frame{time: time.Now(), gray: buf}:
+		case <-ctx.Done():
+		}
+	}
+	return cmd.Wait()
+}
+
+// pollFrames analyses stills from the snapshot service, which asks the engine
+// first and falls back to ffmpeg
+func (s *Service) pollFrames(ctx context.Context, cfg models.MotionConfig, out chan<- frame) error {
+	period := time.Second / time.Duration(cfg.FPS)
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		f, err := s.Frames.Get(ctx, cfg.Stream, snapshot.Options{MaxAge: period / 2})
+		if err != nil {
+			return err
+		}
+		img, err := jpeg.Decode(bytes.NewReader(f.JPEG))
+		if err != nil {
+			return err
+		}
+		select {
+		case out <- frame{time: f.Time, gray: grayFrame(img)}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (w *watcher) frame(f frame) {
+	score, zones := w.det.feed(f.gray)
+	if len(zones) == 0 {
+		w.hits = 0
+		return
+	}
+	w.hits++
+
+	if w.active == nil {
+		if w.hits < minHits {
+			return
+		}
+		w.start(f.time, score, zones)
+	}
+	w.lastMotion = f.time
+	w.active.Score = max(w.active.Score, score)
+	for _, z := range zones {
+		if !contains(w.active.Zones, z) {
+			w.active.Zones = append(w.active.Zones, z)
+		}
+	}
+}
+
+func (w *watcher) tick(now time.Time) {
+	if w.active != nil && now.Sub(w.lastMotion) >= quietPeriod {
+		w.end()
+	}
+
+	// A clip is cut once its post-roll, and the segment being written then, are buffered
+	kept := w.pending[:0]
+	for _, ev := range w.pending {
+		if now.Before(ev.End.Add(time.Duration(w.cfg.PostRoll)*time.Second + segmentDuration)) {
+			kept = append(kept, ev)
+			continue
+		}
+		w.cutClip(ev)
+	}
+	w.pending = kept
+
+	if w.cfg.Clips && now.Sub(w.lastPrune) >= 10*time.Second {
+		w.pruneBuffer(now)
+		w.lastPrune = now
+	}
+}
+
+// close ends an event in progress and cuts the pending clips with what is buffered
+func (w *watcher) close() {
+	if w.active != nil {
+		w.end()
+	}
+	for _, ev := range w.pending {
+		w.cutClip(ev)
+	}
+	w.pending = nil
+	w.snapshots.Wait()
+}
+
+func (w *watcher) start(t time.Time, score float64, zones []string) {
+	name := w.cfg.Stream
+	w.active = &models.MotionEvent{
+		ID:     t.Local().Format(eventLayout),
+		Stream: name,
+		Start:  t.UTC(),
+		Zones:  zones,
+		Score:  score,
+	}
+	if err := w.s.saveEvent(*w.active); err != nil {
+		log.Printf("[Motion] Failed to save event of %s: %v", name, err)
+	}
+
+	// The snapshot URL is announced right away, the file follows shortly
+	ev := *w.active
+	ev.Snapshot = fileURL(name, ev.ID+".jpg")
+	w.s.Events.Publish(events.MotionStarted, ev)
+
+	path := filepath.Join(w.s.eventDir(name), ev.ID+".jpg")
+	w.snapshots.Add(1)
+	go func() {
+		defer w.snapshots.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		f, err := w.s.Frames.Get(ctx, name, snapshot.Options{MaxAge: time.Second})
+		if err == nil {
+			err = os.WriteFile(path, f.JPEG, 0644)
+		}
+		if err != nil {
+			log.Printf("[Motion] No snapshot of the event on %s: %v", name, err)
+		}
+	}()
+}
+
+func (w *watcher) end() {
+	ev := *w.active
+	w.active = nil
+	w.hits = 0
+	ev.End = w.lastMotion.UTC()
+	if err := w.s.saveEvent(ev); err != nil {
+		log.Printf("[Motion] Failed to save event of %s: %v", ev.Stream, err)
+	}
+	log.Printf("[Motion] Motion on %s from %s for %s in %s", ev.Stream, ev.Start.Local().Format(time.TimeOnly), ev.End.Sub(ev.Start).Round(time.Second), strings.Join(ev.Zones, ", "))
+	w.s.Events.Publish(events.MotionEnded, w.s.withFiles(ev))
+
+	if w.cfg.Clips {
+		w.pending = append(w.pending, ev)
+	}
+}
+
+// segments returns the buffered segments by start time, oldest first
+func (w *watcher) segments() ([]string, []time.Time) {
+	entries, err := os.ReadDir(w.bufferDir)
+	if err != nil {
+		return nil, nil
+	}
+	var names []string
+	var times []time.Time
+	for _, e := range entries {
+		t, err := time.ParseInLocation(eventLayout, strings.TrimSuffix(e.Name(), ".ts"), time.Local)
+		if err != nil || !strings.HasSuffix(e.Name(), ".ts") {
+			continue
+		}
+		names = append(names, e.Name())
+		times = append(times, t)
+	}
+	return names, times
+}
+
+// pruneBuffer deletes the segments no event in progress or pending needs
+func (w *watcher) pruneBuffer(now time.Time) {
+	preRoll := time.Duration(w.cfg.PreRoll) * time.Second
+	horizon := now.Add(-preRoll - 2*segmentDuration)
+	if w.active != nil && w.active.Start.Add(-preRoll-segmentDuration).Before(horizon) {
+		horizon = w.active.Start.Add(-preRoll - segmentDuration)
+	}
+	for _, ev := range w.pending {
+		if ev.Start.Add(-preRoll - segmentDuration).Before(horizon) {
+			horizon = ev.Start.Add(-preRoll - segmentDuration)
+		}
+	}
+
+	names, times := w.segments()
+	for i, t := range times {
+		if t.Before(horizon) {
+			os.Remove(filepath.Join(w.bufferDir, names[i]))
+		}
+	}
+}
+
+// cutClip joins the buffered segments covering an event with its pre- and
+// post-roll into an MP4 next to the event
+func (w *watcher) cutClip(ev models.MotionEvent) {
+	from := ev.Start.Add(-time.Duration(w.cfg.PreRoll)*time.Second - segmentDuration)
+	to := ev.End.Add(time.Duration(w.cfg.PostRoll) * time.Second)
+
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	n := 0
+	names, times := w.segments()
+	for i, t := range times {
+		if !t.Before(from) && !t.After(to) {
+			fmt.Fprintf(&list, "file '%s'\n", names[i])
+			n++
+		}
+	}
+	if n == 0 {
+		log.Printf("[Motion] No video buffered for the event on %s at %s", ev.Stream, ev.ID)
+		return
+	}
+
+	// The list sits with the segments, its file names are relative to it
+	listPath := filepath.Join(w.bufferDir, ev.ID+".txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		log.Printf("[Motion] Failed to cut clip of %s: %v", ev.Stream, err)
+		return
+	}
+	defer os.Remove(listPath)
+
+	// Written aside and renamed, so a download never gets half a clip
+	dir := w.s.eventDir(ev.Stream)
+	tmp := filepath.Join(dir, "."+ev.ID+".mp4")
+	cmd := exec.Command(w.s.FFmpeg, "-hide_banner", "-loglevel", "error", "-y",
+		"-f", "concat", "-safe", "0", "-i", listPath,
+		"-c", "copy", "-movflags", "+faststart", tmp)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(dir, ev.ID+".mp4"))
+	} else if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		lines := strings.Split(msg, "\n")
+		err = fmt.Errorf("%s", lines[len(lines)-1])
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("[Motion] Failed to cut clip of %s: %v", ev.Stream, err)
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
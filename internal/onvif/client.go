@@ -0,0 +1,224 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrUnauthorized = errors.New("camera rejected the credentials")
+
+const (
+	deviceNS = "http://www.onvif.org/ver10/device/wsdl"
+	mediaNS  = "http://www.onvif.org/ver10/media/wsdl"
+	schemaNS = "http://www.onvif.org/ver10/schema"
+)
+
+// Client talks SOAP to one ONVIF device, authenticating with a WS-Security UsernameToken
+type Client struct {
+	XAddr    string
+	Username string
+	Password string
+	HTTP     *http.Client
+
+	// offset is the camera clock minus ours; the token timestamp must match the camera's clock
+	offset time.Duration
+}
+
+func NewClient(xaddr, username, password string) *Client {
+	return &Client{
+		XAddr:    xaddr,
+		Username: username,
+		Password: password,
+		HTTP:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+type envelope struct {
+	Body struct {
+		Fault *struct {
+			Code   string `xml:"Code>Subcode>Value"`
+			Reason string `xml:"Reason>Text"`
+		} `xml:"Fault"`
+		Content []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+func (c *Client) security() string {
+	if c.Username == "" {
+		return ""
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := time.Now().Add(c.offset).UTC().Format("2006-01-02T15:04:05Z")
+
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(c.Password))
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	var user bytes.Buffer
+	xml.EscapeText(&user, []byte(c.Username))
+
+	return `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">` +
+		`<UsernameToken><Username>` + user.String() + `</Username>` +
+		`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` + digest + `</Password>` +
+		`<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">` + base64.StdEncoding.EncodeToString(nonce) + `</Nonce>` +
+		`<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` + created + `</Created>` +
+		`</UsernameToken></Security>`
+}
+
+// call posts one SOAP request and decodes the element inside the response body into out
+func (c *Client) call(ctx context.Context, endpoint, body string, auth bool, out interface{}) error {
+	header := ""
+	if auth {
+		header = c.security()
+	}
+	payload := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Header>` + header + `</s:Header>` +
+		`<s:Body>` + body + `</s:Body></s:Envelope>`
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+
+	var env envelope
+	if err := xml.Unmarshal(data, &env); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("device returned status %d", resp.StatusCode)
+		}
+		return fmt.Errorf("invalid SOAP response: %w", err)
+	}
+	if f := env.Body.Fault; f != nil {
+		if strings.Contains(f.Code, "NotAuthorized") || strings.Contains(f.Code, "FailedAuthentication") {
+			return ErrUnauthorized
+		}
+		return fmt.Errorf("device fault: %s", strings.TrimSpace(f.Reason+" "+f.Code))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("device returned status %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return xml.Unmarshal(env.Body.Content, out)
+}
+
+// SyncClock reads the camera's UTC time so tokens are accepted by cameras with a wrong clock
+func (c *Client) SyncClock(ctx context.Context) error {
+	var resp struct {
+		UTC struct {
+			Year   int `xml:"Date>Year"`
+			Month  int `xml:"Date>Month"`
+			Day    int `xml:"Date>Day"`
+			Hour   int `xml:"Time>Hour"`
+			Minute int `xml:"Time>Minute"`
+			Second int `xml:"Time>Second"`
+		} `xml:"SystemDateAndTime>UTCDateTime"`
+	}
+	if err := c.call(ctx, c.XAddr, `<GetSystemDateAndTime xmlns="`+deviceNS+`"/>`, false, &resp); err != nil {
+		return err
+	}
+	u := resp.UTC
+	if u.Year == 0 {
+		return nil
+	}
+	camera := time.Date(u.Year, time.Month(u.Month), u.Day, u.Hour, u.Minute, u.Second, 0, time.UTC)
+	c.offset = time.Until(camera)
+	return nil
+}
+
+type DeviceInfo struct {
+	Manufacturer string `xml:"Manufacturer"`
+	Model        string `xml:"Model"`
+	Firmware     string `xml:"FirmwareVersion"`
+	Serial       string `xml:"SerialNumber"`
+}
+
+func (c *Client) GetDeviceInformation(ctx context.Context) (*DeviceInfo, error) {
+	var info DeviceInfo
+	if err := c.call(ctx, c.XAddr, `<GetDeviceInformation xmlns="`+deviceNS+`"/>`, true, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// MediaXAddr returns the media service URL, falling back to the device service URL
+func (c *Client) MediaXAddr(ctx context.Context) (string, error) {
+	var resp struct {
+		XAddr string `xml:"Capabilities>Media>XAddr"`
+	}
+	body := `<GetCapabilities xmlns="` + deviceNS + `"><Category>Media</Category></GetCapabilities>`
+	if err := c.call(ctx, c.XAddr, body, true, &resp); err != nil {
+		return "", err
+	}
+	if x := strings.TrimSpace(resp.XAddr); x != "" {
+		return x, nil
+	}
+	return c.XAddr, nil
+}
+
+type mediaProfile struct {
+	Token   string `xml:"token,attr"`
+	Name    string `xml:"Name"`
+	Encoder *struct {
+		Encoding  string  `xml:"Encoding"`
+		Width     int     `xml:"Resolution>Width"`
+		Height    int     `xml:"Resolution>Height"`
+		FrameRate float64 `xml:"RateControl>FrameRateLimit"`
+		Bitrate   int     `xml:"RateControl>BitrateLimit"`
+	} `xml:"VideoEncoderConfiguration"`
+}
+
+func (c *Client) GetProfiles(ctx context.Context, mediaXAddr string) ([]mediaProfile, error) {
+	var resp struct {
+		Profiles []mediaProfile `xml:"Profiles"`
+	}
+	if err := c.call(ctx, mediaXAddr, `<GetProfiles xmlns="`+mediaNS+`"/>`, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Profiles, nil
+}
+
+// GetStreamUri asks for the RTSP URL of a profile
+func (c *Client) GetStreamUri(ctx context.Context, mediaXAddr, profileToken string) (string, error) {
+	var token bytes.Buffer
+	xml.EscapeText(&token, []byte(profileToken))
+	body := `<GetStreamUri xmlns="` + mediaNS + `"><StreamSetup>` +
+		`<Stream xmlns="` + schemaNS + `">RTP-Unicast</Stream>` +
+		`<Transport xmlns="` + schemaNS + `"><Protocol>RTSP</Protocol></Transport>` +
+		`</StreamSetup><ProfileToken>` + token.String() + `</ProfileToken></GetStreamUri>`
+
+	var resp struct {
+		URI string `xml:"MediaUri>Uri"`
+	}
+	if err := c.call(ctx, mediaXAddr, body, true, &resp); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.URI), nil
+}
@@ -0,0 +1,137 @@
+package onvif
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// wsDiscoveryAddr is the WS-Discovery multicast group ONVIF devices listen on
+const wsDiscoveryAddr = "239.255.255.250:3702"
+
+const probeTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope" xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<e:Header><w:MessageID>uuid:%s</w:MessageID><w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To><w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action></e:Header>
+<e:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></e:Body>
+</e:Envelope>`
+
+type probeMatches struct {
+	Body struct {
+		ProbeMatches struct {
+			Matches []struct {
+				Endpoint string `xml:"EndpointReference>Address"`
+				Scopes   string `xml:"Scopes"`
+				XAddrs   string `xml:"XAddrs"`
+			} `xml:"ProbeMatch"`
+		} `xml:"ProbeMatches"`
+	} `xml:"Body"`
+}
+
+func uuid() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// discover sends a WS-Discovery probe and collects the devices answering until ctx ends
+func discover(ctx context.Context) ([]Device, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	group, err := net.ResolveUDPAddr("udp4", wsDiscoveryAddr)
+	if err != nil {
+		return nil, err
+	}
+	// Send twice, UDP multicast is easily lost on busy Wi-Fi
+	msg := []byte(fmt.Sprintf(probeTemplate, uuid()))
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteToUDP(msg, group); err != nil {
+			return nil, fmt.Errorf("ws-discovery probe failed: %w", err)
+		}
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(3 * time.Second)
+	}
+	conn.SetReadDeadline(deadline)
+
+	seen := map[string]bool{}
+	devices := []Device{}
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The read deadline ends collection
+			break
+		}
+
+		var pm probeMatches
+		if err := xml.Unmarshal(buf[:n], &pm); err != nil {
+			continue
+		}
+		for _, m := range pm.Body.ProbeMatches.Matches {
+			xaddr := pickXAddr(m.XAddrs, from.IP)
+			if xaddr == "" {
+				continue
+			}
+			key := m.Endpoint
+			if key == "" {
+				key = xaddr
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			d := Device{Address: from.IP.String(), XAddr: xaddr}
+			d.Name, d.Hardware = parseScopes(m.Scopes)
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+// pickXAddr chooses the device service URL on the address the reply came from.
+// Devices with several interfaces list one URL per address.
+func pickXAddr(xaddrs string, from net.IP) string {
+	fields := strings.Fields(xaddrs)
+	for _, x := range fields {
+		if u, err := url.Parse(x); err == nil && u.Hostname() == from.String() {
+			return x
+		}
+	}
+	if len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// parseScopes reads the friendly name and hardware model from the ONVIF scopes
+func parseScopes(scopes string) (name, hardware string) {
+	for _, s := range strings.Fields(scopes) {
+		value := func(prefix string) string {
+			v, _ := url.PathUnescape(strings.TrimPrefix(s, prefix))
+			return v
+		}
+		switch {
+		case strings.HasPrefix(s, "onvif://www.onvif.org/name/"):
+			name = value("onvif://www.onvif.org/name/")
+		case strings.HasPrefix(s, "onvif://www.onvif.org/hardware/"):
+			hardware = value("onvif://www.onvif.org/hardware/")
+		}
+	}
+	return name, hardware
+}
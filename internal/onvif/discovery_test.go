@@ -0,0 +1,38 @@
+package onvif
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPickXAddr(t *testing.T) {
+	tests := []struct {
+		xaddrs string
+		from   string
+		want   string
+	}{
+		{"http://10.0.0.5/onvif/device_service", "10.0.0.5", "http://10.0.0.5/onvif/device_service"},
+		{"http://192.168.1.5/onvif/device_service http://10.0.0.5:8080/onvif/device_service", "10.0.0.5", "http://10.0.0.5:8080/onvif/device_service"},
+		{"http://192.168.1.5/onvif/device_service", "10.0.0.5", "http://192.168.1.5/onvif/device_service"},
+		{"  ", "10.0.0.5", ""},
+	}
+	for _, tt := range tests {
+		if got := pickXAddr(tt.xaddrs, net.ParseIP(tt.from)); got != tt.want {
+			t.Errorf("pickXAddr(%q, %s) = %q, want %q", tt.xaddrs, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes := "onvif://www.onvif.org/type/video_encoder " +
+		"onvif://www.onvif.org/name/Front%20Door " +
+		"onvif://www.onvif.org/hardware/DS-2CD2143 " +
+		"onvif://www.onvif.org/location/country/x"
+	name, hardware := parseScopes(scopes)
+	if name != "Front Door" || hardware != "DS-2CD2143" {
+		t.Errorf("parseScopes = %q, %q", name, hardware)
+	}
+	if name, hardware := parseScopes(""); name != "" || hardware != "" {
+		t.Errorf("empty scopes = %q, %q", name, hardware)
+	}
+}
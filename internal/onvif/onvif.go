@@ -0,0 +1,165 @@
+// Package onvif finds cameras with WS-Discovery and reads their media profiles
+// and RTSP URLs over the ONVIF device and media services.
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile is one encoder configuration of a camera, e.g. main and sub stream
+type Profile struct {
+	Token     string  `json:"token"`
+	Name      string  `json:"name"`
+	Encoding  string  `json:"encoding,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	FrameRate float64 `json:"frame_rate,omitempty"`
+	Bitrate   int     `json:"bitrate,omitempty"` // kbit/s
+	URL       string  `json:"url"`
+}
+
+type Device struct {
+	Address      string    `json:"address"`
+	XAddr        string    `json:"xaddr"`
+	Name         string    `json:"name,omitempty"`
+	Hardware     string    `json:"hardware,omitempty"`
+	Manufacturer string    `json:"manufacturer,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Firmware     string    `json:"firmware,omitempty"`
+	Profiles     []Profile `json:"profiles"`
+	// Error is set when the device was found but could not be queried, e.g. wrong credentials
+	Error string `json:"error,omitempty"`
+}
+
+type Options struct {
+	Username string
+	Password string
+	// Hosts are queried directly, for cameras that multicast does not reach
+	Hosts []string
+	// Wait is how long to collect WS-Discovery replies
+	Wait time.Duration
+}
+
+// Discover finds ONVIF cameras and lists their profiles with stream URLs.
+// The URLs are returned as the camera reports them, without credentials.
+func Discover(ctx context.Context, opts Options) ([]Device, error) {
+	if opts.Wait <= 0 {
+		opts.Wait = 3 * time.Second
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, opts.Wait)
+	devices, err := discover(probeCtx)
+	cancel()
+	if err != nil {
+		if len(opts.Hosts) == 0 {
+			return nil, err
+		}
+		log.Printf("[ONVIF] %v, only querying the given hosts", err)
+	}
+
+	known := map[string]bool{}
+	for _, d := range devices {
+		known[d.XAddr] = true
+	}
+	for _, h := range opts.Hosts {
+		xaddr, host, err := hostXAddr(h)
+		if err != nil {
+			return nil, err
+		}
+		if !known[xaddr] {
+			known[xaddr] = true
+			devices = append(devices, Device{Address: host, XAddr: xaddr})
+		}
+	}
+
+	sem := make(chan struct{}, 8)
+	var wg sync.WaitGroup
+	for i := range devices {
+		wg.Add(1)
+		go func(d *Device) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			devCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+			defer cancel()
+			if err := enumerate(devCtx, d, opts.Username, opts.Password); err != nil {
+				d.Error = err.Error()
+			}
+		}(&devices[i])
+	}
+	wg.Wait()
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Address < devices[j].Address
+	})
+	return devices, nil
+}
+
+// hostXAddr turns "10.0.0.5", "10.0.0.5:8080" or a full URL into a device service URL
+func hostXAddr(h string) (xaddr, host string, err error) {
+	h = strings.TrimSpace(h)
+	if strings.HasPrefix(h, "http://") || strings.HasPrefix(h, "https://") {
+		rest := h[strings.Index(h, "://")+3:]
+		host = strings.SplitN(rest, "/", 2)[0]
+		if hh, _, err := net.SplitHostPort(host); err == nil {
+			host = hh
+		}
+		return h, host, nil
+	}
+	host = h
+	if hh, _, err := net.SplitHostPort(h); err == nil {
+		host = hh
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("invalid host '%s'", h)
+	}
+	return "http://" + h + "/onvif/device_service", host, nil
+}
+
+func enumerate(ctx context.Context, d *Device, username, password string) error {
+	d.Profiles = []Profile{}
+	c := NewClient(d.XAddr, username, password)
+	if err := c.SyncClock(ctx); err != nil {
+		// Some cameras require authentication even for the clock; carry on with ours
+		log.Printf("[ONVIF] %s: could not read camera clock: %v", d.Address, err)
+	}
+
+	if info, err := c.GetDeviceInformation(ctx); err == nil {
+		d.Manufacturer, d.Model, d.Firmware = info.Manufacturer, info.Model, info.Firmware
+	} else if err == ErrUnauthorized {
+		return err
+	}
+
+	media, err := c.MediaXAddr(ctx)
+	if err != nil {
+		return err
+	}
+	profiles, err := c.GetProfiles(ctx, media)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range profiles {
+		uri, err := c.GetStreamUri(ctx, media, p.Token)
+		if err != nil {
+			log.Printf("[ONVIF] %s: no stream URL for profile %s: %v", d.Address, p.Token, err)
+			continue
+		}
+		prof := Profile{Token: p.Token, Name: p.Name, URL: uri}
+		if e := p.Encoder; e != nil {
+			prof.Encoding = strings.ToLower(e.Encoding)
+			prof.Width, prof.Height = e.Width, e.Height
+			prof.FrameRate, prof.Bitrate = e.FrameRate, e.Bitrate
+		}
+		d.Profiles = append(d.Profiles, prof)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package onvif
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostXAddr(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantXAddr string
+		wantHost  string
+		wantErr   bool
+	}{
+		{"10.0.0.5", "http://10.0.0.5/onvif/device_service", "10.0.0.5", false},
+		{" 10.0.0.5:8080 ", "http://10.0.0.5:8080/onvif/device_service", "10.0.0.5", false},
+		{"https://cam.local:8443/onvif/device", "https://cam.local:8443/onvif/device", "cam.local", false},
+		{"http://cam.local", "http://cam.local", "cam.local", false},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		xaddr, host, err := hostXAddr(tt.in)
+		if (err != nil) != tt.wantErr || xaddr != tt.wantXAddr || host != tt.wantHost {
+			t.Errorf("hostXAddr(%q) = %q, %q, %v; want %q, %q, error %v", tt.in, xaddr, host, err, tt.wantXAddr, tt.wantHost, tt.wantErr)
+		}
+	}
+}
+
+// fakeCamera answers the ONVIF calls of enumerate. Authenticated calls need a
+// valid password digest for admin/secret.
+func fakeCamera(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body := string(data)
+		reply := func(content string) {
+			w.Header().Set("Content-Type", "application/soap+xml")
+			io.WriteString(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>`+content+`</s:Body></s:Envelope>`)
+		}
+
+		if strings.Contains(body, "GetSystemDateAndTime") {
+			reply(`<GetSystemDateAndTimeResponse><SystemDateAndTime><UTCDateTime>` +
+				`<Date><Year>2030</Year><Month>1</Month><Day>2</Day></Date>` +
+				`<Time><Hour>3</Hour><Minute>4</Minute><Second>5</Second></Time>` +
+				`</UTCDateTime></SystemDateAndTime></GetSystemDateAndTimeResponse>`)
+			return
+		}
+		if !validDigest(body, "admin", "secret") {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(`<s:Fault><s:Code><s:Value>s:Sender</s:Value><s:Subcode><s:Value>ter:NotAuthorized</s:Value></s:Subcode></s:Code>` +
+				`<s:Reason><s:Text>Sender not authorized</s:Text></s:Reason></s:Fault>`)
+			return
+		}
+		switch {
+		case strings.Contains(body, "GetDeviceInformation"):
+			reply(`<GetDeviceInformationResponse><Manufacturer>Acme</Manufacturer><Model>C1</Model>` +
+				`<FirmwareVersion>1.2</FirmwareVersion></GetDeviceInformationResponse>`)
+		case strings.Contains(body, "GetCapabilities"):
+			reply(`<GetCapabilitiesResponse><Capabilities><Media><XAddr>` + srv.URL + `/onvif/media</XAddr></Media></Capabilities></GetCapabilitiesResponse>`)
+		case strings.Contains(body, "GetProfiles") && r.URL.Path == "/onvif/media":
+			reply(`<GetProfilesResponse>` +
+				`<Profiles token="main"><Name>Main</Name><VideoEncoderConfiguration><Encoding>H264</Encoding>` +
+				`<Resolution><Width>1920</Width><Height>1080</Height></Resolution>` +
+				`<RateControl><FrameRateLimit>25</FrameRateLimit><BitrateLimit>4096</BitrateLimit></RateControl>` +
+				`</VideoEncoderConfiguration></Profiles>` +
+				`<Profiles token="broken"><Name>Broken</Name></Profiles>` +
+				`</GetProfilesResponse>`)
+		case strings.Contains(body, "<ProfileToken>main</ProfileToken>"):
+			reply(`<GetStreamUriResponse><MediaUri><Uri> rtsp://10.0.0.5/main </Uri></MediaUri></GetStreamUriResponse>`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			reply(`<s:Fault><s:Code><s:Value>s:Receiver</s:Value></s:Code><s:Reason><s:Text>no such profile</s:Text></s:Reason></s:Fault>`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// validDigest checks the WS-Security UsernameToken of a request
+func validDigest(body, username, password string) bool {
+	var env struct {
+		Token struct {
+			Username string `xml:"Username"`
+			Password string `xml:"Password"`
+			Nonce    string `xml:"Nonce"`
+			Created  string `xml:"Created"`
+		} `xml:"Header>Security>UsernameToken"`
+	}
+	if xml.Unmarshal([]byte(body), &env) != nil || env.Token.Username != username {
+		return false
+	}
+	nonce, err := base64.StdEncoding.DecodeString(env.Token.Nonce)
+	if err != nil {
+		return false
+	}
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(env.Token.Created))
+	h.Write([]byte(password))
+	return env.Token.Password == base64.StdEncoding.EncodeToString(h.Sum(nil)) &&
+		strings.HasPrefix(env.Token.Created, "2030-01-02T03:0")
+}
+
+func TestEnumerate(t *testing.T) {
+	srv := fakeCamera(t)
+
+	d := Device{Address: "10.0.0.5", XAddr: srv.URL + "/onvif/device_service"}
+	if err := enumerate(context.Background(), &d, "admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if d.Manufacturer != "Acme" || d.Model != "C1" || d.Firmware != "1.2" {
+		t.Errorf("device = %+v", d)
+	}
+	// The profile without a stream URL is left out
+	want := Profile{Token: "main", Name: "Main", Encoding: "h264", Width: 1920, Height: 1080, FrameRate: 25, Bitrate: 4096, URL: "rtsp://10.0.0.5/main"}
+	if len(d.Profiles) != 1 || d.Profiles[0] != want {
+		t.Errorf("profiles = %+v", d.Profiles)
+	}
+}
+
+func TestEnumerateWrongPassword(t *testing.T) {
+	srv := fakeCamera(t)
+
+	d := Device{Address: "10.0.0.5", XAddr: srv.URL + "/onvif/device_service"}
+	if err := enumerate(context.Background(), &d, "admin", "wrong"); err != ErrUnauthorized {
+		t.Errorf("enumerate = %v, want ErrUnauthorized", err)
+	}
+	if d.Profiles == nil {
+		t.Error("profiles should be an empty list, not null")
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"unauthorized status", http.StatusUnauthorized, "", ErrUnauthorized.Error()},
+		{"not soap", http.StatusBadGateway, "<html>", "status 502"},
+		{"garbage with 200", http.StatusOK, "not xml", "invalid SOAP response"},
+		{"fault", http.StatusInternalServerError,
+			`<Envelope><Body><Fault><Code><Subcode><Value>ter:ActionNotSupported</Value></Subcode></Code><Reason><Text>Nope</Text></Reason></Fault></Body></Envelope>`,
+			"device fault: Nope ter:ActionNotSupported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			_, err := NewClient(srv.URL, "", "").GetDeviceInformation(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// HLSPrefix is where HLS is served; a stream's playlist is HLSPrefix +
+// "{stream}/index.m3u8" with the stream name path-escaped, "/" included
+const HLSPrefix = "/api/hls/"
+
+// HLSPath splits an escaped path under HLSPrefix into the stream and the
+// resource within it. The path has to be the escaped one: stream names may
+// contain "/", which only the escaped path tells apart from the separator.
+func HLSPath(escaped string) (stream, resource string, ok bool) {
+	rest, found := strings.CutPrefix(escaped, HLSPrefix)
+	if !found {
+		return "", "", false
+	}
+	name, res, found := strings.Cut(rest, "/")
+	stream, err1 := url.PathUnescape(name)
+	resource, err2 := url.PathUnescape(res)
+	if !found || err1 != nil || err2 != nil || stream == "" || resource == "" {
+		return "", "", false
+	}
+	return stream, resource, true
+}
+
+// HLSSource copies the stream named in an HLS path to ?src=, where the share
+// check and the proxy look for it. Players build the URLs of media playlists
+// and segments from the playlist, so only the path names the stream reliably.
+func HLSSource(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stream, _, ok := HLSPath(r.URL.EscapedPath())
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		q.Set("src", stream)
+		r.URL.RawQuery = q.Encode()
+		next(w, r)
+	}
+}
+
+// HLS serves a stream's playlists and segments from its engine. MediaMTX
+// streams are low-latency HLS, whose blocking playlist requests are held open
+// by the engine until the requested part exists; partial segments are
+// flushed as they are produced.
+func (p *Proxy) HLS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, engine, ok := p.resolve(w, r)
+	if !ok {
+		return
+	}
+	_, resource, _ := HLSPath(r.URL.EscapedPath())
+	if resource == "index.m3u8" {
+		resource = ""
+	}
+	target := engine.HLSURL(st.Name, resource)
+	if target == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The rest of the query goes to the engine: go2rtc's session and segment
+	// numbers, or the LL-HLS blocking reload and delta update directives
+	q := u.Query()
+	for name, values := range r.URL.Query() {
+		if name != "src" {
+			q[name] = values
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	resp, ok := p.forward(w, r, r.Method, u.String(), nil)
+	if !ok {
+		return
+	}
+	defer resp.Body.Close()
+
+	copyHeaders(w.Header(), resp.Header, responseHeaders)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Players resolve playlist entries against the playlist URL, which drops
+	// our query; a share token has to be added to every entry
+	token := shareFrom(r.Context()).token
+	if token == "" || resp.StatusCode != http.StatusOK || !isPlaylist(resp, resource) {
+		w.WriteHeader(resp.StatusCode)
+		copyFlushed(w, resp.Body)
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, "stream engine unavailable", http.StatusBadGateway)
+		return
+	}
+	body = addQuery(body, "share="+url.QueryEscape(token))
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
+
+func isPlaylist(resp *http.Response, resource string) bool {
+	ct := strings.ToLower(resp.Header.Get("Content-Type"))
+	return strings.Contains(ct, "mpegurl") || resource == "" || strings.HasSuffix(resource, ".m3u8")
+}
+
+// uriAttr matches the URI attribute of tags such as EXT-X-MAP and EXT-X-PART
+var uriAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+// addQuery appends a query parameter to every URI of a playlist
+func addQuery(playlist []byte, param string) []byte {
+	add := func(uri string) string {
+		if strings.Contains(uri, "?") {
+			return uri + "&" + param
+		}
+		return uri + "?" + param
+	}
+
+	var out bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(playlist))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			line = uriAttr.ReplaceAllStringFunc(line, func(m string) string {
+				return `URI="` + add(uriAttr.FindStringSubmatch(m)[1]) + `"`
+			})
+		case strings.TrimSpace(line) != "":
+			line = add(strings.TrimSpace(line))
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHLSPath(t *testing.T) {
+	tests := []struct {
+		path             string
+		stream, resource string
+		ok               bool
+	}{
+		{"/api/hls/yard/index.m3u8", "yard", "index.m3u8", true},
+		{"/api/hls/yard/hls/segment.ts", "yard", "hls/segment.ts", true},
+		{"/api/hls/front%2Fdoor/index.m3u8", "front/door", "index.m3u8", true},
+		{"/api/hls/front%20door/index.m3u8", "front door", "index.m3u8", true},
+		{"/api/hls/yard", "", "", false},
+		{"/api/hls/yard/", "", "", false},
+		{"/api/hls//index.m3u8", "", "", false},
+		{"/api/hls/bad%zz/index.m3u8", "", "", false},
+		{"/api/stream.mp4", "", "", false},
+	}
+	for _, tt := range tests {
+		stream, resource, ok := HLSPath(tt.path)
+		if stream != tt.stream || resource != tt.resource || ok != tt.ok {
+			t.Errorf("HLSPath(%q) = %q, %q, %v; want %q, %q, %v", tt.path, stream, resource, ok, tt.stream, tt.resource, tt.ok)
+		}
+	}
+}
+
+func TestHLSSource(t *testing.T) {
+	tests := []struct {
+		target   string
+		wantCode int
+		wantSrc  string
+	}{
+		{"/api/hls/front%2Fdoor/index.m3u8?src=other", http.StatusOK, "front/door"},
+		{"/api/hls/yard/index.m3u8?_HLS_msn=4", http.StatusOK, "yard"},
+		{"/api/hls/yard", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		var src string
+		h := HLSSource(func(w http.ResponseWriter, r *http.Request) {
+			src = r.URL.Query().Get("src")
+		})
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", tt.target, nil))
+		if rec.Code != tt.wantCode || src != tt.wantSrc {
+			t.Errorf("%s: status %d, src %q; want %d, %q", tt.target, rec.Code, src, tt.wantCode, tt.wantSrc)
+		}
+	}
+}
+
+func TestAddQuery(t *testing.T) {
+	playlist := "#EXTM3U\n" +
+		`#EXT-X-MAP:URI="init.mp4"` + "\n" +
+		`#EXT-X-PART:DURATION=0.2,URI="part1.mp4?x=1"` + "\n" +
+		"#EXTINF:2.0,\n" +
+		"  seg1.mp4 \n" +
+		"\n"
+	want := "#EXTM3U\n" +
+		`#EXT-X-MAP:URI="init.mp4?share=t"` + "\n" +
+		`#EXT-X-PART:DURATION=0.2,URI="part1.mp4?x=1&share=t"` + "\n" +
+		"#EXTINF:2.0,\n" +
+		"seg1.mp4?share=t\n" +
+		"\n"
+	if got := string(addQuery([]byte(playlist), "share=t")); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
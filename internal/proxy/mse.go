@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Query parameters a player may pass on to the engine's MP4 output
+var mp4Params = []string{"mp4", "duration"}
+
+// MP4 streams fragmented MP4 for MSE and <video> players. Every chunk is
+// flushed as soon as the engine sends it, so playback starts with the first
+// fragment and latency doesn't build up in buffers. The response ends when the
+// viewer goes away.
+func (p *Proxy) MP4(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, engine, ok := p.resolve(w, r)
+	if !ok {
+		return
+	}
+	target := engine.MP4URL(st.Name)
+	if target == "" {
+		http.Error(w, "the stream's engine does not serve MP4, use WebRTC", http.StatusNotImplemented)
+		return
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := u.Query()
+	for _, name := range mp4Params {
+		if v := r.URL.Query().Get(name); v != "" {
+			q.Set(name, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	resp, ok := p.forward(w, r, r.Method, u.String(), nil)
+	if !ok {
+		return
+	}
+	defer resp.Body.Close()
+
+	copyHeaders(w.Header(), resp.Header, responseHeaders)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.StatusCode)
+	copyFlushed(w, resp.Body)
+}
+
+// copyFlushed sends body to the client, flushing every chunk as it arrives,
+// until either side closes
+func copyFlushed(w http.ResponseWriter, body io.Reader) {
+	// A live stream outlasts any server write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if ferr := rc.Flush(); ferr != nil && !errors.Is(ferr, http.ErrNotSupported) {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
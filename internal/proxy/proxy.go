@@ -0,0 +1,136 @@
+// Package proxy carries player traffic to the streaming engines: WebRTC
+// signalling, WHEP, fragmented MP4 for MSE players and HLS. Every request names one
+// known stream in ?src= and is checked against the caller's access before
+// anything is sent to an engine.
+package proxy
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+	"web-tr/internal/models"
+	"web-tr/internal/stream"
+)
+
+// Streams finds a stream and the engine serving it, see stream.Manager.Lookup
+type Streams interface {
+	Lookup(name string) (models.Stream, stream.Engine, bool)
+}
+
+// Proxy forwards player requests to the engine of the requested stream
+type Proxy struct {
+	Streams Streams
+	// Allowed reports whether the caller may play st; nil allows everyone.
+	// Requests carrying a share for the stream, see WithShare, skip it.
+	Allowed func(r *http.Request, st models.Stream) bool
+	// Client is shared by all requests so engine connections are reused
+	Client *http.Client
+	// SignalTimeout bounds an SDP exchange. Media responses last as long as the viewer stays.
+	SignalTimeout time.Duration
+	// MaxSDPBytes limits the size of an offer or ICE update
+	MaxSDPBytes int64
+}
+
+func New(streams Streams, allowed func(r *http.Request, st models.Stream) bool) *Proxy {
+	return &Proxy{
+		Streams: streams,
+		Allowed: allowed,
+		Client: &http.Client{
+			Transport: NewTransport(),
+			// Engine redirects are passed to the player rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		SignalTimeout: 15 * time.Second,
+		MaxSDPBytes:   64 << 10,
+	}
+}
+
+// NewTransport returns the transport used for engine requests. The engines run
+// on this host, so connecting and the first response byte must be quick; the
+// body of a media response is not limited.
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ResponseHeaderTimeout: 15 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   32,
+	}
+}
+
+type shareKey struct{}
+
+type shareGrant struct {
+	stream, token string
+}
+
+// WithShare marks a request as authorised by the share token of one stream
+func WithShare(ctx context.Context, stream, token string) context.Context {
+	return context.WithValue(ctx, shareKey{}, shareGrant{stream, token})
+}
+
+func shareFrom(ctx context.Context) shareGrant {
+	g, _ := ctx.Value(shareKey{}).(shareGrant)
+	return g
+}
+
+// resolve finds the stream in ?src= and checks the caller may play it. On
+// failure the error response has been written. Unknown and forbidden streams
+// get the same answer so stream names can't be probed.
+func (p *Proxy) resolve(w http.ResponseWriter, r *http.Request) (models.Stream, stream.Engine, bool) {
+	srcs := r.URL.Query()["src"]
+	if len(srcs) != 1 || srcs[0] == "" {
+		http.Error(w, "exactly one src is required", http.StatusBadRequest)
+		return models.Stream{}, nil, false
+	}
+
+	st, engine, found := p.Streams.Lookup(srcs[0])
+	if found && shareFrom(r.Context()).stream != st.Name && p.Allowed != nil && !p.Allowed(r, st) {
+		found = false
+	}
+	if !found {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return models.Stream{}, nil, false
+	}
+	return st, engine, true
+}
+
+// Headers passed between player and engine; cookies and credentials never are
+var (
+	requestHeaders  = []string{"Content-Type", "Accept", "If-Match"}
+	responseHeaders = []string{"Content-Type", "Content-Length", "Cache-Control", "ETag", "Accept-Patch", "Link"}
+)
+
+func copyHeaders(dst, src http.Header, names []string) {
+	for _, name := range names {
+		for _, v := range src.Values(name) {
+			dst.Add(name, v)
+		}
+	}
+}
+
+// forward sends a request to an engine and copies the status, headers and body back
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, method, target string, body io.Reader) (*http.Response, bool) {
+	req, err := http.NewRequestWithContext(r.Context(), method, target, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	copyHeaders(req.Header, r.Header, requestHeaders)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		log.Printf("[Proxy] %s %s: %v", method, target, err)
+		http.Error(w, "stream engine unavailable", http.StatusBadGateway)
+		return nil, false
+	}
+	return resp, true
+}
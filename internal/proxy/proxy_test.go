@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"web-tr/internal/models"
+	"web-tr/internal/stream"
+)
+
+// fakeEngine serves every stream from one test server
+type fakeEngine struct {
+	stream.Engine
+	base string
+}
+
+func (e fakeEngine) WHEPURL(name string) string { return e.base + "/whep/" + url.PathEscape(name) }
+func (e fakeEngine) MP4URL(name string) string  { return e.base + "/mp4?src=" + url.QueryEscape(name) }
+func (e fakeEngine) HLSURL(name, path string) string {
+	if path == "" {
+		path = "index.m3u8"
+	}
+	return e.base + "/hls/" + url.PathEscape(name) + "/" + path
+}
+
+type fakeStreams struct{ engine fakeEngine }
+
+func (f fakeStreams) Lookup(name string) (models.Stream, stream.Engine, bool) {
+	if name != "yard" && name != "vault" && name != "front/door" {
+		return models.Stream{}, nil, false
+	}
+	return models.Stream{Name: name}, f.engine, true
+}
+
+// engineRequest is what the fake engine received last
+type engineRequest struct {
+	method, uri string
+	header      http.Header
+	body        string
+}
+
+func newTestProxy(t *testing.T, handler http.HandlerFunc) (*Proxy, func() engineRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var last engineRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		last = engineRequest{r.Method, r.URL.RequestURI(), r.Header.Clone(), string(body)}
+		mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	// Viewers may not play "vault"
+	allowed := func(r *http.Request, st models.Stream) bool { return st.Name != "vault" }
+	p := New(fakeStreams{fakeEngine{base: srv.URL}}, allowed)
+	return p, func() engineRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestResolveChecksStreamAndAccess(t *testing.T) {
+	p, _ := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name   string
+		query  string
+		share  string
+		status int
+	}{
+		{"allowed", "src=yard", "", http.StatusOK},
+		{"no src", "", "", http.StatusBadRequest},
+		{"empty src", "src=", "", http.StatusBadRequest},
+		{"two sources", "src=yard&src=vault", "", http.StatusBadRequest},
+		{"unknown", "src=nowhere", "", http.StatusNotFound},
+		{"forbidden looks unknown", "src=vault", "", http.StatusNotFound},
+		{"shared", "src=vault", "vault", http.StatusOK},
+		{"shared for another stream", "src=vault", "yard", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/stream.mp4?"+tt.query, nil)
+			if tt.share != "" {
+				r = r.WithContext(WithShare(r.Context(), tt.share, "token"))
+			}
+			rec := httptest.NewRecorder()
+			p.MP4(rec, r)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestMP4PassesOnlyKnownParamsAndHeaders(t *testing.T) {
+	p, last := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Set-Cookie", "engine=1")
+		io.WriteString(w, "moof")
+	})
+
+	r := httptest.NewRequest("GET", "/api/stream.mp4?src=yard&mp4=flac&duration=10&exec=rm", nil)
+	r.Header.Set("Cookie", "session=secret")
+	r.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	p.MP4(rec, r)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "moof" {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Set-Cookie") != "" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("response headers = %v", rec.Header())
+	}
+	got := last()
+	if got.uri != "/mp4?duration=10&mp4=flac&src=yard" {
+		t.Errorf("engine request = %s", got.uri)
+	}
+	if got.header.Get("Cookie") != "" || got.header.Get("Authorization") != "" {
+		t.Errorf("credentials reached the engine: %v", got.header)
+	}
+}
+
+func TestWHEPSessions(t *testing.T) {
+	p, last := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("Location", "/whep/yard/session/abc")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, "v=0 answer")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		query        string
+		contentType  string
+		status       int
+		wantLocation string
+		wantEngine   string
+	}{
+		{"offer", "POST", "src=yard", "application/sdp", http.StatusCreated, "/api/whep?session=abc&src=yard", "POST /whep/yard"},
+		{"offer of the wrong type", "POST", "src=yard", "text/plain", http.StatusUnsupportedMediaType, "", ""},
+		{"ice update", "PATCH", "src=yard&session=abc", "application/trickle-ice-sdpfrag", http.StatusNoContent, "", "PATCH /whep/yard/abc"},
+		{"ice update without a session", "PATCH", "src=yard", "application/trickle-ice-sdpfrag", http.StatusMethodNotAllowed, "", ""},
+		{"hang up", "DELETE", "src=yard&session=abc", "", http.StatusNoContent, "", "DELETE /whep/yard/abc"},
+		{"session leaving the stream", "DELETE", "src=yard&session=" + url.QueryEscape("../vault"), "", http.StatusBadRequest, "", ""},
+		{"forbidden stream", "DELETE", "src=vault&session=abc", "", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := last()
+			r := httptest.NewRequest(tt.method, "/api/whep?"+tt.query, strings.NewReader("v=0 offer"))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			p.WHEP(rec, r)
+
+			if rec.Code != tt.status || rec.Header().Get("Location") != tt.wantLocation {
+				t.Errorf("got %d, location %q; want %d, %q", rec.Code, rec.Header().Get("Location"), tt.status, tt.wantLocation)
+			}
+			got := last()
+			if tt.wantEngine == "" {
+				if got.method != before.method || got.uri != before.uri {
+					t.Errorf("engine was called: %s %s", got.method, got.uri)
+				}
+				return
+			}
+			if got.method+" "+got.uri != tt.wantEngine {
+				t.Errorf("engine request = %s %s, want %s", got.method, got.uri, tt.wantEngine)
+			}
+		})
+	}
+}
+
+func TestHLSAddsShareToPlaylists(t *testing.T) {
+	p, last := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".m3u8") {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			io.WriteString(w, "#EXTM3U\nseg1.mp4\n")
+			return
+		}
+		io.WriteString(w, "segment")
+	})
+	handler := HLSSource(p.HLS)
+
+	tests := []struct {
+		name       string
+		target     string
+		share      string
+		wantBody   string
+		wantEngine string
+	}{
+		{"playlist", "/api/hls/yard/index.m3u8?_HLS_msn=3", "", "#EXTM3U\nseg1.mp4\n", "/hls/yard/index.m3u8?_HLS_msn=3"},
+		{"shared playlist", "/api/hls/vault/index.m3u8", "s.1", "#EXTM3U\nseg1.mp4?share=s.1\n", "/hls/vault/index.m3u8"},
+		{"shared segment", "/api/hls/vault/seg1.mp4", "s.1", "segment", "/hls/vault/seg1.mp4"},
+		{"name with a slash", "/api/hls/front%2Fdoor/index.m3u8", "", "#EXTM3U\nseg1.mp4\n", "/hls/front%2Fdoor/index.m3u8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.share != "" {
+				r = r.WithContext(WithShare(r.Context(), "vault", tt.share))
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, r)
+
+			if rec.Code != http.StatusOK || rec.Body.String() != tt.wantBody {
+				t.Errorf("got %d %q, want %q", rec.Code, rec.Body.String(), tt.wantBody)
+			}
+			if got := last().uri; got != tt.wantEngine {
+				t.Errorf("engine request = %s, want %s", got, tt.wantEngine)
+			}
+		})
+	}
+}
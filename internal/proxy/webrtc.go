@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	mimeSDP        = "application/sdp"
+	mimeTrickleICE = "application/trickle-ice-sdpfrag"
+)
+
+// WebRTC exchanges an SDP offer for the engine's answer. It is the endpoint
+// used by the bundled players: a POST with the offer as application/sdp (or
+// go2rtc's JSON form) answered with the SDP in the body.
+func (p *Proxy) WebRTC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, engine, ok := p.resolve(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.SignalTimeout)
+	defer cancel()
+	resp, ok := p.forward(w, r.WithContext(ctx), http.MethodPost, engine.WHEPURL(st.Name), http.MaxBytesReader(w, r.Body, p.MaxSDPBytes))
+	if !ok {
+		return
+	}
+	defer resp.Body.Close()
+
+	copyHeaders(w.Header(), resp.Header, responseHeaders)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// WHEP implements the WebRTC-HTTP Egress Protocol (RFC 9725) for standard
+// players: POST an offer to create a session, PATCH it with trickled ICE
+// candidates and DELETE it to hang up. Sessions are addressed by the Location
+// returned on creation.
+func (p *Proxy) WHEP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "OPTIONS, POST, PATCH, DELETE")
+		w.Header().Set("Accept-Post", mimeSDP)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	st, engine, ok := p.resolve(w, r)
+	if !ok {
+		return
+	}
+	base := engine.WHEPURL(st.Name)
+	session := r.URL.Query().Get("session")
+	if strings.ContainsAny(session, "/?#") {
+		http.Error(w, "invalid session", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		if !hasType(r, mimeSDP) {
+			http.Error(w, "offer must be application/sdp", http.StatusUnsupportedMediaType)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), p.SignalTimeout)
+		defer cancel()
+		resp, ok := p.forward(w, r.WithContext(ctx), http.MethodPost, base, http.MaxBytesReader(w, r.Body, p.MaxSDPBytes))
+		if !ok {
+			return
+		}
+		defer resp.Body.Close()
+
+		copyHeaders(w.Header(), resp.Header, responseHeaders)
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+
+		// The session lives at the engine's Location; hand out our own address for it.
+		// go2rtc has no session resource, so its sessions end when the peer closes.
+		loc := url.Values{"src": {st.Name}}
+		if upstream := resp.Header.Get("Location"); upstream != "" {
+			loc.Set("session", path.Base(upstream))
+		}
+		w.Header().Set("Location", r.URL.Path+"?"+loc.Encode())
+		w.Header().Set("Content-Type", mimeSDP)
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, resp.Body)
+
+	case http.MethodPatch, http.MethodDelete:
+		if session == "" {
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Error(w, "the stream's engine does not support ICE updates", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Method == http.MethodPatch && !hasType(r, mimeTrickleICE) {
+			http.Error(w, "ICE updates must be "+mimeTrickleICE, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), p.SignalTimeout)
+		defer cancel()
+		resp, ok := p.forward(w, r.WithContext(ctx), r.Method, base+"/"+url.PathEscape(session), http.MaxBytesReader(w, r.Body, p.MaxSDPBytes))
+		if !ok {
+			return
+		}
+		defer resp.Body.Close()
+
+		copyHeaders(w.Header(), resp.Header, responseHeaders)
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func hasType(r *http.Request, want string) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == want
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package retention
+
+import "errors"
+
+// diskSpace is not available on this platform, the free space rule is skipped
+func diskSpace(path string) (free, size int64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
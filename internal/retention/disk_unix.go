@@ -0,0 +1,14 @@
+//go:build unix
+
+package retention
+
+import "syscall"
+
+// diskSpace returns the free and total bytes of the file system holding path
+func diskSpace(path string) (free, size int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), nil
+}
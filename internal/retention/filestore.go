@@ -0,0 +1,82 @@
+package retention
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// FileStore keeps retention policies in a local JSON file for File/YAML mode
+type FileStore struct {
+	FilePath string
+	mu       sync.Mutex
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() ([]models.RetentionPolicy, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []models.RetentionPolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (fs *FileStore) save(policies []models.RetentionPolicy) error {
+	data, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetRetentionPolicies() ([]models.RetentionPolicy, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.load()
+}
+
+func (fs *FileStore) SaveRetentionPolicy(p models.RetentionPolicy) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	policies, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for i := range policies {
+		if policies[i].Stream == p.Stream {
+			policies[i] = p
+			return fs.save(policies)
+		}
+	}
+	return fs.save(append(policies, p))
+}
+
+func (fs *FileStore) RemoveRetentionPolicy(stream string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	policies, err := fs.load()
+	if err != nil {
+		return err
+	}
+	kept := policies[:0]
+	for _, p := range policies {
+		if p.Stream != stream {
+			kept = append(kept, p)
+		}
+	}
+	return fs.save(kept)
+}
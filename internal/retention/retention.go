@@ -0,0 +1,547 @@
+// Package retention keeps the recording store within its limits. A janitor
+// deletes the oldest footage first, whole segments and motion events at a
+// time, until every rule holds:
+//
+//   - the maximum age of a stream's footage, its own or the global one
+//   - the maximum size of a stream's footage
+//   - the maximum size of all footage together
+//   - the minimum free space on the disk
+//
+// Footage with a lock file next to it, see stream.LockFile, is never deleted.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+	"web-tr/internal/stream"
+)
+
+var (
+	ErrNotFound      = errors.New("no retention policy for this stream")
+	ErrInvalidPolicy = errors.New("invalid retention policy")
+	ErrUnknownStream = errors.New("stream not found")
+)
+
+// MaxAgeDays is the longest age a policy can set
+const MaxAgeDays = 3650
+
+const (
+	// fileLayout names recorded segments and motion events after their start
+	fileLayout = "2006-01-02_15-04-05"
+	// activeWindow keeps footage written to this recently, it may still grow
+	activeWindow = 2 * time.Minute
+	// actionLimit is the number of deletions kept for the status
+	actionLimit = 100
+	gigabyte    = 1 << 30
+)
+
+// Reasons of a RetentionAction
+const (
+	reasonAge       = "age"
+	reasonSize      = "size"
+	reasonTotalSize = "total size"
+	reasonFreeSpace = "free space"
+)
+
+// Store is implemented by db.Store in DB mode and FileStore otherwise
+type Store interface {
+	GetRetentionPolicies() ([]models.RetentionPolicy, error)
+	// SaveRetentionPolicy adds the policy of a stream or replaces it
+	SaveRetentionPolicy(p models.RetentionPolicy) error
+	RemoveRetentionPolicy(stream string) error
+}
+
+// Streams lists the configured streams, see stream.Manager
+type Streams interface {
+	GetStreams() ([]models.Stream, error)
+	FindStream(name string) (models.Stream, bool)
+}
+
+// Service keeps the retention policies and runs the janitor
+type Service struct {
+	Store   Store
+	Streams Streams
+	// Dir is the recording store, holding a directory per stream
+	Dir string
+	// Interval is the time between two passes of the janitor
+	Interval time.Duration
+
+	// running makes passes take turns
+	running sync.Mutex
+
+	mu      sync.Mutex
+	lastRun time.Time
+	actions []models.RetentionAction
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewService(store Store, streams Streams, dir string) *Service {
+	return &Service{
+		Store:    store,
+		Streams:  streams,
+		Dir:      dir,
+		Interval: 10 * time.Minute,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the janitor now and every Interval until Stop is called, and
+// keeps the policies of renamed and deleted streams in step
+func (s *Service) Start(hub *events.Hub) {
+	ch := hub.Queue()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer hub.Unsubscribe(ch)
+
+		s.Run()
+		tick := time.NewTicker(s.Interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case ev := <-ch:
+				for _, ev := range events.Expand(ev) {
+					switch ev.Type {
+					case events.StreamUpdated, events.StreamDeleted:
+						s.followStream(ev)
+					}
+				}
+			case <-tick.C:
+				s.Run()
+			}
+		}
+	}()
+}
+
+func (s *Service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// List returns the global policy, stored or not, followed by those of streams
+func (s *Service) List() ([]models.RetentionPolicy, error) {
+	policies, err := s.Store.GetRetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+	list := []models.RetentionPolicy{{}}
+	for _, p := range policies {
+		if p.Stream == "" {
+			list[0] = p
+		} else {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list[1:], func(i, j int) bool { return list[1+i].Stream < list[1+j].Stream })
+	return list, nil
+}
+
+// Get returns the policy of a stream, or the global one for an empty name
+func (s *Service) Get(name string) (*models.RetentionPolicy, error) {
+	policies, err := s.Store.GetRetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range policies {
+		if p.Stream == name {
+			return &p, nil
+		}
+	}
+	if name == "" {
+		return &models.RetentionPolicy{}, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Set saves a policy, which the janitor applies right away
+func (s *Service) Set(p models.RetentionPolicy) (*models.RetentionPolicy, error) {
+	if p.Stream != "" {
+		if _, found := s.Streams.FindStream(p.Stream); !found {
+			return nil, ErrUnknownStream
+		}
+	}
+	switch {
+	case p.MaxAgeDays < 0 || p.MaxAgeDays > MaxAgeDays:
+		return nil, fmt.Errorf("%w: maximum age must be between 0 and %d days", ErrInvalidPolicy, MaxAgeDays)
+	case p.MaxSizeGB < 0:
+		return nil, fmt.Errorf("%w: maximum size cannot be negative", ErrInvalidPolicy)
+	case p.MinFreeGB < 0:
+		return nil, fmt.Errorf("%w: free space cannot be negative", ErrInvalidPolicy)
+	case p.MinFreeGB > 0 && p.Stream != "":
+		return nil, fmt.Errorf("%w: free space is kept by the global policy only", ErrInvalidPolicy)
+	}
+
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.Store.SaveRetentionPolicy(p); err != nil {
+		return nil, err
+	}
+	go s.Run()
+	return &p, nil
+}
+
+// Remove drops the policy of a stream, which falls back to the global one
+func (s *Service) Remove(name string) error {
+	if _, err := s.Get(name); err != nil {
+		return err
+	}
+	return s.Store.RemoveRetentionPolicy(name)
+}
+
+// followStream moves or drops the policy of a renamed or deleted stream. The
+// footage of a deleted stream stays under the global policy.
+func (s *Service) followStream(ev events.Event) {
+	data, _ := ev.Data.(map[string]interface{})
+	name, _ := data["name"].(string)
+	oldName, _ := data["originalName"].(string)
+	if name == "" {
+		return
+	}
+
+	var err error
+	switch {
+	case ev.Type == events.StreamDeleted:
+		if _, e := s.Get(name); e == nil {
+			err = s.Store.RemoveRetentionPolicy(name)
+		}
+	case ev.Type == events.StreamUpdated && oldName != "" && oldName != name:
+		if p, e := s.Get(oldName); e == nil {
+			p.Stream = name
+			if err = s.Store.SaveRetentionPolicy(*p); err == nil {
+				err = s.Store.RemoveRetentionPolicy(oldName)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[Retention] Failed to update the policy of %s: %v", name, err)
+	}
+}
+
+// unit is what the janitor deletes at once: a recorded segment, or a motion
+// event with its snapshot and clip
+type unit struct {
+	stream  string
+	time    time.Time
+	end     time.Time
+	files   []string
+	size    int64
+	locked  bool
+	deleted bool
+}
+
+// scan lists the footage of every stream directory, oldest first. Directories
+// of streams that no longer exist are listed under their directory name.
+func (s *Service) scan() (map[string][]*unit, error) {
+	names := make(map[string]string)
+	if streams, err := s.Streams.GetStreams(); err == nil {
+		for _, st := range streams {
+			names[stream.SafeDirName(st.Name)] = st.Name
+		}
+	}
+
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return map[string][]*unit{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	footage := make(map[string][]*unit)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		name := names[e.Name()]
+		if name == "" {
+			name = e.Name()
+		}
+		dir := filepath.Join(s.Dir, e.Name())
+		units := append(scanDir(name, dir, true), scanDir(name, filepath.Join(dir, "motion"), false)...)
+		sort.Slice(units, func(i, j int) bool { return units[i].time.Before(units[j].time) })
+		footage[name] = units
+	}
+	return footage, nil
+}
+
+// scanDir groups the files of dir named after a time into units. Recorded
+// segments are single MP4 files, motion events keep several files.
+func scanDir(name, dir string, segments bool) []*unit {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	byStem := make(map[string]*unit)
+	var units []*unit
+	for _, e := range entries {
+		file := e.Name()
+		ext := filepath.Ext(file)
+		if e.IsDir() || strings.HasPrefix(file, ".") || ext == ".lock" || (segments && ext != ".mp4") {
+			continue
+		}
+		stem := strings.TrimSuffix(file, ext)
+		t, err := time.ParseInLocation(fileLayout, stem, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		u := byStem[stem]
+		if u == nil {
+			path := filepath.Join(dir, file)
+			u = &unit{stream: name, time: t, locked: stream.Locked(path)}
+			byStem[stem] = u
+			units = append(units, u)
+		}
+		u.files = append(u.files, filepath.Join(dir, file))
+		u.size += info.Size()
+		if info.ModTime().After(u.end) {
+			u.end = info.ModTime()
+		}
+	}
+	return units
+}
+
+// Run makes one pass of the janitor and returns what it deleted
+func (s *Service) Run() []models.RetentionAction {
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	policies, err := s.Store.GetRetentionPolicies()
+	if err != nil {
+		log.Printf("[Retention] Failed to load the policies: %v", err)
+		return nil
+	}
+	var global models.RetentionPolicy
+	own := make(map[string]models.RetentionPolicy)
+	for _, p := range policies {
+		if p.Stream == "" {
+			global = p
+		} else {
+			own[p.Stream] = p
+		}
+	}
+
+	footage, err := s.scan()
+	if err != nil {
+		log.Printf("[Retention] Failed to list the recordings: %v", err)
+		return nil
+	}
+
+	now := time.Now()
+	j := &janitor{now: now}
+	var all []*unit
+	for name, units := range footage {
+		all = append(all, units...)
+
+		if days := effective(own[name], global).MaxAgeDays; days > 0 {
+			cutoff := now.AddDate(0, 0, -days)
+			for _, u := range units {
+				if u.end.Before(cutoff) {
+					j.delete(u, reasonAge)
+				}
+			}
+		}
+		if gb := own[name].MaxSizeGB; gb > 0 {
+			j.shrink(units, int64(gb*gigabyte), reasonSize)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].time.Before(all[j].time) })
+
+	if gb := global.MaxSizeGB; gb > 0 {
+		j.shrink(all, int64(gb*gigabyte), reasonTotalSize)
+	}
+	if gb := global.MinFreeGB; gb > 0 {
+		free, _, err := diskSpace(s.Dir)
+		if err != nil {
+			log.Printf("[Retention] Cannot tell the free disk space: %v", err)
+		} else if need := int64(gb*gigabyte) - free; need > 0 {
+			// The footage left is what may go to make room
+			j.shrink(all, total(all)-need, reasonFreeSpace)
+		}
+	}
+
+	for _, a := range j.actions {
+		noun := "segments"
+		if a.Segments == 1 {
+			noun = "segment"
+		}
+		log.Printf("[Retention] Deleted %d %s of %s (%s, %s to %s) by the %s rule",
+			a.Segments, noun, a.Stream, formatBytes(a.Bytes),
+			a.Oldest.Local().Format("2006-01-02 15:04"), a.Newest.Local().Format("2006-01-02 15:04"), a.Reason)
+	}
+
+	s.mu.Lock()
+	s.lastRun = now
+	s.actions = append(s.actions, j.actions...)
+	if len(s.actions) > actionLimit {
+		s.actions = s.actions[len(s.actions)-actionLimit:]
+	}
+	s.mu.Unlock()
+	return j.actions
+}
+
+// janitor deletes units and sums what went per stream and reason
+type janitor struct {
+	now     time.Time
+	actions []models.RetentionAction
+}
+
+// delete removes the files of an unlocked unit that is no longer written to
+func (j *janitor) delete(u *unit, reason string) bool {
+	if u.deleted || u.locked || j.now.Sub(u.end) < activeWindow {
+		return false
+	}
+	for _, f := range u.files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Retention] Failed to delete %s: %v", f, err)
+			return false
+		}
+	}
+	u.deleted = true
+
+	i := slices.IndexFunc(j.actions, func(a models.RetentionAction) bool {
+		return a.Stream == u.stream && a.Reason == reason
+	})
+	if i < 0 {
+		j.actions = append(j.actions, models.RetentionAction{Time: j.now.UTC(), Stream: u.stream, Reason: reason, Oldest: u.time.UTC()})
+		i = len(j.actions) - 1
+	}
+	a := &j.actions[i]
+	a.Segments++
+	a.Bytes += u.size
+	if u.time.Before(a.Oldest) {
+		a.Oldest = u.time.UTC()
+	}
+	if u.time.After(a.Newest) {
+		a.Newest = u.time.UTC()
+	}
+	return true
+}
+
+// shrink deletes the oldest units until the ones left add up to limit
+func (j *janitor) shrink(units []*unit, limit int64, reason string) {
+	size := total(units)
+	for _, u := range units {
+		if size <= limit {
+			return
+		}
+		if j.delete(u, reason) {
+			size -= u.size
+		}
+	}
+}
+
+// total adds up the size of the units not deleted
+func total(units []*unit) int64 {
+	var n int64
+	for _, u := range units {
+		if !u.deleted {
+			n += u.size
+		}
+	}
+	return n
+}
+
+// effective is a stream's policy with the global limits filled in
+func effective(own, global models.RetentionPolicy) models.RetentionPolicy {
+	if own.MaxAgeDays == 0 {
+		own.MaxAgeDays = global.MaxAgeDays
+	}
+	return own
+}
+
+// Status reports the footage kept of every stream, the disk and the latest
+// deletions, newest first
+func (s *Service) Status() (*models.StorageStatus, error) {
+	footage, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+	streams, err := s.Streams.GetStreams()
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range streams {
+		if _, ok := footage[st.Name]; !ok {
+			footage[st.Name] = nil
+		}
+	}
+
+	policies, err := s.Store.GetRetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+	var global models.RetentionPolicy
+	own := make(map[string]models.RetentionPolicy)
+	for _, p := range policies {
+		if p.Stream == "" {
+			global = p
+		} else {
+			own[p.Stream] = p
+		}
+	}
+
+	now := time.Now()
+	status := &models.StorageStatus{Streams: []models.StreamStorage{}}
+	for name, units := range footage {
+		p := effective(own[name], global)
+		st := models.StreamStorage{Stream: name, MaxAgeDays: p.MaxAgeDays, MaxSizeGB: p.MaxSizeGB}
+		for _, u := range units {
+			st.Segments++
+			st.Bytes += u.size
+			if u.locked {
+				st.Locked++
+			}
+		}
+		if len(units) > 0 {
+			st.Oldest = units[0].time.UTC()
+			st.Newest = units[len(units)-1].end.UTC()
+			st.Days = now.Sub(units[0].time).Hours() / 24
+		}
+		status.Bytes += st.Bytes
+		status.Streams = append(status.Streams, st)
+	}
+	sort.Slice(status.Streams, func(i, j int) bool { return status.Streams[i].Stream < status.Streams[j].Stream })
+
+	if free, size, err := diskSpace(s.Dir); err == nil {
+		status.DiskFree, status.DiskSize = free, size
+	}
+
+	s.mu.Lock()
+	status.LastRun = s.lastRun.UTC()
+	status.Actions = make([]models.RetentionAction, 0, len(s.actions))
+	for i := len(s.actions) - 1; i >= 0; i-- {
+		status.Actions = append(status.Actions, s.actions[i])
+	}
+	s.mu.Unlock()
+	return status, nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= gigabyte:
+		return fmt.Sprintf("%.1f GB", float64(n)/gigabyte)
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%d KB", n>>10)
+}
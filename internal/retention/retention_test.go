@@ -0,0 +1,173 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"web-tr/internal/models"
+)
+
+func TestEffective(t *testing.T) {
+	global := models.RetentionPolicy{MaxAgeDays: 30, MaxSizeGB: 500}
+	tests := []struct {
+		name    string
+		own     models.RetentionPolicy
+		wantAge int
+		wantGB  float64
+	}{
+		{"no own policy", models.RetentionPolicy{}, 30, 0},
+		{"own age wins", models.RetentionPolicy{MaxAgeDays: 7}, 7, 0},
+		{"own size keeps the global age", models.RetentionPolicy{MaxSizeGB: 20}, 30, 20},
+	}
+	for _, tt := range tests {
+		p := effective(tt.own, global)
+		if p.MaxAgeDays != tt.wantAge || p.MaxSizeGB != tt.wantGB {
+			t.Errorf("%s: got %d days, %v GB; want %d days, %v GB", tt.name, p.MaxAgeDays, p.MaxSizeGB, tt.wantAge, tt.wantGB)
+		}
+	}
+}
+
+func TestShrink(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-time.Hour)
+	mk := func(size int64, end time.Time, locked bool) *unit {
+		return &unit{stream: "cam", time: end.Add(-time.Minute), end: end, size: size, locked: locked}
+	}
+
+	tests := []struct {
+		name        string
+		units       []*unit
+		limit       int64
+		wantDeleted []bool
+	}{
+		{
+			name:        "already within the limit",
+			units:       []*unit{mk(10, old, false), mk(10, old, false)},
+			limit:       20,
+			wantDeleted: []bool{false, false},
+		},
+		{
+			name:        "oldest first",
+			units:       []*unit{mk(10, old, false), mk(10, old, false), mk(10, old, false)},
+			limit:       15,
+			wantDeleted: []bool{true, true, false},
+		},
+		{
+			name:        "locked footage is skipped",
+			units:       []*unit{mk(10, old, true), mk(10, old, false), mk(10, old, false)},
+			limit:       20,
+			wantDeleted: []bool{false, true, false},
+		},
+		{
+			name:        "footage still being written is kept",
+			units:       []*unit{mk(10, now.Add(-time.Minute), false), mk(10, old, false)},
+			limit:       0,
+			wantDeleted: []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &janitor{now: now}
+			j.shrink(tt.units, tt.limit, reasonSize)
+			for i, u := range tt.units {
+				if u.deleted != tt.wantDeleted[i] {
+					t.Errorf("unit %d deleted = %v, want %v", i, u.deleted, tt.wantDeleted[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJanitorSumsActions(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	first := now.Add(-3 * time.Hour)
+	second := now.Add(-2 * time.Hour)
+	j := &janitor{now: now}
+	j.delete(&unit{stream: "cam", time: second, end: second, size: 5}, reasonAge)
+	j.delete(&unit{stream: "cam", time: first, end: first, size: 7}, reasonAge)
+	j.delete(&unit{stream: "cam", time: first, end: first, size: 1}, reasonSize)
+
+	if len(j.actions) != 2 {
+		t.Fatalf("got %d actions, want one per reason", len(j.actions))
+	}
+	a := j.actions[0]
+	if a.Segments != 2 || a.Bytes != 12 || !a.Oldest.Equal(first) || !a.Newest.Equal(second) {
+		t.Errorf("age action = %+v", a)
+	}
+}
+
+type memStore struct{ policies []models.RetentionPolicy }
+
+func (m *memStore) GetRetentionPolicies() ([]models.RetentionPolicy, error) { return m.policies, nil }
+func (m *memStore) SaveRetentionPolicy(p models.RetentionPolicy) error      { return nil }
+func (m *memStore) RemoveRetentionPolicy(stream string) error               { return nil }
+
+type staticStreams []models.Stream
+
+func (s staticStreams) GetStreams() ([]models.Stream, error) { return s, nil }
+func (s staticStreams) FindStream(name string) (models.Stream, bool) {
+	for _, st := range s {
+		if st.Name == name {
+			return st, true
+		}
+	}
+	return models.Stream{}, false
+}
+
+// writeSegment creates a recorded segment that started at t and was last written a minute later
+func writeSegment(t *testing.T, dir string, start time.Time, size int) string {
+	t.Helper()
+	path := filepath.Join(dir, start.Format(fileLayout)+".mp4")
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	end := start.Add(time.Minute)
+	if err := os.Chtimes(path, end, end); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunAppliesAgeAndLocks(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "front_door")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	expired := writeSegment(t, dir, now.AddDate(0, 0, -10), 100)
+	locked := writeSegment(t, dir, now.AddDate(0, 0, -9), 100)
+	if err := os.WriteFile(filepath.Join(dir, now.AddDate(0, 0, -9).Format(fileLayout)+".lock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	recent := writeSegment(t, dir, now.AddDate(0, 0, -1), 100)
+
+	store := &memStore{policies: []models.RetentionPolicy{
+		{MaxAgeDays: 30},
+		{Stream: "front/door", MaxAgeDays: 5},
+	}}
+	s := NewService(store, staticStreams{{Name: "front/door"}}, root)
+
+	actions := s.Run()
+	if len(actions) != 1 || actions[0].Stream != "front/door" || actions[0].Reason != reasonAge || actions[0].Segments != 1 {
+		t.Fatalf("actions = %+v", actions)
+	}
+	for path, want := range map[string]bool{expired: false, locked: true, recent: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+
+	status, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Streams) != 1 || status.Streams[0].Segments != 2 || status.Streams[0].Locked != 1 || status.Streams[0].MaxAgeDays != 5 {
+		t.Errorf("status = %+v", status.Streams)
+	}
+	if len(status.Actions) != 1 {
+		t.Errorf("status actions = %+v", status.Actions)
+	}
+}
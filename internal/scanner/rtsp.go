@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type rtspResponse struct {
+	Status int
+	Header textproto.MIMEHeader
+	Body   string
+}
+
+// rtspRequest sends one RTSP request on a fresh connection and reads the reply
+func rtspRequest(ctx context.Context, addr, method, uri string, header map[string]string, timeout time.Duration) (*rtspResponse, error) {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s RTSP/1.0\r\nCSeq: 1\r\nUser-Agent: web-tr\r\n", method, uri)
+	for k, v := range header {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	b.WriteString("\r\n")
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(conn))
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	// "RTSP/1.0 200 OK"
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return nil, fmt.Errorf("not an RTSP server")
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("not an RTSP server")
+	}
+	hdr, err := tp.ReadMIMEHeader()
+	if err != nil && len(hdr) == 0 {
+		return nil, err
+	}
+
+	resp := &rtspResponse{Status: status, Header: hdr}
+	if n, _ := strconv.Atoi(hdr.Get("Content-Length")); n > 0 && n < 64*1024 {
+		body := make([]byte, n)
+		if _, err := io.ReadFull(tp.R, body); err == nil {
+			resp.Body = string(body)
+		}
+	}
+	return resp, nil
+}
+
+// describe sends DESCRIBE for uri, answering a Digest or Basic challenge if credentials are given
+func describe(ctx context.Context, addr, uri, username, password string, timeout time.Duration) (*rtspResponse, error) {
+	header := map[string]string{"Accept": "application/sdp"}
+	resp, err := rtspRequest(ctx, addr, "DESCRIBE", uri, header, timeout)
+	if err != nil || resp.Status != 401 || username == "" {
+		return resp, err
+	}
+
+	auth := authorization(resp.Header.Values("WWW-Authenticate"), "DESCRIBE", uri, username, password)
+	if auth == "" {
+		return resp, nil
+	}
+	header["Authorization"] = auth
+	return rtspRequest(ctx, addr, "DESCRIBE", uri, header, timeout)
+}
+
+// authorization answers an RTSP auth challenge, preferring Digest
+func authorization(challenges []string, method, uri, username, password string) string {
+	for _, c := range challenges {
+		if !strings.HasPrefix(strings.ToLower(c), "digest ") {
+			continue
+		}
+		params := parseAuthParams(c[len("digest "):])
+		ha1 := md5hex(username + ":" + params["realm"] + ":" + password)
+		ha2 := md5hex(method + ":" + uri)
+		response := md5hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+		return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+			username, params["realm"], params["nonce"], uri, response)
+	}
+	for _, c := range challenges {
+		if strings.HasPrefix(strings.ToLower(c), "basic") {
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		}
+	}
+	return ""
+}
+
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return params
+}
+
+func md5hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// sdpVideoCodec reads the first video codec from an SDP description, e.g. "h264"
+func sdpVideoCodec(sdp string) string {
+	inVideo := false
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "m=") {
+			inVideo = strings.HasPrefix(line, "m=video")
+		}
+		if inVideo && strings.HasPrefix(line, "a=rtpmap:") {
+			// a=rtpmap:96 H264/90000
+			if _, enc, ok := strings.Cut(line, " "); ok {
+				name, _, _ := strings.Cut(enc, "/")
+				return strings.ToLower(name)
+			}
+		}
+	}
+	return ""
+}
+
+// realm returns the realm of the first auth challenge, which some vendors fill with their name
+func realm(h textproto.MIMEHeader) string {
+	for _, c := range h.Values("WWW-Authenticate") {
+		if _, rest, ok := strings.Cut(c, " "); ok {
+			if r := parseAuthParams(rest)["realm"]; r != "" {
+				return r
+			}
+		}
+	}
+	return ""
+}
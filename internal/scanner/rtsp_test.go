@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"net/textproto"
+	"testing"
+)
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		challenges []string
+		want       string
+	}{
+		{
+			name:       "digest preferred",
+			challenges: []string{`Basic realm="cam"`, `Digest realm="IP Camera", nonce="abc123"`},
+			want: `Digest username="admin", realm="IP Camera", nonce="abc123", uri="rtsp://cam/live", response="` +
+				md5hex(md5hex("admin:IP Camera:secret")+":abc123:"+md5hex("DESCRIBE:rtsp://cam/live")) + `"`,
+		},
+		{
+			name:       "basic",
+			challenges: []string{`Basic realm="cam"`},
+			want:       "Basic YWRtaW46c2VjcmV0",
+		},
+		{
+			name:       "unknown scheme",
+			challenges: []string{`Bearer realm="cam"`},
+			want:       "",
+		},
+	}
+	for _, tt := range tests {
+		if got := authorization(tt.challenges, "DESCRIBE", "rtsp://cam/live", "admin", "secret"); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSDPVideoCodec(t *testing.T) {
+	tests := []struct {
+		sdp  string
+		want string
+	}{
+		{"v=0\r\nm=audio 0 RTP/AVP 0\r\na=rtpmap:0 PCMU/8000\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n", "h264"},
+		{"m=video 0 RTP/AVP 98\na=rtpmap:98 H265/90000\n", "h265"},
+		{"m=audio 0 RTP/AVP 0\na=rtpmap:0 PCMU/8000\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := sdpVideoCodec(tt.sdp); got != tt.want {
+			t.Errorf("sdpVideoCodec(%q) = %q, want %q", tt.sdp, got, tt.want)
+		}
+	}
+}
+
+func TestRealm(t *testing.T) {
+	h := textproto.MIMEHeader{"Www-Authenticate": {`Basic`, `Digest realm="Login to 4K00CBPAZ", nonce="x"`}}
+	if got := realm(h); got != "Login to 4K00CBPAZ" {
+		t.Errorf("realm = %q", got)
+	}
+	if got := realm(textproto.MIMEHeader{}); got != "" {
+		t.Errorf("realm without a challenge = %q", got)
+	}
+}
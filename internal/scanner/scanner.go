@@ -0,0 +1,322 @@
+// Package scanner sweeps IP ranges for cameras. Open ports are fingerprinted
+// over RTSP and HTTP to guess the vendor, and the vendor's usual stream paths
+// are checked with RTSP DESCRIBE.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxHosts bounds a single scan so a typo like /8 doesn't run for hours
+const MaxHosts = 4096
+
+var DefaultPorts = []int{554, 8554, 80, 8000}
+
+type Options struct {
+	// CIDRs are ranges or single addresses; empty means the local networks
+	CIDRs    []string
+	Ports    []int
+	Username string
+	Password string
+	// Timeout applies to each connection attempt
+	Timeout     time.Duration
+	Concurrency int
+}
+
+type Port struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"` // rtsp, http or tcp
+	Server   string `json:"server,omitempty"`
+}
+
+type Stream struct {
+	URL   string `json:"url"`
+	Codec string `json:"codec,omitempty"`
+	// Verified means DESCRIBE succeeded; otherwise the URL is the vendor's usual path
+	Verified bool `json:"verified"`
+}
+
+type Host struct {
+	Address      string   `json:"address"`
+	Vendor       string   `json:"vendor,omitempty"`
+	Ports        []Port   `json:"ports"`
+	Streams      []Stream `json:"streams"`
+	AuthRequired bool     `json:"auth_required,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Scan checks every address and port, calling found for each host with an open
+// port and progress after each address. Callbacks are never called concurrently.
+func Scan(ctx context.Context, opts Options, found func(Host), progress func(scanned, total int)) error {
+	if len(opts.Ports) == 0 {
+		opts.Ports = DefaultPorts
+	}
+	for _, p := range opts.Ports {
+		if p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %d", p)
+		}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 700 * time.Millisecond
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 64
+	}
+
+	cidrs := opts.CIDRs
+	if len(cidrs) == 0 {
+		var err error
+		if cidrs, err = LocalNetworks(); err != nil {
+			return err
+		}
+	}
+	addrs, err := expand(cidrs)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	scanned := 0
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, a := range addrs {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(a netip.Addr) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			h, open := scanHost(ctx, a.String(), opts)
+
+			mu.Lock()
+			defer mu.Unlock()
+			scanned++
+			if open {
+				found(h)
+			}
+			progress(scanned, len(addrs))
+		}(a)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// expand turns CIDRs and single addresses into a list of IPv4 host addresses
+func expand(cidrs []string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	seen := map[netip.Addr]bool{}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			c += "/32"
+		}
+		prefix, err := netip.ParsePrefix(c)
+		if err != nil || !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("invalid IPv4 range '%s'", c)
+		}
+		prefix = prefix.Masked()
+		if size := 1 << (32 - prefix.Bits()); size > MaxHosts {
+			return nil, fmt.Errorf("range %s has %d addresses, the limit is %d", prefix, size, MaxHosts)
+		}
+
+		// Skip the network and broadcast addresses of real subnets
+		skipEnds := prefix.Bits() <= 30
+		last := lastAddr(prefix)
+		for a := prefix.Addr(); prefix.Contains(a); a = a.Next() {
+			if skipEnds && (a == prefix.Addr() || a == last) {
+				continue
+			}
+			if !seen[a] {
+				seen[a] = true
+				addrs = append(addrs, a)
+			}
+			if len(addrs) > MaxHosts {
+				return nil, fmt.Errorf("too many addresses, the limit is %d", MaxHosts)
+			}
+			if a == last {
+				break
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses to scan")
+	}
+	return addrs, nil
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().As4()
+	n := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	n |= 1<<(32-p.Bits()) - 1
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+}
+
+// virtualInterfaces are skipped when picking default networks
+var virtualInterfaces = []string{"docker", "br-", "veth", "virbr", "cni", "flannel", "tailscale", "zt", "tun", "wg"}
+
+// LocalNetworks returns the IPv4 networks of the host's physical interfaces.
+// Networks wider than /22 are narrowed to the /24 around the host's address.
+func LocalNetworks() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var networks []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		virtual := false
+		for _, prefix := range virtualInterfaces {
+			virtual = virtual || strings.HasPrefix(iface.Name, prefix)
+		}
+		if virtual {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			ones, _ := ipnet.Mask.Size()
+			if ones < 22 {
+				ones = 24
+			}
+			networks = append(networks, (&net.IPNet{IP: ipnet.IP.Mask(net.CIDRMask(ones, 32)), Mask: net.CIDRMask(ones, 32)}).String())
+		}
+	}
+	if len(networks) == 0 {
+		return nil, fmt.Errorf("no local IPv4 network found")
+	}
+	return networks, nil
+}
+
+// scanHost checks the ports of one address and fingerprints what answers
+func scanHost(ctx context.Context, addr string, opts Options) (Host, bool) {
+	h := Host{Address: addr, Ports: []Port{}, Streams: []Stream{}}
+	d := net.Dialer{Timeout: opts.Timeout}
+
+	var hints []string
+	var rtspPorts []int
+	for _, port := range opts.Ports {
+		hostPort := net.JoinHostPort(addr, strconv.Itoa(port))
+		conn, err := d.DialContext(ctx, "tcp", hostPort)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		p := Port{Port: port, Protocol: "tcp"}
+		if resp, err := rtspRequest(ctx, hostPort, "OPTIONS", "rtsp://"+hostPort+"/", nil, 2*opts.Timeout); err == nil {
+			p.Protocol = "rtsp"
+			p.Server = resp.Header.Get("Server")
+			hints = append(hints, p.Server, realm(resp.Header))
+			rtspPorts = append(rtspPorts, port)
+		} else if server, realm, ok := httpFingerprint(ctx, hostPort, 2*opts.Timeout); ok {
+			p.Protocol = "http"
+			p.Server = server
+			hints = append(hints, server, realm)
+		}
+		h.Ports = append(h.Ports, p)
+	}
+	if len(h.Ports) == 0 {
+		return h, false
+	}
+
+	v := identify(hints...)
+	if v != nil {
+		h.Vendor = v.Name
+	}
+	for _, port := range rtspPorts {
+		findStreams(ctx, &h, v, net.JoinHostPort(addr, strconv.Itoa(port)), opts)
+	}
+
+	// A camera found only over HTTP most likely serves RTSP on the default port
+	if len(rtspPorts) == 0 && v != nil {
+		for _, path := range v.Paths {
+			h.Streams = append(h.Streams, Stream{URL: "rtsp://" + net.JoinHostPort(addr, "554") + path})
+		}
+	}
+	return h, true
+}
+
+// findStreams tries the candidate paths on one RTSP port
+func findStreams(ctx context.Context, h *Host, v *vendor, hostPort string, opts Options) {
+	const maxStreams = 2
+
+	// Cameras that challenge every path give no hint about which exist
+	if opts.Username == "" {
+		resp, err := describe(ctx, hostPort, "rtsp://"+hostPort+"/", "", "", 2*opts.Timeout)
+		if err == nil && resp.Status == 401 {
+			h.AuthRequired = true
+			if v != nil {
+				for _, path := range v.Paths {
+					h.Streams = append(h.Streams, Stream{URL: "rtsp://" + hostPort + path})
+				}
+			}
+			return
+		}
+	}
+
+	verified := 0
+	for _, path := range candidatePaths(v) {
+		if verified >= maxStreams || ctx.Err() != nil {
+			return
+		}
+		uri := "rtsp://" + hostPort + path
+		resp, err := describe(ctx, hostPort, uri, opts.Username, opts.Password, 2*opts.Timeout)
+		if err != nil {
+			continue
+		}
+		switch {
+		case resp.Status == 200:
+			h.Streams = append(h.Streams, Stream{URL: uri, Codec: sdpVideoCodec(resp.Body), Verified: true})
+			verified++
+		case resp.Status == 401:
+			h.AuthRequired = true
+			h.Error = "camera rejected the credentials"
+			return
+		}
+	}
+}
+
+// httpFingerprint reads the Server header and auth realm of a web interface
+func httpFingerprint(ctx context.Context, hostPort string, timeout time.Duration) (server, realmName string, ok bool) {
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+hostPort+"/", nil)
+	if err != nil {
+		return "", "", false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", false
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Server"), realm(textproto.MIMEHeader(resp.Header)), true
+}
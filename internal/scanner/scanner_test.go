@@ -0,0 +1,199 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		cidrs   []string
+		want    []string
+		wantErr string
+	}{
+		{[]string{"10.0.0.5"}, []string{"10.0.0.5"}, ""},
+		{[]string{"10.0.0.0/30"}, []string{"10.0.0.1", "10.0.0.2"}, ""},
+		{[]string{"10.0.0.4/31"}, []string{"10.0.0.4", "10.0.0.5"}, ""},
+		{[]string{"10.0.0.1/30", " 10.0.0.2 ", ""}, []string{"10.0.0.1", "10.0.0.2"}, ""},
+		{[]string{"fe80::1"}, nil, "invalid IPv4 range"},
+		{[]string{"10.0.0.0/16"}, nil, "the limit is"},
+		{[]string{"10.0.0.0/21", "10.1.0.0/21", "10.2.0.0/24"}, nil, "too many addresses"},
+		{[]string{""}, nil, "no addresses"},
+	}
+	for _, tt := range tests {
+		addrs, err := expand(tt.cidrs)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expand(%v) error = %v, want %q", tt.cidrs, err, tt.wantErr)
+			}
+			continue
+		}
+		var got []string
+		for _, a := range addrs {
+			got = append(got, a.String())
+		}
+		if err != nil || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("expand(%v) = %v, %v; want %v", tt.cidrs, got, err, tt.want)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		hints []string
+		want  string
+	}{
+		{[]string{"", "App-webs/"}, "hikvision"},
+		{[]string{"Login to 4K00CBPAZ"}, "dahua"},
+		{[]string{"lighttpd", "TP-LINK IP-Camera"}, "tp-link"},
+		{[]string{"nginx"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		name := ""
+		if v := identify(tt.hints...); v != nil {
+			name = v.Name
+		}
+		if name != tt.want {
+			t.Errorf("identify(%q) = %q, want %q", tt.hints, name, tt.want)
+		}
+	}
+
+	paths := candidatePaths(nil)
+	if paths[0] != vendors[0].Paths[0] || paths[len(paths)-1] != genericPaths[len(genericPaths)-1] {
+		t.Errorf("generic candidate paths = %v", paths)
+	}
+}
+
+// fakeCamera serves RTSP like a Hikvision camera with one stream behind
+// Digest authentication for admin/secret
+func fakeCamera(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	const realmName, nonce = "IP Camera", "abc123"
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				tp := textproto.NewReader(bufio.NewReader(conn))
+				line, err := tp.ReadLine()
+				if err != nil {
+					return
+				}
+				hdr, _ := tp.ReadMIMEHeader()
+				method, rest, _ := strings.Cut(line, " ")
+				uri, _, _ := strings.Cut(rest, " ")
+
+				reply := func(status string, header, body string) {
+					fmt.Fprintf(conn, "RTSP/1.0 %s\r\nCSeq: 1\r\nServer: Hikvision-Webs\r\n%sContent-Length: %d\r\n\r\n%s", status, header, len(body), body)
+				}
+				if method == "OPTIONS" {
+					reply("200 OK", "Public: DESCRIBE\r\n", "")
+					return
+				}
+				challenge := fmt.Sprintf("WWW-Authenticate: Digest realm=%q, nonce=%q\r\n", realmName, nonce)
+				want := authorization([]string{fmt.Sprintf("Digest realm=%q, nonce=%q", realmName, nonce)}, method, uri, "admin", "secret")
+				switch {
+				case hdr.Get("Authorization") != want:
+					reply("401 Unauthorized", challenge, "")
+				case strings.HasSuffix(uri, "/Streaming/Channels/101"):
+					reply("200 OK", "Content-Type: application/sdp\r\n", "v=0\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H265/90000\r\n")
+				default:
+					reply("404 Not Found", "", "")
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestScan(t *testing.T) {
+	port := fakeCamera(t)
+	hostPort := fmt.Sprintf("127.0.0.1:%d", port)
+
+	tests := []struct {
+		name         string
+		password     string
+		wantStreams  []Stream
+		wantAuth     bool
+		wantErrorSet bool
+	}{
+		{
+			name:     "without credentials",
+			wantAuth: true,
+			wantStreams: []Stream{
+				{URL: "rtsp://" + hostPort + "/Streaming/Channels/101"},
+				{URL: "rtsp://" + hostPort + "/Streaming/Channels/102"},
+				{URL: "rtsp://" + hostPort + "/h264/ch1/main/av_stream"},
+			},
+		},
+		{
+			name:        "with credentials",
+			password:    "secret",
+			wantStreams: []Stream{{URL: "rtsp://" + hostPort + "/Streaming/Channels/101", Codec: "h265", Verified: true}},
+		},
+		{
+			name:         "wrong password",
+			password:     "wrong",
+			wantAuth:     true,
+			wantErrorSet: true,
+			wantStreams:  []Stream{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{CIDRs: []string{"127.0.0.1"}, Ports: []int{port}, Timeout: time.Second}
+			if tt.password != "" {
+				opts.Username, opts.Password = "admin", tt.password
+			}
+			var hosts []Host
+			var progress []int
+			err := Scan(context.Background(), opts, func(h Host) { hosts = append(hosts, h) }, func(scanned, total int) {
+				progress = append(progress, scanned, total)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(progress) != 2 || progress[0] != 1 || progress[1] != 1 {
+				t.Errorf("progress = %v", progress)
+			}
+			if len(hosts) != 1 {
+				t.Fatalf("found %d hosts, want 1", len(hosts))
+			}
+			h := hosts[0]
+			if h.Vendor != "hikvision" || len(h.Ports) != 1 || h.Ports[0].Protocol != "rtsp" || h.Ports[0].Server != "Hikvision-Webs" {
+				t.Errorf("host = %+v", h)
+			}
+			if h.AuthRequired != tt.wantAuth || (h.Error != "") != tt.wantErrorSet {
+				t.Errorf("auth required %v, error %q", h.AuthRequired, h.Error)
+			}
+			if fmt.Sprint(h.Streams) != fmt.Sprint(tt.wantStreams) {
+				t.Errorf("streams = %+v, want %+v", h.Streams, tt.wantStreams)
+			}
+		})
+	}
+}
+
+func TestScanRejectsBadPorts(t *testing.T) {
+	for _, port := range []int{0, 70000} {
+		err := Scan(context.Background(), Options{CIDRs: []string{"127.0.0.1"}, Ports: []int{port}}, func(Host) {}, func(int, int) {})
+		if err == nil {
+			t.Errorf("port %d was accepted", port)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import "strings"
+
+// vendor describes how to recognise a camera brand and where it serves its streams
+type vendor struct {
+	Name string
+	// Markers are matched case-insensitively against Server headers and auth realms
+	Markers []string
+	// Paths are tried in order; the first is usually the main stream
+	Paths []string
+}
+
+var vendors = []vendor{
+	{
+		Name:    "hikvision",
+		Markers: []string{"hikvision", "app-webs", "dnvrs-webs", "davinci"},
+		Paths:   []string{"/Streaming/Channels/101", "/Streaming/Channels/102", "/h264/ch1/main/av_stream"},
+	},
+	{
+		Name:    "dahua",
+		Markers: []string{"dahua", "amcrest", "lorex", "login to "},
+		Paths:   []string{"/cam/realmonitor?channel=1&subtype=0", "/cam/realmonitor?channel=1&subtype=1"},
+	},
+	{
+		Name:    "reolink",
+		Markers: []string{"reolink"},
+		Paths:   []string{"/h264Preview_01_main", "/h264Preview_01_sub", "/Preview_01_main"},
+	},
+	{
+		Name:    "axis",
+		Markers: []string{"axis"},
+		Paths:   []string{"/axis-media/media.amp"},
+	},
+	{
+		Name:    "uniview",
+		Markers: []string{"uniview", "unv"},
+		Paths:   []string{"/unicast/c1/s0/live", "/unicast/c1/s1/live", "/media/video1"},
+	},
+	{
+		Name:    "hanwha",
+		Markers: []string{"hanwha", "wisenet", "samsung"},
+		Paths:   []string{"/profile2/media.smp", "/profile1/media.smp"},
+	},
+	{
+		Name:    "tp-link",
+		Markers: []string{"tp-link", "tapo", "vigi"},
+		Paths:   []string{"/stream1", "/stream2"},
+	},
+	{
+		Name:    "foscam",
+		Markers: []string{"foscam"},
+		Paths:   []string{"/videoMain", "/videoSub"},
+	},
+	{
+		Name:    "ubiquiti",
+		Markers: []string{"ubnt", "ubiquiti", "unifi"},
+		Paths:   []string{"/s0", "/s1"},
+	},
+}
+
+// genericPaths are tried when the vendor is unknown, after every vendor's main stream
+var genericPaths = []string{"/", "/live", "/stream", "/live/ch00_0", "/ch0_0.h264", "/11", "/12", "/video1"}
+
+// identify returns the vendor whose marker appears in any of the given strings
+func identify(hints ...string) *vendor {
+	for _, h := range hints {
+		h = strings.ToLower(h)
+		if h == "" {
+			continue
+		}
+		for i := range vendors {
+			for _, m := range vendors[i].Markers {
+				if strings.Contains(h, m) {
+					return &vendors[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// candidatePaths lists the URL paths to try for a camera of the given vendor
+func candidatePaths(v *vendor) []string {
+	if v != nil {
+		return v.Paths
+	}
+	paths := []string{}
+	for _, v := range vendors {
+		paths = append(paths, v.Paths[0])
+	}
+	return append(paths, genericPaths...)
+}
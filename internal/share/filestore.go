@@ -0,0 +1,150 @@
+package share
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// FileStore keeps share links in a local JSON file for File/YAML mode
+type FileStore struct {
+	FilePath string
+	mu       sync.Mutex
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() ([]models.ShareLink, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var links []models.ShareLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (fs *FileStore) save(links []models.ShareLink) error {
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetShareLinks(stream string) ([]models.ShareLink, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	all, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var links []models.ShareLink
+	for _, l := range all {
+		if stream == "" || l.Stream == stream {
+			links = append(links, l)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CreatedAt.After(links[j].CreatedAt)
+	})
+	return links, nil
+}
+
+func (fs *FileStore) GetShareLink(id string) (*models.ShareLink, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	links, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		if l.ID == id {
+			return &l, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *FileStore) AddShareLink(l models.ShareLink) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	links, err := fs.load()
+	if err != nil {
+		return err
+	}
+	return fs.save(append(links, l))
+}
+
+func (fs *FileStore) RevokeShareLink(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	links, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for i := range links {
+		if links[i].ID == id {
+			links[i].Revoked = true
+		}
+	}
+	return fs.save(links)
+}
+
+// RevokeStreamShareLinks revokes every link of a stream
+func (fs *FileStore) RevokeStreamShareLinks(stream string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	links, err := fs.load()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range links {
+		if links[i].Stream == stream && !links[i].Revoked {
+			links[i].Revoked = true
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return fs.save(links)
+}
+
+func (fs *FileStore) CountShareView(id string) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	links, err := fs.load()
+	if err != nil {
+		return false, err
+	}
+	for i := range links {
+		if links[i].ID != id {
+			continue
+		}
+		if links[i].MaxViews > 0 && links[i].Views >= links[i].MaxViews {
+			return false, nil
+		}
+		links[i].Views++
+		return true, fs.save(links)
+	}
+	return false, nil
+}
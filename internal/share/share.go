@@ -0,0 +1,261 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+)
+
+var (
+	ErrInvalid   = errors.New("invalid share link")
+	ErrExpired   = errors.New("share link has expired")
+	ErrRevoked   = errors.New("share link has been revoked")
+	ErrViewLimit = errors.New("share link has reached its view limit")
+	ErrWrongSrc  = errors.New("share link is not valid for this stream")
+)
+
+// Store is implemented by db.Store in DB mode and FileStore otherwise
+type Store interface {
+	GetShareLinks(stream string) ([]models.ShareLink, error)
+	GetShareLink(id string) (*models.ShareLink, error)
+	AddShareLink(l models.ShareLink) error
+	RevokeShareLink(id string) error
+	RevokeStreamShareLinks(stream string) error
+	CountShareView(id string) (bool, error)
+}
+
+// Service issues and checks share tokens. A token is "<id>.<signature>", where the
+// signature covers the link's id, stream and expiry so it cannot be moved to another camera.
+// Opening a link with a view limit hands the player a view token, "<id>.<view>.<signature>",
+// which is tied to one counted view; only view tokens reach the media of such a link.
+// Links are bound to a stream name, so they are revoked when their stream is deleted
+// or renamed rather than passed on to a later stream of the same name.
+type Service struct {
+	Store  Store
+	key    []byte
+	MaxTTL time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewService(store Store, key []byte) *Service {
+	return &Service{
+		Store:  store,
+		key:    key,
+		MaxTTL: 30 * 24 * time.Hour,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start revokes the links of deleted and renamed streams as they are announced
+func (s *Service) Start(hub *events.Hub) {
+	ch := hub.Queue()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer hub.Unsubscribe(ch)
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case ev := <-ch:
+				for _, ev := range events.Expand(ev) {
+					s.followStream(ev)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// followStream revokes the links of a stream that is gone under its name
+func (s *Service) followStream(ev events.Event) {
+	data, _ := ev.Data.(map[string]interface{})
+	name, _ := data["name"].(string)
+	oldName, _ := data["originalName"].(string)
+
+	gone := ""
+	switch {
+	case ev.Type == events.StreamDeleted:
+		gone = name
+	case ev.Type == events.StreamUpdated && oldName != "" && oldName != name:
+		gone = oldName
+	}
+	if gone == "" {
+		return
+	}
+	if err := s.Store.RevokeStreamShareLinks(gone); err != nil {
+		log.Printf("[Share] Failed to revoke the links of %s: %v", gone, err)
+	}
+}
+
+func (s *Service) mac(fields ...string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) sign(l models.ShareLink) string {
+	return s.mac(l.ID, l.Stream, strconv.FormatInt(l.ExpiresAt.Unix(), 10))
+}
+
+// Token returns the token for an existing link
+func (s *Service) Token(l models.ShareLink) string {
+	return l.ID + "." + s.sign(l)
+}
+
+func (s *Service) signView(l models.ShareLink, view int) string {
+	return s.mac(l.ID, l.Stream, strconv.FormatInt(l.ExpiresAt.Unix(), 10), "view", strconv.Itoa(view))
+}
+
+// viewToken returns the token the player uses for one counted view of a link
+func (s *Service) viewToken(l models.ShareLink, view int) string {
+	return l.ID + "." + strconv.Itoa(view) + "." + s.signView(l, view)
+}
+
+// Create issues a link for one stream. maxViews of 0 means unlimited.
+func (s *Service) Create(stream, createdBy string, ttl time.Duration, maxViews int) (*models.ShareLink, error) {
+	if stream == "" {
+		return nil, fmt.Errorf("stream is required")
+	}
+	if ttl <= 0 || ttl > s.MaxTTL {
+		return nil, fmt.Errorf("expiry must be between 1s and %s", s.MaxTTL)
+	}
+	if maxViews < 0 {
+		return nil, fmt.Errorf("max views cannot be negative")
+	}
+
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	l := models.ShareLink{
+		ID:        hex.EncodeToString(b),
+		Stream:    stream,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		// Truncate so the signed expiry survives a round trip through the store
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+		MaxViews:  maxViews,
+	}
+	if err := s.Store.AddShareLink(l); err != nil {
+		return nil, err
+	}
+	l.Token = s.Token(l)
+	return &l, nil
+}
+
+// List returns the links of a stream (or all streams) with their tokens filled in
+func (s *Service) List(stream string) ([]models.ShareLink, error) {
+	links, err := s.Store.GetShareLinks(stream)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		links[i].Token = s.Token(links[i])
+	}
+	return links, nil
+}
+
+func (s *Service) Revoke(id string) error {
+	return s.Store.RevokeShareLink(id)
+}
+
+// Validate checks a token for the media proxies without counting a view. If
+// stream is non-empty the link must belong to it. A link with a view limit only
+// accepts the view tokens handed out by Open, so its media can't be played
+// without a counted view; a player opened that way keeps working until the link
+// expires or is revoked, even once the limit has been reached.
+func (s *Service) Validate(token, stream string) (*models.ShareLink, error) {
+	l, view, err := s.check(token)
+	if err != nil {
+		return nil, err
+	}
+	if l.MaxViews > 0 && view == 0 {
+		return nil, ErrViewLimit
+	}
+	if stream != "" && l.Stream != stream {
+		return nil, ErrWrongSrc
+	}
+	return l, nil
+}
+
+// check verifies a link or view token and the link's state. view is the counted
+// view a view token stands for, or 0 for a link token.
+func (s *Service) check(token string) (*models.ShareLink, int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return nil, 0, ErrInvalid
+	}
+
+	l, err := s.Store.GetShareLink(parts[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	if l == nil {
+		return nil, 0, ErrInvalid
+	}
+	view := 0
+	if len(parts) == 3 {
+		view, err = strconv.Atoi(parts[1])
+		// Only views that were actually counted have been handed out
+		if err != nil || view < 1 || view > l.Views || !hmac.Equal([]byte(parts[2]), []byte(s.signView(*l, view))) {
+			return nil, 0, ErrInvalid
+		}
+	} else if !hmac.Equal([]byte(parts[1]), []byte(s.sign(*l))) {
+		return nil, 0, ErrInvalid
+	}
+	if l.Revoked {
+		return nil, 0, ErrRevoked
+	}
+	if time.Now().After(l.ExpiresAt) {
+		return nil, 0, ErrExpired
+	}
+	return l, view, nil
+}
+
+// Open validates a link token and counts one view against its limit. The
+// returned link's Token is the one to give the player: a view token for this
+// view if the link has a limit, the link token otherwise.
+func (s *Service) Open(token string) (*models.ShareLink, error) {
+	l, view, err := s.check(token)
+	if err != nil {
+		return nil, err
+	}
+	if view != 0 {
+		return nil, ErrInvalid
+	}
+	ok, err := s.Store.CountShareView(l.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrViewLimit
+	}
+	l.Views++
+	l.Token = token
+	if l.MaxViews > 0 {
+		l.Token = s.viewToken(*l, l.Views)
+	}
+	return l, nil
+}
@@ -0,0 +1,212 @@
+package share
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	return NewService(NewFileStore(filepath.Join(t.TempDir(), "shares.json")), []byte("test key"))
+}
+
+func TestCreateValidates(t *testing.T) {
+	s := newTestService(t)
+	tests := []struct {
+		stream   string
+		ttl      time.Duration
+		maxViews int
+	}{
+		{"", time.Hour, 0},
+		{"cam", 0, 0},
+		{"cam", s.MaxTTL + time.Second, 0},
+		{"cam", time.Hour, -1},
+	}
+	for _, tt := range tests {
+		if _, err := s.Create(tt.stream, "alice", tt.ttl, tt.maxViews); err == nil {
+			t.Errorf("Create(%q, %s, %d) was accepted", tt.stream, tt.ttl, tt.maxViews)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := newTestService(t)
+	link, err := s.Create("yard", "alice", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, sig, _ := strings.Cut(link.Token, ".")
+
+	other := NewService(s.Store, []byte("another key"))
+	tests := []struct {
+		name   string
+		svc    *Service
+		token  string
+		stream string
+		want   error
+	}{
+		{"valid", s, link.Token, "yard", nil},
+		{"any stream", s, link.Token, "", nil},
+		{"other stream", s, link.Token, "door", ErrWrongSrc},
+		{"tampered signature", s, id + "." + sig[1:] + "A", "yard", ErrInvalid},
+		{"unknown id", s, "ffff." + sig, "yard", ErrInvalid},
+		{"no signature", s, id, "yard", ErrInvalid},
+		{"empty", s, "", "yard", ErrInvalid},
+		{"other key", other, link.Token, "yard", ErrInvalid},
+		{"forged view token", s, id + ".1." + sig, "yard", ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := tt.svc.Validate(tt.token, tt.stream); err != tt.want {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := s.Revoke(link.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(link.Token, "yard"); err != ErrRevoked {
+		t.Errorf("revoked: Validate = %v, want ErrRevoked", err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	s := newTestService(t)
+	l := models.ShareLink{ID: "abc", Stream: "yard", ExpiresAt: time.Now().Add(-time.Minute).Truncate(time.Second)}
+	if err := s.Store.AddShareLink(l); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(s.Token(l), "yard"); err != ErrExpired {
+		t.Errorf("Validate = %v, want ErrExpired", err)
+	}
+	if _, err := s.Open(s.Token(l)); err != ErrExpired {
+		t.Errorf("Open = %v, want ErrExpired", err)
+	}
+}
+
+func TestViewLimit(t *testing.T) {
+	s := newTestService(t)
+	link, err := s.Create("yard", "alice", time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The link token alone can't reach the media of a limited link
+	if _, err := s.Validate(link.Token, "yard"); err != ErrViewLimit {
+		t.Errorf("link token: Validate = %v, want ErrViewLimit", err)
+	}
+
+	var players []string
+	for i := 1; i <= 2; i++ {
+		opened, err := s.Open(link.Token)
+		if err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+		if opened.Views != i || opened.Token == link.Token {
+			t.Fatalf("open %d = %+v, want view %d with a view token", i, opened, i)
+		}
+		players = append(players, opened.Token)
+	}
+	if _, err := s.Open(link.Token); err != ErrViewLimit {
+		t.Errorf("third open = %v, want ErrViewLimit", err)
+	}
+
+	// Players opened before the limit keep working
+	for _, token := range players {
+		if _, err := s.Validate(token, "yard"); err != nil {
+			t.Errorf("view token: Validate = %v", err)
+		}
+		if _, err := s.Validate(token, "door"); err != ErrWrongSrc {
+			t.Errorf("view token on another stream: Validate = %v, want ErrWrongSrc", err)
+		}
+		if _, err := s.Open(token); err != ErrInvalid {
+			t.Errorf("opening a view token = %v, want ErrInvalid", err)
+		}
+	}
+
+	// Views that were never counted have no valid token
+	if _, err := s.Validate(s.viewToken(*link, 3), "yard"); err != ErrInvalid {
+		t.Errorf("uncounted view: Validate = %v, want ErrInvalid", err)
+	}
+}
+
+func TestUnlimitedOpenKeepsLinkToken(t *testing.T) {
+	s := newTestService(t)
+	link, err := s.Create("yard", "alice", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := s.Open(link.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Token != link.Token || opened.Views != 1 {
+		t.Errorf("opened = %+v", opened)
+	}
+}
+
+func TestStreamChangesRevokeLinks(t *testing.T) {
+	tests := []struct {
+		name        string
+		ev          events.Event
+		wantRevoked bool
+	}{
+		{"deleted", events.Event{Type: events.StreamDeleted, Data: map[string]interface{}{"name": "yard"}}, true},
+		{"renamed", events.Event{Type: events.StreamUpdated, Data: map[string]interface{}{"name": "gate", "originalName": "yard"}}, true},
+		{"updated in place", events.Event{Type: events.StreamUpdated, Data: map[string]interface{}{"name": "yard", "originalName": "yard"}}, false},
+		{"other stream deleted", events.Event{Type: events.StreamDeleted, Data: map[string]interface{}{"name": "door"}}, false},
+		{"added", events.Event{Type: events.StreamAdded, Data: map[string]interface{}{"name": "yard"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			link, err := s.Create("yard", "alice", time.Hour, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.followStream(tt.ev)
+			_, err = s.Validate(link.Token, "")
+			if revoked := err == ErrRevoked; revoked != tt.wantRevoked {
+				t.Errorf("Validate = %v, want revoked %v", err, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestStartRevokesLinksOfBatchChanges(t *testing.T) {
+	s := newTestService(t)
+	hub := events.NewHub()
+	s.Start(hub)
+	defer s.Stop()
+
+	var tokens []string
+	for _, stream := range []string{"yard", "door", "gate"} {
+		link, err := s.Create(stream, "alice", time.Hour, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, link.Token)
+	}
+	hub.Publish(events.StreamsChanged, events.Batch{Changes: []events.Change{
+		{Type: events.StreamDeleted, Data: map[string]interface{}{"name": "yard"}},
+		{Type: events.StreamUpdated, Data: map[string]interface{}{"name": "porch", "originalName": "door"}},
+	}})
+
+	want := []error{ErrRevoked, ErrRevoked, nil}
+	deadline := time.Now().Add(5 * time.Second)
+	for i, token := range tokens {
+		for {
+			_, err := s.Validate(token, "")
+			if err == want[i] {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("link %d: Validate = %v, want %v", i, err, want[i])
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"time"
+)
+
+// ErrInvalidOptions is returned for a width or quality out of range
+var ErrInvalidOptions = errors.New("invalid snapshot options")
+
+// Limits of the snapshot options
+const (
+	MinWidth       = 16
+	MaxWidth       = 3840
+	DefaultQuality = 80
+)
+
+// Options ask for a smaller or more compressed frame. The zero value returns
+// the frame as captured.
+type Options struct {
+	// Width scales the frame down, keeping its aspect ratio. Frames are never enlarged.
+	Width int
+	// Quality is the JPEG quality from 1 to 100
+	Quality int
+	// MaxAge lowers the TTL of the cached frame for this request
+	MaxAge time.Duration
+}
+
+func (o Options) validate() error {
+	if o.Width != 0 && (o.Width < MinWidth || o.Width > MaxWidth) {
+		return fmt.Errorf("%w: width must be between %d and %d", ErrInvalidOptions, MinWidth, MaxWidth)
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("%w: quality must be between 1 and 100", ErrInvalidOptions)
+	}
+	return nil
+}
+
+// transform scales a JPEG down to opts.Width and encodes it with opts.Quality
+func transform(data []byte, opts Options) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if opts.Width > 0 && opts.Width < img.Bounds().Dx() {
+		img = scaleDown(img, opts.Width)
+	}
+	quality := opts.Quality
+	if quality == 0 {
+		quality = DefaultQuality
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown shrinks img to the given width by averaging the source pixels
+// covered by each target pixel, which keeps thumbnails free of aliasing
+func scaleDown(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	// draw converts the camera's YCbCr in one fast pass
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	sw, sh := b.Dx(), b.Dy()
+	height := max(1, sh*width/sw)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+			var sum [3]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(sum[0]/n), uint8(sum[1]/n), uint8(sum[2]/n), 0xFF
+		}
+	}
+	return dst
+}
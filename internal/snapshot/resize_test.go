@@ -0,0 +1,91 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testJPEG encodes a w×h frame, red on the left half and blue on the right
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= w/2 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts Options
+		ok   bool
+	}{
+		{Options{}, true},
+		{Options{Width: MinWidth, Quality: 1}, true},
+		{Options{Width: MaxWidth, Quality: 100}, true},
+		{Options{Width: MinWidth - 1}, false},
+		{Options{Width: MaxWidth + 1}, false},
+		{Options{Quality: -1}, false},
+		{Options{Quality: 101}, false},
+	}
+	for _, tt := range tests {
+		err := tt.opts.validate()
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrInvalidOptions)) {
+			t.Errorf("validate(%+v) = %v, want ok %v", tt.opts, err, tt.ok)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	src := testJPEG(t, 64, 32)
+	tests := []struct {
+		name         string
+		opts         Options
+		wantW, wantH int
+	}{
+		{"scaled down", Options{Width: 16}, 16, 8},
+		{"never enlarged", Options{Width: 128}, 64, 32},
+		{"quality only", Options{Quality: 10}, 64, 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := transform(src, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+			// The halves keep their colours
+			left, right := img.At(1, tt.wantH/2), img.At(tt.wantW-2, tt.wantH/2)
+			if r, _, b, _ := left.RGBA(); r>>8 < 200 || b>>8 > 60 {
+				t.Errorf("left pixel = %v", left)
+			}
+			if r, _, b, _ := right.RGBA(); r>>8 > 60 || b>>8 < 200 {
+				t.Errorf("right pixel = %v", right)
+			}
+		})
+	}
+
+	if _, err := transform([]byte("not a jpeg"), Options{Width: 16}); err == nil {
+		t.Error("transform accepted a broken frame")
+	}
+}
@@ -0,0 +1,347 @@
+// Package snapshot grabs still frames of streams. Frames come from the running
+// engine where it can serve them and from ffmpeg otherwise. The latest frame
+// of every stream is cached for a short while, so dashboards full of
+// thumbnails don't start a capture per viewer.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/metrics"
+	"web-tr/internal/models"
+	"web-tr/internal/stream"
+	"web-tr/internal/transcode"
+)
+
+var (
+	ErrNotFound = errors.New("stream not found")
+	// ErrUnavailable wraps the reason no frame could be captured
+	ErrUnavailable = errors.New("no frame available")
+	// ErrTimeout is returned along with ErrUnavailable when the capture ran out of time
+	ErrTimeout = errors.New("snapshot timed out")
+)
+
+// Frame sources
+const (
+	SourceEngine = "engine"
+	SourceFFmpeg = "ffmpeg"
+)
+
+const (
+	// maxFrameBytes bounds a frame read from an engine or ffmpeg
+	maxFrameBytes = 16 << 20
+	// maxVariants bounds the scaled copies kept of one cached frame
+	maxVariants = 8
+)
+
+var (
+	captureDuration = metrics.NewHistogramVec("webtr_snapshot_duration_seconds",
+		"Time taken to capture a snapshot from the engine or ffmpeg.", nil, "stream")
+	captureErrors = metrics.NewCounterVec("webtr_snapshot_errors_total",
+		"Snapshots that failed.", "stream")
+)
+
+// Streams finds a stream with its engine and the camera URL with credentials,
+// see stream.Manager
+type Streams interface {
+	Lookup(name string) (models.Stream, stream.Engine, bool)
+	SourceURL(name string) (string, error)
+}
+
+// Frame is a JPEG captured from a stream
+type Frame struct {
+	JPEG   []byte
+	Time   time.Time
+	Source string
+}
+
+// Service captures and caches frames
+type Service struct {
+	Streams Streams
+	Client  *http.Client
+	// TTL is how long a frame, or a failed capture, is reused
+	TTL time.Duration
+	// Timeout bounds one capture
+	Timeout time.Duration
+	// FFmpeg is the binary used when the engine has no frame
+	FFmpeg string
+
+	mu       sync.Mutex
+	cache    map[string]*entry
+	inflight map[string]*capture
+	// ffmpegSlots limits the ffmpeg processes running at once
+	ffmpegSlots chan struct{}
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// entry is the result of the latest capture of a stream. Only variants changes
+// after it is cached, under the service lock.
+type entry struct {
+	frame    *Frame
+	err      error
+	captured time.Time
+	variants map[Options][]byte
+}
+
+// fresh reports whether e can still be handed out to a request with maxAge
+func (s *Service) fresh(e *entry, maxAge time.Duration) bool {
+	ttl := s.TTL
+	if maxAge > 0 && maxAge < ttl {
+		ttl = maxAge
+	}
+	return time.Since(e.captured) < ttl
+}
+
+// capture is a capture in progress; result is set before done is closed
+type capture struct {
+	done   chan struct{}
+	result *entry
+}
+
+func NewService(streams Streams) *Service {
+	return &Service{
+		Streams:     streams,
+		Client:      &http.Client{},
+		TTL:         5 * time.Second,
+		Timeout:     10 * time.Second,
+		FFmpeg:      stream.FindBinary("ffmpeg"),
+		cache:       make(map[string]*entry),
+		inflight:    make(map[string]*capture),
+		ffmpegSlots: make(chan struct{}, 4),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Get returns the current frame of a stream scaled and encoded as opts asks.
+// Concurrent requests for the same stream share one capture.
+func (s *Service) Get(ctx context.Context, name string, opts Options) (*Frame, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	st, engine, found := s.Streams.Lookup(name)
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	s.mu.Lock()
+	if e, ok := s.cache[name]; ok && s.fresh(e, opts.MaxAge) {
+		s.mu.Unlock()
+		return s.render(e, opts)
+	}
+	// A capture in progress is as fresh as any, whatever the request's MaxAge
+	if c, busy := s.inflight[name]; busy {
+		s.mu.Unlock()
+		select {
+		case <-c.done:
+			return s.render(c.result, opts)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &capture{done: make(chan struct{})}
+	s.inflight[name] = c
+	s.mu.Unlock()
+
+	// The capture outlives a client that gives up, the next one gets its result
+	frame, err := s.capture(st, engine)
+
+	s.mu.Lock()
+	c.result = &entry{frame: frame, err: err, captured: time.Now()}
+	s.cache[name] = c.result
+	delete(s.inflight, name)
+	close(c.done)
+	s.mu.Unlock()
+	return s.render(c.result, opts)
+}
+
+// Forget drops the cached frame of a stream, e.g. after its source changed
+func (s *Service) Forget(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, name)
+}
+
+// Start drops the cached frame of streams changed or removed on the hub until
+// Stop is called, so a new camera URL shows up without waiting for the TTL
+func (s *Service) Start(hub *events.Hub) {
+	ch := hub.Queue()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer hub.Unsubscribe(ch)
+		for {
+			select {
+			case <-s.stop:
+				return
+			case ev := <-ch:
+				for _, ev := range events.Expand(ev) {
+					if ev.Type != events.StreamUpdated && ev.Type != events.StreamDeleted {
+						continue
+					}
+					data, _ := ev.Data.(map[string]interface{})
+					for _, key := range []string{"name", "originalName"} {
+						if name, ok := data[key].(string); ok {
+							s.Forget(name)
+						}
+					}
+					// The series of a stream that is gone under its name would stay forever
+					gone, _ := data["originalName"].(string)
+					if ev.Type == events.StreamDeleted {
+						gone, _ = data["name"].(string)
+					}
+					if gone != "" {
+						captureDuration.Delete(gone)
+						captureErrors.Delete(gone)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the event loop
+func (s *Service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// render returns a cached frame in the requested size and quality
+func (s *Service) render(e *entry, opts Options) (*Frame, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	// Variants are kept by size and quality only
+	opts.MaxAge = 0
+	if opts == (Options{}) {
+		return e.frame, nil
+	}
+	s.mu.Lock()
+	data, ok := e.variants[opts]
+	s.mu.Unlock()
+	if ok {
+		return &Frame{JPEG: data, Time: e.frame.Time, Source: e.frame.Source}, nil
+	}
+
+	data, err := transform(e.frame.JPEG, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	s.mu.Lock()
+	if e.variants == nil {
+		e.variants = make(map[Options][]byte)
+	}
+	if len(e.variants) < maxVariants {
+		e.variants[opts] = data
+	}
+	s.mu.Unlock()
+	return &Frame{JPEG: data, Time: e.frame.Time, Source: e.frame.Source}, nil
+}
+
+// capture asks the engine for a frame and falls back to ffmpeg on the camera
+func (s *Service) capture(st models.Stream, engine stream.Engine) (*Frame, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() { captureDuration.With(st.Name).Observe(time.Since(start).Seconds()) }()
+
+	var engineErr error
+	if target := engine.FrameURL(st.Name); target != "" {
+		data, err := s.fromEngine(ctx, target)
+		if err == nil {
+			return &Frame{JPEG: data, Time: time.Now().UTC(), Source: SourceEngine}, nil
+		}
+		engineErr = err
+	}
+
+	data, err := s.fromFFmpeg(ctx, st.Name)
+	if err == nil {
+		return &Frame{JPEG: data, Time: time.Now().UTC(), Source: SourceFFmpeg}, nil
+	}
+
+	captureErrors.With(st.Name).Inc()
+	if engineErr != nil {
+		err = fmt.Errorf("engine: %v; ffmpeg: %v", engineErr, err)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: %w after %s: %v", ErrUnavailable, ErrTimeout, s.Timeout, err)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+func (s *Service) fromEngine(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFrameBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if !isJPEG(data) {
+		return nil, fmt.Errorf("not a JPEG")
+	}
+	return data, nil
+}
+
+func (s *Service) fromFFmpeg(ctx context.Context, name string) ([]byte, error) {
+	input, err := s.Streams.SourceURL(name)
+	if err != nil {
+		return nil, err
+	}
+	// A go2rtc ffmpeg: source is read from the camera it wraps
+	input = transcode.Go2RTCInput(input)
+
+	select {
+	case s.ffmpegSlots <- struct{}{}:
+		defer func() { <-s.ffmpegSlots }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("too many snapshots in progress")
+	}
+
+	var args []string
+	if strings.HasPrefix(input, "rtsp") {
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	args = append(args, "-hide_banner", "-loglevel", "error", "-i", input,
+		"-frames:v", "1", "-f", "image2pipe", "-c:v", "mjpeg", "-q:v", "3", "-")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.FFmpeg, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			// The last line says why, earlier ones are mostly noise
+			lines := strings.Split(msg, "\n")
+			return nil, fmt.Errorf("%s", lines[len(lines)-1])
+		}
+		return nil, err
+	}
+	if stdout.Len() > maxFrameBytes || !isJPEG(stdout.Bytes()) {
+		return nil, fmt.Errorf("ffmpeg returned no frame")
+	}
+	return stdout.Bytes(), nil
+}
+
+func isJPEG(data []byte) bool {
+	return len(data) > 3 && data[0] == 0xFF && data[1] == 0xD8
+}
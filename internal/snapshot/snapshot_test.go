@@ -0,0 +1,187 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/metrics"
+	"web-tr/internal/models"
+	"web-tr/internal/stream"
+)
+
+type fakeEngine struct {
+	stream.Engine
+	frameURL string
+}
+
+func (e fakeEngine) FrameURL(name string) string { return e.frameURL }
+
+type fakeStreams struct{ engine fakeEngine }
+
+func (f fakeStreams) Lookup(name string) (models.Stream, stream.Engine, bool) {
+	if name == "missing" {
+		return models.Stream{}, nil, false
+	}
+	return models.Stream{Name: name}, f.engine, true
+}
+
+func (f fakeStreams) SourceURL(name string) (string, error) {
+	return "ffmpeg:rtsp://127.0.0.1:1/" + name + "#video=h264", nil
+}
+
+// newTestService serves frames from a fake engine, counting its requests.
+// ffmpeg is never found.
+func newTestService(t *testing.T, handler http.HandlerFunc) (*Service, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := NewService(fakeStreams{fakeEngine{frameURL: srv.URL + "/frame.jpeg"}})
+	s.FFmpeg = "/nonexistent/ffmpeg"
+	s.TTL = time.Minute
+	return s, &hits
+}
+
+func TestGetSharesCapturesAndCaches(t *testing.T) {
+	frame := testJPEG(t, 64, 32)
+	release := make(chan struct{})
+	s, hits := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write(frame)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if f, err := s.Get(context.Background(), "yard", Options{}); err != nil || f.Source != SourceEngine {
+				t.Errorf("Get = %+v, %v", f, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := hits.Load(); n != 1 {
+		t.Errorf("engine asked %d times for concurrent requests, want 1", n)
+	}
+
+	// Scaled copies come from the cached frame
+	small, err := s.Get(context.Background(), "yard", Options{Width: 16})
+	if err != nil || len(small.JPEG) == 0 || hits.Load() != 1 {
+		t.Errorf("scaled Get = %v, engine hits %d", err, hits.Load())
+	}
+
+	tests := []struct {
+		name     string
+		forget   bool
+		opts     Options
+		wantHits int32
+	}{
+		{"cached", false, Options{}, 1},
+		{"max age", false, Options{MaxAge: time.Nanosecond}, 2},
+		{"forgotten", true, Options{}, 3},
+	}
+	for _, tt := range tests {
+		if tt.forget {
+			s.Forget("yard")
+		}
+		if _, err := s.Get(context.Background(), "yard", tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		if n := hits.Load(); n != tt.wantHits {
+			t.Errorf("%s: engine hits = %d, want %d", tt.name, n, tt.wantHits)
+		}
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		opts    Options
+		handler http.HandlerFunc
+		want    error
+	}{
+		{"unknown stream", "missing", Options{}, nil, ErrNotFound},
+		{"bad options", "yard", Options{Width: 1}, nil, ErrInvalidOptions},
+		{"engine error and no ffmpeg", "yard", Options{}, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "no stream", http.StatusNotFound)
+		}, ErrUnavailable},
+		{"engine sends no JPEG", "yard", Options{}, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>"))
+		}, ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t, tt.handler)
+			_, err := s.Get(context.Background(), tt.stream, tt.opts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Get = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestStartForgetsChangedStreams(t *testing.T) {
+	frame := testJPEG(t, 16, 16)
+	s, hits := newTestService(t, func(w http.ResponseWriter, r *http.Request) { w.Write(frame) })
+	hub := events.NewHub()
+	s.Start(hub)
+	defer s.Stop()
+
+	for _, name := range []string{"snap-old", "snap-gone", "snap-kept"} {
+		if _, err := s.Get(context.Background(), name, Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hub.Publish(events.StreamsChanged, events.Batch{Changes: []events.Change{
+		{Type: events.StreamUpdated, Data: map[string]interface{}{"name": "snap-new", "originalName": "snap-old"}},
+		{Type: events.StreamDeleted, Data: map[string]interface{}{"name": "snap-gone"}},
+	}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		_, old := s.cache["snap-old"]
+		_, gone := s.cache["snap-gone"]
+		_, kept := s.cache["snap-kept"]
+		s.mu.Unlock()
+		if !old && !gone && kept {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cached: old %v, gone %v, kept %v", old, gone, kept)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("engine hits = %d", hits.Load())
+	}
+
+	body := scrape(t)
+	for name, want := range map[string]bool{"snap-old": false, "snap-gone": false, "snap-kept": true} {
+		if got := strings.Contains(body, `stream="`+name+`"`); got != want {
+			t.Errorf("series of %s exported = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+	"web-tr/internal/vault"
+)
+
+// MaxBulkOps bounds the size of a single /api/streams/bulk request
+const MaxBulkOps = 1000
+
+// ErrBulkRejected means at least one operation was invalid and nothing was applied
+var ErrBulkRejected = errors.New("bulk operation rejected, nothing was applied")
+
+// plannedOp is a validated bulk item with its credentials split off
+type plannedOp struct {
+	change models.StreamChange
+	cred   *vault.Credential
+	old    models.Stream // the stream before an update or delete
+}
+
+// ApplyBulk validates a batch of creates, updates and deletes against the
+// current streams and applies them together: one DB transaction or config
+// rewrite, one engine config write and a single pass pushing the changes to
+// the running engines. Items are checked in order, so later items see the
+// effect of earlier ones. If any item is invalid, nothing is written and
+// ErrBulkRejected is returned with the per-item results. A dry run stops
+// after validation. The changes are announced as one StreamsChanged event, by
+// naming the user making them.
+func (m *Manager) ApplyBulk(ops []models.BulkOp, dryRun bool, by string) ([]models.BulkResult, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no operations given")
+	}
+
+	stored, err := m.storedStreams()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]models.Stream, len(stored))
+	for _, s := range stored {
+		current[s.Name] = s
+	}
+
+	results := make([]models.BulkResult, len(ops))
+	planned := make([]plannedOp, 0, len(ops))
+	rejected := false
+	for i, op := range ops {
+		p, err := m.planOp(op, current)
+		results[i] = models.BulkResult{Index: i, Op: op.Op, Name: p.change.Stream.Name, Status: models.BulkNotApplied}
+		if err != nil {
+			results[i].Status, results[i].Error = models.BulkError, err.Error()
+			rejected = true
+			continue
+		}
+		planned = append(planned, p)
+	}
+	if rejected {
+		return results, ErrBulkRejected
+	}
+	if dryRun {
+		return results, nil
+	}
+
+	if err := m.storeBulk(planned); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Status = models.BulkApplied
+	}
+
+	// A delete, rename or engine switch leaves the old path behind in its engine
+	var removed, changed []models.Stream
+	for _, p := range planned {
+		st := p.change.Stream
+		switch p.change.Op {
+		case models.BulkDelete:
+			removed = append(removed, p.old)
+		case models.BulkUpdate:
+			if p.old.Name != st.Name || m.engineFor(p.old) != m.engineFor(st) {
+				removed = append(removed, p.old)
+			}
+			changed = append(changed, st)
+		default:
+			changed = append(changed, st)
+		}
+	}
+	err = m.applyChanges(removed, changed)
+
+	announced := make([]streamEvent, len(planned))
+	for i, p := range planned {
+		e := streamEvent{name: p.change.Stream.Name}
+		switch p.change.Op {
+		case models.BulkCreate:
+			e.typ = events.StreamAdded
+		case models.BulkUpdate:
+			e.typ, e.oldName = events.StreamUpdated, p.change.OldName
+		case models.BulkDelete:
+			e.typ = events.StreamDeleted
+		}
+		announced[i] = e
+	}
+	m.publishStreams(announced, by)
+	return results, err
+}
+
+// planOp checks one item and updates current to reflect it
+func (m *Manager) planOp(op models.BulkOp, current map[string]models.Stream) (plannedOp, error) {
+	st := op.Stream
+	name := op.Name
+	if name == "" {
+		name = st.Name
+	}
+	p := plannedOp{change: models.StreamChange{Op: op.Op, OldName: name, Stream: st}}
+
+	switch op.Op {
+	case models.BulkDelete:
+		p.change.Stream = models.Stream{Name: name}
+		old, ok := current[name]
+		if !ok {
+			return p, fmt.Errorf("stream '%s' not found", name)
+		}
+		p.old = old
+		delete(current, name)
+		return p, nil
+	case models.BulkCreate, models.BulkUpdate:
+	default:
+		return p, fmt.Errorf("unknown operation '%s', use create, update or delete", op.Op)
+	}
+
+	if st.Name == "" || st.URL == "" {
+		return p, invalid("name and url are required")
+	}
+	if err := normalizeStream(&st); err != nil {
+		return p, err
+	}
+	if err := m.checkProfile(st); err != nil {
+		return p, err
+	}
+	if err := m.resolveBackend(&st); err != nil {
+		return p, err
+	}
+
+	var prev *models.Stream
+	if op.Op == models.BulkCreate {
+		if _, exists := current[st.Name]; exists {
+			return p, fmt.Errorf("stream '%s' already exists", st.Name)
+		}
+	} else {
+		old, ok := current[name]
+		if !ok {
+			return p, fmt.Errorf("stream '%s' not found", name)
+		}
+		if _, exists := current[st.Name]; exists && st.Name != name {
+			return p, fmt.Errorf("stream name '%s' already exists", st.Name)
+		}
+		p.old = old
+		prev = &p.old
+		delete(current, name)
+	}
+
+	cred, err := m.splitCredentials(&st, prev)
+	if err != nil {
+		return p, err
+	}
+	p.cred = cred
+	p.change.Stream = st
+	current[st.Name] = st
+	return p, nil
+}
+
+// storeBulk writes the planned changes. The DB store takes the credentials in
+// the same transaction; in file mode they are written after the config.
+func (m *Manager) storeBulk(planned []plannedOp) error {
+	changes := make([]models.StreamChange, len(planned))
+	for i, p := range planned {
+		changes[i] = p.change
+	}
+
+	if m.Store != nil {
+		if m.Vault != nil {
+			for i, p := range planned {
+				sealed, err := m.Vault.Seal(p.change.Stream.Name, p.cred)
+				if err != nil {
+					return err
+				}
+				changes[i].Credential = sealed
+			}
+		}
+		return m.Store.ApplyStreamChanges(changes)
+	}
+
+	if err := m.ConfigManager.ApplyStreamChanges(changes); err != nil {
+		return err
+	}
+	if m.Vault == nil {
+		return nil
+	}
+	for _, p := range planned {
+		c := p.change
+		if c.Op != models.BulkCreate && c.OldName != c.Stream.Name {
+			if err := m.Vault.Remove(c.OldName); err != nil {
+				return err
+			}
+		}
+		if c.Op == models.BulkDelete {
+			if err := m.Vault.Remove(c.Stream.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := m.Vault.Set(c.Stream.Name, p.cred); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"web-tr/internal/config"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+)
+
+func TestPlanOpSequence(t *testing.T) {
+	m := &Manager{
+		engines:  map[string]Engine{BackendGo2RTC: nil, BackendMediaMTX: nil},
+		settings: &config.AppSettings{StreamEngine: BackendGo2RTC},
+	}
+	current := map[string]models.Stream{
+		"yard": {Name: "yard", URL: "rtsp://yard"},
+		"door": {Name: "door", URL: "rtsp://door"},
+	}
+
+	// Items are planned in order and see the effect of earlier ones
+	tests := []struct {
+		name    string
+		op      models.BulkOp
+		wantErr string
+	}{
+		{"create", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "gate", URL: "rtsp://gate"}}, ""},
+		{"create twice", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "gate", URL: "rtsp://gate"}}, "already exists"},
+		{"rename onto a taken name", models.BulkOp{Op: models.BulkUpdate, Name: "yard", Stream: models.Stream{Name: "door", URL: "rtsp://yard"}}, "already exists"},
+		{"rename", models.BulkOp{Op: models.BulkUpdate, Name: "yard", Stream: models.Stream{Name: "garden", URL: "rtsp://yard"}}, ""},
+		{"update the old name", models.BulkOp{Op: models.BulkUpdate, Stream: models.Stream{Name: "yard", URL: "rtsp://yard"}}, "not found"},
+		{"delete", models.BulkOp{Op: models.BulkDelete, Name: "door"}, ""},
+		{"delete again", models.BulkOp{Op: models.BulkDelete, Name: "door"}, "not found"},
+		{"reuse a deleted name", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "door", URL: "rtsp://door2", Backend: BackendMediaMTX}}, ""},
+		{"unknown backend", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x", URL: "rtsp://x", Backend: "vlc"}}, "unknown backend"},
+		{"missing url", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x"}}, "required"},
+		{"bad tag", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x", URL: "rtsp://x", Tags: []string{"a,b"}}}, "comma"},
+		{"profile without profiles", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x", URL: "rtsp://x", ProfileID: "720p"}}, "not available"},
+		{"unknown op", models.BulkOp{Op: "upsert", Stream: models.Stream{Name: "x", URL: "rtsp://x"}}, "unknown operation"},
+	}
+	for _, tt := range tests {
+		_, err := m.planOp(tt.op, current)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	var got []string
+	for _, name := range []string{"door", "garden", "gate", "yard"} {
+		if st, ok := current[name]; ok {
+			got = append(got, st.Name+"@"+st.Backend)
+		}
+	}
+	if want := "door@mediamtx,garden@go2rtc,gate@go2rtc"; strings.Join(got, ",") != want {
+		t.Errorf("streams after planning = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestPublishStreamsSendsOneBatch(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "go2rtc.yaml")
+	if err := os.WriteFile(cfgPath, []byte("streams:\n  yard: rtsp://yard/main\n  garden: rtsp://garden/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hub := events.NewHub()
+	ch := hub.Queue()
+	defer hub.Unsubscribe(ch)
+	m := &Manager{ConfigManager: config.NewConfigManager(cfgPath), Monitor: NewMonitor(nil), Events: hub}
+
+	m.publishStreams([]streamEvent{
+		{typ: events.StreamAdded, name: "yard"},
+		{typ: events.StreamUpdated, name: "garden", oldName: "door"},
+		{typ: events.StreamDeleted, name: "gate"},
+	}, "alice")
+
+	ev := <-ch
+	if ev.Type != events.StreamsChanged {
+		t.Fatalf("published %s, want one %s", ev.Type, events.StreamsChanged)
+	}
+	if b := ev.Data.(events.Batch); b.By != "alice" || len(b.Changes) != 3 {
+		t.Fatalf("batch = %+v", b)
+	}
+	if len(ch) > 0 {
+		t.Errorf("%d more events published", len(ch))
+	}
+
+	got := events.Expand(ev)
+	tests := []struct {
+		typ, name, originalName string
+		withStream              bool
+	}{
+		{events.StreamAdded, "yard", "", true},
+		{events.StreamUpdated, "garden", "door", true},
+		{events.StreamDeleted, "gate", "", false},
+	}
+	for i, tt := range tests {
+		data := got[i].Data.(map[string]interface{})
+		_, withStream := data["stream"]
+		orig, _ := data["originalName"].(string)
+		if got[i].Type != tt.typ || data["name"] != tt.name || orig != tt.originalName || withStream != tt.withStream || data["by"] != "alice" {
+			t.Errorf("change %d = %s %v", i, got[i].Type, data)
+		}
+	}
+}
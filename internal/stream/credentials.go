@@ -0,0 +1,191 @@
+package stream
+
+import (
+	"fmt"
+	"log"
+	"web-tr/internal/models"
+	"web-tr/internal/vault"
+)
+
+// storedStreams reads the stream list from the DB or config files with any credentials removed
+func (m *Manager) storedStreams() ([]models.Stream, error) {
+	var streams []models.Stream
+	var err error
+	if m.Store != nil {
+		streams, err = m.Store.GetStreams()
+	} else {
+		streams, err = m.ConfigManager.GetStreams()
+	}
+	if err != nil || m.Vault == nil {
+		return streams, err
+	}
+
+	// go2rtc.yaml is written with credentials injected, so strip them on the way back in
+	for i := range streams {
+		streams[i].URL = vault.StripCredentials(streams[i].URL)
+	}
+	return streams, nil
+}
+
+func (m *Manager) credentials() (map[string]vault.Credential, error) {
+	if m.Vault == nil {
+		return map[string]vault.Credential{}, nil
+	}
+	return m.Vault.All()
+}
+
+// streamsWithCredentials returns the streams with their credentials injected
+// and transcoding profiles resolved. Only use it to write engine configs or run
+// ffmpeg/ffprobe.
+func (m *Manager) streamsWithCredentials() ([]models.Stream, error) {
+	streams, err := m.storedStreams()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := m.credentials()
+	if err != nil {
+		return nil, err
+	}
+	for i := range streams {
+		if c, ok := creds[streams[i].Name]; ok {
+			streams[i].URL = vault.Inject(streams[i].URL, &c)
+		}
+	}
+	if err := m.resolveProfiles(streams); err != nil {
+		return nil, err
+	}
+	return streams, nil
+}
+
+// ExportStreams returns the stream list for a backup, with passwords redacted
+// unless withCredentials is set
+func (m *Manager) ExportStreams(withCredentials bool) ([]models.Stream, error) {
+	if withCredentials {
+		return m.streamsWithCredentials()
+	}
+	return m.GetStreams()
+}
+
+// SourceURL returns the camera URL of a stream including its credentials
+func (m *Manager) SourceURL(name string) (string, error) {
+	streams, err := m.streamsWithCredentials()
+	if err != nil {
+		return "", err
+	}
+	for _, s := range streams {
+		if s.Name == name {
+			return s.URL, nil
+		}
+	}
+	return "", fmt.Errorf("stream '%s' not found", name)
+}
+
+// ResolveURL prepares a URL typed into the dashboard for ffprobe, swapping a
+// redacted password for the one stored for stream name
+func (m *Manager) ResolveURL(name, rawURL string) (string, error) {
+	var prev *models.Stream
+	if name != "" {
+		stored, err := m.storedStreams()
+		if err != nil {
+			return "", err
+		}
+		for i := range stored {
+			if stored[i].Name == name {
+				prev = &stored[i]
+				break
+			}
+		}
+	}
+
+	st := models.Stream{Name: name, URL: rawURL}
+	cred, err := m.splitCredentials(&st, prev)
+	if err != nil {
+		return "", err
+	}
+	return vault.Inject(st.URL, cred), nil
+}
+
+// splitCredentials takes the credentials off a submitted stream URL. A redacted
+// password means "keep the current one" of prev, the stored stream being
+// replaced. It is refused unless the URL still points at the scheme, host and
+// port of prev, so the password can't be redirected to another server.
+func (m *Manager) splitCredentials(st *models.Stream, prev *models.Stream) (*vault.Credential, error) {
+	if m.Vault == nil {
+		return nil, nil
+	}
+
+	clean, cred := vault.Split(st.URL)
+	st.URL = clean
+	if cred == nil || cred.Password != vault.RedactedPassword {
+		return cred, nil
+	}
+
+	var stored *vault.Credential
+	if prev != nil {
+		var err error
+		if stored, err = m.Vault.Get(prev.Name); err != nil {
+			return nil, err
+		}
+	}
+	if stored == nil {
+		return nil, invalid("no stored password for '%s', please enter it", st.Name)
+	}
+	if !vault.SameOrigin(clean, prev.URL) {
+		return nil, invalid("the address of '%s' changed, please enter its password again", prev.Name)
+	}
+	cred.Password = stored.Password
+	return cred, nil
+}
+
+// MigrateCredentials moves credentials found in stored stream URLs into the vault.
+// It also picks up passwords edited by hand in go2rtc.yaml.
+func (m *Manager) MigrateCredentials() error {
+	if m.Vault == nil {
+		return nil
+	}
+
+	var streams []models.Stream
+	var err error
+	if m.Store != nil {
+		streams, err = m.Store.GetStreams()
+	} else {
+		streams, err = m.ConfigManager.GetStreams()
+	}
+	if err != nil {
+		return err
+	}
+	creds, err := m.Vault.All()
+	if err != nil {
+		return err
+	}
+
+	for _, st := range streams {
+		clean, cred := vault.Split(st.URL)
+		if cred == nil {
+			continue
+		}
+		if existing, ok := creds[st.Name]; !ok || existing != *cred {
+			if err := m.Vault.Set(st.Name, cred); err != nil {
+				return err
+			}
+			log.Printf("Moved credentials of stream %s into the vault", st.Name)
+		}
+
+		st.URL = clean
+		if m.Store != nil {
+			err = m.Store.UpdateStream(st.Name, st)
+		} else if !isGo2RTC(st) {
+			// go2rtc.yaml is the engine config and keeps its credentials;
+			// the settings file used for other engines must not
+			err = m.ConfigManager.SetStream(st)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isGo2RTC(st models.Stream) bool {
+	return st.Backend == "" || st.Backend == BackendGo2RTC
+}
@@ -0,0 +1,44 @@
+package stream
+
+import (
+	"context"
+	"web-tr/internal/onvif"
+	"web-tr/internal/scanner"
+	"web-tr/internal/vault"
+)
+
+// DiscoverStreams finds ONVIF cameras on the network and returns their profiles.
+// The given credentials are put into the profile URLs so they can be added as they are.
+func (m *Manager) DiscoverStreams(ctx context.Context, opts onvif.Options) ([]onvif.Device, error) {
+	devices, err := onvif.Discover(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Username == "" {
+		return devices, nil
+	}
+
+	cred := &vault.Credential{Username: opts.Username, Password: opts.Password}
+	for i := range devices {
+		for j := range devices[i].Profiles {
+			p := &devices[i].Profiles[j]
+			p.URL = vault.Inject(vault.StripCredentials(p.URL), cred)
+		}
+	}
+	return devices, nil
+}
+
+// ScanNetwork sweeps IP ranges for cameras, see scanner.Scan. The given
+// credentials are put into the stream URLs like in DiscoverStreams.
+func (m *Manager) ScanNetwork(ctx context.Context, opts scanner.Options, found func(scanner.Host), progress func(scanned, total int)) error {
+	var cred *vault.Credential
+	if opts.Username != "" {
+		cred = &vault.Credential{Username: opts.Username, Password: opts.Password}
+	}
+	return scanner.Scan(ctx, opts, func(h scanner.Host) {
+		for i := range h.Streams {
+			h.Streams[i].URL = vault.Inject(h.Streams[i].URL, cred)
+		}
+		found(h)
+	}, progress)
+}
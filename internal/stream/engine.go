@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"web-tr/internal/models"
+)
+
+const (
+	BackendGo2RTC   = "go2rtc"
+	BackendMediaMTX = "mediamtx"
+)
+
+// Engine is a streaming backend that pulls the cameras and serves them to viewers
+type Engine interface {
+	Name() string
+	// Command returns the binary and arguments used to launch the engine
+	Command() (string, []string, error)
+	// HealthURL answers with a non-5xx status once the engine API is up
+	HealthURL() string
+	// WriteConfig rewrites the engine's config file from the full stream list,
+	// keeping only the streams assigned to this engine
+	WriteConfig(streams []models.Stream) error
+	// SyncStream adds or replaces a stream in the running engine
+	SyncStream(st models.Stream) error
+	// RemoveStream drops a stream from the running engine
+	RemoveStream(name string) error
+	// RTSPURL is the engine's local restream address for a stream
+	RTSPURL(name string) string
+	// WHEPURL is the engine's WebRTC endpoint for a stream: an SDP offer
+	// POSTed to it is answered with the engine's SDP
+	WHEPURL(name string) string
+	// MP4URL serves a stream as fragmented MP4 for MSE players, empty if the
+	// engine can't
+	MP4URL(name string) string
+	// HLSURL is the engine address of an HLS resource of a stream. path is
+	// relative to the stream's main playlist and empty for the playlist itself;
+	// the result is empty if path is not one of the stream's HLS resources.
+	HLSURL(name, path string) string
+	// FrameURL answers with a JPEG of the stream's current frame, empty if the
+	// engine can't
+	FrameURL(name string) string
+}
+
+// validHLSPath rejects paths that could leave a stream's HLS directory. The
+// engines only name their files with plain characters.
+func validHLSPath(path string) bool {
+	if path == "" || strings.Trim(path, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-/") != "" {
+		return false
+	}
+	for _, part := range strings.Split(path, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// engineClient is used for engine API calls, which are always local
+var engineClient = &http.Client{Timeout: 10 * time.Second}
+
+// locateBinary finds an engine binary in PATH, the current directory or any of dirs
+func locateBinary(name string, dirs ...string) (string, error) {
+	binaryName := name
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+
+	if path, err := exec.LookPath(binaryName); err == nil {
+		return path, nil
+	}
+	for _, dir := range append([]string{"."}, dirs...) {
+		candidate := filepath.Join(dir, binaryName)
+		if _, err := os.Stat(candidate); err == nil {
+			if abs, err := filepath.Abs(candidate); err == nil {
+				return abs, nil
+			}
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s binary not found in current directory or PATH", binaryName)
+}
@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"web-tr/internal/config"
+	"web-tr/internal/models"
+	"web-tr/internal/transcode"
+)
+
+const go2rtcAPI = "http://127.0.0.1:1984"
+
+type go2rtcEngine struct {
+	cfg *config.ConfigManager
+}
+
+func newGo2RTCEngine(cfg *config.ConfigManager) *go2rtcEngine {
+	return &go2rtcEngine{cfg: cfg}
+}
+
+func (e *go2rtcEngine) Name() string { return BackendGo2RTC }
+
+func (e *go2rtcEngine) Command() (string, []string, error) {
+	path, err := locateBinary("go2rtc")
+	if err != nil {
+		return "", nil, err
+	}
+	return path, []string{"-c", e.cfg.FilePath}, nil
+}
+
+func (e *go2rtcEngine) HealthURL() string { return go2rtcAPI + "/api" }
+
+func (e *go2rtcEngine) WriteConfig(streams []models.Stream) error {
+	var own []models.Stream
+	for _, s := range streams {
+		if s.Backend == "" || s.Backend == BackendGo2RTC {
+			s.URL = go2rtcSource(s)
+			own = append(own, s)
+		}
+	}
+	return e.cfg.ReplaceStreams(own)
+}
+
+// go2rtcSource is the go2rtc source of a stream: the camera URL, pulled
+// through ffmpeg if the stream has a transcoding profile
+func go2rtcSource(st models.Stream) string {
+	if st.Transcode == nil {
+		return st.URL
+	}
+	return transcode.Go2RTCSource(st.URL, st.Transcode)
+}
+
+func (e *go2rtcEngine) SyncStream(st models.Stream) error {
+	reqURL := fmt.Sprintf("%s/api/streams?name=%s&src=%s", go2rtcAPI, url.QueryEscape(st.Name), url.QueryEscape(go2rtcSource(st)))
+	return e.call(http.MethodPut, st.Name, reqURL)
+}
+
+func (e *go2rtcEngine) RemoveStream(name string) error {
+	reqURL := fmt.Sprintf("%s/api/streams?src=%s", go2rtcAPI, url.QueryEscape(name))
+	return e.call(http.MethodDelete, name, reqURL)
+}
+
+func (e *go2rtcEngine) RTSPURL(name string) string {
+	return "rtsp://127.0.0.1:8554/" + url.PathEscape(name)
+}
+
+// go2rtc answers plain SDP offers as well as WHEP on the same endpoint
+func (e *go2rtcEngine) WHEPURL(name string) string {
+	return go2rtcAPI + "/api/webrtc?src=" + url.QueryEscape(name)
+}
+
+func (e *go2rtcEngine) MP4URL(name string) string {
+	return go2rtcAPI + "/api/stream.mp4?src=" + url.QueryEscape(name)
+}
+
+// go2rtc's playlist refers to its media playlists and segments under /api/hls/;
+// nothing else of its API is reachable this way
+func (e *go2rtcEngine) HLSURL(name, path string) string {
+	if path == "" {
+		return go2rtcAPI + "/api/stream.m3u8?src=" + url.QueryEscape(name)
+	}
+	if !strings.HasPrefix(path, "hls/") || !validHLSPath(path) {
+		return ""
+	}
+	return go2rtcAPI + "/api/" + path
+}
+
+func (e *go2rtcEngine) FrameURL(name string) string {
+	return go2rtcAPI + "/api/frame.jpeg?src=" + url.QueryEscape(name)
+}
+
+func (e *go2rtcEngine) call(method, name, reqURL string) error {
+	req, err := http.NewRequest(method, reqURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := engineClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	log.Printf("Sync stream %s response: %s (Status: %d)", name, string(body), resp.StatusCode)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("go2rtc api returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"web-tr/internal/models"
+)
+
+// normalizeStream cleans up the group path and tags of a submitted stream
+func normalizeStream(st *models.Stream) error {
+	st.Group = models.NormalizeGroup(st.Group)
+
+	var tags []string
+	seen := map[string]bool{}
+	for _, t := range st.Tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		// The DB stores tags as a comma separated list
+		if strings.Contains(t, ",") {
+			return invalid("tag '%s' must not contain a comma", t)
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	st.Tags = tags
+
+	if n := st.TimelapseInterval; n != 0 && (n < models.MinTimelapseInterval || n > models.MaxTimelapseInterval) {
+		return invalid("time-lapse interval must be between %d and %d seconds", models.MinTimelapseInterval, models.MaxTimelapseInterval)
+	}
+	return nil
+}
+
+// Filter selects streams by group, tags and name. Zero values match everything.
+type Filter struct {
+	// Group matches the group and its subgroups
+	Group string `json:"group,omitempty"`
+	// Tags must all be present on the stream
+	Tags []string `json:"tags,omitempty"`
+	// Query is a case-insensitive substring of the name
+	Query string `json:"q,omitempty"`
+}
+
+func (f Filter) Match(st models.Stream) bool {
+	if !models.InGroup(st.Group, models.NormalizeGroup(f.Group)) {
+		return false
+	}
+	for _, want := range f.Tags {
+		found := false
+		for _, t := range st.Tags {
+			found = found || t == want
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.Query == "" || strings.Contains(strings.ToLower(st.Name), strings.ToLower(f.Query))
+}
+
+// FilterStreams returns the streams matching f and allowed by allowed, which may be nil
+func FilterStreams(streams []models.Stream, f Filter, allowed func(models.Stream) bool) []models.Stream {
+	out := []models.Stream{}
+	for _, st := range streams {
+		if f.Match(st) && (allowed == nil || allowed(st)) {
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// GroupNode is one level of the group tree. Count includes the streams of subgroups.
+type GroupNode struct {
+	Name     string       `json:"name"`
+	Path     string       `json:"path"`
+	Count    int          `json:"count"`
+	Children []*GroupNode `json:"children"`
+}
+
+// GroupTree builds the group hierarchy of the given streams, sorted by name.
+// Streams without a group are not part of the tree.
+func GroupTree(streams []models.Stream) []*GroupNode {
+	root := &GroupNode{}
+	for _, st := range streams {
+		if st.Group == "" {
+			continue
+		}
+		node := root
+		for _, name := range strings.Split(st.Group, models.GroupSeparator) {
+			var child *GroupNode
+			for _, c := range node.Children {
+				if c.Name == name {
+					child = c
+					break
+				}
+			}
+			if child == nil {
+				path := name
+				if node.Path != "" {
+					path = node.Path + models.GroupSeparator + name
+				}
+				child = &GroupNode{Name: name, Path: path, Children: []*GroupNode{}}
+				node.Children = append(node.Children, child)
+			}
+			child.Count++
+			node = child
+		}
+	}
+	sortTree(root.Children)
+	if root.Children == nil {
+		return []*GroupNode{}
+	}
+	return root.Children
+}
+
+func sortTree(nodes []*GroupNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	for _, n := range nodes {
+		sortTree(n.Children)
+	}
+}
+
+// Group actions applied to every stream matched by a filter
+const (
+	ActionRecord        = "record"
+	ActionStopRecording = "stop_recording"
+	ActionMove          = "move"        // Value is the new group
+	ActionTag           = "tag"         // Value is the tag to add
+	ActionUntag         = "untag"       // Value is the tag to remove
+	ActionSetBackend    = "set_backend" // Value is the engine, empty for the default
+	ActionDelete        = "delete"
+)
+
+type GroupAction struct {
+	Filter Filter `json:"filter"`
+	Action string `json:"action"`
+	Value  string `json:"value,omitempty"`
+}
+
+// GroupActionOps turns a group action into bulk operations on the matching
+// streams. allowed limits the streams an operator may change and may be nil.
+func GroupActionOps(streams []models.Stream, a GroupAction, allowed func(models.Stream) bool) ([]models.BulkOp, error) {
+	apply := func(st *models.Stream) {}
+	switch a.Action {
+	case ActionRecord, ActionStopRecording:
+		apply = func(st *models.Stream) { st.Recording = a.Action == ActionRecord }
+	case ActionMove:
+		group := models.NormalizeGroup(a.Value)
+		apply = func(st *models.Stream) { st.Group = group }
+	case ActionTag, ActionUntag:
+		tag := strings.TrimSpace(a.Value)
+		if tag == "" {
+			return nil, fmt.Errorf("a tag is required")
+		}
+		apply = func(st *models.Stream) {
+			var tags []string
+			for _, t := range st.Tags {
+				if t != tag {
+					tags = append(tags, t)
+				}
+			}
+			if a.Action == ActionTag {
+				tags = append(tags, tag)
+			}
+			st.Tags = tags
+		}
+	case ActionSetBackend:
+		apply = func(st *models.Stream) { st.Backend = a.Value }
+	case ActionDelete:
+	default:
+		return nil, fmt.Errorf("unknown action '%s'", a.Action)
+	}
+
+	var ops []models.BulkOp
+	for _, st := range FilterStreams(streams, a.Filter, allowed) {
+		if a.Action == ActionDelete {
+			ops = append(ops, models.BulkOp{Op: models.BulkDelete, Name: st.Name})
+			continue
+		}
+		st.Health = nil
+		apply(&st)
+		ops = append(ops, models.BulkOp{Op: models.BulkUpdate, Name: st.Name, Stream: st})
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no streams match the filter")
+	}
+	return ops, nil
+}
@@ -0,0 +1,162 @@
+package stream
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"web-tr/internal/models"
+)
+
+var groupStreams = []models.Stream{
+	{Name: "Lobby", Group: "HQ", Tags: []string{"indoor"}},
+	{Name: "Gate North", Group: "HQ/Gate", Tags: []string{"outdoor", "ptz"}},
+	{Name: "Gate South", Group: "HQ/Gate", Tags: []string{"outdoor"}},
+	{Name: "Dock", Group: "Branch/Dock", Tags: []string{"outdoor"}},
+	{Name: "Spare"},
+}
+
+func names(streams []models.Stream) string {
+	var out []string
+	for _, st := range streams {
+		out = append(out, st.Name)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestFilterStreams(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  Filter
+		allowed func(models.Stream) bool
+		want    string
+	}{
+		{"everything", Filter{}, nil, "Lobby,Gate North,Gate South,Dock,Spare"},
+		{"group includes subgroups", Filter{Group: "HQ"}, nil, "Lobby,Gate North,Gate South"},
+		{"group is normalized", Filter{Group: " HQ / Gate /"}, nil, "Gate North,Gate South"},
+		{"every tag must match", Filter{Tags: []string{"outdoor", "ptz"}}, nil, "Gate North"},
+		{"query ignores case", Filter{Query: "gate s"}, nil, "Gate South"},
+		{"combined", Filter{Group: "HQ", Tags: []string{"outdoor"}, Query: "north"}, nil, "Gate North"},
+		{"allowed limits the result", Filter{Tags: []string{"outdoor"}}, func(st models.Stream) bool {
+			return models.InGroup(st.Group, "Branch")
+		}, "Dock"},
+		{"no match", Filter{Group: "Nowhere"}, nil, ""},
+	}
+	for _, tt := range tests {
+		if got := names(FilterStreams(groupStreams, tt.filter, tt.allowed)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGroupTree(t *testing.T) {
+	tree := GroupTree(groupStreams)
+
+	type flat struct {
+		Path  string
+		Count int
+	}
+	var got []flat
+	var walk func([]*GroupNode)
+	walk = func(nodes []*GroupNode) {
+		for _, n := range nodes {
+			got = append(got, flat{n.Path, n.Count})
+			walk(n.Children)
+		}
+	}
+	walk(tree)
+
+	want := []flat{{"Branch", 1}, {"Branch/Dock", 1}, {"HQ", 3}, {"HQ/Gate", 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %+v, want %+v", got, want)
+	}
+
+	if tree := GroupTree(nil); tree == nil || len(tree) != 0 {
+		t.Errorf("empty tree = %#v, want an empty list", tree)
+	}
+}
+
+func TestGroupActionOps(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  GroupAction
+		want    string // name:op:group:tags of each op
+		wantErr string
+	}{
+		{
+			name:   "move",
+			action: GroupAction{Filter: Filter{Group: "HQ/Gate"}, Action: ActionMove, Value: " Branch / Gate "},
+			want:   "Gate North:update:Branch/Gate:outdoor|ptz Gate South:update:Branch/Gate:outdoor",
+		},
+		{
+			name:   "tag without duplicates",
+			action: GroupAction{Filter: Filter{Query: "gate"}, Action: ActionTag, Value: "ptz"},
+			want:   "Gate North:update:HQ/Gate:outdoor|ptz Gate South:update:HQ/Gate:outdoor|ptz",
+		},
+		{
+			name:   "untag",
+			action: GroupAction{Filter: Filter{Tags: []string{"ptz"}}, Action: ActionUntag, Value: "ptz"},
+			want:   "Gate North:update:HQ/Gate:outdoor",
+		},
+		{
+			name:   "delete",
+			action: GroupAction{Filter: Filter{Group: "Branch"}, Action: ActionDelete},
+			want:   "Dock:delete::",
+		},
+		{
+			name:    "tag requires a value",
+			action:  GroupAction{Action: ActionTag, Value: " "},
+			wantErr: "tag is required",
+		},
+		{
+			name:    "unknown action",
+			action:  GroupAction{Action: "explode"},
+			wantErr: "unknown action",
+		},
+		{
+			name:    "nothing matches",
+			action:  GroupAction{Filter: Filter{Group: "Nowhere"}, Action: ActionRecord},
+			wantErr: "no streams match",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := GroupActionOps(groupStreams, tt.action, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, op := range ops {
+				got = append(got, op.Name+":"+op.Op+":"+op.Stream.Group+":"+strings.Join(op.Stream.Tags, "|"))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ops = %s, want %s", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeStream(t *testing.T) {
+	st := models.Stream{Group: " HQ//Gate ", Tags: []string{" a ", "b", "a", ""}}
+	if err := normalizeStream(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Group != "HQ/Gate" || !reflect.DeepEqual(st.Tags, []string{"a", "b"}) {
+		t.Errorf("normalized = %+v", st)
+	}
+
+	for _, bad := range []models.Stream{
+		{Tags: []string{"a,b"}},
+		{TimelapseInterval: models.MinTimelapseInterval - 1},
+		{TimelapseInterval: models.MaxTimelapseInterval + 1},
+	} {
+		if err := normalizeStream(&bad); err == nil {
+			t.Errorf("normalizeStream accepted %+v", bad)
+		}
+	}
+}
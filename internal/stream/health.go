@@ -0,0 +1,397 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/models"
+	"web-tr/internal/vault"
+)
+
+const healthHistoryLimit = 200
+
+// Monitor periodically checks every stream and keeps its online/offline state.
+// Streams that go2rtc is actively pulling are judged by their producer byte
+// counters; idle streams and streams on other engines are checked with ffprobe.
+type Monitor struct {
+	Interval     time.Duration
+	ProbeTimeout time.Duration
+	Concurrency  int
+	// Streams returns the streams to check, with credentials
+	Streams func() ([]models.Stream, error)
+	// OnChange is called when a stream goes online or offline
+	OnChange func(models.HealthChange)
+
+	mu      sync.Mutex
+	health  map[string]*models.StreamHealth
+	settled map[string]string // last online/offline result, ignoring inconclusive checks
+	bytes   map[string]int64
+	viewers map[string]int
+	history []models.HealthChange
+	stop    chan struct{}
+	trigger chan struct{}
+}
+
+func NewMonitor(streams func() ([]models.Stream, error)) *Monitor {
+	return &Monitor{
+		Interval:     30 * time.Second,
+		ProbeTimeout: 15 * time.Second,
+		Concurrency:  4,
+		Streams:      streams,
+		health:       make(map[string]*models.StreamHealth),
+		settled:      make(map[string]string),
+		bytes:        make(map[string]int64),
+		viewers:      make(map[string]int),
+		trigger:      make(chan struct{}, 1),
+	}
+}
+
+// Start launches the check loop; calling it twice has no effect
+func (mon *Monitor) Start() {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	if mon.stop != nil {
+		return
+	}
+	mon.stop = make(chan struct{})
+	go mon.loop(mon.stop)
+}
+
+func (mon *Monitor) Stop() {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	if mon.stop != nil {
+		close(mon.stop)
+		mon.stop = nil
+	}
+}
+
+// Trigger asks for a check as soon as possible, e.g. after a stream was changed
+func (mon *Monitor) Trigger() {
+	select {
+	case mon.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (mon *Monitor) loop(stop chan struct{}) {
+	ticker := time.NewTicker(mon.Interval)
+	defer ticker.Stop()
+
+	for {
+		mon.Check()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-mon.trigger:
+		}
+	}
+}
+
+// Get returns a copy of the latest health of a stream
+func (mon *Monitor) Get(name string) *models.StreamHealth {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	if h, ok := mon.health[name]; ok {
+		c := *h
+		return &c
+	}
+	return &models.StreamHealth{Status: models.HealthUnknown}
+}
+
+// History returns the recorded transitions of one stream, or of all streams if name is empty, newest first
+func (mon *Monitor) History(name string) []models.HealthChange {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+
+	changes := []models.HealthChange{}
+	for i := len(mon.history) - 1; i >= 0; i-- {
+		if name == "" || mon.history[i].Stream == name {
+			changes = append(changes, mon.history[i])
+		}
+	}
+	return changes
+}
+
+// Check runs one round of health checks
+func (mon *Monitor) Check() {
+	streams, err := mon.Streams()
+	if err != nil {
+		log.Printf("[Health] Failed to load streams: %v", err)
+		return
+	}
+
+	// go2rtc may not be running; then everything falls back to ffprobe
+	producers, err := go2rtcProducers()
+	if err != nil {
+		producers = nil
+	}
+	viewers := make(map[string]int, len(producers))
+	for name, p := range producers {
+		viewers[name] = p.consumers
+	}
+	mon.mu.Lock()
+	mon.viewers = viewers
+	mon.mu.Unlock()
+
+	sem := make(chan struct{}, mon.Concurrency)
+	var wg sync.WaitGroup
+	for _, st := range streams {
+		if p, ok := producers[st.Name]; ok && isGo2RTC(st) && mon.advanced(st.Name, p.bytes) {
+			// Resolution is not in the producer info, probe once to learn it
+			if mon.Get(st.Name).Width > 0 {
+				mon.record(st.Name, probeResult{online: true, codec: p.codec, source: "go2rtc"})
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(st models.Stream) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			res := mon.probe(st.URL)
+			if !res.inconclusive {
+				probeDuration.With(st.Name, probeOutcome(res)).Observe(time.Since(start).Seconds())
+			}
+			mon.record(st.Name, res)
+		}(st)
+	}
+	wg.Wait()
+
+	mon.prune(streams)
+}
+
+// advanced reports whether go2rtc received data for a stream since the last check
+func (mon *Monitor) advanced(name string, bytes int64) bool {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	prev := mon.bytes[name]
+	mon.bytes[name] = bytes
+	return bytes > prev
+}
+
+type probeResult struct {
+	online bool
+	// inconclusive means the check itself could not run, e.g. ffprobe is missing
+	inconclusive bool
+	codec        string
+	width        int
+	height       int
+	source       string
+	err          error
+}
+
+func (mon *Monitor) record(name string, res probeResult) {
+	now := time.Now()
+	status := models.HealthOffline
+	if res.online {
+		status = models.HealthOnline
+	} else if res.inconclusive {
+		status = models.HealthUnknown
+	}
+
+	mon.mu.Lock()
+	h, ok := mon.health[name]
+	if !ok {
+		h = &models.StreamHealth{Status: models.HealthUnknown}
+		mon.health[name] = h
+	}
+	previous, settled := h.Status, mon.settled[name]
+	if status != models.HealthUnknown {
+		mon.settled[name] = status
+	}
+
+	h.Status = status
+	h.CheckedAt = now
+	h.Source = res.source
+	h.Error = ""
+	if res.online {
+		h.LastSeen = now
+		if res.codec != "" {
+			h.Codec = res.codec
+		}
+		if res.width > 0 {
+			h.Width, h.Height = res.width, res.height
+		}
+	} else if res.err != nil {
+		h.Error = res.err.Error()
+	}
+
+	var change *models.HealthChange
+	if previous != status {
+		h.Since = now
+	}
+	if settled != status && status != models.HealthUnknown {
+		change = &models.HealthChange{Stream: name, Status: status, Time: now, Error: h.Error}
+		mon.history = append(mon.history, *change)
+		if len(mon.history) > healthHistoryLimit {
+			mon.history = mon.history[len(mon.history)-healthHistoryLimit:]
+		}
+	}
+	onChange := mon.OnChange
+	mon.mu.Unlock()
+
+	if change == nil {
+		return
+	}
+	// The first result after startup is not a real transition, don't report it
+	if settled == "" {
+		return
+	}
+	if status == models.HealthOffline {
+		log.Printf("[Health] Stream %s is offline: %s", name, change.Error)
+	} else {
+		log.Printf("[Health] Stream %s is online", name)
+	}
+	if onChange != nil {
+		onChange(*change)
+	}
+}
+
+// prune forgets streams that no longer exist
+func (mon *Monitor) prune(streams []models.Stream) {
+	keep := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		keep[s.Name] = true
+	}
+
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	for name := range mon.health {
+		if !keep[name] {
+			delete(mon.health, name)
+			delete(mon.settled, name)
+			delete(mon.bytes, name)
+			probeDuration.Delete(name, models.HealthOnline)
+			probeDuration.Delete(name, models.HealthOffline)
+		}
+	}
+}
+
+// Viewers returns how many consumers go2rtc is serving for a stream at the last check
+func (mon *Monitor) Viewers(name string) int {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	return mon.viewers[name]
+}
+
+// probe checks a camera directly with ffprobe and reads its video codec and resolution
+func (mon *Monitor) probe(sourceURL string) probeResult {
+	ctx, cancel := context.WithTimeout(context.Background(), mon.ProbeTimeout)
+	defer cancel()
+
+	input := probeInput(sourceURL)
+	args := []string{"-v", "error"}
+	if strings.HasPrefix(input, "rtsp") {
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	args = append(args,
+		"-timeout", "10000000",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,width,height",
+		"-of", "json",
+		"-i", input,
+	)
+
+	out, err := exec.CommandContext(ctx, FindBinary("ffprobe"), args...).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return probeResult{source: "ffprobe", inconclusive: true, err: err}
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return probeResult{source: "ffprobe", err: fmt.Errorf("timed out")}
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			// ffprobe echoes the input URL, keep the password out of the API
+			msg := strings.ReplaceAll(string(exitErr.Stderr), input, vault.StripCredentials(input))
+			return probeResult{source: "ffprobe", err: fmt.Errorf("%s", strings.TrimSpace(msg))}
+		}
+		return probeResult{source: "ffprobe", err: err}
+	}
+
+	var info struct {
+		Streams []struct {
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return probeResult{source: "ffprobe", err: err}
+	}
+	if len(info.Streams) == 0 {
+		return probeResult{source: "ffprobe", err: fmt.Errorf("no video stream")}
+	}
+
+	v := info.Streams[0]
+	return probeResult{online: true, codec: v.CodecName, width: v.Width, height: v.Height, source: "ffprobe"}
+}
+
+// probeInput turns a go2rtc source into something ffprobe can open by
+// dropping the "ffmpeg:" prefix and "#" options
+func probeInput(src string) string {
+	src = strings.TrimPrefix(src, "ffmpeg:")
+	if i := strings.Index(src, "#"); i >= 0 {
+		src = src[:i]
+	}
+	return src
+}
+
+type producerStats struct {
+	bytes     int64
+	codec     string
+	consumers int
+}
+
+// go2rtcProducers reads how much data go2rtc has received per stream, and the video codec
+func go2rtcProducers() (map[string]producerStats, error) {
+	resp, err := engineClient.Get(go2rtcAPI + "/api/streams")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("go2rtc api returned status %d", resp.StatusCode)
+	}
+
+	var info map[string]struct {
+		Producers []struct {
+			BytesRecv int64 `json:"bytes_recv"`
+			Receivers []struct {
+				Codec struct {
+					Name string `json:"codec_name"`
+					Type string `json:"codec_type"`
+				} `json:"codec"`
+			} `json:"receivers"`
+		} `json:"producers"`
+		Consumers []json.RawMessage `json:"consumers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]producerStats, len(info))
+	for name, s := range info {
+		p := producerStats{consumers: len(s.Consumers)}
+		for _, prod := range s.Producers {
+			p.bytes += prod.BytesRecv
+			for _, r := range prod.Receivers {
+				if p.codec == "" && r.Codec.Type == "video" {
+					p.codec = r.Codec.Name
+				}
+			}
+		}
+		stats[name] = p
+	}
+	return stats, nil
+}
@@ -0,0 +1,72 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+	"web-tr/internal/models"
+)
+
+func TestHealthTransitions(t *testing.T) {
+	online := probeResult{online: true, codec: "h264", width: 1920, height: 1080}
+	offline := probeResult{err: errors.New("connection refused")}
+	inconclusive := probeResult{inconclusive: true}
+
+	tests := []struct {
+		name    string
+		results []probeResult
+		want    []string // statuses reported to OnChange
+	}{
+		{"starts online", []probeResult{online, online}, nil},
+		{"starts offline", []probeResult{offline, offline}, nil},
+		{"goes down", []probeResult{online, offline, offline}, []string{models.HealthOffline}},
+		{"comes back", []probeResult{offline, online}, []string{models.HealthOnline}},
+		{"inconclusive first", []probeResult{inconclusive, offline, online}, []string{models.HealthOnline}},
+		{"inconclusive in between", []probeResult{online, inconclusive, online, inconclusive, offline}, []string{models.HealthOffline}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mon := NewMonitor(nil)
+			var got []string
+			mon.OnChange = func(c models.HealthChange) { got = append(got, c.Status) }
+			for _, res := range tt.results {
+				mon.record("cam", res)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("changes = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("changes = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthState(t *testing.T) {
+	mon := NewMonitor(nil)
+	if h := mon.Get("cam"); h.Status != models.HealthUnknown {
+		t.Errorf("unchecked stream = %+v", h)
+	}
+
+	mon.record("cam", probeResult{online: true, codec: "h264", width: 1280, height: 720, source: "ffprobe"})
+	h := mon.Get("cam")
+	if h.Status != models.HealthOnline || h.Codec != "h264" || h.Width != 1280 || h.LastSeen.IsZero() {
+		t.Errorf("online stream = %+v", h)
+	}
+
+	mon.record("cam", probeResult{err: errors.New("timeout")})
+	h = mon.Get("cam")
+	if h.Status != models.HealthOffline || h.Error != "timeout" || h.Codec != "h264" {
+		t.Errorf("offline stream = %+v, want the last codec kept", h)
+	}
+	if n := len(mon.History("cam")); n != 2 {
+		t.Errorf("history has %d entries, want 2", n)
+	}
+
+	mon.prune(nil)
+	mon.record("cam", probeResult{err: errors.New("timeout")})
+	if n := len(mon.History("cam")); n != 3 {
+		t.Errorf("history has %d entries after the stream came back, want 3", n)
+	}
+}
@@ -1,30 +1,72 @@
 package stream
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"net"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sync"
-	"time"
 	"web-tr/internal/config"
 	"web-tr/internal/db"
+	"web-tr/internal/events"
 	"web-tr/internal/models"
+	"web-tr/internal/transcode"
+	"web-tr/internal/vault"
 )
 
 type Manager struct {
 	ConfigManager *config.ConfigManager
 	Store         *db.Store
-	cmd           *exec.Cmd
+	Vault         *vault.Vault
+	Profiles      *transcode.Service
+	Recorder      *Recorder
+	Monitor       *Monitor
+	// Events receives engine restarts and health transitions; may be nil
+	Events *events.Hub
+	// OnRemove is called with the name of a stream that was deleted or
+	// renamed, e.g. to drop its metrics
+	OnRemove func(name string)
+
+	engines map[string]Engine
+
+	mu          sync.Mutex
+	settings    *config.AppSettings
+	supervisors map[string]*Supervisor
+	// names are the stored streams as of the last engine config write
+	names map[string]bool
 }
 
 func NewManager(cfg *config.ConfigManager) *Manager {
-	return &Manager{
+	settings, err := config.LoadAppSettings()
+	if err != nil {
+		log.Printf("Failed to load %s, defaulting to go2rtc: %v", config.SettingsFile, err)
+		settings = &config.AppSettings{StreamEngine: BackendGo2RTC}
+	}
+
+	m := &Manager{
 		ConfigManager: cfg,
+		Recorder:      NewRecorder("recordings"),
+		engines: map[string]Engine{
+			BackendGo2RTC:   newGo2RTCEngine(cfg),
+			BackendMediaMTX: newMediaMTXEngine("mediamtx.yml"),
+		},
+		settings:    settings,
+		supervisors: make(map[string]*Supervisor),
+	}
+	m.Recorder.SourceURL = func(st models.Stream) string {
+		return m.engineFor(st).RTSPURL(st.Name)
+	}
+	m.Recorder.OnGap = func(gap models.RecordingGap) {
+		m.Events.Publish(events.RecordingGap, gap)
+	}
+	m.Monitor = NewMonitor(m.streamsWithCredentials)
+	m.Monitor.OnChange = func(c models.HealthChange) {
+		m.Events.Publish(events.HealthChanged, c)
 	}
+	return m
 }
 
 // EnsureConfig checks if config file exists
@@ -37,247 +79,531 @@ func (m *Manager) EnsureConfig() error {
 	return nil
 }
 
-func (m *Manager) Start() error {
-	// Check binary
-	binaryName := "go2rtc"
-	configName := m.ConfigManager.FilePath
+// Settings returns the current application settings
+func (m *Manager) Settings() config.AppSettings {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.settings
+}
 
-	if runtime.GOOS == "windows" {
-		binaryName += ".exe"
+// ApplySettings persists new settings and launches the selected engine if needed
+func (m *Manager) ApplySettings(settings config.AppSettings) error {
+	if _, ok := m.engines[settings.StreamEngine]; !ok {
+		return fmt.Errorf("unknown stream engine '%s'", settings.StreamEngine)
+	}
+	if err := config.SaveAppSettings(&settings); err != nil {
+		return err
 	}
 
-	// Check path
-	path, err := exec.LookPath(binaryName)
+	m.mu.Lock()
+	m.settings = &settings
+	m.mu.Unlock()
+
+	_, err := m.startEngine(settings.StreamEngine)
+	return err
+}
+
+func (m *Manager) defaultBackend() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.engines[m.settings.StreamEngine]; ok {
+		return m.settings.StreamEngine
+	}
+	return BackendGo2RTC
+}
+
+// resolveBackend checks a stream's engine, assigning the default one if it has none
+func (m *Manager) resolveBackend(st *models.Stream) error {
+	if st.Backend == "" {
+		st.Backend = m.defaultBackend()
+		return nil
+	}
+	if _, ok := m.engines[st.Backend]; !ok {
+		return invalid("%w '%s'", ErrUnknownBackend, st.Backend)
+	}
+	return nil
+}
+
+// engineFor returns the engine serving a stream, falling back to the configured default
+func (m *Manager) engineFor(st models.Stream) Engine {
+	if e, ok := m.engines[st.Backend]; ok {
+		return e
+	}
+	return m.engines[m.defaultBackend()]
+}
+
+// Start writes the engine configs and launches the default engine plus any
+// engine that a stream is assigned to
+func (m *Manager) Start() error {
+	streams, err := m.streamsWithCredentials()
 	if err != nil {
-		if _, err := os.Stat("./" + binaryName); err == nil {
-			path = "./" + binaryName
-		} else {
-			return fmt.Errorf("%s binary not found in current directory or PATH", binaryName)
+		return err
+	}
+	if err := m.writeEngineConfigs(streams); err != nil {
+		return err
+	}
+	m.setNames(streams)
+
+	m.Monitor.Start()
+
+	primary := m.defaultBackend()
+	if _, err := m.startEngine(primary); err != nil {
+		return err
+	}
+	for _, s := range streams {
+		name := m.engineFor(s).Name()
+		if _, err := m.startEngine(name); err != nil {
+			log.Printf("Error starting %s for stream %s: %v", name, s.Name, err)
 		}
 	}
+	return nil
+}
 
-	cmd := exec.Command(path, "-c", configName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// startEngine launches an engine under a supervisor unless it is already running.
+// It reports whether the engine was already running.
+func (m *Manager) startEngine(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start %s: %w", binaryName, err)
+	if _, running := m.supervisors[name]; running {
+		return true, nil
 	}
 
-	m.cmd = cmd
-	return nil
+	e := m.engines[name]
+	path, args, err := e.Command()
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("Starting %s...", name)
+	sup := NewSupervisor(name, path, args, e.HealthURL())
+	sup.OnReady = func() {
+		m.refreshRecorder()
+		m.Events.Publish(events.EngineReady, map[string]string{"engine": name})
+	}
+	sup.OnRestart = func(restarts int) {
+		m.Events.Publish(events.EngineRestart, map[string]interface{}{"engine": name, "restarts": restarts})
+	}
+	sup.Start()
+	m.supervisors[name] = sup
+	return false, nil
 }
 
-func (m *Manager) AddStream(name, url string) error {
-	backend := "go2rtc" // Default backend
+// EngineStatus reports the state of the default engine and every supervised one
+func (m *Manager) EngineStatus() []EngineStatus {
+	primary := m.defaultBackend()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := []EngineStatus{}
+	for _, name := range []string{BackendGo2RTC, BackendMediaMTX} {
+		if sup, ok := m.supervisors[name]; ok {
+			statuses = append(statuses, sup.Status())
+		} else if name == primary {
+			statuses = append(statuses, EngineStatus{Engine: name, State: EngineStopped})
+		}
+	}
+	return statuses
+}
+
+var (
+	// ErrStreamNotFound is returned when removing a stream that does not exist
+	ErrStreamNotFound = errors.New("stream not found")
+	// ErrInvalidStream matches every error about a submitted stream that can't
+	// be stored as given, such as a bad tag or an unknown profile
+	ErrInvalidStream = errors.New("invalid stream")
+	// ErrUnknownBackend is returned for a stream assigned to an engine that isn't configured
+	ErrUnknownBackend = errors.New("unknown backend")
+)
+
+// invalidStream is a validation error. Its message is shown to the user as is.
+type invalidStream struct{ err error }
+
+func invalid(format string, args ...interface{}) error {
+	return invalidStream{fmt.Errorf(format, args...)}
+}
+
+func (e invalidStream) Error() string        { return e.err.Error() }
+func (e invalidStream) Unwrap() error        { return e.err }
+func (e invalidStream) Is(target error) bool { return target == ErrInvalidStream }
+
+// AddStream stores a new stream and pushes it to its engine; by names the user
+// making the change for the published event
+func (m *Manager) AddStream(st models.Stream, by string) error {
+	if err := m.resolveBackend(&st); err != nil {
+		return err
+	}
+	if err := normalizeStream(&st); err != nil {
+		return err
+	}
+	if err := m.checkProfile(st); err != nil {
+		return err
+	}
+	cred, err := m.splitCredentials(&st, nil)
+	if err != nil {
+		return err
+	}
+
 	if m.Store != nil {
-		// DB mode - simplified for now, assuming URL string
-		if err := m.Store.UpdateStream(name, name, url, backend); err != nil {
+		if err := m.Store.AddStream(st); err != nil {
+			return err
+		}
+	} else if err := m.ConfigManager.AddStream(st); err != nil {
+		return err
+	}
+	if cred != nil {
+		if err := m.Vault.Set(st.Name, cred); err != nil {
 			return err
 		}
-		return m.SyncFromDB()
 	}
 
-	return m.ConfigManager.AddStream(name, url)
+	err = m.applyChanges(nil, []models.Stream{st})
+	m.publishStream(events.StreamAdded, st.Name, "", by)
+	return err
 }
 
-func (m *Manager) RemoveStream(name string) error {
+func (m *Manager) RemoveStream(name, by string) error {
+	old, found := m.FindStream(name)
+	if !found {
+		return ErrStreamNotFound
+	}
+
 	if m.Store != nil {
 		if err := m.Store.RemoveStream(name); err != nil {
 			return err
 		}
-		return m.SyncFromDB()
+	} else if err := m.ConfigManager.RemoveStream(name); err != nil {
+		return err
+	}
+	if m.Vault != nil {
+		if err := m.Vault.Remove(name); err != nil {
+			return err
+		}
 	}
 
-	return m.ConfigManager.RemoveStream(name)
+	err := m.applyChanges([]models.Stream{old}, nil)
+	m.publishStream(events.StreamDeleted, name, "", by)
+	return err
 }
 
-func (m *Manager) UpdateStream(oldName, name, url string) error {
-	backend := "go2rtc" // Default backend
+func (m *Manager) UpdateStream(oldName string, st models.Stream, by string) error {
+	if err := m.resolveBackend(&st); err != nil {
+		return err
+	}
+	if oldName == "" {
+		oldName = st.Name
+	}
+	if err := normalizeStream(&st); err != nil {
+		return err
+	}
+	if err := m.checkProfile(st); err != nil {
+		return err
+	}
+	old, found := m.FindStream(oldName)
+	var prev *models.Stream
+	if found {
+		prev = &old
+	}
+	cred, err := m.splitCredentials(&st, prev)
+	if err != nil {
+		return err
+	}
+
 	if m.Store != nil {
-		if err := m.Store.UpdateStream(oldName, name, url, backend); err != nil {
+		if err := m.Store.UpdateStream(oldName, st); err != nil {
 			return err
 		}
-		return m.SyncFromDB()
-	}
-
-	// Go2RTC File-based update logic
-	if oldName != "" && oldName != name {
+	} else if oldName != st.Name {
+		// Go2RTC File-based update logic
 		if err := m.ConfigManager.RemoveStream(oldName); err != nil {
 			return err
 		}
-		return m.ConfigManager.AddStream(name, url)
+		if err := m.ConfigManager.AddStream(st); err != nil {
+			return err
+		}
+	} else if err := m.ConfigManager.SetStream(st); err != nil {
+		return err
 	}
-	return m.ConfigManager.SetStream(name, url)
-}
 
-func (m *Manager) GetStreams() ([]models.Stream, error) {
-	if m.Store != nil {
-		return m.Store.GetStreams()
+	if m.Vault != nil {
+		if oldName != st.Name {
+			if err := m.Vault.Remove(oldName); err != nil {
+				return err
+			}
+		}
+		if err := m.Vault.Set(st.Name, cred); err != nil {
+			return err
+		}
 	}
 
-	return m.ConfigManager.GetStreams()
+	// A rename or engine switch leaves the old path behind in the previous engine
+	var removed []models.Stream
+	if found && (old.Name != st.Name || m.engineFor(old) != m.engineFor(st)) {
+		removed = append(removed, old)
+	}
+	err = m.applyChanges(removed, []models.Stream{st})
+	m.publishStream(events.StreamUpdated, st.Name, oldName, by)
+	return err
 }
 
-func (m *Manager) Stop() error {
-	if m.cmd != nil && m.cmd.Process != nil {
-		return m.cmd.Process.Kill()
+// publishStream announces a stored change with the password redacted. It is sent
+// even if the engines could not be updated, since the stored stream did change.
+// by is the user who made the change, empty for changes the server makes itself.
+func (m *Manager) publishStream(typ, name, oldName, by string) {
+	var st *models.Stream
+	if found, ok := m.FindStream(name); ok {
+		st = &found
 	}
-	return nil
+	m.Events.Publish(typ, streamEventData(name, oldName, by, st))
 }
 
-// SyncFromDB reads from DB and overrides the config file
-func (m *Manager) SyncFromDB() error {
-	streams, err := m.Store.GetStreams()
-	if err != nil {
-		return err
-	}
+// streamEvent is one change announced by publishStreams
+type streamEvent struct {
+	typ, name, oldName string
+}
 
-	// Go2RTC Logic
-	cfg, err := m.ConfigManager.Load()
+// publishStreams announces a batch of stored changes as one StreamsChanged
+// event, reading the stream list once for all of them
+func (m *Manager) publishStreams(list []streamEvent, by string) {
+	streams, err := m.GetStreams()
 	if err != nil {
-		return err
+		log.Printf("Failed to load streams for the change events: %v", err)
 	}
-
-	// Reset streams map
-	cfg.Streams = make(map[string]interface{})
-	for _, s := range streams {
-		cfg.Streams[s.Name] = s.URL
+	byName := make(map[string]*models.Stream, len(streams))
+	for i := range streams {
+		byName[streams[i].Name] = &streams[i]
 	}
 
-	return m.ConfigManager.Save(cfg)
+	batch := events.Batch{By: by, Changes: make([]events.Change, len(list))}
+	for i, e := range list {
+		batch.Changes[i] = events.Change{Type: e.typ, Data: streamEventData(e.name, e.oldName, by, byName[e.name])}
+	}
+	m.Events.Publish(events.StreamsChanged, batch)
 }
 
-// ProbeStream runs ffprobe to check if the stream is reachable
-func (m *Manager) ProbeStream(url string) error {
-	// Increased timeout from 5s to 15s for slow/distant streams
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	// Adjust arguments. -rtsp_transport tcp is usually more reliable.
-	args := []string{
-		"-v", "error",
-		"-show_entries", "stream=codec_type",
-		"-rtsp_transport", "tcp",
-		"-timeout", "10000000", // 10 second connection timeout (in microseconds)
-		"-i", url,
+// streamEventData is the data of a stream event; st is the stream as shown to clients, nil once deleted
+func streamEventData(name, oldName, by string, st *models.Stream) map[string]interface{} {
+	data := map[string]interface{}{"name": name}
+	if by != "" {
+		data["by"] = by
 	}
-
-	// Resolve ffprobe path
-	binaryName := "ffprobe"
-	if runtime.GOOS == "windows" {
-		binaryName = "ffprobe.exe"
+	if oldName != "" && oldName != name {
+		data["originalName"] = oldName
 	}
+	if st != nil {
+		data["stream"] = *st
+	}
+	return data
+}
 
-	path := binaryName
-	// Check if it exists in current directory first
-	if _, err := os.Stat(binaryName); err == nil {
-		if abs, err := filepath.Abs(binaryName); err == nil {
-			path = abs
-		} else {
-			path = "." + string(os.PathSeparator) + binaryName
-		}
-	} else {
-		// If not in current dir, look in PATH
-		if p, err := exec.LookPath(binaryName); err == nil {
-			path = p
+// GetStreams returns the stream list with passwords redacted, safe to show to clients
+func (m *Manager) GetStreams() ([]models.Stream, error) {
+	streams, err := m.storedStreams()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := m.credentials()
+	if err != nil {
+		return nil, err
+	}
+	for i := range streams {
+		if c, ok := creds[streams[i].Name]; ok {
+			streams[i].URL = vault.Redact(streams[i].URL, &c)
 		}
+		streams[i].Health = m.Monitor.Get(streams[i].Name)
 	}
+	return streams, nil
+}
 
-	cmd := exec.CommandContext(ctx, path, args...)
-	output, err := cmd.CombinedOutput()
+// Lookup finds a stream together with the engine serving it
+func (m *Manager) Lookup(name string) (models.Stream, Engine, bool) {
+	st, found := m.FindStream(name)
+	if !found {
+		return st, nil, false
+	}
+	return st, m.engineFor(st), true
+}
 
+// FindStream looks up a stream by name
+func (m *Manager) FindStream(name string) (models.Stream, bool) {
+	streams, err := m.GetStreams()
 	if err != nil {
-		// Provide more helpful error messages
-		if ctx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("connection timeout (15s) - stream might be too slow or unreachable")
+		return models.Stream{}, false
+	}
+	for _, s := range streams {
+		if s.Name == name {
+			return s, true
 		}
+	}
+	return models.Stream{}, false
+}
 
-		outputStr := string(output)
-		if outputStr != "" {
-			return fmt.Errorf("stream validation failed: %s", outputStr)
-		}
+func (m *Manager) Stop() error {
+	m.Monitor.Stop()
+	m.Recorder.StopAll()
 
-		return fmt.Errorf("cannot connect to stream - check URL, credentials, and network connectivity")
-	}
+	m.mu.Lock()
+	supervisors := m.supervisors
+	m.supervisors = make(map[string]*Supervisor)
+	m.mu.Unlock()
 
+	for _, sup := range supervisors {
+		sup.Stop()
+	}
 	return nil
 }
 
-// DiscoveredStream holds info about a found camera
-type DiscoveredStream struct {
-	Address string `json:"address"`
-	URL     string `json:"url"` // Suggested URL
+// SyncFromDB reads from DB and overrides the engine config files
+func (m *Manager) SyncFromDB() error {
+	_, err := m.syncStreams()
+	return err
 }
 
-// DiscoverStreams scans the local network for RTSP services (Port 554)
-func (m *Manager) DiscoverStreams() ([]DiscoveredStream, error) {
-	// 1. Get Local IP and Subnet
-	ip, ipNet, err := getLocalIPAndNetwork()
+// syncStreams rewrites the engine configs and recorder jobs from the stored
+// streams, returning them with credentials injected
+func (m *Manager) syncStreams() ([]models.Stream, error) {
+	streams, err := m.streamsWithCredentials()
 	if err != nil {
 		return nil, err
 	}
+	if err := m.writeEngineConfigs(streams); err != nil {
+		return nil, err
+	}
+	m.setNames(streams)
+	m.Recorder.Sync(streams)
+	return streams, nil
+}
 
-	// 2. Scan Subnet (Simple /24 assumption for now for home networks)
-	// We'll scan x.x.x.1 -> x.x.x.254
-	ipv4 := ip.To4()
-	if ipv4 == nil {
-		return nil, fmt.Errorf("only IPv4 supported for simple scan")
+// setNames records the stored streams for HasStream and reports those that are gone to OnRemove
+func (m *Manager) setNames(streams []models.Stream) {
+	names := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		names[s.Name] = true
 	}
 
-	baseIP := ipv4.Mask(ipNet.Mask)
+	m.mu.Lock()
+	old := m.names
+	m.names = names
+	m.mu.Unlock()
 
-	discovered := []DiscoveredStream{} // Init as empty slice to return [] instead of null
-	var mu sync.Mutex
-	var wg sync.WaitGroup
+	if m.OnRemove == nil {
+		return
+	}
+	for name := range old {
+		if !names[name] {
+			m.OnRemove(name)
+		}
+	}
+}
 
-	// Limit concurrency
-	sem := make(chan struct{}, 50)
+// HasStream reports whether a stream exists without reading the store, for
+// checks made on every request
+func (m *Manager) HasStream(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.names[name]
+}
 
-	for i := 1; i < 255; i++ {
-		// Construct target IP
-		// This is a naive way to iterate /24.
-		// If mask is not /24, this might be slightly off but works for 99% of home cases.
-		targetIP := net.IPv4(baseIP[0], baseIP[1], baseIP[2], byte(i))
-		if targetIP.Equal(ip) {
-			continue // skip self if needed, though self might run rtsp server
+// writeEngineConfigs regenerates every engine's config file from the stream list
+func (m *Manager) writeEngineConfigs(streams []models.Stream) error {
+	// Resolve empty backends so each engine picks up its streams
+	resolved := make([]models.Stream, len(streams))
+	for i, s := range streams {
+		s.Backend = m.engineFor(s).Name()
+		resolved[i] = s
+	}
+
+	for _, e := range m.engines {
+		if err := e.WriteConfig(resolved); err != nil {
+			return fmt.Errorf("failed to write %s config: %w", e.Name(), err)
 		}
+	}
+	return nil
+}
 
-		wg.Add(1)
-		go func(target string) {
-			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			conn, err := net.DialTimeout("tcp", target+":554", 200*time.Millisecond)
-			if err == nil {
-				conn.Close()
-				mu.Lock()
-				discovered = append(discovered, DiscoveredStream{
-					Address: target,
-					URL:     fmt.Sprintf("rtsp://%s:554/stream", target), // Guess default
-				})
-				mu.Unlock()
-			}
-		}(targetIP.String())
+// applyChanges rewrites the engine configs after a stream change and pushes the
+// change to engines that are already running, so no restart is needed
+func (m *Manager) applyChanges(removed, changed []models.Stream) error {
+	streams, err := m.syncStreams()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]models.Stream, len(streams))
+	for _, s := range streams {
+		byName[s.Name] = s
+	}
+
+	for _, s := range removed {
+		e := m.engineFor(s)
+		if !m.engineRunning(e.Name()) {
+			continue
+		}
+		if err := e.RemoveStream(s.Name); err != nil {
+			log.Printf("Failed to remove stream %s from %s: %v", s.Name, e.Name(), err)
+		}
+	}
+
+	for _, s := range changed {
+		// Running engines need the URL with credentials
+		if full, ok := byName[s.Name]; ok {
+			s = full
+		}
+		e := m.engineFor(s)
+		wasRunning, err := m.startEngine(e.Name())
+		if err != nil {
+			log.Printf("Failed to start %s for stream %s: %v", e.Name(), s.Name, err)
+			continue
+		}
+		// A freshly started engine reads the new config file on its own
+		if !wasRunning {
+			continue
+		}
+		if err := e.SyncStream(s); err != nil {
+			log.Printf("Failed to sync stream %s to %s: %v", s.Name, e.Name(), err)
+		}
+	}
+
+	if len(changed) > 0 {
+		m.Monitor.Trigger()
 	}
+	return nil
+}
 
-	wg.Wait()
-	return discovered, nil
+func (m *Manager) engineRunning(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.supervisors[name]
+	return ok
 }
 
-func getLocalIPAndNetwork() (net.IP, *net.IPNet, error) {
-	addrs, err := net.InterfaceAddrs()
+// refreshRecorder aligns the running recordings with the current stream list
+func (m *Manager) refreshRecorder() {
+	streams, err := m.GetStreams()
 	if err != nil {
-		return nil, nil, err
+		log.Printf("[Recorder] Failed to load streams: %v", err)
+		return
 	}
-	for _, address := range addrs {
-		// check the address type and if it is not a loopback the display it
-		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				return ipnet.IP, ipnet, nil
-			}
+	m.Recorder.Sync(streams)
+}
+
+// FindBinary resolves a helper binary, preferring the current directory over PATH
+func FindBinary(name string) string {
+	binaryName := name
+	if runtime.GOOS == "windows" {
+		binaryName += ".exe"
+	}
+
+	// Check if it exists in current directory first
+	if _, err := os.Stat(binaryName); err == nil {
+		if abs, err := filepath.Abs(binaryName); err == nil {
+			return abs
 		}
+		return "." + string(os.PathSeparator) + binaryName
+	}
+	// If not in current dir, look in PATH
+	if p, err := exec.LookPath(binaryName); err == nil {
+		return p
 	}
-	return nil, nil, fmt.Errorf("no valid local IP found")
+	return binaryName
 }
@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"errors"
+	"testing"
+	"web-tr/internal/config"
+	"web-tr/internal/models"
+)
+
+func TestResolveBackend(t *testing.T) {
+	m := &Manager{
+		engines:  map[string]Engine{BackendGo2RTC: nil, BackendMediaMTX: nil},
+		settings: &config.AppSettings{StreamEngine: BackendMediaMTX},
+	}
+
+	tests := []struct {
+		backend string
+		want    string
+		wantErr error
+	}{
+		{"", BackendMediaMTX, nil},
+		{BackendGo2RTC, BackendGo2RTC, nil},
+		{BackendMediaMTX, BackendMediaMTX, nil},
+		{"vlc", "vlc", ErrUnknownBackend},
+		{"Go2RTC", "Go2RTC", ErrUnknownBackend},
+	}
+	for _, tt := range tests {
+		st := models.Stream{Name: "cam", Backend: tt.backend}
+		err := m.resolveBackend(&st)
+		if !errors.Is(err, tt.wantErr) || st.Backend != tt.want {
+			t.Errorf("resolveBackend(%q) = %q, %v; want %q, %v", tt.backend, st.Backend, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// An unknown configured engine falls back to go2rtc
+	m.settings.StreamEngine = "gone"
+	st := models.Stream{}
+	if err := m.resolveBackend(&st); err != nil || st.Backend != BackendGo2RTC {
+		t.Errorf("default with a bad setting = %q, %v", st.Backend, err)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	m := &Manager{
+		engines:  map[string]Engine{BackendGo2RTC: nil},
+		settings: &config.AppSettings{StreamEngine: BackendGo2RTC},
+	}
+	current := map[string]models.Stream{"yard": {Name: "yard", URL: "rtsp://yard"}}
+
+	tests := []struct {
+		name    string
+		op      models.BulkOp
+		invalid bool
+	}{
+		{"unknown backend", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x", URL: "rtsp://x", Backend: "vlc"}}, true},
+		{"bad tag", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x", URL: "rtsp://x", Tags: []string{"a,b"}}}, true},
+		{"bad time-lapse interval", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x", URL: "rtsp://x", TimelapseInterval: 1}}, true},
+		{"profile on an ffmpeg source", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x", URL: "ffmpeg:yard#video=h264", ProfileID: "720p"}}, true},
+		{"missing url", models.BulkOp{Op: models.BulkCreate, Stream: models.Stream{Name: "x"}}, true},
+		{"missing stream", models.BulkOp{Op: models.BulkDelete, Name: "gone"}, false},
+	}
+	for _, tt := range tests {
+		_, err := m.planOp(tt.op, current)
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		if errors.Is(err, ErrInvalidStream) != tt.invalid {
+			t.Errorf("%s: %v matches ErrInvalidStream = %v, want %v", tt.name, err, !tt.invalid, tt.invalid)
+		}
+	}
+}
+
+func TestSetNames(t *testing.T) {
+	var removed []string
+	m := &Manager{OnRemove: func(name string) { removed = append(removed, name) }}
+
+	m.setNames([]models.Stream{{Name: "yard"}, {Name: "door"}})
+	if !m.HasStream("yard") || !m.HasStream("door") || m.HasStream("gate") {
+		t.Error("HasStream does not match the stream list")
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed %v on the first sync", removed)
+	}
+
+	// door was renamed to gate
+	m.setNames([]models.Stream{{Name: "yard"}, {Name: "gate"}})
+	if m.HasStream("door") || !m.HasStream("gate") {
+		t.Error("HasStream still sees the old name")
+	}
+	if len(removed) != 1 || removed[0] != "door" {
+		t.Errorf("removed %v, want door", removed)
+	}
+}
@@ -0,0 +1,146 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"web-tr/internal/config"
+	"web-tr/internal/models"
+	"web-tr/internal/transcode"
+)
+
+const (
+	mediamtxAPI    = "http://127.0.0.1:9997"
+	mediamtxWebRTC = "http://127.0.0.1:8889"
+	mediamtxHLS    = "http://127.0.0.1:8888"
+)
+
+type mediamtxEngine struct {
+	configPath string
+}
+
+func newMediaMTXEngine(configPath string) *mediamtxEngine {
+	return &mediamtxEngine{configPath: configPath}
+}
+
+func (e *mediamtxEngine) Name() string { return BackendMediaMTX }
+
+func (e *mediamtxEngine) Command() (string, []string, error) {
+	// The release archive is usually unpacked into ./mediamtx
+	path, err := locateBinary("mediamtx", "mediamtx")
+	if err != nil {
+		return "", nil, err
+	}
+	return path, []string{e.configPath}, nil
+}
+
+func (e *mediamtxEngine) HealthURL() string { return mediamtxAPI + "/v3/config/global/get" }
+
+func (e *mediamtxEngine) WriteConfig(streams []models.Stream) error {
+	paths := make(map[string]config.MediaMTXPath)
+	for _, s := range streams {
+		if s.Backend == BackendMediaMTX {
+			paths[s.Name] = e.path(s)
+		}
+	}
+	return config.GenerateMediaMTXConfig(paths, e.configPath)
+}
+
+// path is the MediaMTX config of a stream. MediaMTX pulls a plain camera
+// itself; with a transcoding profile it runs ffmpeg, which publishes the
+// transcoded stream to the path whenever someone watches it.
+func (e *mediamtxEngine) path(st models.Stream) config.MediaMTXPath {
+	if st.Transcode == nil {
+		return config.MediaMTXPath{Source: st.URL}
+	}
+	args := transcode.FFmpegArgs(st.URL, "rtsp://localhost:$RTSP_PORT/$MTX_PATH", st.Transcode)
+	return config.MediaMTXPath{
+		Source:             "publisher",
+		RunOnDemand:        transcode.Command(FindBinary("ffmpeg"), args),
+		RunOnDemandRestart: true,
+	}
+}
+
+func (e *mediamtxEngine) SyncStream(st models.Stream) error {
+	body, err := json.Marshal(e.path(st))
+	if err != nil {
+		return err
+	}
+
+	// "add" fails for existing paths, in which case patch the source instead
+	status, err := e.call(http.MethodPost, "/v3/config/paths/add/"+url.PathEscape(st.Name), body)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusBadRequest {
+		status, err = e.call(http.MethodPatch, "/v3/config/paths/patch/"+url.PathEscape(st.Name), body)
+		if err != nil {
+			return err
+		}
+	}
+	if status >= 400 {
+		return fmt.Errorf("mediamtx api returned status %d", status)
+	}
+	return nil
+}
+
+func (e *mediamtxEngine) RemoveStream(name string) error {
+	status, err := e.call(http.MethodDelete, "/v3/config/paths/delete/"+url.PathEscape(name), nil)
+	if err != nil {
+		return err
+	}
+	if status >= 400 && status != http.StatusNotFound {
+		return fmt.Errorf("mediamtx api returned status %d", status)
+	}
+	return nil
+}
+
+func (e *mediamtxEngine) RTSPURL(name string) string {
+	return "rtsp://127.0.0.1:8555/" + url.PathEscape(name)
+}
+
+func (e *mediamtxEngine) WHEPURL(name string) string {
+	return mediamtxWebRTC + "/" + url.PathEscape(name) + "/whep"
+}
+
+// MediaMTX has no progressive MP4 output, only HLS
+func (e *mediamtxEngine) MP4URL(name string) string { return "" }
+
+// MediaMTX keeps the playlists and segments of a stream in one flat directory
+func (e *mediamtxEngine) HLSURL(name, path string) string {
+	if path == "" {
+		path = "index.m3u8"
+	}
+	if strings.Contains(path, "/") || !validHLSPath(path) {
+		return ""
+	}
+	return mediamtxHLS + "/" + url.PathEscape(name) + "/" + path
+}
+
+// MediaMTX has no snapshot API
+func (e *mediamtxEngine) FrameURL(name string) string { return "" }
+
+func (e *mediamtxEngine) call(method, path string, body []byte) (int, error) {
+	req, err := http.NewRequest(method, mediamtxAPI+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := engineClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	log.Printf("MediaMTX %s %s response: %s (Status: %d)", method, path, string(respBody), resp.StatusCode)
+	return resp.StatusCode, nil
+}
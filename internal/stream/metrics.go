@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"log"
+	"web-tr/internal/metrics"
+	"web-tr/internal/models"
+)
+
+var probeDuration = metrics.NewHistogramVec(
+	"webtr_stream_probe_duration_seconds",
+	"Duration of ffprobe health checks per stream, by result.",
+	[]float64{0.25, 0.5, 1, 2, 5, 10, 15},
+	"stream", "result",
+)
+
+func probeOutcome(res probeResult) string {
+	if res.online {
+		return models.HealthOnline
+	}
+	return models.HealthOffline
+}
+
+// CollectMetrics emits stream health and engine state on every scrape
+func (m *Manager) CollectMetrics(e *metrics.Emitter) {
+	streams, err := m.GetStreams()
+	if err != nil {
+		log.Printf("[Metrics] Failed to load streams: %v", err)
+		streams = nil
+	}
+
+	e.Header("webtr_stream_up", "1 if the stream is online, 0 if it is offline. Absent until the first conclusive check.", "gauge")
+	for _, s := range streams {
+		switch s.Health.Status {
+		case models.HealthOnline:
+			e.Sample("webtr_stream_up", 1, "stream", s.Name, "backend", s.Backend)
+		case models.HealthOffline:
+			e.Sample("webtr_stream_up", 0, "stream", s.Name, "backend", s.Backend)
+		}
+	}
+
+	e.Header("webtr_stream_last_seen_timestamp_seconds", "Unix time the stream was last seen online.", "gauge")
+	for _, s := range streams {
+		if !s.Health.LastSeen.IsZero() {
+			e.Sample("webtr_stream_last_seen_timestamp_seconds", float64(s.Health.LastSeen.Unix()), "stream", s.Name)
+		}
+	}
+
+	e.Header("webtr_stream_viewers", "Consumers go2rtc is serving per stream at the last health check.", "gauge")
+	for _, s := range streams {
+		if isGo2RTC(s) {
+			e.Sample("webtr_stream_viewers", float64(m.Monitor.Viewers(s.Name)), "stream", s.Name)
+		}
+	}
+
+	statuses := m.EngineStatus()
+	e.Header("webtr_engine_up", "1 if the stream engine answers its health check.", "gauge")
+	for _, st := range statuses {
+		up := 0.0
+		if st.Ready {
+			up = 1
+		}
+		e.Sample("webtr_engine_up", up, "engine", st.Engine)
+	}
+
+	e.Header("webtr_engine_restarts_total", "Times the supervisor restarted the engine after it exited.", "counter")
+	for _, st := range statuses {
+		e.Sample("webtr_engine_restarts_total", float64(st.Restarts), "engine", st.Engine)
+	}
+}
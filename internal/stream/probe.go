@@ -0,0 +1,212 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"web-tr/internal/vault"
+)
+
+// ProbeTrack describes one elementary stream reported by ffprobe
+type ProbeTrack struct {
+	Index       int     `json:"index"`
+	Type        string  `json:"type"` // video, audio, data
+	Codec       string  `json:"codec"`
+	Profile     string  `json:"profile,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	FPS         float64 `json:"fps,omitempty"`
+	PixelFormat string  `json:"pixel_format,omitempty"`
+	Bitrate     int64   `json:"bitrate,omitempty"` // bit/s, often unknown for live RTSP
+	SampleRate  int     `json:"sample_rate,omitempty"`
+	Channels    int     `json:"channels,omitempty"`
+	Layout      string  `json:"channel_layout,omitempty"`
+}
+
+// TranscodeAdvice says whether the stream needs the ffmpeg transcode that
+// go2rtc.yaml uses so HLS and MSE players can decode it
+type TranscodeAdvice struct {
+	Needed  bool     `json:"needed"`
+	Video   bool     `json:"video"`
+	Audio   bool     `json:"audio"`
+	Reasons []string `json:"reasons"`
+	// Source is the suggested stream URL, e.g. "ffmpeg:rtsp://...#video=h264#audio=aac"
+	Source string `json:"source,omitempty"`
+}
+
+type ProbeResult struct {
+	Format    string          `json:"format,omitempty"`
+	Bitrate   int64           `json:"bitrate,omitempty"`
+	Tracks    []ProbeTrack    `json:"tracks"`
+	Transcode TranscodeAdvice `json:"transcode"`
+}
+
+// ProbeStream runs ffprobe against a camera URL and describes its tracks.
+// A "ffmpeg:" source is probed at its input, the transcode options are ignored.
+func (m *Manager) ProbeStream(url string) (*ProbeResult, error) {
+	// Increased timeout from 5s to 15s for slow/distant streams
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	input := probeInput(url)
+	args := []string{"-v", "error"}
+	if strings.HasPrefix(input, "rtsp") {
+		// -rtsp_transport tcp is usually more reliable
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	args = append(args,
+		"-timeout", "10000000", // 10 second connection timeout (in microseconds)
+		"-show_streams",
+		"-show_format",
+		"-of", "json",
+		"-i", input,
+	)
+
+	out, err := exec.CommandContext(ctx, FindBinary("ffprobe"), args...).Output()
+	if err != nil {
+		// Provide more helpful error messages
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("ffprobe is not installed")
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("connection timeout (15s) - stream might be too slow or unreachable")
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			msg := strings.ReplaceAll(string(exitErr.Stderr), input, vault.StripCredentials(input))
+			return nil, fmt.Errorf("stream validation failed: %s", strings.TrimSpace(msg))
+		}
+		return nil, fmt.Errorf("cannot connect to stream - check URL, credentials, and network connectivity")
+	}
+
+	res, err := parseProbe(out)
+	if err != nil {
+		return nil, err
+	}
+	res.Transcode = adviseTranscode(res.Tracks)
+	return res, nil
+}
+
+func parseProbe(out []byte) (*ProbeResult, error) {
+	var info struct {
+		Streams []struct {
+			Index         int    `json:"index"`
+			CodecType     string `json:"codec_type"`
+			CodecName     string `json:"codec_name"`
+			Profile       string `json:"profile"`
+			Width         int    `json:"width"`
+			Height        int    `json:"height"`
+			AvgFrameRate  string `json:"avg_frame_rate"`
+			RFrameRate    string `json:"r_frame_rate"`
+			PixFmt        string `json:"pix_fmt"`
+			BitRate       string `json:"bit_rate"`
+			SampleRate    string `json:"sample_rate"`
+			Channels      int    `json:"channels"`
+			ChannelLayout string `json:"channel_layout"`
+		} `json:"streams"`
+		Format struct {
+			FormatName string `json:"format_name"`
+			BitRate    string `json:"bit_rate"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("unexpected ffprobe output: %w", err)
+	}
+	if len(info.Streams) == 0 {
+		return nil, fmt.Errorf("stream has no tracks")
+	}
+
+	res := &ProbeResult{Format: info.Format.FormatName, Tracks: []ProbeTrack{}}
+	res.Bitrate, _ = strconv.ParseInt(info.Format.BitRate, 10, 64)
+	for _, s := range info.Streams {
+		t := ProbeTrack{
+			Index:       s.Index,
+			Type:        s.CodecType,
+			Codec:       s.CodecName,
+			Profile:     s.Profile,
+			Width:       s.Width,
+			Height:      s.Height,
+			PixelFormat: s.PixFmt,
+			Channels:    s.Channels,
+			Layout:      s.ChannelLayout,
+		}
+		if t.Type == "video" {
+			// avg_frame_rate is 0/0 for many live sources
+			if t.FPS = parseRate(s.AvgFrameRate); t.FPS == 0 {
+				t.FPS = parseRate(s.RFrameRate)
+			}
+		}
+		t.Bitrate, _ = strconv.ParseInt(s.BitRate, 10, 64)
+		t.SampleRate, _ = strconv.Atoi(s.SampleRate)
+		res.Tracks = append(res.Tracks, t)
+	}
+	return res, nil
+}
+
+// parseRate turns ffprobe's "30000/1001" into 29.97
+func parseRate(r string) float64 {
+	num, den, ok := strings.Cut(r, "/")
+	if !ok {
+		v, _ := strconv.ParseFloat(r, 64)
+		return v
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return float64(int(n/d*100+0.5)) / 100
+}
+
+// adviseTranscode checks the tracks against what browsers decode over HLS and MSE:
+// H.264 in 8-bit 4:2:0 and AAC audio
+func adviseTranscode(tracks []ProbeTrack) TranscodeAdvice {
+	a := TranscodeAdvice{Reasons: []string{}}
+	hasVideo := false
+	for _, t := range tracks {
+		switch t.Type {
+		case "video":
+			if hasVideo {
+				continue
+			}
+			hasVideo = true
+			if t.Codec != "h264" {
+				a.Video = true
+				a.Reasons = append(a.Reasons, fmt.Sprintf("video codec %s is not supported by most browsers over HLS", t.Codec))
+			} else if t.PixelFormat != "" && t.PixelFormat != "yuv420p" && t.PixelFormat != "yuvj420p" {
+				a.Video = true
+				a.Reasons = append(a.Reasons, fmt.Sprintf("H.264 with pixel format %s is not decoded by browsers", t.PixelFormat))
+			}
+		case "audio":
+			if t.Codec != "aac" && !a.Audio {
+				a.Audio = true
+				a.Reasons = append(a.Reasons, fmt.Sprintf("audio codec %s is not supported in HLS/MP4, AAC is", t.Codec))
+			}
+		}
+	}
+	if !hasVideo {
+		a.Reasons = append(a.Reasons, "no video track found")
+	}
+	a.Needed = a.Video || a.Audio
+	return a
+}
+
+// Suggest builds the transcoding source for a camera URL in the form go2rtc.yaml uses
+func (a TranscodeAdvice) Suggest(src string) string {
+	if !a.Needed {
+		return ""
+	}
+	input := probeInput(src)
+	video, audio := "copy", "copy"
+	if a.Video {
+		video = "h264"
+	}
+	if a.Audio {
+		audio = "aac"
+	}
+	return "ffmpeg:" + input + "#video=" + video + "#audio=" + audio
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProbe(t *testing.T) {
+	out := `{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "hevc", "profile": "Main", "width": 2560, "height": 1440,
+			 "avg_frame_rate": "0/0", "r_frame_rate": "30000/1001", "pix_fmt": "yuvj420p"},
+			{"index": 1, "codec_type": "audio", "codec_name": "pcm_alaw", "sample_rate": "8000", "channels": 1,
+			 "channel_layout": "mono", "bit_rate": "64000"}
+		],
+		"format": {"format_name": "rtsp", "bit_rate": "N/A"}
+	}`
+	res, err := parseProbe([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProbeTrack{
+		{Index: 0, Type: "video", Codec: "hevc", Profile: "Main", Width: 2560, Height: 1440, FPS: 29.97, PixelFormat: "yuvj420p"},
+		{Index: 1, Type: "audio", Codec: "pcm_alaw", Bitrate: 64000, SampleRate: 8000, Channels: 1, Layout: "mono"},
+	}
+	if res.Format != "rtsp" || res.Bitrate != 0 || !reflect.DeepEqual(res.Tracks, want) {
+		t.Errorf("got %+v", res)
+	}
+
+	for _, bad := range []string{`{"streams": []}`, `not json`} {
+		if _, err := parseProbe([]byte(bad)); err == nil {
+			t.Errorf("parseProbe(%s) was accepted", bad)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"25/1", 25},
+		{"30000/1001", 29.97},
+		{"0/0", 0},
+		{"15", 15},
+		{"x/1", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRate(tt.in); got != tt.want {
+			t.Errorf("parseRate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAdviseTranscode(t *testing.T) {
+	h264 := ProbeTrack{Type: "video", Codec: "h264", PixelFormat: "yuv420p"}
+	aac := ProbeTrack{Type: "audio", Codec: "aac"}
+	tests := []struct {
+		name       string
+		tracks     []ProbeTrack
+		wantVideo  bool
+		wantAudio  bool
+		wantReason string
+		wantSource string
+	}{
+		{"browser ready", []ProbeTrack{h264, aac}, false, false, "", ""},
+		{"hevc", []ProbeTrack{{Type: "video", Codec: "hevc"}, aac}, true, false, "video codec hevc", "ffmpeg:rtsp://cam/main#video=h264#audio=copy"},
+		{"10-bit h264", []ProbeTrack{{Type: "video", Codec: "h264", PixelFormat: "yuv420p10le"}}, true, false, "pixel format yuv420p10le", "ffmpeg:rtsp://cam/main#video=h264#audio=copy"},
+		{"g711 audio", []ProbeTrack{h264, {Type: "audio", Codec: "pcm_mulaw"}}, false, true, "audio codec pcm_mulaw", "ffmpeg:rtsp://cam/main#video=copy#audio=aac"},
+		{"only the first video track counts", []ProbeTrack{h264, {Type: "video", Codec: "mjpeg"}}, false, false, "", ""},
+		{"audio only", []ProbeTrack{aac}, false, false, "no video track", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := adviseTranscode(tt.tracks)
+			if a.Video != tt.wantVideo || a.Audio != tt.wantAudio || a.Needed != (tt.wantVideo || tt.wantAudio) {
+				t.Errorf("advice = %+v", a)
+			}
+			reasons := strings.Join(a.Reasons, "; ")
+			if (tt.wantReason == "") != (reasons == "") || !strings.Contains(reasons, tt.wantReason) {
+				t.Errorf("reasons = %q, want %q", reasons, tt.wantReason)
+			}
+			// A transcoding source is probed at its input
+			if got := a.Suggest("ffmpeg:rtsp://cam/main#video=copy"); got != tt.wantSource {
+				t.Errorf("Suggest = %q, want %q", got, tt.wantSource)
+			}
+		})
+	}
+}
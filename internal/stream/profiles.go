@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+	"web-tr/internal/transcode"
+)
+
+// resolveProfiles attaches the transcoding profile of each stream for the
+// engines. A stream whose profile has gone missing is passed through as is.
+func (m *Manager) resolveProfiles(streams []models.Stream) error {
+	if m.Profiles == nil {
+		return nil
+	}
+	profiles, err := m.Profiles.All()
+	if err != nil {
+		return err
+	}
+	for i := range streams {
+		if streams[i].ProfileID == "" {
+			continue
+		}
+		p, ok := profiles[streams[i].ProfileID]
+		if !ok {
+			log.Printf("Stream %s refers to unknown transcoding profile %s, passing it through", streams[i].Name, streams[i].ProfileID)
+			continue
+		}
+		streams[i].Transcode = &p
+	}
+	return nil
+}
+
+// checkProfile verifies the transcoding profile a submitted stream refers to
+func (m *Manager) checkProfile(st models.Stream) error {
+	if st.ProfileID == "" {
+		return nil
+	}
+	if transcode.IsTranscodeSource(st.URL) {
+		return invalid("a stream with a transcoding profile needs the camera URL, not an ffmpeg: source")
+	}
+	if m.Profiles == nil {
+		return invalid("transcoding profiles are not available")
+	}
+	if _, err := m.Profiles.Get(st.ProfileID); err != nil {
+		if errors.Is(err, transcode.ErrNotFound) {
+			return invalid("unknown transcoding profile '%s'", st.ProfileID)
+		}
+		return err
+	}
+	return nil
+}
+
+// ProfileStreams returns the streams using profile id
+func (m *Manager) ProfileStreams(id string) ([]models.Stream, error) {
+	streams, err := m.GetStreams()
+	if err != nil {
+		return nil, err
+	}
+	var users []models.Stream
+	for _, s := range streams {
+		if s.ProfileID == id {
+			users = append(users, s)
+		}
+	}
+	return users, nil
+}
+
+// UpdateProfile changes profile id and pushes it to every stream using it,
+// which restarts their transcoding in the running engines
+func (m *Manager) UpdateProfile(id string, p models.TranscodeProfile, by string) (*models.TranscodeProfile, error) {
+	updated, err := m.Profiles.Update(id, p)
+	if err != nil {
+		return nil, err
+	}
+	users, err := m.ProfileStreams(id)
+	if err != nil || len(users) == 0 {
+		return updated, err
+	}
+
+	err = m.applyChanges(nil, users)
+	announced := make([]streamEvent, len(users))
+	for i, st := range users {
+		announced[i] = streamEvent{typ: events.StreamUpdated, name: st.Name}
+	}
+	m.publishStreams(announced, by)
+	return updated, err
+}
+
+// RemoveProfile deletes a profile no stream uses any more
+func (m *Manager) RemoveProfile(id string) error {
+	users, err := m.ProfileStreams(id)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		names := make([]string, len(users))
+		for i, st := range users {
+			names[i] = st.Name
+		}
+		return fmt.Errorf("%w: %s", transcode.ErrInUse, strings.Join(names, ", "))
+	}
+	return m.Profiles.Remove(id)
+}
@@ -0,0 +1,281 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/models"
+)
+
+// segmentTimeLayout matches the strftime pattern passed to ffmpeg below
+const segmentTimeLayout = "2006-01-02_15-04-05"
+
+// ErrInvalidRecording is returned for a file name outside a stream's recordings
+var ErrInvalidRecording = errors.New("invalid recording file")
+
+// recordingSettle is how long a restarted ffmpeg must keep running before the
+// recording counts as resumed
+const recordingSettle = 10 * time.Second
+
+// Segment is one recorded MP4 file as consumed by playback.html
+type Segment struct {
+	Time time.Time `json:"time"`
+	// End is when the segment was last written to
+	End      time.Time `json:"end"`
+	Size     int64     `json:"size"`
+	URL      string    `json:"url"`
+	Filename string    `json:"filename"`
+	// Locked segments are kept by retention
+	Locked bool `json:"locked,omitempty"`
+}
+
+// Recorder keeps one ffmpeg segmenter running for every stream with Recording enabled
+type Recorder struct {
+	Dir             string
+	SegmentDuration time.Duration
+	// SourceURL returns the URL ffmpeg should read from for a stream
+	SourceURL func(st models.Stream) string
+	// OnGap is called when a recording resumes after ffmpeg failed
+	OnGap func(gap models.RecordingGap)
+
+	mu   sync.Mutex
+	jobs map[string]*recordingJob
+}
+
+type recordingJob struct {
+	source string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRecorder(dir string) *Recorder {
+	return &Recorder{
+		Dir:             dir,
+		SegmentDuration: 5 * time.Minute,
+		SourceURL: func(st models.Stream) string {
+			// Record from go2rtc's RTSP restream so the camera only serves one connection
+			return "rtsp://127.0.0.1:8554/" + url.PathEscape(st.Name)
+		},
+		jobs: make(map[string]*recordingJob),
+	}
+}
+
+// Sync starts recording for newly enabled streams and stops it for removed or disabled ones
+func (r *Recorder) Sync(streams []models.Stream) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wanted := make(map[string]string)
+	for _, s := range streams {
+		if s.Recording {
+			wanted[s.Name] = r.SourceURL(s)
+		}
+	}
+
+	for name, job := range r.jobs {
+		if src, ok := wanted[name]; !ok || src != job.source {
+			log.Printf("[Recorder] Stopping recording for %s", name)
+			job.cancel()
+			<-job.done
+			delete(r.jobs, name)
+		}
+	}
+
+	for name, src := range wanted {
+		if _, running := r.jobs[name]; running {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		job := &recordingJob{source: src, cancel: cancel, done: make(chan struct{})}
+		r.jobs[name] = job
+		log.Printf("[Recorder] Starting recording for %s", name)
+		go r.run(ctx, name, job)
+	}
+}
+
+// StopAll stops every running recording
+func (r *Recorder) StopAll() {
+	r.Sync(nil)
+}
+
+// IsRecording reports whether a segmenter is currently assigned to the stream
+func (r *Recorder) IsRecording(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.jobs[name]
+	return ok
+}
+
+func (r *Recorder) run(ctx context.Context, name string, job *recordingJob) {
+	defer close(job.done)
+
+	dir := r.StreamDir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[Recorder] Cannot create %s: %v", dir, err)
+		return
+	}
+
+	// down is when ffmpeg last failed, until a new one keeps running
+	var down time.Time
+	var downErr error
+	for {
+		args := []string{
+			"-hide_banner",
+			"-loglevel", "error",
+			"-rtsp_transport", "tcp",
+			"-i", job.source,
+			"-map", "0:v",
+			"-map", "0:a?",
+			"-c:v", "copy",
+			"-c:a", "aac",
+			"-f", "segment",
+			"-segment_time", fmt.Sprintf("%d", int(r.SegmentDuration.Seconds())),
+			"-segment_format", "mp4",
+			// Fragmented MP4 keeps the segment being written playable
+			"-segment_format_options", "movflags=+frag_keyframe+empty_moov+default_base_moof",
+			"-reset_timestamps", "1",
+			"-strftime", "1",
+			filepath.Join(dir, "%Y-%m-%d_%H-%M-%S.mp4"),
+		}
+
+		cmd := exec.CommandContext(ctx, FindBinary("ffmpeg"), args...)
+		cmd.Stderr = os.Stderr
+		started := time.Now()
+		err := cmd.Start()
+		if err == nil {
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+			select {
+			case err = <-exited:
+			case <-time.After(recordingSettle):
+				if !down.IsZero() && r.OnGap != nil {
+					gap := models.RecordingGap{Stream: name, From: down, To: started}
+					if downErr != nil {
+						gap.Error = downErr.Error()
+					}
+					r.OnGap(gap)
+				}
+				down = time.Time{}
+				err = <-exited
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		if down.IsZero() {
+			down, downErr = time.Now(), err
+		}
+		log.Printf("[Recorder] ffmpeg for %s exited (%v), restarting in 5s", name, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// StreamDir returns the directory holding a stream's segments
+func (r *Recorder) StreamDir(name string) string {
+	return filepath.Join(r.Dir, SafeDirName(name))
+}
+
+// ListSegments returns the recorded segments of a stream, oldest first
+func (r *Recorder) ListSegments(name string) ([]Segment, error) {
+	entries, err := os.ReadDir(r.StreamDir(name))
+	if os.IsNotExist(err) {
+		return []Segment{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []Segment{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".mp4") {
+			continue
+		}
+		t, err := time.ParseInLocation(segmentTimeLayout, strings.TrimSuffix(e.Name(), ".mp4"), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, Segment{
+			Time:     t,
+			End:      info.ModTime(),
+			Size:     info.Size(),
+			URL:      "/recordings/" + url.PathEscape(SafeDirName(name)) + "/" + url.PathEscape(e.Name()),
+			Filename: e.Name(),
+			Locked:   Locked(filepath.Join(r.StreamDir(name), e.Name())),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Time.Before(segments[j].Time)
+	})
+	return segments, nil
+}
+
+// LockFile returns the marker protecting a recording file from retention:
+// 2006-01-02_15-04-05.lock for 2006-01-02_15-04-05.mp4 and, for a motion
+// event, for all of its files
+func LockFile(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".lock"
+}
+
+// Locked reports whether a recording file is protected from retention
+func Locked(path string) bool {
+	_, err := os.Stat(LockFile(path))
+	return err == nil
+}
+
+// SetLocked protects a file of a stream's recordings from retention, or lifts
+// the protection. file is a segment's name or motion/ and the name of a
+// motion event file.
+func (r *Recorder) SetLocked(name, file string, locked bool) error {
+	dir, base := filepath.Split(filepath.FromSlash(file))
+	if base == "" || base != filepath.Base(base) || strings.HasPrefix(base, ".") || strings.HasSuffix(base, ".lock") ||
+		(dir != "" && dir != "motion"+string(filepath.Separator)) {
+		return fmt.Errorf("%w %q", ErrInvalidRecording, file)
+	}
+	path := filepath.Join(r.StreamDir(name), dir, base)
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	if !locked {
+		err := os.Remove(LockFile(path))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(LockFile(path), nil, 0644)
+}
+
+// SafeDirName maps a stream name to a single path element
+func SafeDirName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." || name == "" {
+		name = "_"
+	}
+	return name
+}
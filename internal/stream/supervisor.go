@@ -0,0 +1,286 @@
+package stream
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	EngineStopped  = "stopped"
+	EngineStarting = "starting"
+	EngineRunning  = "running"
+	EngineBackoff  = "backoff"
+)
+
+// EngineStatus is the snapshot reported by /api/engine/status
+type EngineStatus struct {
+	Engine    string     `json:"engine"`
+	State     string     `json:"state"`
+	Ready     bool       `json:"ready"`
+	PID       int        `json:"pid,omitempty"`
+	Restarts  int        `json:"restarts"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	LastExit  *time.Time `json:"last_exit,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	NextRetry *time.Time `json:"next_retry,omitempty"`
+}
+
+// Supervisor keeps an engine process alive, restarting it with exponential backoff
+type Supervisor struct {
+	Name      string
+	Path      string
+	Args      []string
+	HealthURL string
+
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	StopTimeout time.Duration
+	// StableAfter is how long a process must run before the backoff resets
+	StableAfter time.Duration
+
+	// OnReady is called every time the engine's API starts answering
+	OnReady func()
+	// OnRestart is called before the process is launched again after an exit
+	OnRestart func(restarts int)
+
+	mu     sync.Mutex
+	status EngineStatus
+	stop   chan struct{}
+	done   chan struct{}
+	// launches counts the processes started; running is the number of the
+	// one alive, 0 if none, so a late health check can't mark another ready
+	launches int
+	running  int
+}
+
+func NewSupervisor(name, path string, args []string, healthURL string) *Supervisor {
+	return &Supervisor{
+		Name:        name,
+		Path:        path,
+		Args:        args,
+		HealthURL:   healthURL,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Minute,
+		StopTimeout: 10 * time.Second,
+		StableAfter: 30 * time.Second,
+		status:      EngineStatus{Engine: name, State: EngineStopped},
+	}
+}
+
+// Start launches the supervision loop in the background
+func (s *Supervisor) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop(s.stop, s.done)
+}
+
+// Stop terminates the process (SIGTERM, then kill after StopTimeout) and ends supervision
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+	return nil
+}
+
+// Status returns a copy of the current engine status
+func (s *Supervisor) Status() EngineStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *Supervisor) update(fn func(st *EngineStatus)) {
+	s.mu.Lock()
+	fn(&s.status)
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) loop(stop, done chan struct{}) {
+	defer close(done)
+	defer s.update(func(st *EngineStatus) {
+		st.State = EngineStopped
+		st.Ready = false
+		st.PID = 0
+		st.NextRetry = nil
+	})
+
+	backoff := s.MinBackoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			s.update(func(st *EngineStatus) { st.Restarts++ })
+			if s.OnRestart != nil {
+				s.OnRestart(s.Status().Restarts)
+			}
+		}
+
+		startedAt := time.Now()
+		err := s.runOnce(stop)
+		if err == errStopped {
+			return
+		}
+
+		if time.Since(startedAt) >= s.StableAfter {
+			backoff = s.MinBackoff
+		}
+
+		now := time.Now()
+		retry := now.Add(backoff)
+		s.update(func(st *EngineStatus) {
+			st.State = EngineBackoff
+			st.Ready = false
+			st.PID = 0
+			st.LastExit = &now
+			st.NextRetry = &retry
+			if err != nil {
+				st.LastError = err.Error()
+			}
+		})
+		log.Printf("[Supervisor] %s exited (%v), restarting in %s", s.Name, err, backoff)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+var errStopped = fmt.Errorf("supervisor stopped")
+
+// runOnce starts the process and blocks until it exits or stop is closed
+func (s *Supervisor) runOnce(stop chan struct{}) error {
+	s.update(func(st *EngineStatus) {
+		st.State = EngineStarting
+		st.Ready = false
+		st.NextRetry = nil
+	})
+
+	cmd := exec.Command(s.Path, s.Args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", s.Name, err)
+	}
+
+	now := time.Now()
+	var launch int
+	s.update(func(st *EngineStatus) {
+		st.State = EngineRunning
+		st.PID = cmd.Process.Pid
+		st.StartedAt = &now
+		s.launches++
+		launch = s.launches
+		s.running = launch
+	})
+	log.Printf("[Supervisor] %s started (pid %d)", s.Name, cmd.Process.Pid)
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	healthDone := make(chan struct{})
+	defer close(healthDone)
+	defer s.update(func(st *EngineStatus) {
+		s.running = 0
+		st.Ready = false
+	})
+	go s.watchHealth(healthDone, launch)
+
+	select {
+	case err := <-exited:
+		if err == nil {
+			err = fmt.Errorf("%s exited unexpectedly", s.Name)
+		}
+		return err
+	case <-stop:
+		s.terminate(cmd, exited)
+		return errStopped
+	}
+}
+
+// terminate asks the process to shut down gracefully before killing it
+func (s *Supervisor) terminate(cmd *exec.Cmd, exited chan error) {
+	log.Printf("[Supervisor] Stopping %s (pid %d)", s.Name, cmd.Process.Pid)
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		// Windows cannot deliver SIGTERM
+		cmd.Process.Kill()
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(s.StopTimeout):
+		log.Printf("[Supervisor] %s did not exit within %s, killing", s.Name, s.StopTimeout)
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// watchHealth polls the engine API and keeps Ready up to date while process
+// launch runs. A check that finishes after the process exited is dropped.
+func (s *Supervisor) watchHealth(done chan struct{}, launch int) {
+	if s.HealthURL == "" {
+		return
+	}
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	interval := 500 * time.Millisecond
+	wasReady := false
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+
+		ready := false
+		if resp, err := client.Get(s.HealthURL); err == nil {
+			resp.Body.Close()
+			ready = resp.StatusCode < 500
+		}
+
+		current := false
+		s.update(func(st *EngineStatus) {
+			if current = s.running == launch; current {
+				st.Ready = ready
+			}
+		})
+		if !current {
+			return
+		}
+		if ready && !wasReady {
+			log.Printf("[Supervisor] %s is ready", s.Name)
+			if s.OnReady != nil {
+				s.OnReady()
+			}
+		}
+		wasReady = ready
+
+		// Poll quickly until the API first answers, then settle into a slower rhythm
+		if ready {
+			interval = 5 * time.Second
+		}
+	}
+}
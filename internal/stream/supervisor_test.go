@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls the supervisor status until cond holds
+func waitFor(t *testing.T, s *Supervisor, what string, cond func(EngineStatus) bool) EngineStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := s.Status()
+		if cond(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, status %+v", what, st)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestSupervisor(script string) *Supervisor {
+	s := NewSupervisor("engine", "/bin/sh", []string{"-c", script}, "")
+	s.MinBackoff = 10 * time.Millisecond
+	s.MaxBackoff = 20 * time.Millisecond
+	s.StopTimeout = time.Second
+	return s
+}
+
+func TestSupervisorRestartsAfterExit(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		script  string
+		wantErr string
+	}{
+		{"exit code", "/bin/sh", "exit 3", "exit status 3"},
+		{"clean exit", "/bin/sh", "exit 0", "exited unexpectedly"},
+		{"missing binary", "/nonexistent/engine", "", "failed to start engine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSupervisor(tt.script)
+			s.Path = tt.path
+			var restarts atomic.Int32
+			s.OnRestart = func(int) { restarts.Add(1) }
+			s.Start()
+			defer s.Stop()
+
+			st := waitFor(t, s, "two restarts", func(st EngineStatus) bool { return st.Restarts >= 2 })
+			if !strings.Contains(st.LastError, tt.wantErr) {
+				t.Errorf("last error = %q, want %q", st.LastError, tt.wantErr)
+			}
+			if restarts.Load() < 2 {
+				t.Errorf("OnRestart called %d times", restarts.Load())
+			}
+		})
+	}
+}
+
+func TestSupervisorStop(t *testing.T) {
+	s := newTestSupervisor("exec sleep 60")
+	s.Start()
+	st := waitFor(t, s, "the process", func(st EngineStatus) bool { return st.State == EngineRunning })
+	if st.PID == 0 || st.StartedAt == nil {
+		t.Errorf("running status = %+v", st)
+	}
+
+	start := time.Now()
+	s.Stop()
+	if time.Since(start) >= s.StopTimeout {
+		t.Error("the process ignored SIGTERM")
+	}
+	if st := s.Status(); st.State != EngineStopped || st.PID != 0 || st.Ready {
+		t.Errorf("stopped status = %+v", st)
+	}
+	// Stopping twice is harmless
+	s.Stop()
+}
+
+func TestSupervisorReady(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s := newTestSupervisor("exec sleep 60")
+	s.HealthURL = srv.URL
+	var ready atomic.Int32
+	s.OnReady = func() { ready.Add(1) }
+	s.Start()
+	defer s.Stop()
+
+	waitFor(t, s, "ready", func(st EngineStatus) bool { return st.Ready })
+	if ready.Load() != 1 {
+		t.Errorf("OnReady called %d times", ready.Load())
+	}
+}
+
+func TestHealthCheckOfExitedProcessIsDropped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	s := newTestSupervisor("")
+	s.HealthURL = srv.URL
+	s.OnReady = func() { t.Error("OnReady called for a process that is gone") }
+	// Process 1 exited and process 2 is running
+	s.launches, s.running = 2, 2
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		s.watchHealth(done, 1)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		close(done)
+		t.Fatal("the health check kept running")
+	}
+	if s.Status().Ready {
+		t.Error("a stale health check marked the engine ready")
+	}
+}
@@ -0,0 +1,475 @@
+// Package timelapse stores a frame of selected streams at a fixed interval and
+// stitches the frames of a day into an MP4 with ffmpeg, on demand or nightly.
+//
+// Frames and videos are kept per stream next to each other:
+//
+//	timelapses/<stream>/frames/2006-01-02/15-04-05.jpg
+//	timelapses/<stream>/2006-01-02.mp4
+package timelapse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+	"web-tr/internal/snapshot"
+	"web-tr/internal/stream"
+)
+
+var (
+	ErrNotFound    = errors.New("no time-lapse frames for that day")
+	ErrInvalidDate = errors.New("invalid date, expected YYYY-MM-DD")
+)
+
+const (
+	// DateLayout names a day of frames and the video made from it
+	DateLayout = "2006-01-02"
+	// frameLayout names a frame within its day
+	frameLayout = "15-04-05"
+	// captureTimeout bounds taking one frame
+	captureTimeout = 30 * time.Second
+)
+
+// Frames is the snapshot pipeline frames are taken from, see snapshot.Service
+type Frames interface {
+	Get(ctx context.Context, name string, opts snapshot.Options) (*snapshot.Frame, error)
+}
+
+// Streams lists the streams and their capture intervals, see stream.Manager
+type Streams interface {
+	GetStreams() ([]models.Stream, error)
+}
+
+// Day is the frames captured on one day and the video made from them
+type Day struct {
+	Date   string `json:"date"`
+	Frames int    `json:"frames"`
+	// The video fields are empty until the day has been generated
+	Size        int64     `json:"size,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Filename    string    `json:"filename,omitempty"`
+	GeneratedAt time.Time `json:"generated_at,omitzero"`
+	// Stale is set when frames were captured after the video was made
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Service captures frames of the streams with a TimelapseInterval and makes
+// videos of them
+type Service struct {
+	Dir string
+	// FPS is the frame rate of the videos, one stored frame per video frame
+	FPS int
+	// NightlyAt is the time after local midnight when the videos of the
+	// previous day are made
+	NightlyAt time.Duration
+	FFmpeg    string
+	Frames    Frames
+	Streams   Streams
+
+	mu   sync.Mutex
+	jobs map[string]*captureJob
+	// encodeMu runs one encode at a time, they are heavy on the CPU
+	encodeMu sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+type captureJob struct {
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewService(frames Frames, streams Streams) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		Dir:       "timelapses",
+		FPS:       30,
+		NightlyAt: 5 * time.Minute,
+		FFmpeg:    stream.FindBinary("ffmpeg"),
+		Frames:    frames,
+		Streams:   streams,
+		jobs:      make(map[string]*captureJob),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start captures the configured streams, following stream changes on the hub,
+// and makes the videos of past days nightly until Stop is called. Days missed
+// while the server was down are made right away.
+func (s *Service) Start(hub *events.Hub) {
+	ch := hub.Queue()
+	s.refresh()
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		defer hub.Unsubscribe(ch)
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case ev := <-ch:
+				switch ev.Type {
+				case events.StreamAdded, events.StreamUpdated, events.StreamDeleted, events.StreamsChanged:
+					s.refresh()
+				}
+			}
+		}
+	}()
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.generatePending()
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(time.Until(s.nextNightly(time.Now()))):
+			}
+		}
+	}()
+}
+
+// Stop ends capturing and abandons a running encode
+func (s *Service) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	s.Sync(nil)
+}
+
+// refresh aligns the captures with the stored streams
+func (s *Service) refresh() {
+	streams, err := s.Streams.GetStreams()
+	if err != nil {
+		log.Printf("[Timelapse] Failed to load streams: %v", err)
+		return
+	}
+	s.Sync(streams)
+}
+
+// Sync starts capturing newly enabled streams and stops removed or disabled
+// ones. A stream whose interval changed is restarted.
+func (s *Service) Sync(streams []models.Stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]time.Duration)
+	for _, st := range streams {
+		if st.TimelapseInterval > 0 {
+			wanted[st.Name] = time.Duration(st.TimelapseInterval) * time.Second
+		}
+	}
+
+	for name, job := range s.jobs {
+		if interval, ok := wanted[name]; !ok || interval != job.interval {
+			log.Printf("[Timelapse] Stopping capture for %s", name)
+			job.cancel()
+			<-job.done
+			delete(s.jobs, name)
+		}
+	}
+
+	for name, interval := range wanted {
+		if _, running := s.jobs[name]; running {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		job := &captureJob{interval: interval, cancel: cancel, done: make(chan struct{})}
+		s.jobs[name] = job
+		log.Printf("[Timelapse] Capturing %s every %s", name, interval)
+		go s.run(ctx, name, job)
+	}
+}
+
+func (s *Service) run(ctx context.Context, name string, job *captureJob) {
+	defer close(job.done)
+
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+
+	// Only changes between failing and working are logged, a camera that is
+	// down would otherwise fill the log
+	failing := false
+	for {
+		err := s.capture(ctx, name, job.interval)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !failing {
+			log.Printf("[Timelapse] No frame from %s: %v", name, err)
+		} else if err == nil && failing {
+			log.Printf("[Timelapse] Capturing %s again", name)
+		}
+		failing = err != nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// capture stores the current frame of a stream
+func (s *Service) capture(ctx context.Context, name string, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, captureTimeout)
+	defer cancel()
+	// A frame cached for a dashboard is good enough if it was taken since the
+	// previous tick, the snapshot TTL may be longer than the interval
+	frame, err := s.Frames.Get(ctx, name, snapshot.Options{MaxAge: interval / 2})
+	if err != nil {
+		return err
+	}
+
+	t := frame.Time.Local()
+	dir := filepath.Join(s.streamDir(name), "frames", t.Format(DateLayout))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, t.Format(frameLayout)+".jpg")
+	if _, err := os.Stat(path); err == nil {
+		// The snapshot cache handed out a frame that is stored already
+		return nil
+	}
+	// Written aside and renamed, so an encode never reads half a frame
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, frame.JPEG, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// streamDir returns the directory holding a stream's frames and videos
+func (s *Service) streamDir(name string) string {
+	return filepath.Join(s.Dir, stream.SafeDirName(name))
+}
+
+// List returns the days with frames or a video of a stream, oldest first
+func (s *Service) List(name string) ([]Day, error) {
+	return s.list(stream.SafeDirName(name))
+}
+
+func (s *Service) list(dirName string) ([]Day, error) {
+	dir := filepath.Join(s.Dir, dirName)
+	days := map[string]*Day{}
+	latest := map[string]time.Time{}
+	day := func(date string) *Day {
+		if days[date] == nil {
+			days[date] = &Day{Date: date}
+		}
+		return days[date]
+	}
+
+	frameDays, err := os.ReadDir(filepath.Join(dir, "frames"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range frameDays {
+		if !e.IsDir() || !validDate(e.Name()) {
+			continue
+		}
+		frames, err := dayFrames(dir, e.Name())
+		if err != nil || len(frames) == 0 {
+			continue
+		}
+		day(e.Name()).Frames = len(frames)
+		last := strings.TrimSuffix(frames[len(frames)-1], ".jpg")
+		latest[e.Name()], _ = time.ParseInLocation(DateLayout+" "+frameLayout, e.Name()+" "+last, time.Local)
+	}
+
+	videos, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range videos {
+		date, ok := strings.CutSuffix(e.Name(), ".mp4")
+		if e.IsDir() || !ok || !validDate(date) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		d := day(date)
+		d.Size = info.Size()
+		d.URL = "/timelapses/" + url.PathEscape(dirName) + "/" + url.PathEscape(e.Name())
+		d.Filename = e.Name()
+		d.GeneratedAt = info.ModTime()
+		d.Stale = latest[date].After(info.ModTime())
+	}
+
+	out := make([]Day, 0, len(days))
+	for _, d := range days {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
+
+// Generate makes the video of a stream's frames on date, replacing an
+// earlier one. The current day can be made too, with the frames so far.
+func (s *Service) Generate(ctx context.Context, name, date string) (*Day, error) {
+	if !validDate(date) {
+		return nil, ErrInvalidDate
+	}
+	dirName := stream.SafeDirName(name)
+	if err := s.generate(ctx, dirName, date); err != nil {
+		return nil, err
+	}
+	days, err := s.list(dirName)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range days {
+		if d.Date == date {
+			return &d, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *Service) generate(ctx context.Context, dirName, date string) error {
+	dir := filepath.Join(s.Dir, dirName)
+	frames, err := dayFrames(dir, date)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return ErrNotFound
+	}
+
+	s.encodeMu.Lock()
+	defer s.encodeMu.Unlock()
+
+	// The concat demuxer takes the frames in order with a fixed duration each;
+	// it resolves the file names relative to the list
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	for _, f := range frames {
+		fmt.Fprintf(&b, "file 'frames/%s/%s'\nduration %g\n", date, f, 1/float64(s.FPS))
+	}
+	// The duration of the last file only counts if it is listed again
+	fmt.Fprintf(&b, "file 'frames/%s/%s'\n", date, frames[len(frames)-1])
+
+	list := filepath.Join(dir, "."+date+".txt")
+	if err := os.WriteFile(list, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(list)
+
+	// Encoded aside and renamed, so a download never gets half a video
+	tmp := filepath.Join(dir, "."+date+".mp4")
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-y",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", list,
+		// Cameras may send odd sizes, which H.264 in 4:2:0 can't encode
+		"-vf", fmt.Sprintf("fps=%d,scale=trunc(iw/2)*2:trunc(ih/2)*2,format=yuv420p", s.FPS),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-movflags", "+faststart",
+		tmp,
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.FFmpeg, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			lines := strings.Split(msg, "\n")
+			return fmt.Errorf("ffmpeg: %s", lines[len(lines)-1])
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, date+".mp4"))
+}
+
+// generatePending makes the videos of past days that have none yet, or that
+// got frames after their video was made
+func (s *Service) generatePending() {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[Timelapse] Failed to read %s: %v", s.Dir, err)
+		}
+		return
+	}
+
+	today := time.Now().Format(DateLayout)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		days, err := s.list(e.Name())
+		if err != nil {
+			log.Printf("[Timelapse] Failed to list %s: %v", e.Name(), err)
+			continue
+		}
+		for _, d := range days {
+			if d.Date >= today || d.Frames == 0 || (d.URL != "" && !d.Stale) {
+				continue
+			}
+			start := time.Now()
+			err := s.generate(s.ctx, e.Name(), d.Date)
+			if s.ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("[Timelapse] Failed to make %s/%s.mp4: %v", e.Name(), d.Date, err)
+				continue
+			}
+			log.Printf("[Timelapse] Made %s/%s.mp4 from %d frames in %s", e.Name(), d.Date, d.Frames, time.Since(start).Round(time.Second))
+		}
+	}
+}
+
+// nextNightly returns when the nightly run after now is due
+func (s *Service) nextNightly(now time.Time) time.Time {
+	y, m, d := now.Date()
+	next := time.Date(y, m, d, 0, 0, 0, 0, now.Location()).Add(s.NightlyAt)
+	if !next.After(now) {
+		next = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Add(s.NightlyAt)
+	}
+	return next
+}
+
+// dayFrames returns the file names of the frames stored on date, in order
+func dayFrames(dir, date string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, "frames", date))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var frames []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".jpg") {
+			frames = append(frames, e.Name())
+		}
+	}
+	// ReadDir sorts by name, which is the capture time
+	return frames, nil
+}
+
+func validDate(date string) bool {
+	_, err := time.Parse(DateLayout, date)
+	return err == nil
+}
@@ -0,0 +1,250 @@
+package timelapse
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"web-tr/internal/models"
+	"web-tr/internal/snapshot"
+)
+
+// fakeFrames hands out a frame taken at the current time, or err
+type fakeFrames struct {
+	mu    sync.Mutex
+	calls map[string]int
+	err   error
+}
+
+func (f *fakeFrames) Get(ctx context.Context, name string, opts snapshot.Options) (*snapshot.Frame, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[name]++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &snapshot.Frame{JPEG: []byte{0xFF, 0xD8, 0xFF, 0xD9}, Time: time.Now()}, nil
+}
+
+func (f *fakeFrames) count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[name]
+}
+
+type staticStreams []models.Stream
+
+func (s staticStreams) GetStreams() ([]models.Stream, error) { return s, nil }
+
+// fakeFFmpeg writes a script that stores the concat list as the video, so a
+// test can check what would have been encoded
+func fakeFFmpeg(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\nlist=\nfor a; do\n  [ \"$prev\" = -i ] && list=$a\n  prev=$a\n  out=$a\ndone\ncp \"$list\" \"$out\"\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	s := NewService(&fakeFrames{}, staticStreams{})
+	s.Dir = t.TempDir()
+	s.FFmpeg = fakeFFmpeg(t)
+	s.FPS = 10
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// writeFrames stores frames of a stream at the given times of date
+func writeFrames(t *testing.T, s *Service, name, date string, times ...string) {
+	t.Helper()
+	dir := filepath.Join(s.streamDir(name), "frames", date)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, tm := range times {
+		if err := os.WriteFile(filepath.Join(dir, tm+".jpg"), []byte{0xFF, 0xD8}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNextNightly(t *testing.T) {
+	s := &Service{NightlyAt: 5 * time.Minute}
+	tests := []struct {
+		now, want string
+	}{
+		{"2026-05-01 00:00:00", "2026-05-01 00:05:00"},
+		{"2026-05-01 00:05:00", "2026-05-02 00:05:00"},
+		{"2026-05-01 13:00:00", "2026-05-02 00:05:00"},
+		{"2026-12-31 23:59:00", "2027-01-01 00:05:00"},
+	}
+	for _, tt := range tests {
+		now, _ := time.ParseInLocation(time.DateTime, tt.now, time.Local)
+		if got := s.nextNightly(now).Format(time.DateTime); got != tt.want {
+			t.Errorf("nextNightly(%s) = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestCaptureStoresFrames(t *testing.T) {
+	s := newTestService(t)
+	if err := s.capture(context.Background(), "front/door", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// A frame handed out again within the same second is not stored twice
+	if err := s.capture(context.Background(), "front/door", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	days, err := s.List("front/door")
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().Format(DateLayout)
+	if len(days) != 1 || days[0].Date != today || days[0].Frames < 1 || days[0].URL != "" {
+		t.Errorf("days = %+v", days)
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir, "front_door", "frames", today)); err != nil {
+		t.Errorf("frames are not under the stream's directory: %v", err)
+	}
+
+	s.Frames = &fakeFrames{err: errors.New("camera offline")}
+	if err := s.capture(context.Background(), "front/door", time.Minute); err == nil {
+		t.Error("capture without a frame succeeded")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	s := newTestService(t)
+	writeFrames(t, s, "yard", "2026-05-01", "10-00-00", "10-00-10")
+
+	tests := []struct {
+		name, stream, date string
+		want               error
+	}{
+		{"invalid date", "yard", "2026-5-1", ErrInvalidDate},
+		{"no frames", "yard", "2026-05-02", ErrNotFound},
+		{"unknown stream", "door", "2026-05-01", ErrNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := s.Generate(context.Background(), tt.stream, tt.date); err != tt.want {
+			t.Errorf("%s: Generate = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	day, err := s.Generate(context.Background(), "yard", "2026-05-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if day.Frames != 2 || day.URL != "/timelapses/yard/2026-05-01.mp4" || day.Stale {
+		t.Errorf("day = %+v", day)
+	}
+	list, err := os.ReadFile(filepath.Join(s.Dir, "yard", "2026-05-01.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ffconcat version 1.0\n" +
+		"file 'frames/2026-05-01/10-00-00.jpg'\nduration 0.1\n" +
+		"file 'frames/2026-05-01/10-00-10.jpg'\nduration 0.1\n" +
+		"file 'frames/2026-05-01/10-00-10.jpg'\n"
+	if string(list) != want {
+		t.Errorf("concat list:\n%s\nwant:\n%s", list, want)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(s.Dir, "yard")); len(entries) != 2 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	// Frames newer than the video make it stale
+	old := time.Date(2026, 5, 1, 10, 0, 5, 0, time.Local)
+	os.Chtimes(filepath.Join(s.Dir, "yard", "2026-05-01.mp4"), old, old)
+	days, _ := s.List("yard")
+	if len(days) != 1 || !days[0].Stale {
+		t.Errorf("days = %+v, want a stale video", days)
+	}
+}
+
+func TestGeneratePendingSkipsTodayAndFreshVideos(t *testing.T) {
+	s := newTestService(t)
+	today := time.Now().Format(DateLayout)
+	writeFrames(t, s, "yard", "2026-05-01", "10-00-00")
+	writeFrames(t, s, "yard", "2026-05-02", "10-00-00")
+	writeFrames(t, s, "yard", today, "00-00-00")
+	if _, err := s.Generate(context.Background(), "yard", "2026-05-02"); err != nil {
+		t.Fatal(err)
+	}
+	made := filepath.Join(s.Dir, "yard", "2026-05-02.mp4")
+	if err := os.WriteFile(made, []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s.generatePending()
+
+	for date, want := range map[string]bool{"2026-05-01": true, today: false} {
+		_, err := os.Stat(filepath.Join(s.Dir, "yard", date+".mp4"))
+		if (err == nil) != want {
+			t.Errorf("video of %s made = %v, want %v", date, err == nil, want)
+		}
+	}
+	if data, _ := os.ReadFile(made); string(data) != "kept" {
+		t.Error("a video that is up to date was made again")
+	}
+}
+
+func TestSyncFollowsIntervals(t *testing.T) {
+	frames := &fakeFrames{}
+	s := newTestService(t)
+	s.Frames = frames
+
+	s.Sync([]models.Stream{{Name: "yard", TimelapseInterval: 3600}, {Name: "door"}})
+	waitForCalls(t, frames, "yard", 1)
+
+	tests := []struct {
+		name    string
+		streams []models.Stream
+		want    map[string]time.Duration
+	}{
+		{"unchanged", []models.Stream{{Name: "yard", TimelapseInterval: 3600}}, map[string]time.Duration{"yard": time.Hour}},
+		{"interval changed", []models.Stream{{Name: "yard", TimelapseInterval: 60}}, map[string]time.Duration{"yard": time.Minute}},
+		{"disabled", []models.Stream{{Name: "yard"}, {Name: "door", TimelapseInterval: 60}}, map[string]time.Duration{"door": time.Minute}},
+		{"removed", nil, map[string]time.Duration{}},
+	}
+	for _, tt := range tests {
+		s.Sync(tt.streams)
+		s.mu.Lock()
+		got := map[string]time.Duration{}
+		for name, job := range s.jobs {
+			got[name] = job.interval
+		}
+		s.mu.Unlock()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: jobs = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for name, interval := range tt.want {
+			if got[name] != interval {
+				t.Errorf("%s: jobs = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func waitForCalls(t *testing.T, f *fakeFrames, name string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for f.count(name) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s captured %d times, want %d", name, f.count(name), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
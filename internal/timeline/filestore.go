@@ -0,0 +1,224 @@
+package timeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"web-tr/internal/models"
+)
+
+// fileLimit is the number of events kept in the file, the oldest are dropped
+// first. New events are appended; the file is only rewritten when events are
+// removed or changed, or once it holds compactSlack events over the limit.
+const (
+	fileLimit    = 20000
+	compactSlack = 2000
+)
+
+// FileStore keeps timeline events in a local file for File/YAML mode, one JSON
+// event per line. Files written as a single JSON array by older versions are
+// read too and converted on the first write. The events are cached in memory
+// after the first read.
+type FileStore struct {
+	FilePath string
+
+	mu     sync.Mutex
+	list   []models.TimelineEvent
+	loaded bool
+	// lines is false until the file is known to hold one event per line
+	lines bool
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() ([]models.TimelineEvent, error) {
+	if fs.loaded {
+		return fs.list, nil
+	}
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		fs.loaded, fs.lines = true, true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []models.TimelineEvent
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, err
+		}
+	} else {
+		lines := bytes.Split(data, []byte("\n"))
+		for i, line := range lines {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var ev models.TimelineEvent
+			if err := json.Unmarshal(line, &ev); err != nil {
+				// A crash can leave the last line half written
+				if i == len(lines)-1 {
+					log.Printf("[Timeline] Ignoring a truncated event at the end of %s", fs.FilePath)
+					break
+				}
+				return nil, err
+			}
+			list = append(list, ev)
+		}
+		fs.lines = true
+	}
+	fs.list, fs.loaded = list, true
+	return list, nil
+}
+
+// save rewrites the whole file from list
+func (fs *FileStore) save(list []models.TimelineEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, ev := range list {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(fs.FilePath, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	fs.list, fs.lines = list, true
+	return nil
+}
+
+// appendEvent adds one line to the file
+func (fs *FileStore) appendEvent(ev models.TimelineEvent) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fs.FilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fs.list = append(fs.list, ev)
+	return nil
+}
+
+func (fs *FileStore) GetTimelineEvents(q models.TimelineQuery) ([]models.TimelineEvent, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	list, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	out := []models.TimelineEvent{}
+	for _, ev := range list {
+		if matches(ev, q) {
+			out = append(out, ev)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+func (fs *FileStore) GetTimelineEvent(id int64) (*models.TimelineEvent, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	list, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, ev := range list {
+		if ev.ID == id {
+			return &ev, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *FileStore) AddTimelineEvent(ev models.TimelineEvent) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	list, err := fs.load()
+	if err != nil {
+		return 0, err
+	}
+	ev.ID = 1
+	if len(list) > 0 {
+		ev.ID = list[len(list)-1].ID + 1
+	}
+	if !fs.lines || len(list) >= fileLimit+compactSlack {
+		list = append(slices.Clone(list), ev)
+		if len(list) > fileLimit {
+			list = list[len(list)-fileLimit:]
+		}
+		return ev.ID, fs.save(list)
+	}
+	return ev.ID, fs.appendEvent(ev)
+}
+
+func (fs *FileStore) RemoveTimelineEvent(id int64) error {
+	return fs.remove(func(ev models.TimelineEvent) bool { return ev.ID == id })
+}
+
+func (fs *FileStore) RenameTimelineStream(oldName, newName string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	list, err := fs.load()
+	if err != nil {
+		return err
+	}
+	list = slices.Clone(list)
+	for i := range list {
+		if list[i].Stream == oldName {
+			list[i].Stream = newName
+		}
+	}
+	return fs.save(list)
+}
+
+func (fs *FileStore) PruneTimeline(before time.Time) (int64, error) {
+	var n int64
+	err := fs.remove(func(ev models.TimelineEvent) bool {
+		if endOf(ev).Before(before) {
+			n++
+			return true
+		}
+		return false
+	})
+	return n, err
+}
+
+func (fs *FileStore) remove(drop func(models.TimelineEvent) bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	list, err := fs.load()
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(slices.Clone(list), drop)
+	if len(kept) == len(list) {
+		return nil
+	}
+	return fs.save(kept)
+}
@@ -0,0 +1,121 @@
+package timeline
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"web-tr/internal/models"
+)
+
+var day = time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func addEvents(t *testing.T, fs *FileStore, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		ev := models.TimelineEvent{Stream: "yard", Type: models.TimelineMotion, Time: day.Add(time.Duration(i) * time.Minute)}
+		if _, err := fs.AddTimelineEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileStoreAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeline.json")
+	fs := NewFileStore(path)
+	addEvents(t, fs, 3)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 3 {
+		t.Errorf("file has %d lines, want one per event", n)
+	}
+
+	// A second store reads what the first wrote, and carries on numbering
+	again := NewFileStore(path)
+	id, err := again.AddTimelineEvent(models.TimelineEvent{Stream: "door", Type: models.TimelineGap, Time: day})
+	if err != nil || id != 4 {
+		t.Fatalf("id = %d, %v; want 4", id, err)
+	}
+	list, err := again.GetTimelineEvents(models.TimelineQuery{})
+	if err != nil || len(list) != 4 {
+		t.Fatalf("got %d events, %v", len(list), err)
+	}
+}
+
+func TestFileStoreReadsOlderFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeline.json")
+	legacy := `[{"id":7,"stream":"yard","type":"gap","time":"2026-05-01T00:00:00Z"}]`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFileStore(path)
+	if id, err := fs.AddTimelineEvent(models.TimelineEvent{Stream: "yard", Type: models.TimelineMotion, Time: day}); err != nil || id != 8 {
+		t.Fatalf("id = %d, %v; want 8", id, err)
+	}
+	list, err := NewFileStore(path).GetTimelineEvents(models.TimelineQuery{Stream: "yard"})
+	if err != nil || len(list) != 2 || list[0].ID != 7 {
+		t.Fatalf("events after converting = %+v, %v", list, err)
+	}
+}
+
+func TestFileStoreIgnoresTruncatedLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeline.json")
+	fs := NewFileStore(path)
+	addEvents(t, fs, 2)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":3,"stream":"ya`)
+	f.Close()
+
+	list, err := NewFileStore(path).GetTimelineEvents(models.TimelineQuery{})
+	if err != nil || len(list) != 2 {
+		t.Errorf("got %d events, %v; want the 2 complete ones", len(list), err)
+	}
+}
+
+func TestFileStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeline.json")
+	fs := NewFileStore(path)
+	addEvents(t, fs, fileLimit+compactSlack+1)
+
+	list, err := NewFileStore(path).GetTimelineEvents(models.TimelineQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != fileLimit || list[len(list)-1].ID != fileLimit+compactSlack+1 {
+		t.Errorf("kept %d events ending at %d, want the newest %d", len(list), list[len(list)-1].ID, fileLimit)
+	}
+}
+
+func TestFileStoreRenameAndPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeline.json")
+	fs := NewFileStore(path)
+	addEvents(t, fs, 3)
+
+	if err := fs.RenameTimelineStream("yard", "garden"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := fs.PruneTimeline(day.Add(90 * time.Second))
+	if err != nil || n != 2 {
+		t.Fatalf("pruned %d, %v; want 2", n, err)
+	}
+	if err := fs.RemoveTimelineEvent(3); err != nil {
+		t.Fatal(err)
+	}
+	addEvents(t, fs, 1)
+
+	list, err := NewFileStore(path).GetTimelineEvents(models.TimelineQuery{})
+	if err != nil || len(list) != 1 || list[0].Stream != "yard" {
+		t.Fatalf("events = %+v, %v", list, err)
+	}
+	if list, _ := fs.GetTimelineEvents(models.TimelineQuery{Stream: "garden"}); len(list) != 0 {
+		t.Errorf("garden still has %d events", len(list))
+	}
+}
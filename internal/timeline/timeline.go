@@ -0,0 +1,260 @@
+// Package timeline keeps what happened on each stream for the playback
+// timeline: motion, the stream going offline and online, gaps in its
+// recording, changes to its settings and bookmarks set by users. All but the
+// bookmarks are taken from the event hub.
+package timeline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+)
+
+var (
+	ErrNotFound     = errors.New("bookmark not found")
+	ErrInvalidQuery = errors.New("invalid timeline query")
+	ErrInvalidEvent = errors.New("invalid bookmark")
+)
+
+// MaxMessage is the longest bookmark text
+const MaxMessage = 500
+
+// Store is implemented by db.Store in DB mode and FileStore otherwise
+type Store interface {
+	// GetTimelineEvents returns the events matching q by time, oldest first
+	GetTimelineEvents(q models.TimelineQuery) ([]models.TimelineEvent, error)
+	// GetTimelineEvent returns nil if the event does not exist
+	GetTimelineEvent(id int64) (*models.TimelineEvent, error)
+	AddTimelineEvent(ev models.TimelineEvent) (int64, error)
+	RemoveTimelineEvent(id int64) error
+	RenameTimelineStream(oldName, newName string) error
+	// PruneTimeline deletes the events that ended before t
+	PruneTimeline(before time.Time) (int64, error)
+}
+
+// Service records hub events on the timeline and serves queries
+type Service struct {
+	Store Store
+	// Retention is how long events are kept
+	Retention time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewService(store Store) *Service {
+	return &Service{
+		Store:     store,
+		Retention: 90 * 24 * time.Hour,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start records the events published on hub until Stop is called, and
+// prunes old events daily
+func (s *Service) Start(hub *events.Hub) {
+	ch := hub.Queue()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		s.prune()
+		prune := time.NewTicker(24 * time.Hour)
+		defer prune.Stop()
+		for {
+			select {
+			case <-s.stop:
+				// Keep what was published before Stop, such as motion ended by a shutdown
+				for _, ev := range hub.Drain(ch) {
+					s.handle(ev)
+				}
+				return
+			case ev := <-ch:
+				s.handle(ev)
+			case <-prune.C:
+				s.prune()
+			}
+		}
+	}()
+}
+
+func (s *Service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Query returns the events matching q, oldest first
+func (s *Service) Query(q models.TimelineQuery) ([]models.TimelineEvent, error) {
+	for _, t := range q.Types {
+		if !slices.Contains(models.TimelineTypes, t) {
+			return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidQuery, t)
+		}
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return nil, fmt.Errorf("%w: the range ends before it starts", ErrInvalidQuery)
+	}
+	return s.Store.GetTimelineEvents(q)
+}
+
+// AddBookmark marks a moment, or a period when b.End is set, of a stream
+func (s *Service) AddBookmark(b models.TimelineEvent) (*models.TimelineEvent, error) {
+	b.Type = models.TimelineBookmark
+	b.Message = strings.TrimSpace(b.Message)
+	b.Data = nil
+	switch {
+	case b.Time.IsZero():
+		return nil, fmt.Errorf("%w: time required", ErrInvalidEvent)
+	case !b.End.IsZero() && b.End.Before(b.Time):
+		return nil, fmt.Errorf("%w: end before time", ErrInvalidEvent)
+	case len(b.Message) > MaxMessage:
+		return nil, fmt.Errorf("%w: message longer than %d characters", ErrInvalidEvent, MaxMessage)
+	}
+	b.Time = b.Time.UTC()
+	if !b.End.IsZero() {
+		b.End = b.End.UTC()
+	}
+
+	id, err := s.Store.AddTimelineEvent(b)
+	if err != nil {
+		return nil, err
+	}
+	b.ID = id
+	return &b, nil
+}
+
+// Bookmark returns a bookmark, or ErrNotFound for other events
+func (s *Service) Bookmark(id int64) (*models.TimelineEvent, error) {
+	ev, err := s.Store.GetTimelineEvent(id)
+	if err != nil {
+		return nil, err
+	}
+	if ev == nil || ev.Type != models.TimelineBookmark {
+		return nil, ErrNotFound
+	}
+	return ev, nil
+}
+
+// RemoveBookmark deletes a bookmark. Recorded events cannot be removed.
+func (s *Service) RemoveBookmark(id int64) error {
+	if _, err := s.Bookmark(id); err != nil {
+		return err
+	}
+	return s.Store.RemoveTimelineEvent(id)
+}
+
+// handle records the hub events that belong on the timeline
+func (s *Service) handle(ev events.Event) {
+	if ev.Type == events.StreamsChanged {
+		for _, ev := range events.Expand(ev) {
+			s.handle(ev)
+		}
+		return
+	}
+
+	switch d := ev.Data.(type) {
+	case models.HealthChange:
+		switch d.Status {
+		case models.HealthOffline:
+			s.record(models.TimelineEvent{Stream: d.Stream, Type: models.TimelineOffline, Time: d.Time, Message: d.Error})
+		case models.HealthOnline:
+			s.record(models.TimelineEvent{Stream: d.Stream, Type: models.TimelineOnline, Time: d.Time})
+		}
+
+	case models.MotionEvent:
+		if ev.Type != events.MotionEnded {
+			return
+		}
+		data := map[string]string{
+			"id":    d.ID,
+			"score": strconv.FormatFloat(d.Score, 'f', 3, 64),
+		}
+		if d.Snapshot != "" {
+			data["snapshot"] = d.Snapshot
+		}
+		s.record(models.TimelineEvent{
+			Stream:  d.Stream,
+			Type:    models.TimelineMotion,
+			Time:    d.Start,
+			End:     d.End,
+			Message: strings.Join(d.Zones, ", "),
+			Data:    data,
+		})
+
+	case models.RecordingGap:
+		s.record(models.TimelineEvent{Stream: d.Stream, Type: models.TimelineGap, Time: d.From, End: d.To, Message: d.Error})
+
+	case map[string]interface{}:
+		name, _ := d["name"].(string)
+		if name == "" {
+			return
+		}
+		switch ev.Type {
+		case events.StreamAdded:
+			s.record(models.TimelineEvent{Stream: name, Type: models.TimelineConfig, Time: ev.Time, Message: "Stream added"})
+		case events.StreamUpdated:
+			msg := "Settings changed"
+			if oldName, _ := d["originalName"].(string); oldName != "" && oldName != name {
+				if err := s.Store.RenameTimelineStream(oldName, name); err != nil {
+					log.Printf("[Timeline] Failed to move the events of %s to %s: %v", oldName, name, err)
+				}
+				msg = "Renamed from " + oldName
+			}
+			s.record(models.TimelineEvent{Stream: name, Type: models.TimelineConfig, Time: ev.Time, Message: msg})
+		case events.StreamDeleted:
+			s.record(models.TimelineEvent{Stream: name, Type: models.TimelineConfig, Time: ev.Time, Message: "Stream deleted"})
+		}
+	}
+}
+
+func (s *Service) record(ev models.TimelineEvent) {
+	ev.Time = ev.Time.UTC()
+	if !ev.End.IsZero() {
+		ev.End = ev.End.UTC()
+	}
+	if _, err := s.Store.AddTimelineEvent(ev); err != nil {
+		log.Printf("[Timeline] Failed to record %s event of %s: %v", ev.Type, ev.Stream, err)
+	}
+}
+
+func (s *Service) prune() {
+	if s.Retention <= 0 {
+		return
+	}
+	n, err := s.Store.PruneTimeline(time.Now().Add(-s.Retention))
+	if err != nil {
+		log.Printf("[Timeline] Failed to prune old events: %v", err)
+	} else if n > 0 {
+		log.Printf("[Timeline] Pruned %d events older than %s", n, s.Retention)
+	}
+}
+
+// endOf is when an event ends, or happens when it has no end
+func endOf(ev models.TimelineEvent) time.Time {
+	if ev.End.IsZero() {
+		return ev.Time
+	}
+	return ev.End
+}
+
+// matches reports whether an event is selected by q
+func matches(ev models.TimelineEvent, q models.TimelineQuery) bool {
+	switch {
+	case q.Stream != "" && ev.Stream != q.Stream:
+		return false
+	case !q.From.IsZero() && endOf(ev).Before(q.From):
+		return false
+	case !q.To.IsZero() && ev.Time.After(q.To):
+		return false
+	case len(q.Types) > 0 && !slices.Contains(q.Types, ev.Type):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package timeline
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	return NewService(NewFileStore(filepath.Join(t.TempDir(), "timeline.json")))
+}
+
+func TestHandle(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		ev       events.Event
+		wantType string
+		wantMsg  string
+	}{
+		{"offline", events.Event{Type: events.HealthChanged, Data: models.HealthChange{Stream: "yard", Status: models.HealthOffline, Time: at, Error: "timeout"}}, models.TimelineOffline, "timeout"},
+		{"online", events.Event{Type: events.HealthChanged, Data: models.HealthChange{Stream: "yard", Status: models.HealthOnline, Time: at}}, models.TimelineOnline, ""},
+		{"unknown health", events.Event{Type: events.HealthChanged, Data: models.HealthChange{Stream: "yard", Status: models.HealthUnknown, Time: at}}, "", ""},
+		{"motion start", events.Event{Type: events.MotionStarted, Data: models.MotionEvent{Stream: "yard", Start: at}}, "", ""},
+		{"motion end", events.Event{Type: events.MotionEnded, Data: models.MotionEvent{ID: "m1", Stream: "yard", Start: at, End: at.Add(time.Minute), Zones: []string{"gate", "path"}, Score: 0.25}}, models.TimelineMotion, "gate, path"},
+		{"gap", events.Event{Type: events.RecordingGap, Data: models.RecordingGap{Stream: "yard", From: at, To: at.Add(time.Minute), Error: "exited"}}, models.TimelineGap, "exited"},
+		{"added", events.Event{Type: events.StreamAdded, Time: at, Data: map[string]interface{}{"name": "yard"}}, models.TimelineConfig, "Stream added"},
+		{"updated", events.Event{Type: events.StreamUpdated, Time: at, Data: map[string]interface{}{"name": "yard"}}, models.TimelineConfig, "Settings changed"},
+		{"deleted", events.Event{Type: events.StreamDeleted, Time: at, Data: map[string]interface{}{"name": "yard"}}, models.TimelineConfig, "Stream deleted"},
+		{"batch", events.Event{Type: events.StreamsChanged, Time: at, Data: events.Batch{Changes: []events.Change{
+			{Type: events.StreamAdded, Data: map[string]interface{}{"name": "yard"}},
+		}}}, models.TimelineConfig, "Stream added"},
+		{"import", events.Event{Type: events.ImportDone, Data: map[string]interface{}{"created": 1}}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			s.handle(tt.ev)
+			list, err := s.Store.GetTimelineEvents(models.TimelineQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantType == "" {
+				if len(list) != 0 {
+					t.Errorf("recorded %+v, want nothing", list)
+				}
+				return
+			}
+			if len(list) != 1 || list[0].Type != tt.wantType || list[0].Message != tt.wantMsg || list[0].Stream != "yard" || !list[0].Time.Equal(at) {
+				t.Errorf("recorded %+v, want one %s event %q", list, tt.wantType, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestHandleRenameMovesEvents(t *testing.T) {
+	s := newTestService(t)
+	s.handle(events.Event{Type: events.StreamAdded, Time: day, Data: map[string]interface{}{"name": "door"}})
+	s.handle(events.Event{Type: events.StreamUpdated, Time: day, Data: map[string]interface{}{"name": "gate", "originalName": "door"}})
+
+	list, err := s.Query(models.TimelineQuery{Stream: "gate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[1].Message != "Renamed from door" {
+		t.Errorf("gate events = %+v", list)
+	}
+}
+
+func TestQueryValidation(t *testing.T) {
+	s := newTestService(t)
+	tests := []struct {
+		name string
+		q    models.TimelineQuery
+		ok   bool
+	}{
+		{"everything", models.TimelineQuery{}, true},
+		{"known types", models.TimelineQuery{Types: []string{models.TimelineMotion, models.TimelineBookmark}}, true},
+		{"unknown type", models.TimelineQuery{Types: []string{"sunrise"}}, false},
+		{"reversed range", models.TimelineQuery{From: day.Add(time.Hour), To: day}, false},
+	}
+	for _, tt := range tests {
+		_, err := s.Query(tt.q)
+		if (err == nil) != tt.ok || err != nil && !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	s := newTestService(t)
+	tests := []struct {
+		name string
+		b    models.TimelineEvent
+		ok   bool
+	}{
+		{"moment", models.TimelineEvent{Stream: "yard", Time: day, Message: "  fox  "}, true},
+		{"period", models.TimelineEvent{Stream: "yard", Time: day, End: day.Add(time.Minute)}, true},
+		{"no time", models.TimelineEvent{Stream: "yard"}, false},
+		{"ends before it starts", models.TimelineEvent{Stream: "yard", Time: day, End: day.Add(-time.Minute)}, false},
+		{"long message", models.TimelineEvent{Stream: "yard", Time: day, Message: string(make([]byte, MaxMessage+1))}, false},
+	}
+	for _, tt := range tests {
+		b, err := s.AddBookmark(tt.b)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidEvent) {
+			t.Errorf("%s: %v is not ErrInvalidEvent", tt.name, err)
+		}
+		if tt.name == "moment" && (b.Type != models.TimelineBookmark || b.Message != "fox") {
+			t.Errorf("bookmark = %+v", b)
+		}
+	}
+
+	// Only bookmarks can be removed
+	s.handle(events.Event{Type: events.StreamAdded, Time: day, Data: map[string]interface{}{"name": "yard"}})
+	list, _ := s.Query(models.TimelineQuery{Types: []string{models.TimelineConfig}})
+	if err := s.RemoveBookmark(list[0].ID); err != ErrNotFound {
+		t.Errorf("removing a recorded event: %v", err)
+	}
+	if err := s.RemoveBookmark(1); err != nil {
+		t.Errorf("removing a bookmark: %v", err)
+	}
+	if _, err := s.Bookmark(1); err != ErrNotFound {
+		t.Errorf("removed bookmark: %v", err)
+	}
+}
+
+func TestStopRecordsWhatWasPublished(t *testing.T) {
+	s := newTestService(t)
+	s.Retention = 0
+	hub := events.NewHub()
+	s.Start(hub)
+
+	const n = 300
+	for i := 0; i < n; i++ {
+		hub.Publish(events.RecordingGap, models.RecordingGap{Stream: "yard", From: day, To: day.Add(time.Minute)})
+	}
+	s.Stop()
+
+	list, err := s.Query(models.TimelineQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != n {
+		t.Errorf("recorded %d events, want %d", len(list), n)
+	}
+}
@@ -0,0 +1,115 @@
+package transcode
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// FileStore keeps profiles in a local JSON file for File/YAML mode
+type FileStore struct {
+	FilePath string
+	mu       sync.Mutex
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() ([]models.TranscodeProfile, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []models.TranscodeProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (fs *FileStore) save(profiles []models.TranscodeProfile) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetProfiles() ([]models.TranscodeProfile, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	profiles, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+func (fs *FileStore) GetProfile(id string) (*models.TranscodeProfile, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	profiles, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *FileStore) AddProfile(p models.TranscodeProfile) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	profiles, err := fs.load()
+	if err != nil {
+		return err
+	}
+	return fs.save(append(profiles, p))
+}
+
+func (fs *FileStore) UpdateProfile(p models.TranscodeProfile) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	profiles, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for i := range profiles {
+		if profiles[i].ID == p.ID {
+			profiles[i] = p
+		}
+	}
+	return fs.save(profiles)
+}
+
+func (fs *FileStore) RemoveProfile(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	profiles, err := fs.load()
+	if err != nil {
+		return err
+	}
+	kept := profiles[:0]
+	for _, p := range profiles {
+		if p.ID != id {
+			kept = append(kept, p)
+		}
+	}
+	return fs.save(kept)
+}
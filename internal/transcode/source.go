@@ -0,0 +1,160 @@
+package transcode
+
+import (
+	"strconv"
+	"strings"
+	"web-tr/internal/models"
+)
+
+// go2rtcPrefix marks a go2rtc source that is pulled through ffmpeg
+const go2rtcPrefix = "ffmpeg:"
+
+// Go2RTCSource wraps a camera URL in a go2rtc ffmpeg source applying p, e.g.
+// "ffmpeg:rtsp://cam/main#video=h264#width=1280#raw=-r 15#audio=copy#hardware".
+func Go2RTCSource(input string, p *models.TranscodeProfile) string {
+	var b strings.Builder
+	b.WriteString(go2rtcPrefix + input)
+	b.WriteString("#video=" + p.VideoCodec)
+	if p.Width > 0 {
+		b.WriteString("#width=" + strconv.Itoa(p.Width))
+	}
+	if p.Height > 0 {
+		b.WriteString("#height=" + strconv.Itoa(p.Height))
+	}
+	// go2rtc has no options of its own for these, raw arguments go to the encoder
+	if p.FPS > 0 {
+		b.WriteString("#raw=-r " + strconv.Itoa(p.FPS))
+	}
+	if p.Bitrate > 0 {
+		b.WriteString("#raw=-b:v " + strconv.Itoa(p.Bitrate) + "k")
+	}
+	// Without an audio option go2rtc drops the audio
+	if p.AudioCodec != models.CodecNone {
+		b.WriteString("#audio=" + p.AudioCodec)
+	}
+	switch p.HWAccel {
+	case "":
+	case "auto":
+		b.WriteString("#hardware")
+	default:
+		b.WriteString("#hardware=" + p.HWAccel)
+	}
+	return b.String()
+}
+
+// Go2RTCInput returns the camera URL of a source built by Go2RTCSource. Other
+// sources are returned unchanged.
+func Go2RTCInput(source string) string {
+	rest, ok := strings.CutPrefix(source, go2rtcPrefix)
+	if !ok {
+		return source
+	}
+	input, _, _ := strings.Cut(rest, "#")
+	return input
+}
+
+// IsTranscodeSource reports whether a stream URL already is an ffmpeg source,
+// which can't be combined with a profile
+func IsTranscodeSource(url string) bool {
+	return strings.HasPrefix(url, go2rtcPrefix)
+}
+
+// Encoders by hardware acceleration and codec. Codecs missing for a method are
+// encoded on the CPU.
+var encoders = map[string]map[string]string{
+	"":             {models.CodecH264: "libx264", models.CodecH265: "libx265", models.CodecMJPEG: "mjpeg"},
+	"vaapi":        {models.CodecH264: "h264_vaapi", models.CodecH265: "hevc_vaapi", models.CodecMJPEG: "mjpeg_vaapi"},
+	"cuda":         {models.CodecH264: "h264_nvenc", models.CodecH265: "hevc_nvenc"},
+	"v4l2m2m":      {models.CodecH264: "h264_v4l2m2m", models.CodecH265: "hevc_v4l2m2m"},
+	"videotoolbox": {models.CodecH264: "h264_videotoolbox", models.CodecH265: "hevc_videotoolbox"},
+}
+
+// Methods that decode in hardware with plain -hwaccel; VAAPI and V4L2 only encode
+var hwDecoders = map[string]bool{"auto": true, "cuda": true, "videotoolbox": true, "dxva2": true}
+
+var audioEncoders = map[string][]string{
+	models.CodecCopy: {"-c:a", "copy"},
+	models.CodecAAC:  {"-c:a", "aac"},
+	models.CodecOpus: {"-c:a", "libopus"},
+	models.CodecPCMU: {"-c:a", "pcm_mulaw", "-ar", "8000", "-ac", "1"},
+	models.CodecNone: {"-an"},
+}
+
+// FFmpegArgs returns the ffmpeg arguments that read input, apply p and
+// publish the result to the RTSP URL output
+func FFmpegArgs(input, output string, p *models.TranscodeProfile) []string {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if strings.HasPrefix(input, "rtsp") {
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+
+	encoder, hw := encoders[p.HWAccel][p.VideoCodec], true
+	if encoder == "" {
+		encoder, hw = encoders[""][p.VideoCodec], false
+	}
+	vaapi := hw && p.HWAccel == "vaapi"
+	if vaapi {
+		args = append(args, "-vaapi_device", "/dev/dri/renderD128")
+	}
+	if hwDecoders[p.HWAccel] {
+		args = append(args, "-hwaccel", p.HWAccel)
+	}
+	args = append(args, "-i", input)
+
+	if p.VideoCodec == models.CodecCopy {
+		args = append(args, "-c:v", "copy")
+	} else {
+		var filters []string
+		if p.Width > 0 || p.Height > 0 {
+			// -2 keeps the aspect ratio at an even size
+			w, h := p.Width, p.Height
+			if w == 0 {
+				w = -2
+			}
+			if h == 0 {
+				h = -2
+			}
+			filters = append(filters, "scale="+strconv.Itoa(w)+":"+strconv.Itoa(h))
+		}
+		if vaapi {
+			filters = append(filters, "format=nv12", "hwupload")
+		} else if encoder != "mjpeg" {
+			filters = append(filters, "format=yuv420p")
+		}
+		if len(filters) > 0 {
+			args = append(args, "-vf", strings.Join(filters, ","))
+		}
+
+		args = append(args, "-c:v", encoder)
+		if encoder == "libx264" || encoder == "libx265" {
+			args = append(args, "-preset", "veryfast", "-tune", "zerolatency")
+		}
+		if p.FPS > 0 {
+			args = append(args, "-r", strconv.Itoa(p.FPS))
+		}
+		if p.Bitrate > 0 {
+			rate := strconv.Itoa(p.Bitrate) + "k"
+			args = append(args, "-b:v", rate, "-maxrate", rate, "-bufsize", strconv.Itoa(2*p.Bitrate)+"k")
+		}
+	}
+
+	args = append(args, audioEncoders[p.AudioCodec]...)
+	return append(args, "-f", "rtsp", "-rtsp_transport", "tcp", output)
+}
+
+// Command joins a binary and its arguments into a command line, quoting them
+// the way a POSIX shell would
+func Command(binary string, args []string) string {
+	parts := make([]string, 0, len(args)+1)
+	for _, a := range append([]string{binary}, args...) {
+		parts = append(parts, quote(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=.,:/@%$") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,89 @@
+package transcode
+
+import (
+	"strings"
+	"testing"
+	"web-tr/internal/models"
+)
+
+func TestGo2RTCSource(t *testing.T) {
+	tests := []struct {
+		name string
+		p    models.TranscodeProfile
+		want string
+	}{
+		{
+			"everything",
+			models.TranscodeProfile{VideoCodec: "h264", Width: 1280, Height: 720, FPS: 15, Bitrate: 1500, AudioCodec: "aac", HWAccel: "auto"},
+			"ffmpeg:rtsp://cam/main#video=h264#width=1280#height=720#raw=-r 15#raw=-b:v 1500k#audio=aac#hardware",
+		},
+		{
+			"no audio",
+			models.TranscodeProfile{VideoCodec: "h265", AudioCodec: "none", HWAccel: "vaapi"},
+			"ffmpeg:rtsp://cam/main#video=h265#hardware=vaapi",
+		},
+	}
+	for _, tt := range tests {
+		got := Go2RTCSource("rtsp://cam/main", &tt.p)
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+		if in := Go2RTCInput(got); in != "rtsp://cam/main" {
+			t.Errorf("%s: input = %s", tt.name, in)
+		}
+	}
+	if in := Go2RTCInput("rtsp://cam/main"); in != "rtsp://cam/main" {
+		t.Errorf("plain source changed to %s", in)
+	}
+	if !IsTranscodeSource("ffmpeg:rtsp://cam") || IsTranscodeSource("rtsp://cam") {
+		t.Error("IsTranscodeSource")
+	}
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	const in, out = "rtsp://cam/main", "rtsp://127.0.0.1:8554/cam"
+	tests := []struct {
+		name string
+		p    models.TranscodeProfile
+		want string
+	}{
+		{
+			"software h264",
+			models.TranscodeProfile{VideoCodec: "h264", Width: 1280, FPS: 10, Bitrate: 1000, AudioCodec: "copy"},
+			"-hide_banner -loglevel error -rtsp_transport tcp -i " + in +
+				" -vf scale=1280:-2,format=yuv420p -c:v libx264 -preset veryfast -tune zerolatency -r 10" +
+				" -b:v 1000k -maxrate 1000k -bufsize 2000k -c:a copy -f rtsp -rtsp_transport tcp " + out,
+		},
+		{
+			"vaapi",
+			models.TranscodeProfile{VideoCodec: "h265", HWAccel: "vaapi", AudioCodec: "none"},
+			"-hide_banner -loglevel error -rtsp_transport tcp -vaapi_device /dev/dri/renderD128 -i " + in +
+				" -vf format=nv12,hwupload -c:v hevc_vaapi -an -f rtsp -rtsp_transport tcp " + out,
+		},
+		{
+			"cuda without an mjpeg encoder falls back to the cpu",
+			models.TranscodeProfile{VideoCodec: "mjpeg", HWAccel: "cuda", AudioCodec: "pcmu"},
+			"-hide_banner -loglevel error -rtsp_transport tcp -hwaccel cuda -i " + in +
+				" -c:v mjpeg -c:a pcm_mulaw -ar 8000 -ac 1 -f rtsp -rtsp_transport tcp " + out,
+		},
+		{
+			"audio only",
+			models.TranscodeProfile{VideoCodec: "copy", AudioCodec: "opus"},
+			"-hide_banner -loglevel error -rtsp_transport tcp -i " + in +
+				" -c:v copy -c:a libopus -f rtsp -rtsp_transport tcp " + out,
+		},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(FFmpegArgs(in, out, &tt.p), " "); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	got := Command("ffmpeg", []string{"-i", "rtsp://u:p@cam/main", "-vf", "scale=1:2,format=yuv420p", "it's", ""})
+	want := `ffmpeg -i rtsp://u:p@cam/main -vf scale=1:2,format=yuv420p 'it'\''s' ''`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
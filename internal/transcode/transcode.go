@@ -0,0 +1,194 @@
+// Package transcode manages the named transcoding profiles streams refer to
+// and turns them into engine sources.
+package transcode
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"web-tr/internal/models"
+)
+
+var (
+	ErrNotFound = errors.New("transcoding profile not found")
+	ErrInUse    = errors.New("transcoding profile is used by streams")
+)
+
+// Limits of a profile
+const (
+	MaxSide    = 7680
+	MaxFPS     = 120
+	MaxBitrate = 100000
+)
+
+// HWAccels are the hardware acceleration methods a profile can ask for; "auto"
+// lets ffmpeg pick one
+var HWAccels = []string{"auto", "vaapi", "cuda", "v4l2m2m", "videotoolbox", "dxva2"}
+
+var (
+	videoCodecs = []string{models.CodecCopy, models.CodecH264, models.CodecH265, models.CodecMJPEG}
+	audioCodecs = []string{models.CodecCopy, models.CodecAAC, models.CodecOpus, models.CodecPCMU, models.CodecNone}
+)
+
+// Store is implemented by db.Store in DB mode and FileStore otherwise
+type Store interface {
+	GetProfiles() ([]models.TranscodeProfile, error)
+	GetProfile(id string) (*models.TranscodeProfile, error)
+	AddProfile(p models.TranscodeProfile) error
+	UpdateProfile(p models.TranscodeProfile) error
+	RemoveProfile(id string) error
+}
+
+// Service validates profiles and keeps them in the store
+type Service struct {
+	Store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{Store: store}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func validate(p *models.TranscodeProfile) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if p.VideoCodec == "" {
+		p.VideoCodec = models.CodecH264
+	}
+	if !contains(videoCodecs, p.VideoCodec) {
+		return fmt.Errorf("unknown video codec '%s', use one of %s", p.VideoCodec, strings.Join(videoCodecs, ", "))
+	}
+	if p.AudioCodec == "" {
+		p.AudioCodec = models.CodecCopy
+	}
+	if !contains(audioCodecs, p.AudioCodec) {
+		return fmt.Errorf("unknown audio codec '%s', use one of %s", p.AudioCodec, strings.Join(audioCodecs, ", "))
+	}
+	if p.HWAccel != "" && !contains(HWAccels, p.HWAccel) {
+		return fmt.Errorf("unknown hardware acceleration '%s', use one of %s", p.HWAccel, strings.Join(HWAccels, ", "))
+	}
+
+	if p.Width < 0 || p.Width > MaxSide || p.Height < 0 || p.Height > MaxSide {
+		return fmt.Errorf("width and height must be between 0 and %d", MaxSide)
+	}
+	// H.264 and H.265 encoders only take even frame sizes
+	if p.Width%2 != 0 || p.Height%2 != 0 {
+		return fmt.Errorf("width and height must be even")
+	}
+	if p.FPS < 0 || p.FPS > MaxFPS {
+		return fmt.Errorf("fps must be between 0 and %d", MaxFPS)
+	}
+	if p.Bitrate < 0 || p.Bitrate > MaxBitrate {
+		return fmt.Errorf("bitrate must be between 0 and %d kbit/s", MaxBitrate)
+	}
+
+	if p.VideoCodec == models.CodecCopy && (p.Width != 0 || p.Height != 0 || p.FPS != 0 || p.Bitrate != 0 || p.HWAccel != "") {
+		return fmt.Errorf("size, fps, bitrate and hardware acceleration need a video codec other than copy")
+	}
+	if p.VideoCodec == models.CodecCopy && p.AudioCodec == models.CodecCopy {
+		return fmt.Errorf("a profile copying both video and audio does nothing, leave the stream without a profile")
+	}
+	return nil
+}
+
+// List returns all profiles sorted by name
+func (s *Service) List() ([]models.TranscodeProfile, error) {
+	profiles, err := s.Store.GetProfiles()
+	if err != nil {
+		return nil, err
+	}
+	if profiles == nil {
+		profiles = []models.TranscodeProfile{}
+	}
+	return profiles, nil
+}
+
+func (s *Service) Get(id string) (*models.TranscodeProfile, error) {
+	p, err := s.Store.GetProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrNotFound
+	}
+	return p, nil
+}
+
+// All returns the profiles by ID
+func (s *Service) All() (map[string]models.TranscodeProfile, error) {
+	profiles, err := s.Store.GetProfiles()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.TranscodeProfile, len(profiles))
+	for _, p := range profiles {
+		byID[p.ID] = p
+	}
+	return byID, nil
+}
+
+func (s *Service) Create(p models.TranscodeProfile) (*models.TranscodeProfile, error) {
+	if err := validate(&p); err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	p.ID = id
+	p.CreatedAt = time.Now().UTC()
+	p.UpdatedAt = p.CreatedAt
+	if err := s.Store.AddProfile(p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Update replaces the settings of profile id; the ID itself never changes
+func (s *Service) Update(id string, p models.TranscodeProfile) (*models.TranscodeProfile, error) {
+	old, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(&p); err != nil {
+		return nil, err
+	}
+
+	p.ID, p.CreatedAt = old.ID, old.CreatedAt
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.Store.UpdateProfile(p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Remove deletes a profile. Callers check first that no stream uses it.
+func (s *Service) Remove(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.Store.RemoveProfile(id)
+}
@@ -0,0 +1,77 @@
+package transcode
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"web-tr/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       models.TranscodeProfile
+		wantErr string
+	}{
+		{"defaults", models.TranscodeProfile{Name: " Low "}, ""},
+		{"full", models.TranscodeProfile{Name: "hd", VideoCodec: "h265", AudioCodec: "opus", Width: 1280, Height: 720, FPS: 15, Bitrate: 2000, HWAccel: "vaapi"}, ""},
+		{"audio only", models.TranscodeProfile{Name: "aac", VideoCodec: "copy", AudioCodec: "aac"}, ""},
+		{"no name", models.TranscodeProfile{Name: "  "}, "name is required"},
+		{"video codec", models.TranscodeProfile{Name: "x", VideoCodec: "vp9"}, "unknown video codec"},
+		{"audio codec", models.TranscodeProfile{Name: "x", AudioCodec: "mp3"}, "unknown audio codec"},
+		{"hardware", models.TranscodeProfile{Name: "x", HWAccel: "quicksync"}, "unknown hardware"},
+		{"too wide", models.TranscodeProfile{Name: "x", Width: MaxSide + 2}, "between 0 and"},
+		{"odd size", models.TranscodeProfile{Name: "x", Width: 1279}, "even"},
+		{"fps", models.TranscodeProfile{Name: "x", FPS: MaxFPS + 1}, "fps"},
+		{"bitrate", models.TranscodeProfile{Name: "x", Bitrate: -1}, "bitrate"},
+		{"scaling a copy", models.TranscodeProfile{Name: "x", VideoCodec: "copy", AudioCodec: "aac", Width: 640}, "other than copy"},
+		{"copying everything", models.TranscodeProfile{Name: "x", VideoCodec: "copy"}, "does nothing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.p
+			err := validate(&p)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.Name != strings.TrimSpace(tt.p.Name) || p.VideoCodec == "" || p.AudioCodec == "" {
+					t.Errorf("normalised profile = %+v", p)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceKeepsIDAndCreation(t *testing.T) {
+	s := NewService(NewFileStore(filepath.Join(t.TempDir(), "profiles.json")))
+	created, err := s.Create(models.TranscodeProfile{Name: "low", Width: 640})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.Update(created.ID, models.TranscodeProfile{ID: "other", Name: "lower", Width: 320})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != created.ID || !updated.CreatedAt.Equal(created.CreatedAt) || updated.Width != 320 {
+		t.Errorf("updated = %+v", updated)
+	}
+
+	all, err := s.All()
+	if err != nil || len(all) != 1 || all[created.ID].Name != "lower" {
+		t.Errorf("All = %v, %v", all, err)
+	}
+	if err := s.Remove(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(created.ID); err != ErrNotFound {
+		t.Errorf("Get after Remove = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Update("missing", models.TranscodeProfile{Name: "x"}); err != ErrNotFound {
+		t.Errorf("Update of a missing profile = %v, want ErrNotFound", err)
+	}
+}
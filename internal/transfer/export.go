@@ -0,0 +1,74 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"web-tr/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatYAML:
+		return "application/yaml"
+	}
+	return "application/json"
+}
+
+// Export writes streams in the given format. The output of each format can be
+// imported again; YAML only carries what go2rtc.yaml stores, name and URL.
+func Export(w io.Writer, streams []models.Stream, format string) error {
+	switch format {
+	case FormatCSV:
+		return exportCSV(w, streams)
+	case FormatJSON:
+		return exportJSON(w, streams)
+	case FormatYAML:
+		return exportYAML(w, streams)
+	}
+	return fmt.Errorf("unsupported format '%s'", format)
+}
+
+func exportCSV(w io.Writer, streams []models.Stream) error {
+	cw := csv.NewWriter(w)
+	cw.Write(Fields)
+	for _, s := range streams {
+		cw.Write([]string{s.Name, s.URL, s.Backend, strconv.FormatBool(s.Recording), strings.Join(s.Tags, ";"), s.Group, s.ProfileID, strconv.Itoa(s.TimelapseInterval)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportJSON(w io.Writer, streams []models.Stream) error {
+	out := make([]models.Stream, len(streams))
+	for i, s := range streams {
+		s.Health = nil
+		out[i] = s
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"streams": out})
+}
+
+func exportYAML(w io.Writer, streams []models.Stream) error {
+	cfg := struct {
+		Streams map[string]string `yaml:"streams"`
+	}{Streams: make(map[string]string, len(streams))}
+	for _, s := range streams {
+		cfg.Streams[s.Name] = s.URL
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,221 @@
+package transfer
+
+import (
+	"fmt"
+	"strconv"
+	"web-tr/internal/models"
+)
+
+// Conflict policies for rows whose name already exists
+const (
+	PolicySkip      = "skip"
+	PolicyOverwrite = "overwrite"
+	PolicyRename    = "rename"
+)
+
+// Row actions reported back to the client
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionRename = "rename"
+	ActionSkip   = "skip"
+	ActionError  = "error"
+)
+
+// Import phases passed to Options.Progress
+const (
+	PhasePlan  = "plan"
+	PhaseWrite = "write"
+)
+
+// Target is where imported streams are written, normally the stream manager
+type Target interface {
+	GetStreams() ([]models.Stream, error)
+	ApplyBulk(ops []models.BulkOp, dryRun bool, by string) ([]models.BulkResult, error)
+}
+
+type Options struct {
+	Policy string
+	// DryRun plans every row and validates it without writing anything
+	DryRun bool
+	// Allowed limits the streams the importing user may create or overwrite; nil allows all
+	Allowed func(models.Stream) bool
+	// By is the importing user, recorded on the stream events
+	By string
+	// Progress, if set, is called as each row is planned and before the rows are written
+	Progress func(phase string, row, total int)
+}
+
+type RowResult struct {
+	Line    int    `json:"line"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+	NewName string `json:"new_name,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Report struct {
+	DryRun  bool        `json:"dry_run"`
+	Policy  string      `json:"policy"`
+	Total   int         `json:"total"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Renamed int         `json:"renamed"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Warning string      `json:"warning,omitempty"`
+	Rows    []RowResult `json:"rows"`
+}
+
+// ValidPolicy reports whether p is a known conflict policy; empty means skip
+func ValidPolicy(p string) bool {
+	switch p {
+	case "", PolicySkip, PolicyOverwrite, PolicyRename:
+		return true
+	}
+	return false
+}
+
+// Import writes the parsed rows to the target according to the conflict policy.
+// A name repeated within the file conflicts with its earlier row the same way
+// it would with an existing stream. All rows are written in one bulk operation;
+// rows the target rejects are reported as failed and the rest are applied.
+func Import(t Target, rows []Row, opts Options) (*Report, error) {
+	if opts.Policy == "" {
+		opts.Policy = PolicySkip
+	}
+	if !ValidPolicy(opts.Policy) {
+		return nil, fmt.Errorf("unknown conflict policy '%s'", opts.Policy)
+	}
+
+	existing, err := t.GetStreams()
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool, len(existing)+len(rows))
+	for _, s := range existing {
+		taken[s.Name] = true
+	}
+	if opts.Allowed == nil {
+		opts.Allowed = func(models.Stream) bool { return true }
+	}
+	if opts.Progress == nil {
+		opts.Progress = func(string, int, int) {}
+	}
+	// Streams the user may not touch can't be overwritten
+	protected := map[string]bool{}
+	for _, s := range existing {
+		if !opts.Allowed(s) {
+			protected[s.Name] = true
+		}
+	}
+
+	report := &Report{DryRun: opts.DryRun, Policy: opts.Policy, Total: len(rows), Rows: make([]RowResult, len(rows))}
+	var ops []models.BulkOp
+	var opRows []int // index into report.Rows of each op
+	for i, row := range rows {
+		opts.Progress(PhasePlan, i, len(rows))
+		res, op := planRow(row, opts, taken, protected)
+		report.Rows[i] = res
+		if op != nil {
+			ops = append(ops, *op)
+			opRows = append(opRows, i)
+		}
+	}
+
+	// One retry without the rejected rows; the others were valid on their own
+	for attempt := 0; attempt < 2 && len(ops) > 0; attempt++ {
+		opts.Progress(PhaseWrite, 0, len(ops))
+		results, err := t.ApplyBulk(ops, opts.DryRun, opts.By)
+		if err == nil {
+			break
+		}
+		if results == nil {
+			return nil, err
+		}
+		// The streams were stored but a running engine could not be updated
+		if results[0].Status == models.BulkApplied {
+			report.Warning = err.Error()
+			break
+		}
+		var keptOps []models.BulkOp
+		var keptRows []int
+		for j, r := range results {
+			if r.Status == models.BulkError || attempt == 1 {
+				row := &report.Rows[opRows[j]]
+				row.Action, row.Error = ActionError, r.Error
+				if row.Error == "" {
+					row.Error = err.Error()
+				}
+				continue
+			}
+			keptOps = append(keptOps, ops[j])
+			keptRows = append(keptRows, opRows[j])
+		}
+		ops, opRows = keptOps, keptRows
+	}
+
+	for _, r := range report.Rows {
+		switch r.Action {
+		case ActionCreate:
+			report.Created++
+		case ActionUpdate:
+			report.Updated++
+		case ActionRename:
+			report.Renamed++
+		case ActionSkip:
+			report.Skipped++
+		case ActionError:
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+// planRow decides what to do with a row and returns the bulk operation for it, if any
+func planRow(row Row, opts Options, taken, protected map[string]bool) (RowResult, *models.BulkOp) {
+	st := row.Stream
+	res := RowResult{Line: row.Line, Name: st.Name}
+	if row.Error != "" {
+		res.Action, res.Error = ActionError, row.Error
+		return res, nil
+	}
+	if !opts.Allowed(st) {
+		res.Action, res.Error = ActionError, fmt.Sprintf("group '%s' is outside your groups", st.Group)
+		return res, nil
+	}
+
+	res.Action = ActionCreate
+	op := &models.BulkOp{Op: models.BulkCreate}
+	if taken[st.Name] {
+		switch opts.Policy {
+		case PolicySkip:
+			res.Action = ActionSkip
+			return res, nil
+		case PolicyOverwrite:
+			if protected[st.Name] {
+				res.Action, res.Error = ActionError, "an existing stream outside your groups has this name"
+				return res, nil
+			}
+			res.Action = ActionUpdate
+			op.Op = models.BulkUpdate
+		case PolicyRename:
+			res.Action = ActionRename
+			st.Name = freeName(st.Name, taken)
+			res.NewName = st.Name
+		}
+	}
+	taken[st.Name] = true
+	op.Stream = st
+	return res, op
+}
+
+// freeName appends -2, -3, ... until the name is unused
+func freeName(name string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		candidate := name + "-" + strconv.Itoa(n)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package transfer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"web-tr/internal/models"
+)
+
+// fakeTarget rejects the whole batch if any stream URL starts with "bad:"
+type fakeTarget struct {
+	existing []models.Stream
+	applied  [][]models.BulkOp
+	by       string
+}
+
+func (f *fakeTarget) GetStreams() ([]models.Stream, error) {
+	return f.existing, nil
+}
+
+func (f *fakeTarget) ApplyBulk(ops []models.BulkOp, dryRun bool, by string) ([]models.BulkResult, error) {
+	f.by = by
+	results := make([]models.BulkResult, len(ops))
+	rejected := false
+	for i, op := range ops {
+		results[i] = models.BulkResult{Index: i, Op: op.Op, Name: op.Stream.Name, Status: models.BulkNotApplied}
+		if strings.HasPrefix(op.Stream.URL, "bad:") {
+			results[i].Status, results[i].Error = models.BulkError, "unreachable"
+			rejected = true
+		}
+	}
+	if rejected {
+		return results, errors.New("rejected")
+	}
+	if !dryRun {
+		f.applied = append(f.applied, ops)
+	}
+	for i := range results {
+		results[i].Status = models.BulkApplied
+	}
+	return results, nil
+}
+
+func rowsOf(streams ...models.Stream) []Row {
+	rows := make([]Row, len(streams))
+	for i, st := range streams {
+		rows[i] = Row{Line: i + 1, Stream: st}
+	}
+	return rows
+}
+
+func TestImportPolicies(t *testing.T) {
+	existing := []models.Stream{{Name: "cam", URL: "rtsp://old"}}
+	rows := rowsOf(
+		models.Stream{Name: "cam", URL: "rtsp://new"},
+		models.Stream{Name: "other", URL: "rtsp://other"},
+		models.Stream{Name: "other", URL: "rtsp://other2"},
+	)
+
+	tests := []struct {
+		policy  string
+		actions []string
+		names   []string // names of the applied streams
+	}{
+		{PolicySkip, []string{ActionSkip, ActionCreate, ActionSkip}, []string{"other"}},
+		{PolicyOverwrite, []string{ActionUpdate, ActionCreate, ActionUpdate}, []string{"cam", "other", "other"}},
+		{PolicyRename, []string{ActionRename, ActionCreate, ActionRename}, []string{"cam-2", "other", "other-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			target := &fakeTarget{existing: existing}
+			report, err := Import(target, rows, Options{Policy: tt.policy, By: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.actions {
+				if got := report.Rows[i].Action; got != want {
+					t.Errorf("row %d action = %s, want %s", i, got, want)
+				}
+			}
+			if len(target.applied) != 1 {
+				t.Fatalf("applied %d batches, want 1", len(target.applied))
+			}
+			var names []string
+			for _, op := range target.applied[0] {
+				names = append(names, op.Stream.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+				t.Errorf("applied %v, want %v", names, tt.names)
+			}
+			if target.by != "alice" {
+				t.Errorf("applied by %q, want alice", target.by)
+			}
+		})
+	}
+}
+
+func TestImportRetriesWithoutRejectedRows(t *testing.T) {
+	target := &fakeTarget{}
+	rows := rowsOf(
+		models.Stream{Name: "a", URL: "rtsp://a"},
+		models.Stream{Name: "b", URL: "bad:b"},
+		models.Stream{Name: "c", URL: "rtsp://c"},
+	)
+	rows = append(rows, Row{Line: 4, Error: "empty name or URL"})
+
+	report, err := Import(target, rows, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Policy != PolicySkip {
+		t.Errorf("policy = %s, want the skip default", report.Policy)
+	}
+	if report.Created != 2 || report.Failed != 2 {
+		t.Errorf("created %d, failed %d; want 2 and 2", report.Created, report.Failed)
+	}
+	if r := report.Rows[1]; r.Action != ActionError || r.Error != "unreachable" {
+		t.Errorf("rejected row = %+v", r)
+	}
+	if len(target.applied) != 1 || len(target.applied[0]) != 2 {
+		t.Errorf("applied %v, want one batch of a and c", target.applied)
+	}
+}
+
+func TestImportRespectsAllowedGroups(t *testing.T) {
+	target := &fakeTarget{existing: []models.Stream{{Name: "lobby", Group: "HQ"}}}
+	rows := rowsOf(
+		models.Stream{Name: "lobby", URL: "rtsp://lobby", Group: "Branch"},
+		models.Stream{Name: "yard", URL: "rtsp://yard", Group: "HQ"},
+		models.Stream{Name: "gate", URL: "rtsp://gate", Group: "Branch/Gate"},
+	)
+	allowed := func(st models.Stream) bool { return models.InGroup(st.Group, "Branch") }
+
+	report, err := Import(target, rows, Options{Policy: PolicyOverwrite, Allowed: allowed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ActionError, ActionError, ActionCreate}
+	for i, a := range want {
+		if report.Rows[i].Action != a {
+			t.Errorf("row %d = %+v, want %s", i, report.Rows[i], a)
+		}
+	}
+}
+
+func TestImportDryRunAndProgress(t *testing.T) {
+	target := &fakeTarget{}
+	rows := rowsOf(models.Stream{Name: "a", URL: "rtsp://a"}, models.Stream{Name: "b", URL: "rtsp://b"})
+
+	var phases []string
+	progress := func(phase string, row, total int) {
+		phases = append(phases, phase)
+	}
+	report, err := Import(target, rows, Options{DryRun: true, Progress: progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Created != 2 || len(target.applied) != 0 {
+		t.Errorf("dry run report = %+v, applied %v", report, target.applied)
+	}
+	if got := strings.Join(phases, ","); got != "plan,plan,write" {
+		t.Errorf("progress phases = %s", got)
+	}
+}
+
+func TestImportUnknownPolicy(t *testing.T) {
+	if _, err := Import(&fakeTarget{}, nil, Options{Policy: "merge"}); err == nil {
+		t.Error("unknown policy was accepted")
+	}
+}
@@ -0,0 +1,382 @@
+// Package transfer imports and exports stream lists as CSV, JSON or go2rtc YAML.
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"web-tr/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Fields that can be mapped from CSV columns
+var Fields = []string{"name", "url", "backend", "recording", "tags", "group", "profile", "timelapse"}
+
+// headerAliases recognises common column titles when no mapping is given
+var headerAliases = map[string]string{
+	"name":       "name",
+	"stream":     "name",
+	"camera":     "name",
+	"url":        "url",
+	"uri":        "url",
+	"source":     "url",
+	"rtsp":       "url",
+	"backend":    "backend",
+	"engine":     "backend",
+	"recording":  "recording",
+	"record":     "recording",
+	"tags":       "tags",
+	"tag":        "tags",
+	"group":      "group",
+	"folder":     "group",
+	"location":   "group",
+	"profile":    "profile",
+	"profile_id": "profile",
+	"transcode":  "profile",
+	"timelapse":  "timelapse",
+	"time-lapse": "timelapse",
+}
+
+// Row is one stream read from an import file
+type Row struct {
+	Line   int           `json:"line"`
+	Stream models.Stream `json:"stream"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// DetectFormat picks the format from an explicit value or the file name
+func DetectFormat(format, filename string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch format {
+	case FormatCSV, "txt":
+		return FormatCSV, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatYAML, "yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("unsupported format '%s', use csv, json or yaml", format)
+}
+
+// Parse reads streams in the given format. mapping maps field names to CSV
+// column titles or 1-based column numbers and is only used for CSV.
+func Parse(r io.Reader, format string, mapping map[string]string) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r, mapping)
+	case FormatJSON:
+		return parseJSON(r)
+	case FormatYAML:
+		return parseYAML(r)
+	}
+	return nil, fmt.Errorf("unsupported format '%s'", format)
+}
+
+func parseCSV(r io.Reader, mapping map[string]string) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	// Records are read one by one to keep their line numbers; comment lines are skipped
+	var records [][]string
+	var lines []int
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		records = append(records, rec)
+		lines = append(lines, line)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+
+	// Strip a UTF-8 byte order mark left by spreadsheet exports
+	records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+
+	columns, hasHeader, err := resolveColumns(records[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("no column for the stream name")
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, fmt.Errorf("no column for the stream url")
+	}
+
+	start := 0
+	if hasHeader {
+		start = 1
+	}
+	var rows []Row
+	for i := start; i < len(records); i++ {
+		rec := records[i]
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		get := func(field string) string {
+			if col, ok := columns[field]; ok && col < len(rec) {
+				return strings.TrimSpace(rec[col])
+			}
+			return ""
+		}
+
+		row := Row{Line: lines[i]}
+		row.Stream, err = buildStream(get("name"), get("url"), get("backend"), get("recording"), get("tags"), get("group"), get("profile"), get("timelapse"))
+		if err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// resolveColumns finds the column index of each field. Without a mapping the
+// first record is used as a header if it names any known field; otherwise the
+// columns are taken in the order of Fields.
+func resolveColumns(first []string, mapping map[string]string) (map[string]int, bool, error) {
+	titles := map[string]int{}
+	for i, t := range first {
+		titles[strings.ToLower(strings.TrimSpace(t))] = i
+	}
+
+	columns := map[string]int{}
+	if len(mapping) > 0 {
+		usesTitles := false
+		for field, col := range mapping {
+			if !isField(field) {
+				return nil, false, fmt.Errorf("unknown field '%s' in mapping", field)
+			}
+			if col == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(col); err == nil {
+				if n < 1 {
+					return nil, false, fmt.Errorf("column numbers start at 1")
+				}
+				columns[field] = n - 1
+				continue
+			}
+			i, ok := titles[strings.ToLower(strings.TrimSpace(col))]
+			if !ok {
+				return nil, false, fmt.Errorf("column '%s' not found in the header", col)
+			}
+			columns[field] = i
+			usesTitles = true
+		}
+		return columns, usesTitles || looksLikeHeader(titles), nil
+	}
+
+	if looksLikeHeader(titles) {
+		// The first column with a recognised title wins
+		for i, t := range first {
+			if field, ok := headerAliases[strings.ToLower(strings.TrimSpace(t))]; ok {
+				if _, taken := columns[field]; !taken {
+					columns[field] = i
+				}
+			}
+		}
+		return columns, true, nil
+	}
+	for i, f := range Fields {
+		columns[f] = i
+	}
+	return columns, false, nil
+}
+
+func looksLikeHeader(titles map[string]int) bool {
+	for title := range titles {
+		if _, ok := headerAliases[title]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isField(f string) bool {
+	for _, known := range Fields {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
+
+func buildStream(name, url, backend, recording, tags, group, profile, timelapse string) (models.Stream, error) {
+	st := models.Stream{
+		Name:      name,
+		URL:       url,
+		Backend:   strings.ToLower(backend),
+		Group:     models.NormalizeGroup(group),
+		Tags:      ParseTags(tags),
+		ProfileID: profile,
+	}
+	if name == "" || url == "" {
+		return st, fmt.Errorf("empty name or URL")
+	}
+	if strings.ContainsAny(name, "/?#") {
+		return st, fmt.Errorf("name must not contain '/', '?' or '#'")
+	}
+	switch st.Backend {
+	case "", "go2rtc", "mediamtx":
+	default:
+		return st, fmt.Errorf("unknown backend '%s'", backend)
+	}
+	rec, err := parseBool(recording)
+	if err != nil {
+		return st, err
+	}
+	st.Recording = rec
+	if timelapse = strings.TrimSpace(timelapse); timelapse != "" {
+		n, err := strconv.Atoi(timelapse)
+		if err != nil || n < 0 {
+			return st, fmt.Errorf("invalid time-lapse interval '%s'", timelapse)
+		}
+		st.TimelapseInterval = n
+	}
+	return st, nil
+}
+
+// ParseTags splits a tag list on commas, semicolons or pipes and drops duplicates
+func ParseTags(s string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '|' }) {
+		t = strings.TrimSpace(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "false", "no", "n", "off":
+		return false, nil
+	case "1", "true", "yes", "y", "on":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid recording value '%s'", s)
+}
+
+// parseJSON accepts a list of streams as served by /api/streams, or {"streams": [...]}
+func parseJSON(r io.Reader) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	type jsonStream struct {
+		Name      string      `json:"name"`
+		URL       string      `json:"url"`
+		Backend   string      `json:"backend"`
+		Recording interface{} `json:"recording"`
+		Tags      interface{} `json:"tags"`
+		Group     string      `json:"group"`
+		ProfileID string      `json:"profile_id"`
+		Timelapse interface{} `json:"timelapse_interval"`
+	}
+	var list []jsonStream
+	if err := json.Unmarshal(data, &list); err != nil {
+		var wrapped struct {
+			Streams []jsonStream `json:"streams"`
+		}
+		if err2 := json.Unmarshal(data, &wrapped); err2 != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		list = wrapped.Streams
+	}
+
+	rows := make([]Row, 0, len(list))
+	for i, s := range list {
+		row := Row{Line: i + 1}
+		row.Stream, err = buildStream(strings.TrimSpace(s.Name), strings.TrimSpace(s.URL), s.Backend, scalar(s.Recording), tagString(s.Tags), strings.TrimSpace(s.Group), strings.TrimSpace(s.ProfileID), scalar(s.Timelapse))
+		if err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func scalar(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func tagString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for _, p := range t {
+			parts = append(parts, fmt.Sprint(p))
+		}
+		return strings.Join(parts, ",")
+	}
+	return ""
+}
+
+// parseYAML reads the streams section of a go2rtc config. Only the first source
+// of a stream is imported; transcoding sources refer to the stream by name.
+func parseYAML(r io.Reader) ([]Row, error) {
+	var cfg struct {
+		Streams map[string]interface{} `yaml:"streams"`
+	}
+	if err := yaml.NewDecoder(r).Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	names := make([]string, 0, len(cfg.Streams))
+	for name := range cfg.Streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([]Row, 0, len(names))
+	for i, name := range names {
+		url := ""
+		switch v := cfg.Streams[name].(type) {
+		case string:
+			url = v
+		case []interface{}:
+			if len(v) > 0 {
+				url, _ = v[0].(string)
+			}
+		}
+		row := Row{Line: i + 1}
+		var err error
+		row.Stream, err = buildStream(name, strings.TrimSpace(url), "go2rtc", "", "", "", "", "")
+		if err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,257 @@
+package transfer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		format, filename string
+		want             string
+		wantErr          bool
+	}{
+		{"", "cams.csv", FormatCSV, false},
+		{"", "cams.TXT", FormatCSV, false},
+		{"", "streams.json", FormatJSON, false},
+		{"", "go2rtc.yml", FormatYAML, false},
+		{"yaml", "whatever.csv", FormatYAML, false},
+		{"", "cams.xlsx", "", true},
+		{"", "noext", "", true},
+	}
+	for _, tt := range tests {
+		got, err := DetectFormat(tt.format, tt.filename)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("DetectFormat(%q, %q) = %q, %v; want %q, error %v", tt.format, tt.filename, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveColumns(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      []string
+		mapping    map[string]string
+		want       map[string]int
+		wantHeader bool
+		wantErr    string
+	}{
+		{
+			name:       "aliases in header",
+			first:      []string{"Camera", "RTSP", "Location", "Stream"},
+			want:       map[string]int{"name": 0, "url": 1, "group": 2},
+			wantHeader: true,
+		},
+		{
+			name:  "no header uses field order",
+			first: []string{"cam1", "rtsp://cam1/stream"},
+			want: map[string]int{
+				"name": 0, "url": 1, "backend": 2, "recording": 3,
+				"tags": 4, "group": 5, "profile": 6, "timelapse": 7,
+			},
+		},
+		{
+			name:       "mapping by title",
+			first:      []string{"id", "label", "address"},
+			mapping:    map[string]string{"name": "Label", "url": "address"},
+			want:       map[string]int{"name": 1, "url": 2},
+			wantHeader: true,
+		},
+		{
+			name:    "mapping by number skips empty entries",
+			first:   []string{"cam1", "x", "rtsp://cam1"},
+			mapping: map[string]string{"name": "1", "url": "3", "group": ""},
+			want:    map[string]int{"name": 0, "url": 2},
+		},
+		{
+			name:       "numeric mapping keeps a recognised header",
+			first:      []string{"name", "url"},
+			mapping:    map[string]string{"name": "1", "url": "2"},
+			want:       map[string]int{"name": 0, "url": 1},
+			wantHeader: true,
+		},
+		{
+			name:    "unknown field",
+			first:   []string{"a"},
+			mapping: map[string]string{"colour": "1"},
+			wantErr: "unknown field",
+		},
+		{
+			name:    "column zero",
+			first:   []string{"a"},
+			mapping: map[string]string{"name": "0"},
+			wantErr: "start at 1",
+		},
+		{
+			name:    "missing title",
+			first:   []string{"a", "b"},
+			mapping: map[string]string{"url": "address"},
+			wantErr: "not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, header, err := resolveColumns(tt.first, tt.mapping)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || header != tt.wantHeader {
+				t.Errorf("got %v, header %v; want %v, header %v", got, header, tt.want, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	input := "\ufeffname,url,recording,tags,group\n" +
+		"# a comment\n" +
+		"front,rtsp://10.0.0.1/main,yes,\"outdoor;ptz,outdoor\",/HQ//Gate/\n" +
+		"\n" +
+		"back,,no,,\n" +
+		"side,rtsp://10.0.0.3/main,maybe,,\n"
+
+	rows, err := Parse(strings.NewReader(input), FormatCSV, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3: %+v", len(rows), rows)
+	}
+
+	front := rows[0]
+	if front.Error != "" || front.Line != 3 {
+		t.Fatalf("front = %+v", front)
+	}
+	st := front.Stream
+	if st.Name != "front" || st.URL != "rtsp://10.0.0.1/main" || !st.Recording || st.Group != "HQ/Gate" {
+		t.Errorf("front stream = %+v", st)
+	}
+	if !reflect.DeepEqual(st.Tags, []string{"outdoor", "ptz"}) {
+		t.Errorf("front tags = %v", st.Tags)
+	}
+
+	if rows[1].Error == "" || rows[1].Line != 5 {
+		t.Errorf("row without url = %+v, want an error on line 5", rows[1])
+	}
+	if !strings.Contains(rows[2].Error, "recording") {
+		t.Errorf("row with bad recording value = %+v", rows[2])
+	}
+}
+
+func TestParseCSVRequiresNameAndURL(t *testing.T) {
+	_, err := Parse(strings.NewReader("name,group\ncam,HQ\n"), FormatCSV, nil)
+	if err == nil || !strings.Contains(err.Error(), "url") {
+		t.Errorf("error = %v, want a missing url column", err)
+	}
+	if _, err := Parse(strings.NewReader(""), FormatCSV, nil); err == nil {
+		t.Error("empty file was accepted")
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"list", `[{"name":"cam","url":"rtsp://cam","recording":true,"tags":["a","b"],"timelapse_interval":30}]`},
+		{"wrapped", `{"streams":[{"name":"cam","url":"rtsp://cam","recording":"yes","tags":"a,b","timelapse_interval":"30"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Parse(strings.NewReader(tt.input), FormatJSON, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || rows[0].Error != "" {
+				t.Fatalf("rows = %+v", rows)
+			}
+			st := rows[0].Stream
+			if !st.Recording || st.TimelapseInterval != 30 || !reflect.DeepEqual(st.Tags, []string{"a", "b"}) {
+				t.Errorf("stream = %+v", st)
+			}
+		})
+	}
+
+	if _, err := Parse(strings.NewReader(`{"streams":`), FormatJSON, nil); err == nil {
+		t.Error("truncated JSON was accepted")
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	input := `
+streams:
+  yard: rtsp://yard/main
+  door:
+    - rtsp://door/main
+    - ffmpeg:door#video=h264
+  bad/name: rtsp://x
+`
+	rows, err := Parse(strings.NewReader(input), FormatYAML, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	// Sorted by name
+	if rows[0].Error == "" {
+		t.Errorf("bad/name = %+v, want an error", rows[0])
+	}
+	if st := rows[1].Stream; st.Name != "door" || st.URL != "rtsp://door/main" || st.Backend != "go2rtc" {
+		t.Errorf("door = %+v", st)
+	}
+	if st := rows[2].Stream; st.Name != "yard" || st.URL != "rtsp://yard/main" {
+		t.Errorf("yard = %+v", st)
+	}
+}
+
+func TestBuildStream(t *testing.T) {
+	tests := []struct {
+		name, url, backend, recording, timelapse string
+		wantErr                                  string
+	}{
+		{"cam", "rtsp://cam", "MediaMTX", "on", "60", ""},
+		{"", "rtsp://cam", "", "", "", "empty name"},
+		{"a/b", "rtsp://cam", "", "", "", "must not contain"},
+		{"cam", "rtsp://cam", "vlc", "", "", "unknown backend"},
+		{"cam", "rtsp://cam", "", "sometimes", "", "invalid recording"},
+		{"cam", "rtsp://cam", "", "", "-5", "time-lapse"},
+		{"cam", "rtsp://cam", "", "", "often", "time-lapse"},
+	}
+	for _, tt := range tests {
+		_, err := buildStream(tt.name, tt.url, tt.backend, tt.recording, "", "", "", tt.timelapse)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("buildStream(%q, %q, %q): %v", tt.name, tt.backend, tt.timelapse, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("buildStream(%q, %q, %q) error = %v, want %q", tt.name, tt.backend, tt.timelapse, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{" a , b;c|a ", []string{"a", "b", "c"}},
+		{";;,", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseTags(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTags(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileStore keeps sealed credentials in a local JSON file for File/YAML mode
+type FileStore struct {
+	FilePath string
+	mu       sync.Mutex
+}
+
+func NewFileStore(filePath string) *FileStore {
+	return &FileStore{FilePath: filePath}
+}
+
+func (fs *FileStore) load() (map[string]string, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	creds := map[string]string{}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (fs *FileStore) save(creds map[string]string) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetCredentials() (map[string]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.load()
+}
+
+func (fs *FileStore) SaveCredential(stream, sealed string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	creds, err := fs.load()
+	if err != nil {
+		return err
+	}
+	creds[stream] = sealed
+	return fs.save(creds)
+}
+
+func (fs *FileStore) RemoveCredential(stream string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	creds, err := fs.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := creds[stream]; !ok {
+		return nil
+	}
+	delete(creds, stream)
+	return fs.save(creds)
+}
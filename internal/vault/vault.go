@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Store persists sealed credentials by stream name. It is implemented by
+// db.Store in DB mode and FileStore otherwise.
+type Store interface {
+	GetCredentials() (map[string]string, error)
+	SaveCredential(stream, sealed string) error
+	RemoveCredential(stream string) error
+}
+
+// Vault keeps camera credentials out of the stream list, encrypted with AES-GCM under the server key
+type Vault struct {
+	Store Store
+	aead  cipher.AEAD
+}
+
+func New(store Store, key []byte) (*Vault, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{Store: store, aead: aead}, nil
+}
+
+func (v *Vault) seal(stream string, c Credential) (string, error) {
+	plain, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// The stream name is bound as additional data so sealed values can't be swapped between streams
+	sealed := v.aead.Seal(nonce, nonce, plain, []byte(stream))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (v *Vault) open(stream, sealed string) (Credential, error) {
+	var c Credential
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return c, err
+	}
+	if len(data) < v.aead.NonceSize() {
+		return c, fmt.Errorf("sealed credential too short")
+	}
+	nonce, ciphertext := data[:v.aead.NonceSize()], data[v.aead.NonceSize():]
+	plain, err := v.aead.Open(nil, nonce, ciphertext, []byte(stream))
+	if err != nil {
+		return c, fmt.Errorf("cannot decrypt credentials for %s (was the secret key changed?)", stream)
+	}
+	err = json.Unmarshal(plain, &c)
+	return c, err
+}
+
+// All returns the credentials of every stream that has them
+func (v *Vault) All() (map[string]Credential, error) {
+	sealed, err := v.Store.GetCredentials()
+	if err != nil {
+		return nil, err
+	}
+	creds := make(map[string]Credential, len(sealed))
+	for stream, s := range sealed {
+		c, err := v.open(stream, s)
+		if err != nil {
+			return nil, err
+		}
+		creds[stream] = c
+	}
+	return creds, nil
+}
+
+// Get returns nil if the stream has no credentials
+func (v *Vault) Get(stream string) (*Credential, error) {
+	creds, err := v.All()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := creds[stream]; ok {
+		return &c, nil
+	}
+	return nil, nil
+}
+
+// Set stores the credentials of a stream; nil removes them
+func (v *Vault) Set(stream string, c *Credential) error {
+	if c == nil {
+		return v.Store.RemoveCredential(stream)
+	}
+	sealed, err := v.seal(stream, *c)
+	if err != nil {
+		return err
+	}
+	return v.Store.SaveCredential(stream, sealed)
+}
+
+func (v *Vault) Remove(stream string) error {
+	return v.Store.RemoveCredential(stream)
+}
+
+// Seal encrypts the credentials of a stream for a store that writes them
+// itself, such as a batch in a DB transaction. nil seals to "".
+func (v *Vault) Seal(stream string, c *Credential) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	return v.seal(stream, *c)
+}
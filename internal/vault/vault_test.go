@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func newVault(t *testing.T) *Vault {
+	t.Helper()
+	v, err := New(NewFileStore(filepath.Join(t.TempDir(), "credentials.json")), bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	v := newVault(t)
+	if err := v.Set("yard", &Credential{"admin", "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("door", &Credential{"viewer", ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := v.Get("yard")
+	if err != nil || got == nil || *got != (Credential{"admin", "secret"}) {
+		t.Fatalf("Get(yard) = %+v, %v", got, err)
+	}
+	if got, err := v.Get("gate"); got != nil || err != nil {
+		t.Errorf("Get(gate) = %+v, %v; want nothing", got, err)
+	}
+
+	// Setting nil removes the credential
+	if err := v.Set("door", nil); err != nil {
+		t.Fatal(err)
+	}
+	all, err := v.All()
+	if err != nil || len(all) != 1 || all["yard"].Password != "secret" {
+		t.Errorf("All() = %+v, %v", all, err)
+	}
+}
+
+func TestSealedValuesAreBoundToTheStream(t *testing.T) {
+	v := newVault(t)
+	sealed, err := v.Seal("yard", &Credential{"admin", "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Store.SaveCredential("door", sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Get("door"); err == nil {
+		t.Error("a credential sealed for yard opened under door")
+	}
+
+	other, err := New(v.Store, bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Store.SaveCredential("yard", sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Get("yard"); err == nil {
+		t.Error("a credential opened under another key")
+	}
+}
@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"web-tr/internal/models"
+)
+
+// FileStore keeps webhooks and their delivery log in local JSON files for File/YAML mode
+type FileStore struct {
+	FilePath string
+	LogPath  string
+	mu       sync.Mutex
+}
+
+func NewFileStore(filePath, logPath string) *FileStore {
+	return &FileStore{FilePath: filePath, LogPath: logPath}
+}
+
+func (fs *FileStore) load() ([]models.Webhook, error) {
+	data, err := os.ReadFile(fs.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []models.Webhook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (fs *FileStore) save(hooks []models.Webhook) error {
+	data, err := json.MarshalIndent(hooks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.FilePath, data, 0600)
+}
+
+func (fs *FileStore) GetWebhooks() ([]models.Webhook, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.load()
+}
+
+func (fs *FileStore) GetWebhook(id string) (*models.Webhook, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	hooks, err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range hooks {
+		if w.ID == id {
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *FileStore) AddWebhook(w models.Webhook) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	hooks, err := fs.load()
+	if err != nil {
+		return err
+	}
+	return fs.save(append(hooks, w))
+}
+
+func (fs *FileStore) UpdateWebhook(w models.Webhook) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	hooks, err := fs.load()
+	if err != nil {
+		return err
+	}
+	for i := range hooks {
+		if hooks[i].ID == w.ID {
+			hooks[i].URL = w.URL
+			hooks[i].Events = w.Events
+			hooks[i].Enabled = w.Enabled
+		}
+	}
+	return fs.save(hooks)
+}
+
+func (fs *FileStore) RemoveWebhook(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	hooks, err := fs.load()
+	if err != nil {
+		return err
+	}
+	kept := hooks[:0]
+	for _, w := range hooks {
+		if w.ID != id {
+			kept = append(kept, w)
+		}
+	}
+	return fs.save(kept)
+}
+
+// loadLog returns the logged deliveries, oldest first
+func (fs *FileStore) loadLog() ([]models.WebhookDelivery, error) {
+	data, err := os.ReadFile(fs.LogPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var log []models.WebhookDelivery
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+func (fs *FileStore) SaveDelivery(d models.WebhookDelivery, keep int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	log, err := fs.loadLog()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := len(log) - 1; i >= 0 && !found; i-- {
+		if log[i].ID == d.ID {
+			log[i] = d
+			found = true
+		}
+	}
+	if !found {
+		log = append(log, d)
+	}
+	if len(log) > keep {
+		log = log[len(log)-keep:]
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.LogPath, data, 0600)
+}
+
+func (fs *FileStore) GetDeliveries(webhookID string) ([]models.WebhookDelivery, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	log, err := fs.loadLog()
+	if err != nil {
+		return nil, err
+	}
+	var out []models.WebhookDelivery
+	for i := len(log) - 1; i >= 0; i-- {
+		if webhookID == "" || log[i].WebhookID == webhookID {
+			out = append(out, log[i])
+		}
+	}
+	return out, nil
+}
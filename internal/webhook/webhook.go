@@ -0,0 +1,427 @@
+// Package webhook notifies external HTTP endpoints about stream and engine
+// events. Deliveries are signed with a per-webhook secret and retried with
+// exponential backoff; recent deliveries are logged in the store for inspection.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/metrics"
+	"web-tr/internal/models"
+)
+
+// Events a webhook can subscribe to
+const (
+	EventStreamAdded   = "stream.added"
+	EventStreamUpdated = "stream.updated"
+	EventStreamDeleted = "stream.deleted"
+	EventStreamOffline = "stream.offline"
+	EventStreamOnline  = "stream.online"
+	EventEngineRestart = "engine.restart"
+	EventMotionStart   = "motion.start"
+	EventMotionEnd     = "motion.end"
+	// EventPing is only sent by Test
+	EventPing = "ping"
+)
+
+var Events = []string{
+	EventStreamAdded,
+	EventStreamUpdated,
+	EventStreamDeleted,
+	EventStreamOffline,
+	EventStreamOnline,
+	EventEngineRestart,
+	EventMotionStart,
+	EventMotionEnd,
+}
+
+const deliveryLogLimit = 200
+
+var ErrNotFound = errors.New("webhook not found")
+
+var deliveries = metrics.NewCounterVec("webtr_webhook_deliveries_total",
+	"Webhook deliveries by final result.", "result")
+
+// Store is implemented by db.Store in DB mode and FileStore otherwise
+type Store interface {
+	GetWebhooks() ([]models.Webhook, error)
+	GetWebhook(id string) (*models.Webhook, error)
+	AddWebhook(w models.Webhook) error
+	UpdateWebhook(w models.Webhook) error
+	RemoveWebhook(id string) error
+	// SaveDelivery adds or replaces a logged delivery, keeping the newest keep of them
+	SaveDelivery(d models.WebhookDelivery, keep int) error
+	// GetDeliveries returns the logged deliveries of one webhook, or of all if id is empty, newest first
+	GetDeliveries(webhookID string) ([]models.WebhookDelivery, error)
+}
+
+// Service manages webhooks and delivers events to them
+type Service struct {
+	Store       Store
+	Client      *http.Client
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles after every attempt
+	Backoff time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewService(store Store) *Service {
+	return &Service{
+		Store: store,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			// A redirect is reported as a failed delivery rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+		stop:        make(chan struct{}),
+	}
+}
+
+func newID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validate(rawURL string, evs []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	for _, e := range evs {
+		known := false
+		for _, k := range Events {
+			known = known || e == k
+		}
+		if !known {
+			return fmt.Errorf("unknown event '%s'", e)
+		}
+	}
+	return nil
+}
+
+// Create adds a webhook with a new secret, which is returned only here
+func (s *Service) Create(rawURL string, evs []string, createdBy string) (*models.Webhook, error) {
+	if err := validate(rawURL, evs); err != nil {
+		return nil, err
+	}
+	id, err := newID(8)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newID(32)
+	if err != nil {
+		return nil, err
+	}
+
+	w := models.Webhook{
+		ID:        id,
+		URL:       rawURL,
+		Secret:    secret,
+		Events:    evs,
+		Enabled:   true,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.Store.AddWebhook(w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// List returns all webhooks without their secrets
+func (s *Service) List() ([]models.Webhook, error) {
+	hooks, err := s.Store.GetWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	if hooks == nil {
+		hooks = []models.Webhook{}
+	}
+	return hooks, nil
+}
+
+// Update replaces a webhook's URL and events; a nil enabled keeps the stored state
+func (s *Service) Update(id, rawURL string, evs []string, enabled *bool) error {
+	w, err := s.Store.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		return ErrNotFound
+	}
+	if err := validate(rawURL, evs); err != nil {
+		return err
+	}
+	w.URL, w.Events = rawURL, evs
+	if enabled != nil {
+		w.Enabled = *enabled
+	}
+	return s.Store.UpdateWebhook(*w)
+}
+
+func (s *Service) Remove(id string) error {
+	return s.Store.RemoveWebhook(id)
+}
+
+// Deliveries returns the logged deliveries of one webhook, or of all if id is empty, newest first
+func (s *Service) Deliveries(id string) ([]models.WebhookDelivery, error) {
+	out, err := s.Store.GetDeliveries(id)
+	if out == nil {
+		out = []models.WebhookDelivery{}
+	}
+	return out, err
+}
+
+// Start delivers every event from the hub until Stop is called. Deliveries
+// left pending by a previous run are marked as failed first.
+func (s *Service) Start(hub *events.Hub) {
+	s.failInterrupted()
+	ch := hub.Queue()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer hub.Unsubscribe(ch)
+		for {
+			select {
+			case <-s.stop:
+				return
+			case ev := <-ch:
+				for _, ev := range events.Expand(ev) {
+					if typ, ok := translate(ev); ok {
+						s.Dispatch(typ, ev.Data)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends the event loop and abandons pending retries
+func (s *Service) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// translate maps a hub event to the webhook event it triggers, if any
+func translate(ev events.Event) (string, bool) {
+	switch ev.Type {
+	case events.StreamAdded, events.StreamUpdated, events.StreamDeleted, events.EngineRestart,
+		events.MotionStarted, events.MotionEnded:
+		return ev.Type, true
+	case events.HealthChanged:
+		c, ok := ev.Data.(models.HealthChange)
+		if !ok {
+			return "", false
+		}
+		switch c.Status {
+		case models.HealthOffline:
+			return EventStreamOffline, true
+		case models.HealthOnline:
+			return EventStreamOnline, true
+		}
+	}
+	return "", false
+}
+
+func subscribed(w models.Webhook, event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch sends an event to every enabled webhook subscribed to it
+func (s *Service) Dispatch(event string, data interface{}) {
+	hooks, err := s.Store.GetWebhooks()
+	if err != nil {
+		log.Printf("[Webhook] Failed to load webhooks: %v", err)
+		return
+	}
+	for _, w := range hooks {
+		if w.Enabled && subscribed(w, event) {
+			if _, err := s.send(w, event, data); err != nil {
+				log.Printf("[Webhook] Failed to queue %s for %s: %v", event, w.ID, err)
+			}
+		}
+	}
+}
+
+// Test sends a ping to one webhook, whether or not it is enabled
+func (s *Service) Test(id string) (*models.WebhookDelivery, error) {
+	w, err := s.Store.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, ErrNotFound
+	}
+	return s.send(*w, EventPing, map[string]string{"webhook": w.ID})
+}
+
+// send logs a delivery and runs it in the background
+func (s *Service) send(w models.Webhook, event string, data interface{}) (*models.WebhookDelivery, error) {
+	id, err := newID(8)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    id,
+		"event": event,
+		"time":  now,
+		"data":  data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := models.WebhookDelivery{
+		ID:        id,
+		WebhookID: w.ID,
+		Event:     event,
+		Status:    models.DeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.Store.SaveDelivery(d, deliveryLogLimit); err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.deliver(w, d, body)
+	}()
+	return &d, nil
+}
+
+func (s *Service) deliver(w models.Webhook, d models.WebhookDelivery, body []byte) {
+	wait := s.Backoff
+	for attempt := 1; ; attempt++ {
+		code, err := s.post(w, d, body)
+		retry := err != nil || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+		if err == nil && (code < 200 || code > 299) {
+			err = fmt.Errorf("endpoint returned status %d", code)
+		}
+
+		status := models.DeliveryPending
+		switch {
+		case err == nil:
+			status = models.DeliveryDelivered
+		case !retry || attempt >= s.MaxAttempts:
+			status = models.DeliveryFailed
+		}
+		d.Attempts = attempt
+		d.StatusCode = code
+		d.Status = status
+		d.Error = ""
+		if err != nil {
+			d.Error = err.Error()
+		}
+		s.save(d)
+
+		if status != models.DeliveryPending {
+			if status == models.DeliveryFailed {
+				log.Printf("[Webhook] Delivery of %s to %s failed after %d attempt(s): %v", d.Event, w.URL, attempt, err)
+			}
+			deliveries.With(status).Inc()
+			return
+		}
+
+		select {
+		case <-s.stop:
+			d.Status = models.DeliveryFailed
+			d.Error = "server shut down before the delivery succeeded: " + d.Error
+			s.save(d)
+			deliveries.With(models.DeliveryFailed).Inc()
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post makes one attempt. The signature covers "<timestamp>.<body>" so receivers
+// can reject replayed requests.
+func (s *Service) post(w models.Webhook, d models.WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "web-tr-webhook/1")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", d.ID)
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(w.Secret, ts, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Sign computes the hex HMAC-SHA256 a receiver should compare against X-Webhook-Signature
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// save logs the new state of a delivery
+func (s *Service) save(d models.WebhookDelivery) {
+	d.UpdatedAt = time.Now().UTC()
+	if err := s.Store.SaveDelivery(d, deliveryLogLimit); err != nil {
+		log.Printf("[Webhook] Failed to log delivery %s: %v", d.ID, err)
+	}
+}
+
+// failInterrupted marks deliveries still pending from a previous run as failed
+func (s *Service) failInterrupted() {
+	logged, err := s.Store.GetDeliveries("")
+	if err != nil {
+		log.Printf("[Webhook] Failed to load the delivery log: %v", err)
+		return
+	}
+	for _, d := range logged {
+		if d.Status == models.DeliveryPending {
+			d.Status = models.DeliveryFailed
+			d.Error = "server stopped before the delivery succeeded: " + d.Error
+			s.save(d)
+		}
+	}
+}
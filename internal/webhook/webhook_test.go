@@ -0,0 +1,299 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"web-tr/internal/events"
+	"web-tr/internal/models"
+)
+
+func newFileStore(t *testing.T) *FileStore {
+	dir := t.TempDir()
+	return NewFileStore(filepath.Join(dir, "webhooks.json"), filepath.Join(dir, "webhook-deliveries.json"))
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	s := NewService(newFileStore(t))
+	s.Backoff = time.Millisecond
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func TestSign(t *testing.T) {
+	got := Sign("topsecret", "1700000000", []byte(`{"event":"ping"}`))
+	want := "49dbf5542544194f41a09374d23028d79a5a64b07761bf746c46154c7c5f264a"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("topsecret", "1700000001", []byte(`{"event":"ping"}`)) == want {
+		t.Error("the signature does not cover the timestamp")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		url  string
+		evs  []string
+		good bool
+	}{
+		{"https://example.com/hook", nil, true},
+		{"http://10.0.0.5:8080/hook", []string{EventStreamOffline, EventMotionStart}, true},
+		{"ftp://example.com/hook", nil, false},
+		{"https:///hook", nil, false},
+		{"not a url", nil, false},
+		{"https://example.com/hook", []string{"stream.exploded"}, false},
+		{"https://example.com/hook", []string{EventPing}, false},
+	}
+	for _, tt := range tests {
+		if err := validate(tt.url, tt.evs); (err == nil) != tt.good {
+			t.Errorf("validate(%q, %v) = %v", tt.url, tt.evs, err)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		ev   events.Event
+		want string
+		ok   bool
+	}{
+		{events.Event{Type: events.StreamAdded}, EventStreamAdded, true},
+		{events.Event{Type: events.MotionStarted}, EventMotionStart, true},
+		{events.Event{Type: events.HealthChanged, Data: models.HealthChange{Status: models.HealthOffline}}, EventStreamOffline, true},
+		{events.Event{Type: events.HealthChanged, Data: models.HealthChange{Status: models.HealthOnline}}, EventStreamOnline, true},
+		{events.Event{Type: events.HealthChanged, Data: models.HealthChange{Status: models.HealthUnknown}}, "", false},
+		{events.Event{Type: events.HealthChanged, Data: "bogus"}, "", false},
+		{events.Event{Type: events.ImportDone}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := translate(tt.ev)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("translate(%s) = %q, %v; want %q, %v", tt.ev.Type, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	all := models.Webhook{}
+	some := models.Webhook{Events: []string{EventStreamOffline}}
+	if !subscribed(all, EventMotionEnd) || !subscribed(some, EventStreamOffline) || subscribed(some, EventStreamOnline) {
+		t.Error("subscription filter is wrong")
+	}
+}
+
+func TestUpdateKeepsEnabled(t *testing.T) {
+	s := newTestService(t)
+	w, err := s.Create("https://example.com/hook", nil, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled := false
+	if err := s.Update(w.ID, w.URL, nil, &disabled); err != nil {
+		t.Fatal(err)
+	}
+	// An edit that doesn't mention enabled leaves it alone
+	if err := s.Update(w.ID, "https://example.com/other", []string{EventStreamOffline}, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Store.GetWebhook(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Enabled || got.URL != "https://example.com/other" || len(got.Events) != 1 {
+		t.Errorf("webhook = %+v", got)
+	}
+
+	if err := s.Update("missing", w.URL, nil, nil); err != ErrNotFound {
+		t.Errorf("missing webhook: %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeliveryRetriesAndSigns(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	badSignature := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		secret := r.URL.Query().Get("secret")
+		if r.Header.Get("X-Webhook-Signature") != "sha256="+Sign(secret, r.Header.Get("X-Webhook-Timestamp"), body) {
+			badSignature = true
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := newTestService(t)
+	w, err := s.Create(srv.URL, nil, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The test server reads the secret from the URL to check the signature
+	w.URL = srv.URL + "?secret=" + w.Secret
+	if err := s.Store.UpdateWebhook(*w); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := s.Test(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	var got models.WebhookDelivery
+	for time.Now().Before(deadline) {
+		logged, err := s.Deliveries(w.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = logged[0]
+		if got.Status != models.DeliveryPending {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got.ID != d.ID || got.Status != models.DeliveryDelivered || got.Attempts != 3 || got.StatusCode != http.StatusNoContent {
+		t.Errorf("delivery = %+v", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if badSignature {
+		t.Error("a delivery had a wrong signature")
+	}
+}
+
+func TestDeliveryGivesUpOnClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	s := newTestService(t)
+	w, err := s.Create(srv.URL, nil, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Test(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.wg.Wait()
+	logged, err := s.Deliveries(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := logged[0]; got.Status != models.DeliveryFailed || got.Attempts != 1 {
+		t.Errorf("delivery = %+v, want one failed attempt", got)
+	}
+}
+
+func TestDeliveryLogIsStored(t *testing.T) {
+	store := newFileStore(t)
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		d := models.WebhookDelivery{ID: string(rune('a' + i)), WebhookID: "w1", Status: models.DeliveryPending, CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+		if i%2 == 1 {
+			d.WebhookID = "w2"
+		}
+		if err := store.SaveDelivery(d, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Saving a known delivery replaces it instead of adding one
+	if err := store.SaveDelivery(models.WebhookDelivery{ID: "e", WebhookID: "w1", Status: models.DeliveryDelivered, Attempts: 2}, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		webhook string
+		want    string
+	}{
+		{"", "edc"},
+		{"w1", "ec"},
+		{"w2", "d"},
+		{"w3", ""},
+	}
+	for _, tt := range tests {
+		logged, err := store.GetDeliveries(tt.webhook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		for _, d := range logged {
+			got += d.ID
+		}
+		if got != tt.want {
+			t.Errorf("GetDeliveries(%q) = %s, want %s", tt.webhook, got, tt.want)
+		}
+	}
+
+	// A new service on the same store sees the log, with deliveries cut off by a restart failed
+	s := NewService(store)
+	hub := events.NewHub()
+	s.Start(hub)
+	defer s.Stop()
+	logged, err := s.Deliveries("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range logged {
+		want := models.DeliveryFailed
+		if d.ID == "e" {
+			want = models.DeliveryDelivered
+		}
+		if d.Status != want {
+			t.Errorf("delivery %s = %s, want %s", d.ID, d.Status, want)
+		}
+	}
+}
+
+func TestStartDeliversEveryEvent(t *testing.T) {
+	var mu sync.Mutex
+	received := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := newTestService(t)
+	if _, err := s.Create(srv.URL, []string{EventStreamAdded}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	hub := events.NewHub()
+	s.Start(hub)
+
+	// A batch larger than any subscriber buffer, plus events the webhook ignores
+	const n = 150
+	batch := events.Batch{}
+	for i := 0; i < n; i++ {
+		batch.Changes = append(batch.Changes, events.Change{Type: events.StreamAdded, Data: map[string]interface{}{"name": i}})
+		hub.Publish(events.ImportProgress, i)
+	}
+	hub.Publish(events.StreamsChanged, batch)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := received == n
+		mu.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	t.Errorf("received %d deliveries, want %d", received, n)
+}